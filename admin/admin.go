@@ -0,0 +1,370 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/metrics"
+	"github.com/cloud-gov/aws-broker/services/elasticsearch"
+	"github.com/cloud-gov/aws-broker/services/rds"
+	"github.com/cloud-gov/aws-broker/services/redis"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+// JobClient is the subset of the job queue client used by the admin API.
+type JobClient interface {
+	ListJobs(ctx context.Context, params queue.ListParams) ([]*rivertype.JobRow, error)
+	JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error)
+	JobRetry(ctx context.Context, id int64) (*rivertype.JobRow, error)
+	JobCancel(ctx context.Context, id int64) (*rivertype.JobRow, error)
+}
+
+// Credentials are the basic auth credentials required by the admin API. They
+// are separate from the credentials used by the platform to call the broker.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Fields of the service instance records which hold secrets, even if encrypted,
+// and are never returned by the admin API.
+var redactedFields = []string{
+	"Password",
+	"Salt",
+	"ClearPassword",
+	"AccessKey",
+	"SecretKey",
+}
+
+// Jobs in these states have failed and can be retried.
+var retryableJobStates = []rivertype.JobState{
+	rivertype.JobStateCancelled,
+	rivertype.JobStateDiscarded,
+}
+
+type api struct {
+	db        *gorm.DB
+	catalog   *catalog.Catalog
+	jobClient JobClient
+	logger    *slog.Logger
+}
+
+type instanceResponse struct {
+	Instance base.Instance  `json:"instance"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+type jobResponse struct {
+	ID          int64              `json:"id"`
+	Kind        string             `json:"kind"`
+	Queue       string             `json:"queue"`
+	State       rivertype.JobState `json:"state"`
+	Attempt     int                `json:"attempt"`
+	MaxAttempts int                `json:"max_attempts"`
+	OperationID string             `json:"operation_id,omitempty"`
+	Errors      []jobErrorResponse `json:"errors,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	ScheduledAt time.Time          `json:"scheduled_at"`
+	AttemptedAt *time.Time         `json:"attempted_at,omitempty"`
+	FinalizedAt *time.Time         `json:"finalized_at,omitempty"`
+}
+
+type jobErrorResponse struct {
+	At      time.Time `json:"at"`
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+}
+
+// New returns the handler for the admin API, which lets operators inspect the
+// instances known to the broker and the snapshots kept of their databases, and
+// manage the River jobs run for them. It also serves the Prometheus metrics of
+// the broker, so that they are not exposed on the route used by the platform.
+func New(db *gorm.DB, catalog *catalog.Catalog, jobClient JobClient, logger *slog.Logger, credentials Credentials) http.Handler {
+	a := &api{
+		db:        db,
+		catalog:   catalog,
+		jobClient: jobClient,
+		logger:    logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /instances", a.listInstances)
+	mux.HandleFunc("GET /instances/{instance_id}", a.getInstance)
+	mux.HandleFunc("GET /instances/{instance_id}/operations", a.listOperations)
+	mux.HandleFunc("GET /instances/{instance_id}/jobs", a.listJobs)
+	mux.HandleFunc("POST /jobs/{job_id}/retry", a.retryJob)
+	mux.HandleFunc("POST /jobs/{job_id}/cancel", a.cancelJob)
+	mux.HandleFunc("GET /rds/snapshots", a.listRDSSnapshots)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	return basicAuth(mux, credentials)
+}
+
+func basicAuth(next http.Handler, credentials Credentials) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(credentials.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(credentials.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("not authorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) listInstances(w http.ResponseWriter, r *http.Request) {
+	query := a.db.Order("created_at")
+	if serviceID := r.URL.Query().Get("service_id"); serviceID != "" {
+		query = query.Where("service_id = ?", serviceID)
+	}
+
+	instances := []base.Instance{}
+	if err := query.Find(&instances).Error; err != nil {
+		a.writeInternalError(w, "list instances", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, instances)
+}
+
+func (a *api) getInstance(w http.ResponseWriter, r *http.Request) {
+	instance, ok := a.findInstance(w, r)
+	if !ok {
+		return
+	}
+
+	details, err := a.findInstanceDetails(instance)
+	if err != nil {
+		a.writeInternalError(w, "find instance details", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, instanceResponse{
+		Instance: instance,
+		Details:  details,
+	})
+}
+
+func (a *api) listOperations(w http.ResponseWriter, r *http.Request) {
+	instance, ok := a.findInstance(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := asyncmessage.GetOperationLog(a.db, instance.ServiceID, instance.Uuid)
+	if err != nil {
+		a.writeInternalError(w, "list operations", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (a *api) listJobs(w http.ResponseWriter, r *http.Request) {
+	instanceID := r.PathValue("instance_id")
+
+	// Jobs outlive the instance records they were run for, so they can be
+	// listed for deleted instances too.
+	result, err := a.jobClient.ListJobs(r.Context(), queue.ListParams{
+		InstanceID: instanceID,
+		Limit:      100,
+	})
+	if err != nil {
+		a.writeInternalError(w, "list jobs", err)
+		return
+	}
+
+	jobs := []jobResponse{}
+	for _, job := range result {
+		jobs = append(jobs, newJobResponse(job))
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (a *api) retryJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.findJob(w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(retryableJobStates, job.State) {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %d is %s and cannot be retried", job.ID, job.State))
+		return
+	}
+
+	job, err := a.jobClient.JobRetry(r.Context(), job.ID)
+	if err != nil {
+		a.writeInternalError(w, "retry job", err)
+		return
+	}
+	a.logger.Info("admin: retried job", "job_id", job.ID, "kind", job.Kind)
+	writeJSON(w, http.StatusOK, newJobResponse(job))
+}
+
+func (a *api) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.findJob(w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(queue.UnfinishedJobStates, job.State) {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %d is %s and cannot be cancelled", job.ID, job.State))
+		return
+	}
+
+	job, err := a.jobClient.JobCancel(r.Context(), job.ID)
+	if err != nil {
+		a.writeInternalError(w, "cancel job", err)
+		return
+	}
+	a.logger.Info("admin: cancelled job", "job_id", job.ID, "kind", job.Kind)
+	writeJSON(w, http.StatusOK, newJobResponse(job))
+}
+
+// listRDSSnapshots lists the recorded snapshots of RDS databases, which
+// include the final snapshots of deleted instances.
+func (a *api) listRDSSnapshots(w http.ResponseWriter, r *http.Request) {
+	query := a.db.Order("created_at")
+	if instanceID := r.URL.Query().Get("instance_id"); instanceID != "" {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	if spaceGUID := r.URL.Query().Get("space_guid"); spaceGUID != "" {
+		query = query.Where("space_guid = ?", spaceGUID)
+	}
+
+	snapshots := []rds.RDSSnapshot{}
+	if err := query.Find(&snapshots).Error; err != nil {
+		a.writeInternalError(w, "list RDS snapshots", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshots)
+}
+
+func (a *api) findInstance(w http.ResponseWriter, r *http.Request) (base.Instance, bool) {
+	instance := base.Instance{}
+	result := a.db.Where("uuid = ?", r.PathValue("instance_id")).Limit(1).Find(&instance)
+	if result.Error != nil {
+		a.writeInternalError(w, "find instance", result.Error)
+		return instance, false
+	}
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, errors.New("instance not found"))
+		return instance, false
+	}
+	return instance, true
+}
+
+// findInstanceDetails returns the service specific record for an instance,
+// without the fields holding secrets.
+func (a *api) findInstanceDetails(instance base.Instance) (map[string]any, error) {
+	var record any
+	switch instance.ServiceID {
+	case a.catalog.RdsService.ID:
+		record = rds.NewRDSInstance()
+	case a.catalog.RedisService.ID:
+		record = &redis.RedisInstance{}
+	case a.catalog.ElasticsearchService.ID:
+		record = &elasticsearch.ElasticsearchInstance{}
+	default:
+		return nil, nil
+	}
+
+	result := a.db.Where("uuid = ?", instance.Uuid).Limit(1).Find(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	serialized, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{}
+	if err := json.Unmarshal(serialized, &details); err != nil {
+		return nil, err
+	}
+	for _, field := range redactedFields {
+		delete(details, field)
+	}
+	return details, nil
+}
+
+func (a *api) findJob(w http.ResponseWriter, r *http.Request) (*rivertype.JobRow, bool) {
+	jobID, err := strconv.ParseInt(r.PathValue("job_id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job ID: %s", r.PathValue("job_id")))
+		return nil, false
+	}
+
+	job, err := a.jobClient.JobGet(r.Context(), jobID)
+	if errors.Is(err, rivertype.ErrNotFound) {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return nil, false
+	}
+	if err != nil {
+		a.writeInternalError(w, "get job", err)
+		return nil, false
+	}
+	return job, true
+}
+
+func newJobResponse(job *rivertype.JobRow) jobResponse {
+	response := jobResponse{
+		ID:          job.ID,
+		Kind:        job.Kind,
+		Queue:       job.Queue,
+		State:       job.State,
+		Attempt:     job.Attempt,
+		MaxAttempts: job.MaxAttempts,
+		CreatedAt:   job.CreatedAt,
+		ScheduledAt: job.ScheduledAt,
+		AttemptedAt: job.AttemptedAt,
+		FinalizedAt: job.FinalizedAt,
+	}
+
+	// The job arguments include the instance record, so only the operation ID
+	// is returned from them.
+	args := struct {
+		OperationID string `json:"operation_id"`
+	}{}
+	if err := json.Unmarshal(job.EncodedArgs, &args); err == nil {
+		response.OperationID = args.OperationID
+	}
+
+	for _, attemptError := range job.Errors {
+		response.Errors = append(response.Errors, jobErrorResponse{
+			At:      attemptError.At,
+			Attempt: attemptError.Attempt,
+			Error:   attemptError.Error,
+		})
+	}
+	return response
+}
+
+func (a *api) writeInternalError(w http.ResponseWriter, description string, err error) {
+	a.logger.Error(fmt.Sprintf("admin: %s", description), "err", err)
+	writeError(w, http.StatusInternalServerError, fmt.Errorf("%s failed", description))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,398 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/services/elasticsearch"
+	"github.com/cloud-gov/aws-broker/services/rds"
+	"github.com/cloud-gov/aws-broker/services/redis"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+const (
+	rdsServiceID   = "rds-service"
+	adminUsername  = "admin"
+	adminPassword  = "secret"
+	testInstanceID = "instance-1"
+)
+
+type mockJobClient struct {
+	jobs      map[int64]*rivertype.JobRow
+	retried   []int64
+	cancelled []int64
+}
+
+func (c *mockJobClient) ListJobs(ctx context.Context, params queue.ListParams) ([]*rivertype.JobRow, error) {
+	jobs := []*rivertype.JobRow{}
+	for _, job := range c.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (c *mockJobClient) JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	job, ok := c.jobs[id]
+	if !ok {
+		return nil, rivertype.ErrNotFound
+	}
+	return job, nil
+}
+
+func (c *mockJobClient) JobRetry(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	c.retried = append(c.retried, id)
+	job := *c.jobs[id]
+	job.State = rivertype.JobStateAvailable
+	return &job, nil
+}
+
+func (c *mockJobClient) JobCancel(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	c.cancelled = append(c.cancelled, id)
+	job := *c.jobs[id]
+	job.State = rivertype.JobStateCancelled
+	return &job, nil
+}
+
+func testDBInit(t *testing.T) *gorm.DB {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&base.Instance{}, &rds.RDSInstance{}, &redis.RedisInstance{}, &elasticsearch.ElasticsearchInstance{}, &asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}, &rds.RDSSnapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func setup(t *testing.T) (http.Handler, *gorm.DB, *mockJobClient) {
+	db := testDBInit(t)
+
+	// The test database is shared between tests, so remove the records created
+	// by any previous test.
+	for _, model := range []any{&base.Instance{}, &rds.RDSInstance{}, &asyncmessage.OperationLogEntry{}, &rds.RDSSnapshot{}} {
+		if err := db.Where("1 = 1").Delete(model).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	instance := &rds.RDSInstance{
+		Instance: base.Instance{
+			Uuid: testInstanceID,
+			Request: request.Request{
+				ServiceID: rdsServiceID,
+				PlanID:    "plan-1",
+			},
+		},
+		Database: "db-1",
+		Password: helpers.RandStr(20),
+		Salt:     helpers.RandStr(20),
+		DbType:   "postgres",
+	}
+	if err := db.Create(instance).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&instance.Instance).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	jobClient := &mockJobClient{
+		jobs: map[int64]*rivertype.JobRow{
+			1: {
+				ID:          1,
+				Kind:        rds.ModifyKind,
+				State:       rivertype.JobStateDiscarded,
+				EncodedArgs: []byte(`{"instance": {"Uuid": "instance-1"}, "operation_id": "operation-1"}`),
+				Errors: []rivertype.AttemptError{
+					{Attempt: 1, Error: "modify failed"},
+				},
+			},
+			2: {
+				ID:          2,
+				Kind:        rds.DeleteKind,
+				State:       rivertype.JobStateRunning,
+				EncodedArgs: []byte(`{"instance": {"Uuid": "instance-1"}}`),
+			},
+		},
+	}
+
+	c := &catalog.Catalog{
+		RdsService: catalog.RDSService{
+			Service: catalog.Service{ID: rdsServiceID},
+		},
+	}
+
+	handler := New(db, c, jobClient, slog.New(&testutil.MockLogHandler{}), Credentials{
+		Username: adminUsername,
+		Password: adminPassword,
+	})
+	return handler, db, jobClient
+}
+
+func doRequest(handler http.Handler, method string, url string, auth bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	if auth {
+		req.SetBasicAuth(adminUsername, adminPassword)
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestAuthentication(t *testing.T) {
+	handler, _, _ := setup(t)
+
+	res := doRequest(handler, "GET", "/instances", false)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without credentials, got %d", http.StatusUnauthorized, res.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/instances", nil)
+	req.SetBasicAuth(adminUsername, "wrong")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with the wrong password, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	handler, _, _ := setup(t)
+
+	res := doRequest(handler, "GET", "/instances?service_id="+rdsServiceID, true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	instances := []base.Instance{}
+	if err := json.Unmarshal(res.Body.Bytes(), &instances); err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Uuid != testInstanceID {
+		t.Errorf("expected only instance %s, got %+v", testInstanceID, instances)
+	}
+
+	res = doRequest(handler, "GET", "/instances?service_id=other", true)
+	if res.Body.String() != "[]\n" {
+		t.Errorf("expected no instances for another service, got %s", res.Body.String())
+	}
+}
+
+func TestGetInstance(t *testing.T) {
+	handler, _, _ := setup(t)
+
+	res := doRequest(handler, "GET", "/instances/unknown", true)
+	if res.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+
+	res = doRequest(handler, "GET", "/instances/"+testInstanceID, true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	response := instanceResponse{}
+	if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Instance.PlanID != "plan-1" {
+		t.Errorf("expected plan plan-1, got %s", response.Instance.PlanID)
+	}
+	if response.Details["Database"] != "db-1" {
+		t.Errorf("expected RDS details to be returned, got %+v", response.Details)
+	}
+	for _, field := range redactedFields {
+		if _, ok := response.Details[field]; ok {
+			t.Errorf("expected %s to be redacted", field)
+		}
+	}
+}
+
+func TestListOperations(t *testing.T) {
+	handler, db, _ := setup(t)
+
+	err := asyncmessage.WriteAsyncJobMessage(db, rdsServiceID, testInstanceID, base.CreateOp, base.InstanceInProgress, "Creating database instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := doRequest(handler, "GET", "/instances/"+testInstanceID+"/operations", true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	entries := []asyncmessage.OperationLogEntry{}
+	if err := json.Unmarshal(res.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message != "Creating database instance" {
+		t.Errorf("expected the operation log entry to be returned, got %+v", entries)
+	}
+}
+
+func TestListRDSSnapshots(t *testing.T) {
+	handler, db, _ := setup(t)
+
+	for _, snapshot := range []*rds.RDSSnapshot{
+		{Identifier: "db-final-deleted-1", InstanceID: "deleted-1", SpaceGUID: "space-1"},
+		{Identifier: "db-final-deleted-2", InstanceID: "deleted-2", SpaceGUID: "space-2"},
+	} {
+		if err := db.Create(snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := doRequest(handler, "GET", "/rds/snapshots", true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	snapshots := []rds.RDSSnapshot{}
+	if err := json.Unmarshal(res.Body.Bytes(), &snapshots); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Errorf("expected 2 snapshots, got %+v", snapshots)
+	}
+
+	res = doRequest(handler, "GET", "/rds/snapshots?space_guid=space-2", true)
+	snapshots = []rds.RDSSnapshot{}
+	if err := json.Unmarshal(res.Body.Bytes(), &snapshots); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Identifier != "db-final-deleted-2" {
+		t.Errorf("expected only snapshot db-final-deleted-2, got %+v", snapshots)
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	handler, _, _ := setup(t)
+
+	res := doRequest(handler, "GET", "/instances/"+testInstanceID+"/jobs", true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	jobs := []jobResponse{}
+	if err := json.Unmarshal(res.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.ID == 1 {
+			if job.OperationID != "operation-1" {
+				t.Errorf("expected operation ID operation-1, got %s", job.OperationID)
+			}
+			if len(job.Errors) != 1 || job.Errors[0].Error != "modify failed" {
+				t.Errorf("expected the job errors to be returned, got %+v", job.Errors)
+			}
+		}
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+	testCases := map[string]struct {
+		url            string
+		expectedStatus int
+		expectRetry    bool
+	}{
+		"failed job": {
+			url:            "/jobs/1/retry",
+			expectedStatus: http.StatusOK,
+			expectRetry:    true,
+		},
+		"running job": {
+			url:            "/jobs/2/retry",
+			expectedStatus: http.StatusConflict,
+		},
+		"unknown job": {
+			url:            "/jobs/3/retry",
+			expectedStatus: http.StatusNotFound,
+		},
+		"invalid job ID": {
+			url:            "/jobs/abc/retry",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler, _, jobClient := setup(t)
+
+			res := doRequest(handler, "POST", test.url, true)
+			if res.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", test.expectedStatus, res.Code, res.Body.String())
+			}
+			if test.expectRetry != (len(jobClient.retried) == 1) {
+				t.Errorf("expected retry: %t, retried jobs: %v", test.expectRetry, jobClient.retried)
+			}
+		})
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	testCases := map[string]struct {
+		url            string
+		expectedStatus int
+		expectCancel   bool
+	}{
+		"running job": {
+			url:            "/jobs/2/cancel",
+			expectedStatus: http.StatusOK,
+			expectCancel:   true,
+		},
+		"discarded job": {
+			url:            "/jobs/1/cancel",
+			expectedStatus: http.StatusConflict,
+		},
+		"unknown job": {
+			url:            "/jobs/3/cancel",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler, _, jobClient := setup(t)
+
+			res := doRequest(handler, "POST", test.url, true)
+			if res.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", test.expectedStatus, res.Code, res.Body.String())
+			}
+			if test.expectCancel != (len(jobClient.cancelled) == 1) {
+				t.Errorf("expected cancel: %t, cancelled jobs: %v", test.expectCancel, jobClient.cancelled)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	handler, _, _ := setup(t)
+
+	res := doRequest(handler, "GET", "/metrics", false)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without credentials, got %d", http.StatusUnauthorized, res.Code)
+	}
+
+	res = doRequest(handler, "GET", "/metrics", true)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if !strings.Contains(res.Body.String(), "go_goroutines") {
+		t.Errorf("expected Prometheus metrics, got %s", res.Body.String())
+	}
+}
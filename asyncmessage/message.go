@@ -1,16 +1,90 @@
 package asyncmessage
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 
 	"github.com/cloud-gov/aws-broker/base"
+	"github.com/riverqueue/river/rivertype"
 	"gorm.io/gorm"
 )
 
+type contextKey string
+
+const (
+	jobContextKey         contextKey = "river_job"
+	operationIDContextKey contextKey = "operation_id"
+)
+
+// ContextWithJob returns a context carrying the River job that is running.
+// Messages written with a database handle using this context are recorded in
+// the operation log with the job ID.
+func ContextWithJob(ctx context.Context, job *rivertype.JobRow) context.Context {
+	if job == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, jobContextKey, job)
+}
+
+// JobFromContext returns the River job carried by the context, or nil if the
+// context was not created by ContextWithJob.
+func JobFromContext(ctx context.Context) *rivertype.JobRow {
+	if ctx == nil {
+		return nil
+	}
+	job, _ := ctx.Value(jobContextKey).(*rivertype.JobRow)
+	return job
+}
+
+// ContextWithOperationID returns a context carrying the ID of the operation
+// that is running. Messages written with a database handle using this context
+// are recorded in the operation log with the operation ID.
+func ContextWithOperationID(ctx context.Context, operationID string) context.Context {
+	return context.WithValue(ctx, operationIDContextKey, operationID)
+}
+
+func operationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	operationID, _ := ctx.Value(operationIDContextKey).(string)
+	return operationID
+}
+
+func jobIDFromContext(ctx context.Context) int64 {
+	job := JobFromContext(ctx)
+	if job == nil {
+		return 0
+	}
+	return job.ID
+}
+
 // This function is writing a message to the database for tracking the state of an asychronous job. This is useful
 // when querying the status of asynchronous create/modify/delete operations from a LastOperation handler.
+//
+// Every message is appended to the operation log, and the latest state of the operation is also saved as an
+// AsyncJobMsg.
+//
+// The message is written even if the context of db is cancelled, so that a job which fails because it timed out or
+// was stopped still records how its operation ended, instead of leaving it in progress.
 func WriteAsyncJobMessage(db *gorm.DB, brokerId string, instanceId string, operation base.Operation, state base.InstanceState, message string) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	db = db.WithContext(context.WithoutCancel(ctx))
+
+	entry := &OperationLogEntry{
+		BrokerId:    brokerId,
+		InstanceId:  instanceId,
+		JobType:     operation,
+		OperationID: operationIDFromContext(ctx),
+		JobID:       jobIDFromContext(ctx),
+		State:       state,
+		Message:     message,
+	}
 	asyncJobMsg := &AsyncJobMsg{
 		BrokerId:   brokerId,
 		InstanceId: instanceId,
@@ -20,18 +94,99 @@ func WriteAsyncJobMessage(db *gorm.DB, brokerId string, instanceId string, opera
 			State:   state,
 		},
 	}
-	return db.Save(asyncJobMsg).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Save(asyncJobMsg).Error
+	})
 }
 
+// GetLastAsyncJobMessage returns the latest message written for an operation on an instance. Operations which
+// started before the operation log existed only have an AsyncJobMsg, so fall back to it.
 func GetLastAsyncJobMessage(db *gorm.DB, brokerId string, instanceId string, operation base.Operation) (*AsyncJobMsg, error) {
+	entry := OperationLogEntry{}
+	result := db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Where("job_type = ?", operation).Order("id desc").Limit(1).Find(&entry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &AsyncJobMsg{
+			BrokerId:   entry.BrokerId,
+			InstanceId: entry.InstanceId,
+			JobType:    entry.JobType,
+			JobState: AsyncJobState{
+				Message: entry.Message,
+				State:   entry.State,
+			},
+		}, nil
+	}
+
 	asyncJobMsg := AsyncJobMsg{}
-	result := db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Where("job_type = ?", operation).First(&asyncJobMsg)
+	result = db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Where("job_type = ?", operation).First(&asyncJobMsg)
 	if result.RowsAffected == 0 {
 		return nil, errors.New("could not find async job status message")
 	}
 	return &asyncJobMsg, result.Error
 }
 
+// GetAsyncJobMessage returns the latest message written for the operation with the given ID. Operations started
+// before operation IDs were introduced have no ID, so the latest message for the type of operation is returned
+// instead.
+func GetAsyncJobMessage(db *gorm.DB, brokerId string, instanceId string, operation base.Operation, operationID string) (*AsyncJobMsg, error) {
+	if operationID == "" {
+		return GetLastAsyncJobMessage(db, brokerId, instanceId, operation)
+	}
+
+	entry := OperationLogEntry{}
+	result := db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Where("operation_id = ?", operationID).Order("id desc").Limit(1).Find(&entry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("could not find async job status message for operation %s", operationID)
+	}
+	return &AsyncJobMsg{
+		BrokerId:   entry.BrokerId,
+		InstanceId: entry.InstanceId,
+		JobType:    entry.JobType,
+		JobState: AsyncJobState{
+			Message: entry.Message,
+			State:   entry.State,
+		},
+	}, nil
+}
+
+// GetOperationLog returns every message written for operations on an instance, oldest first.
+func GetOperationLog(db *gorm.DB, brokerId string, instanceId string) ([]OperationLogEntry, error) {
+	entries := []OperationLogEntry{}
+	err := db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Order("id asc").Find(&entries).Error
+	return entries, err
+}
+
+// HasOperationInProgress reports whether the latest message written for the instance, whatever the operation,
+// recorded that its operation is still in progress. Earlier operations which never recorded how they ended, for
+// example because their job was cancelled first, do not count. Instances without an operation log fall back to
+// their AsyncJobMsg.
+func HasOperationInProgress(db *gorm.DB, brokerId string, instanceId string) (bool, error) {
+	entry := OperationLogEntry{}
+	result := db.Where("broker_id = ?", brokerId).Where("instance_id = ?", instanceId).Order("id desc").Limit(1).Find(&entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return entry.State == base.InstanceInProgress, nil
+	}
+
+	var count int64
+	err := db.Model(&AsyncJobMsg{}).
+		Where("broker_id = ?", brokerId).
+		Where("instance_id = ?", instanceId).
+		Where("state = ?", base.InstanceInProgress).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func WriteAsyncJobMessageAndLogError(db *gorm.DB, logger *slog.Logger, brokerId string, instanceId string, operation base.Operation, state base.InstanceState, message string) {
 	err := WriteAsyncJobMessage(db, brokerId, instanceId, operation, state, message)
 	if err != nil {
@@ -0,0 +1,267 @@
+package asyncmessage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/go-test/deep"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+func testDBInit(t *testing.T) *gorm.DB {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&AsyncJobMsg{}, &OperationLogEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWriteAsyncJobMessageAppendsToOperationLog(t *testing.T) {
+	db := testDBInit(t)
+	brokerID := helpers.RandStr(10)
+	instanceID := helpers.RandStr(10)
+
+	jobDB := db.WithContext(ContextWithJob(context.Background(), &rivertype.JobRow{ID: 42}))
+	writes := []struct {
+		operation base.Operation
+		state     base.InstanceState
+		message   string
+	}{
+		{base.CreateOp, base.InstanceInProgress, "Creating database instance"},
+		{base.CreateOp, base.InstanceInProgress, "Waiting for database to be ready"},
+		{base.CreateOp, base.InstanceNotCreated, "Error waiting for database to become available"},
+	}
+	for _, write := range writes {
+		err := WriteAsyncJobMessage(jobDB, brokerID, instanceID, write.operation, write.state, write.message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := GetOperationLog(db, brokerID, instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(writes) {
+		t.Fatalf("expected %d operation log entries, got %d", len(writes), len(entries))
+	}
+	for i, write := range writes {
+		if entries[i].Message != write.message {
+			t.Errorf("expected entry %d to have message %q, got %q", i, write.message, entries[i].Message)
+		}
+		if entries[i].State != write.state {
+			t.Errorf("expected entry %d to have state %s, got %s", i, write.state, entries[i].State)
+		}
+		if entries[i].JobID != 42 {
+			t.Errorf("expected entry %d to have job ID 42, got %d", i, entries[i].JobID)
+		}
+		if entries[i].CreatedAt.IsZero() {
+			t.Errorf("expected entry %d to have a timestamp", i)
+		}
+	}
+
+	asyncJobMsg, err := GetLastAsyncJobMessage(db, brokerID, instanceID, base.CreateOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedState := AsyncJobState{
+		State:   base.InstanceNotCreated,
+		Message: "Error waiting for database to become available",
+	}
+	if diff := deep.Equal(asyncJobMsg.JobState, expectedState); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestWriteAsyncJobMessageWithoutJob(t *testing.T) {
+	db := testDBInit(t)
+	brokerID := helpers.RandStr(10)
+	instanceID := helpers.RandStr(10)
+
+	err := WriteAsyncJobMessage(db, brokerID, instanceID, base.ModifyOp, base.InstanceInProgress, "Modification in progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := GetOperationLog(db, brokerID, instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 operation log entry, got %d", len(entries))
+	}
+	if entries[0].JobID != 0 {
+		t.Errorf("expected no job ID, got %d", entries[0].JobID)
+	}
+}
+
+func TestGetLastAsyncJobMessage(t *testing.T) {
+	testCases := map[string]struct {
+		asyncJobMsg   *AsyncJobMsg
+		writeMessages []string
+		operation     base.Operation
+		expectedMsg   string
+		expectErr     bool
+	}{
+		"reads the latest entry for the operation": {
+			writeMessages: []string{"first", "second"},
+			operation:     base.ModifyOp,
+			expectedMsg:   "second",
+		},
+		"falls back to the message written before the operation log existed": {
+			asyncJobMsg: &AsyncJobMsg{
+				JobType: base.ModifyOp,
+				JobState: AsyncJobState{
+					State:   base.InstanceInProgress,
+					Message: "legacy",
+				},
+			},
+			operation:   base.ModifyOp,
+			expectedMsg: "legacy",
+		},
+		"ignores entries for other operations": {
+			writeMessages: []string{"modifying"},
+			operation:     base.DeleteOp,
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := testDBInit(t)
+			brokerID := helpers.RandStr(10)
+			instanceID := helpers.RandStr(10)
+
+			if test.asyncJobMsg != nil {
+				test.asyncJobMsg.BrokerId = brokerID
+				test.asyncJobMsg.InstanceId = instanceID
+				if err := db.Create(test.asyncJobMsg).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, message := range test.writeMessages {
+				err := WriteAsyncJobMessage(db, brokerID, instanceID, base.ModifyOp, base.InstanceInProgress, message)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			asyncJobMsg, err := GetLastAsyncJobMessage(db, brokerID, instanceID, test.operation)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if asyncJobMsg.JobState.Message != test.expectedMsg {
+				t.Errorf("expected message %q, got %q", test.expectedMsg, asyncJobMsg.JobState.Message)
+			}
+		})
+	}
+}
+
+func TestHasOperationInProgress(t *testing.T) {
+	type write struct {
+		operation base.Operation
+		state     base.InstanceState
+	}
+	testCases := map[string]struct {
+		asyncJobMsg        *AsyncJobMsg
+		writes             []write
+		expectedInProgress bool
+	}{
+		"no operations": {},
+		"operation in progress": {
+			writes: []write{
+				{base.ModifyOp, base.InstanceInProgress},
+			},
+			expectedInProgress: true,
+		},
+		"operation finished": {
+			writes: []write{
+				{base.ModifyOp, base.InstanceInProgress},
+				{base.ModifyOp, base.InstanceReady},
+			},
+		},
+		"stale operation followed by a finished one": {
+			writes: []write{
+				{base.CreateOp, base.InstanceInProgress},
+				{base.ModifyOp, base.InstanceInProgress},
+				{base.ModifyOp, base.InstanceReady},
+			},
+		},
+		"operation without an operation log in progress": {
+			asyncJobMsg: &AsyncJobMsg{
+				JobType:  base.ModifyOp,
+				JobState: AsyncJobState{State: base.InstanceInProgress},
+			},
+			expectedInProgress: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := testDBInit(t)
+			brokerID := helpers.RandStr(10)
+			instanceID := helpers.RandStr(10)
+
+			if test.asyncJobMsg != nil {
+				test.asyncJobMsg.BrokerId = brokerID
+				test.asyncJobMsg.InstanceId = instanceID
+				if err := db.Create(test.asyncJobMsg).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, write := range test.writes {
+				err := WriteAsyncJobMessage(db, brokerID, instanceID, write.operation, write.state, "message")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			inProgress, err := HasOperationInProgress(db, brokerID, instanceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inProgress != test.expectedInProgress {
+				t.Errorf("expected in progress: %t, got: %t", test.expectedInProgress, inProgress)
+			}
+		})
+	}
+}
+
+func TestWriteAsyncJobMessageWithCancelledContext(t *testing.T) {
+	db := testDBInit(t)
+	brokerID := helpers.RandStr(10)
+	instanceID := helpers.RandStr(10)
+
+	ctx, cancel := context.WithCancel(ContextWithJob(context.Background(), &rivertype.JobRow{ID: 42}))
+	cancel()
+
+	err := WriteAsyncJobMessage(db.WithContext(ctx), brokerID, instanceID, base.ModifyOp, base.InstanceNotModified, "Error modifying database")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := GetOperationLog(db, brokerID, instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].State != base.InstanceNotModified {
+		t.Fatalf("expected the failure to be recorded, got %+v", entries)
+	}
+	if entries[0].JobID != 42 {
+		t.Errorf("expected job ID 42, got %d", entries[0].JobID)
+	}
+}
@@ -1,6 +1,10 @@
 package asyncmessage
 
-import "github.com/cloud-gov/aws-broker/base"
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/base"
+)
 
 type AsyncJobState struct {
 	State   base.InstanceState
@@ -16,3 +20,23 @@ type AsyncJobMsg struct {
 	JobState        AsyncJobState  `gorm:"embedded"`
 	ProcessedStatus chan bool      `gorm:"-"`
 }
+
+// OperationLogEntry is an append-only record of a single step of an
+// asynchronous operation. Unlike AsyncJobMsg, which only holds the latest
+// state of an operation, the entries for an instance form the full timeline
+// of every operation run against it.
+type OperationLogEntry struct {
+	ID         uint           `gorm:"primaryKey; autoIncrement"`
+	BrokerId   string         `gorm:"not null; index:idx_operation_log_instance"`
+	InstanceId string         `gorm:"not null; index:idx_operation_log_instance"`
+	JobType    base.Operation `gorm:"not null"`
+	// OperationID is the ID of the operation the entry belongs to, as
+	// returned to the platform in the operation data.
+	OperationID string `gorm:"index"`
+	// JobID is the ID of the River job that wrote the entry, or 0 if the
+	// entry was not written by a job.
+	JobID     int64
+	State     base.InstanceState
+	Message   string `gorm:"type:text"`
+	CreatedAt time.Time
+}
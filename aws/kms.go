@@ -0,0 +1,151 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+type KMSClientInterface interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// A data key generated by KMS is reused to encrypt secrets until it is
+// dataKeyMaxAge old or has been used dataKeyMaxUses times, so that encrypting
+// a secret does not call KMS every time. Each secret still gets its own random
+// nonce, and the limit on uses is far below what AES-GCM allows per key.
+const (
+	dataKeyMaxAge  = 5 * time.Minute
+	dataKeyMaxUses = 1000
+)
+
+// Unwrapped data keys are kept in memory for as long as a generated data key is
+// reused, and at most maxCachedDataKeys of them are kept, so that decrypting
+// many secrets does not keep every data key in plain text.
+const maxCachedDataKeys = 1000
+
+// KMSKeyProvider generates data keys wrapped by an AWS KMS key, so the master
+// key never leaves KMS. Unwrapped data keys are cached for a while, so
+// decrypting a secret again does not call KMS.
+type KMSKeyProvider struct {
+	client KMSClientInterface
+	keyID  string
+
+	cacheMu sync.Mutex
+	cache   map[string]*cachedDataKey
+
+	mu      sync.Mutex
+	current *generatedDataKey
+}
+
+type cachedDataKey struct {
+	plaintext []byte
+	expiresAt time.Time
+}
+
+type generatedDataKey struct {
+	plaintext []byte
+	wrapped   []byte
+	expiresAt time.Time
+	uses      int
+}
+
+// NewKMSKeyProvider returns a key provider using the KMS key with the given ID,
+// ARN or alias.
+func NewKMSKeyProvider(client KMSClientInterface, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client: client,
+		keyID:  keyID,
+		cache:  map[string]*cachedDataKey{},
+	}
+}
+
+func (p *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil || p.current.uses >= dataKeyMaxUses || time.Now().After(p.current.expiresAt) {
+		output, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:   aws.String(p.keyID),
+			KeySpec: kmsTypes.DataKeySpecAes256,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		p.current = &generatedDataKey{
+			plaintext: output.Plaintext,
+			wrapped:   output.CiphertextBlob,
+			expiresAt: time.Now().Add(dataKeyMaxAge),
+		}
+	}
+	p.current.uses++
+	return bytes.Clone(p.current.plaintext), bytes.Clone(p.current.wrapped), nil
+}
+
+func (p *KMSKeyProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if dataKey, ok := p.cachedDataKey(wrapped); ok {
+		return dataKey, nil
+	}
+	// The key ID is passed so KMS refuses data keys wrapped by another key.
+	output, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob: wrapped,
+		KeyId:          aws.String(p.keyID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Plaintext) == 0 {
+		return nil, errors.New("KMS returned an empty data key")
+	}
+	p.cacheDataKey(wrapped, output.Plaintext)
+	return output.Plaintext, nil
+}
+
+func (p *KMSKeyProvider) cachedDataKey(wrapped []byte) ([]byte, bool) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	cached, ok := p.cache[string(wrapped)]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(cached.expiresAt) {
+		delete(p.cache, string(wrapped))
+		return nil, false
+	}
+	return bytes.Clone(cached.plaintext), true
+}
+
+// cacheDataKey caches an unwrapped data key, first dropping the expired keys
+// and, if the cache is still full, the key which expires soonest.
+func (p *KMSKeyProvider) cacheDataKey(wrapped, plaintext []byte) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	now := time.Now()
+	for key, cached := range p.cache {
+		if now.After(cached.expiresAt) {
+			delete(p.cache, key)
+		}
+	}
+	if len(p.cache) >= maxCachedDataKeys {
+		var oldest string
+		for key, cached := range p.cache {
+			if oldest == "" || cached.expiresAt.Before(p.cache[oldest].expiresAt) {
+				oldest = key
+			}
+		}
+		delete(p.cache, oldest)
+	}
+	p.cache[string(wrapped)] = &cachedDataKey{
+		plaintext: bytes.Clone(plaintext),
+		expiresAt: now.Add(dataKeyMaxAge),
+	}
+}
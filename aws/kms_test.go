@@ -0,0 +1,162 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+type mockKMSClient struct {
+	dataKey       []byte
+	wrapped       []byte
+	generateCalls int
+	decryptCalls  int
+	generateErr   error
+	decryptErr    error
+	decryptKeyIDs []string
+}
+
+func (m *mockKMSClient) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	m.generateCalls++
+	if m.generateErr != nil {
+		return nil, m.generateErr
+	}
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          params.KeyId,
+		Plaintext:      m.dataKey,
+		CiphertextBlob: m.wrapped,
+	}, nil
+}
+
+func (m *mockKMSClient) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.decryptCalls++
+	m.decryptKeyIDs = append(m.decryptKeyIDs, *params.KeyId)
+	if m.decryptErr != nil {
+		return nil, m.decryptErr
+	}
+	if !bytes.Equal(params.CiphertextBlob, m.wrapped) {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return &kms.DecryptOutput{Plaintext: m.dataKey}, nil
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	client := &mockKMSClient{
+		dataKey: []byte("12345678901234567890123456789012"),
+		wrapped: []byte("wrapped-data-key"),
+	}
+	provider := NewKMSKeyProvider(client, "alias/broker")
+
+	dataKey, wrapped, err := provider.GenerateDataKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dataKey, client.dataKey) || !bytes.Equal(wrapped, client.wrapped) {
+		t.Error("expected data key returned by KMS")
+	}
+
+	for range 2 {
+		unwrapped, err := provider.DecryptDataKey(ctx, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, client.dataKey) {
+			t.Error("expected data key decrypted by KMS")
+		}
+	}
+	if client.decryptCalls != 1 {
+		t.Errorf("expected decrypted data key to be cached, KMS was called %d times", client.decryptCalls)
+	}
+	if client.decryptKeyIDs[0] != "alias/broker" {
+		t.Errorf("expected data key to be decrypted with the configured key, got %s", client.decryptKeyIDs[0])
+	}
+
+	if _, err := provider.DecryptDataKey(ctx, []byte("other-data-key")); err == nil {
+		t.Error("expected error decrypting unknown data key")
+	}
+}
+
+func TestKMSKeyProviderReusesDataKeys(t *testing.T) {
+	ctx := context.Background()
+	client := &mockKMSClient{
+		dataKey: []byte("12345678901234567890123456789012"),
+		wrapped: []byte("wrapped-data-key"),
+	}
+	provider := NewKMSKeyProvider(client, "alias/broker")
+
+	for range dataKeyMaxUses {
+		if _, _, err := provider.GenerateDataKey(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if client.generateCalls != 1 {
+		t.Errorf("expected data key to be reused, KMS was called %d times", client.generateCalls)
+	}
+
+	if _, _, err := provider.GenerateDataKey(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.generateCalls != 2 {
+		t.Errorf("expected a new data key once the limit on uses was reached, KMS was called %d times", client.generateCalls)
+	}
+
+	provider.current.expiresAt = time.Now().Add(-time.Second)
+	if _, _, err := provider.GenerateDataKey(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.generateCalls != 3 {
+		t.Errorf("expected a new data key once the data key expired, KMS was called %d times", client.generateCalls)
+	}
+}
+
+func TestKMSKeyProviderExpiresCachedDataKeys(t *testing.T) {
+	ctx := context.Background()
+	client := &mockKMSClient{
+		dataKey: []byte("12345678901234567890123456789012"),
+		wrapped: []byte("wrapped-data-key"),
+	}
+	provider := NewKMSKeyProvider(client, "alias/broker")
+
+	if _, err := provider.DecryptDataKey(ctx, client.wrapped); err != nil {
+		t.Fatal(err)
+	}
+	provider.cache[string(client.wrapped)].expiresAt = time.Now().Add(-time.Second)
+	if _, err := provider.DecryptDataKey(ctx, client.wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if client.decryptCalls != 2 {
+		t.Errorf("expected expired data key to be decrypted again, KMS was called %d times", client.decryptCalls)
+	}
+
+	for i := range maxCachedDataKeys + 10 {
+		provider.cacheDataKey(fmt.Appendf(nil, "other-data-key-%d", i), client.dataKey)
+	}
+	if len(provider.cache) != maxCachedDataKeys {
+		t.Errorf("expected at most %d cached data keys, got %d", maxCachedDataKeys, len(provider.cache))
+	}
+	if _, ok := provider.cache[string(client.wrapped)]; ok {
+		t.Error("expected the oldest data key to be dropped from the full cache")
+	}
+}
+
+func TestKMSKeyProviderErrors(t *testing.T) {
+	ctx := context.Background()
+	client := &mockKMSClient{
+		generateErr: errors.New("access denied"),
+		decryptErr:  errors.New("access denied"),
+	}
+	provider := NewKMSKeyProvider(client, "alias/broker")
+
+	if _, _, err := provider.GenerateDataKey(ctx); err == nil {
+		t.Error("expected error generating data key")
+	}
+	if _, err := provider.DecryptDataKey(ctx, []byte("wrapped-data-key")); err == nil {
+		t.Error("expected error decrypting data key")
+	}
+}
@@ -0,0 +1,143 @@
+package base
+
+import (
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"gorm.io/gorm"
+)
+
+// Binding is the record of a binding between an application and a service
+// instance, kept for every service so that bindings can be retrieved and
+// audited.
+type Binding struct {
+	InstanceUuid string `gorm:"primaryKey" sql:"size(255)"`
+	BindingID    string `gorm:"primaryKey" sql:"size(255)"`
+	AppGUID      string `sql:"size(255)"`
+	Parameters   string `gorm:"type:text"`
+	Credentials  string `gorm:"type:text"`
+	Salt         string `sql:"size(255)"`
+
+	CreatedAt time.Time `deep:"-"`
+}
+
+// NewBinding builds the record for a binding, encrypting the credentials
+// that were returned to the application with the current key.
+func NewBinding(
+	bindingID string,
+	instanceID string,
+	details domain.BindDetails,
+	credentials map[string]string,
+	keys *helpers.Keyring,
+) (*Binding, error) {
+	binding := &Binding{
+		BindingID:    bindingID,
+		InstanceUuid: instanceID,
+		AppGUID:      appGUID(details),
+		Parameters:   string(details.RawParameters),
+	}
+
+	if err := binding.setCredentials(credentials, keys); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+func appGUID(details domain.BindDetails) string {
+	if details.AppGUID == "" && details.BindResource != nil {
+		return details.BindResource.AppGuid
+	}
+	return details.AppGUID
+}
+
+// Matches reports whether the binding was created with details, so that a
+// repeated request to create it can return the binding instead of a conflict.
+func (b *Binding) Matches(details domain.BindDetails) bool {
+	if b.AppGUID != appGUID(details) {
+		return false
+	}
+	if b.Parameters == "" || len(details.RawParameters) == 0 {
+		return b.Parameters == "" && len(details.RawParameters) == 0
+	}
+	var recorded, requested any
+	if err := json.Unmarshal([]byte(b.Parameters), &recorded); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(details.RawParameters, &requested); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(recorded, requested)
+}
+
+func (b *Binding) setCredentials(credentials map[string]string, keys *helpers.Keyring) error {
+	serialized, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	b.Salt = helpers.GenerateSalt(aes.BlockSize)
+
+	encrypted, err := keys.Encrypt(string(serialized))
+	if err != nil {
+		return err
+	}
+	b.Credentials = encrypted
+	return nil
+}
+
+// GetCredentials decrypts the credentials that were returned for the binding.
+func (b *Binding) GetCredentials(keys *helpers.Keyring) (map[string]string, error) {
+	if b.Salt == "" || b.Credentials == "" {
+		return nil, errors.New("salt and credentials have to be set before getting the credentials")
+	}
+
+	iv, _ := base64.StdEncoding.DecodeString(b.Salt)
+
+	decrypted, err := keys.Decrypt(b.Credentials, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := map[string]string{}
+	if err := json.Unmarshal([]byte(decrypted), &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// GetParameters returns the parameters provided when the binding was created.
+func (b *Binding) GetParameters() (any, error) {
+	if b.Parameters == "" {
+		return nil, nil
+	}
+	var parameters any
+	if err := json.Unmarshal([]byte(b.Parameters), &parameters); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
+
+// FindBinding is a helper function to find a binding to a service instance.
+func FindBinding(brokerDb *gorm.DB, instanceID string, bindingID string) (Binding, error) {
+	binding := Binding{}
+	result := brokerDb.Where("binding_id = ? AND instance_uuid = ?", bindingID, instanceID).Limit(1).Find(&binding)
+	if result.Error != nil {
+		return binding, apiresponses.NewFailureResponse(
+			result.Error,
+			http.StatusInternalServerError,
+			"find binding",
+		)
+	}
+	if result.RowsAffected == 0 {
+		return binding, apiresponses.ErrBindingNotFound
+	}
+	return binding, nil
+}
@@ -0,0 +1,47 @@
+package base
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+)
+
+func TestBindingMatches(t *testing.T) {
+	binding := Binding{AppGUID: "app-1", Parameters: `{"read_only": true, "role": "reader"}`}
+
+	testCases := map[string]struct {
+		details  domain.BindDetails
+		expected bool
+	}{
+		"same details": {
+			details:  domain.BindDetails{AppGUID: "app-1", RawParameters: json.RawMessage(`{"read_only": true, "role": "reader"}`)},
+			expected: true,
+		},
+		"same parameters in another order": {
+			details:  domain.BindDetails{AppGUID: "app-1", RawParameters: json.RawMessage(`{"role":"reader","read_only":true}`)},
+			expected: true,
+		},
+		"app from the bind resource": {
+			details:  domain.BindDetails{BindResource: &domain.BindResource{AppGuid: "app-1"}, RawParameters: json.RawMessage(`{"read_only": true, "role": "reader"}`)},
+			expected: true,
+		},
+		"other app": {
+			details: domain.BindDetails{AppGUID: "app-2", RawParameters: json.RawMessage(`{"read_only": true, "role": "reader"}`)},
+		},
+		"other parameters": {
+			details: domain.BindDetails{AppGUID: "app-1", RawParameters: json.RawMessage(`{"read_only": false, "role": "reader"}`)},
+		},
+		"no parameters": {
+			details: domain.BindDetails{AppGUID: "app-1"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if binding.Matches(test.details) != test.expected {
+				t.Errorf("expected Matches to return %t", test.expected)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package base
 
 import (
+	"strings"
+
 	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"github.com/google/uuid"
 )
 
 // operation represents the type of async operation a broker may require
@@ -14,6 +17,10 @@ const (
 	DeleteOp
 	BindOp
 	UnBindOp
+	// ReconcileOp is not requested by the platform. It records the results of
+	// the periodic jobs which bring the resources of an instance in line with
+	// the broker's records in the operation log of the instance.
+	ReconcileOp
 )
 
 func (o Operation) String() string {
@@ -28,17 +35,63 @@ func (o Operation) String() string {
 		return "bind"
 	case UnBindOp:
 		return "unbind"
+	case ReconcileOp:
+		return "reconcile"
 	default:
 		return "unknown"
 	}
 }
 
+// OperationData identifies a single asynchronous operation on an instance. It is
+// returned to the platform as the operation field of an asynchronous response,
+// and sent back when polling the last operation.
+type OperationData struct {
+	Operation Operation
+	// ID is unique for each operation. It is empty for operations started
+	// before operation IDs were introduced.
+	ID string
+}
+
+// NewOperationData returns the data for a new operation with a unique ID.
+func NewOperationData(o Operation) OperationData {
+	return OperationData{
+		Operation: o,
+		ID:        uuid.NewString(),
+	}
+}
+
+func (d OperationData) String() string {
+	if d.ID == "" {
+		return d.Operation.String()
+	}
+	return d.Operation.String() + ":" + d.ID
+}
+
+// ParseOperationData parses the operation data sent by the platform. Data
+// without an ID, such as "modify", is accepted for operations started before
+// operation IDs were introduced.
+func ParseOperationData(data string) OperationData {
+	name, id, _ := strings.Cut(data, ":")
+	operation := NoOp
+	for _, o := range []Operation{CreateOp, ModifyOp, DeleteOp, BindOp, UnBindOp} {
+		if o.String() == name {
+			operation = o
+		}
+	}
+	return OperationData{
+		Operation: operation,
+		ID:        id,
+	}
+}
+
 // Broker is the interface that every type of broker should implement.
 type Broker interface {
 	AsyncOperationRequired(o Operation) bool
-	CreateInstance(string, domain.ProvisionDetails) error
-	ModifyInstance(string, domain.UpdateDetails) error
-	DeleteInstance(string) error
+	CreateInstance(string, string, domain.ProvisionDetails) error
+	ModifyInstance(string, string, domain.UpdateDetails) error
+	DeleteInstance(string, string) error
 	LastOperation(string, domain.PollDetails) (domain.LastOperation, error)
-	BindInstance(string, domain.BindDetails) (domain.Binding, error)
+	BindInstance(string, string, domain.BindDetails) (domain.Binding, error)
+	UnbindInstance(string, string, domain.UnbindDetails) error
+	GetInstance(string, domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error)
 }
@@ -0,0 +1,44 @@
+package base
+
+import "testing"
+
+func TestOperationData(t *testing.T) {
+	operationData := NewOperationData(ModifyOp)
+	if operationData.ID == "" {
+		t.Fatal("expected new operation data to have an ID")
+	}
+	if NewOperationData(ModifyOp).ID == operationData.ID {
+		t.Fatal("expected every operation to have a unique ID")
+	}
+
+	testCases := map[string]struct {
+		data     string
+		expected OperationData
+	}{
+		"operation with ID": {
+			data:     operationData.String(),
+			expected: operationData,
+		},
+		"operation without ID": {
+			data:     "delete",
+			expected: OperationData{Operation: DeleteOp},
+		},
+		"unknown operation": {
+			data:     "upgrade:123",
+			expected: OperationData{Operation: NoOp, ID: "123"},
+		},
+		"empty": {
+			data:     "",
+			expected: OperationData{Operation: NoOp},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			parsed := ParseOperationData(test.data)
+			if parsed != test.expected {
+				t.Errorf("expected: %+v, got: %+v", test.expected, parsed)
+			}
+		})
+	}
+}
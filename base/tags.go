@@ -0,0 +1,39 @@
+package base
+
+import (
+	brokertags "github.com/cloud-gov/go-broker-tags"
+)
+
+// ReconcileTags returns the tags which the resources of the instance should
+// have. The timestamp tags are left out, as they differ every time the tags
+// are generated.
+func (i Instance) ReconcileTags(tagManager brokertags.TagManager, serviceName string, planName string) (map[string]string, error) {
+	tags, err := tagManager.GenerateTags(
+		brokertags.Update,
+		serviceName,
+		planName,
+		brokertags.ResourceGUIDs{
+			InstanceGUID:     i.Uuid,
+			SpaceGUID:        i.SpaceGUID,
+			OrganizationGUID: i.OrganizationGUID,
+		},
+		true,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delete(tags, "Created at")
+	delete(tags, "Updated at")
+	return tags, nil
+}
+
+// HasTags reports whether the existing tags of a resource include every one
+// of tags with the same value.
+func HasTags(existing map[string]string, tags map[string]string) bool {
+	for key, value := range tags {
+		if existingValue, ok := existing[key]; !ok || existingValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package base
+
+import "testing"
+
+func TestHasTags(t *testing.T) {
+	testCases := map[string]struct {
+		existing map[string]string
+		expected bool
+	}{
+		"all tags": {
+			existing: map[string]string{"Space": "space-1", "Organization": "org-1", "Other": "value"},
+			expected: true,
+		},
+		"missing tag": {
+			existing: map[string]string{"Space": "space-1"},
+		},
+		"different value": {
+			existing: map[string]string{"Space": "space-2", "Organization": "org-1"},
+		},
+		"no tags": {},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if HasTags(test.existing, map[string]string{"Space": "space-1", "Organization": "org-1"}) != test.expected {
+				t.Errorf("expected HasTags to return %t", test.expected)
+			}
+		})
+	}
+}
@@ -2,22 +2,24 @@ package broker
 
 import (
 	"context"
-	"database/sql"
-	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"code.cloudfoundry.org/brokerapi/v13/domain"
 	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
 	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/metrics"
 	"github.com/cloud-gov/aws-broker/services/elasticsearch"
 	"github.com/cloud-gov/aws-broker/services/rds"
 	"github.com/cloud-gov/aws-broker/services/redis"
 	brokertags "github.com/cloud-gov/go-broker-tags"
-	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
 
@@ -27,7 +29,7 @@ type AWSBroker struct {
 	catalog     *catalog.Catalog
 	settings    *config.Settings
 	tagManager  brokertags.TagManager
-	riverClient *river.Client[*sql.Tx]
+	riverClient queue.Client
 	logger      *slog.Logger
 }
 
@@ -37,7 +39,7 @@ func New(
 	db *gorm.DB,
 	catalog *catalog.Catalog,
 	tagManager brokertags.TagManager,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 	logger *slog.Logger,
 ) *AWSBroker {
 	return &AWSBroker{
@@ -61,7 +63,10 @@ func (b *AWSBroker) Provision(
 	details domain.ProvisionDetails,
 	asyncAllowed bool,
 ) (domain.ProvisionedServiceSpec, error) {
-	return b.createInstance(instanceID, details, asyncAllowed)
+	start := time.Now()
+	spec, err := b.createInstance(instanceID, details, asyncAllowed)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "provision", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) Update(
@@ -70,7 +75,10 @@ func (b *AWSBroker) Update(
 	details domain.UpdateDetails,
 	asyncAllowed bool,
 ) (domain.UpdateServiceSpec, error) {
-	return b.modifyInstance(instanceID, details, asyncAllowed)
+	start := time.Now()
+	spec, err := b.modifyInstance(instanceID, details, asyncAllowed)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "update", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) Deprovision(
@@ -79,7 +87,10 @@ func (b *AWSBroker) Deprovision(
 	details domain.DeprovisionDetails,
 	asyncAllowed bool,
 ) (domain.DeprovisionServiceSpec, error) {
-	return b.deleteInstance(instanceID, details, asyncAllowed)
+	start := time.Now()
+	spec, err := b.deleteInstance(instanceID, details, asyncAllowed)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "deprovision", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) Bind(
@@ -89,7 +100,10 @@ func (b *AWSBroker) Bind(
 	details domain.BindDetails,
 	asyncAllowed bool,
 ) (domain.Binding, error) {
-	return b.bindInstance(instanceID, details, asyncAllowed)
+	start := time.Now()
+	binding, err := b.bindInstance(instanceID, bindingID, details, asyncAllowed)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "bind", start, err)
+	return binding, err
 }
 
 func (b *AWSBroker) Unbind(
@@ -99,7 +113,10 @@ func (b *AWSBroker) Unbind(
 	details domain.UnbindDetails,
 	asyncAllowed bool,
 ) (domain.UnbindSpec, error) {
-	return domain.UnbindSpec{}, nil
+	start := time.Now()
+	spec, err := b.unbindInstance(instanceID, bindingID, details, asyncAllowed)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "unbind", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) LastOperation(
@@ -107,7 +124,10 @@ func (b *AWSBroker) LastOperation(
 	instanceID string,
 	details domain.PollDetails,
 ) (domain.LastOperation, error) {
-	return b.lastOperation(instanceID, details)
+	start := time.Now()
+	lastOperation, err := b.lastOperation(instanceID, details)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "last_operation", start, err)
+	return lastOperation, err
 }
 
 func (b *AWSBroker) GetBinding(
@@ -116,7 +136,10 @@ func (b *AWSBroker) GetBinding(
 	bindingID string,
 	details domain.FetchBindingDetails,
 ) (domain.GetBindingSpec, error) {
-	return domain.GetBindingSpec{}, errors.New("this broker does not support GetBinding")
+	start := time.Now()
+	spec, err := b.getBinding(instanceID, bindingID)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "get_binding", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) GetInstance(
@@ -124,7 +147,10 @@ func (b *AWSBroker) GetInstance(
 	instanceID string,
 	details domain.FetchInstanceDetails,
 ) (domain.GetInstanceDetailsSpec, error) {
-	return domain.GetInstanceDetailsSpec{}, errors.New("this broker does not support GetInstance")
+	start := time.Now()
+	spec, err := b.getInstance(instanceID, details)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "get_instance", start, err)
+	return spec, err
 }
 
 func (b *AWSBroker) LastBindingOperation(
@@ -133,7 +159,23 @@ func (b *AWSBroker) LastBindingOperation(
 	bindingID string,
 	details domain.PollDetails,
 ) (domain.LastOperation, error) {
-	return domain.LastOperation{}, errors.New("this broker does not support LastBindingOperation")
+	start := time.Now()
+	lastOperation, err := b.lastBindingOperation(instanceID, bindingID)
+	metrics.ObserveBrokerRequest(b.serviceName(details.ServiceID), "last_binding_operation", start, err)
+	return lastOperation, err
+}
+
+// serviceName returns the catalog name of a service, which is used to label metrics.
+func (b *AWSBroker) serviceName(serviceID string) string {
+	switch serviceID {
+	case b.catalog.RdsService.ID:
+		return b.catalog.RdsService.Name
+	case b.catalog.RedisService.ID:
+		return b.catalog.RedisService.Name
+	case b.catalog.ElasticsearchService.ID:
+		return b.catalog.ElasticsearchService.Name
+	}
+	return "unknown"
 }
 
 func (b *AWSBroker) findBroker(serviceID string) (base.Broker, error) {
@@ -163,8 +205,9 @@ func (b *AWSBroker) findBroker(serviceID string) (base.Broker, error) {
 }
 
 func (b *AWSBroker) createInstance(id string, details domain.ProvisionDetails, asyncAllowed bool) (domain.ProvisionedServiceSpec, error) {
+	operationData := base.NewOperationData(base.CreateOp)
 	spec := domain.ProvisionedServiceSpec{
-		OperationData: base.CreateOp.String(),
+		OperationData: operationData.String(),
 	}
 	broker, err := b.findBroker(details.ServiceID)
 	if err != nil {
@@ -192,7 +235,7 @@ func (b *AWSBroker) createInstance(id string, details domain.ProvisionDetails, a
 	}
 
 	// Create instance
-	err = broker.CreateInstance(id, details)
+	err = broker.CreateInstance(id, operationData.ID, details)
 	if err != nil {
 		return spec, err
 	}
@@ -201,8 +244,9 @@ func (b *AWSBroker) createInstance(id string, details domain.ProvisionDetails, a
 }
 
 func (b *AWSBroker) modifyInstance(id string, details domain.UpdateDetails, asyncAllowed bool) (domain.UpdateServiceSpec, error) {
+	operationData := base.NewOperationData(base.ModifyOp)
 	spec := domain.UpdateServiceSpec{
-		OperationData: base.ModifyOp.String(),
+		OperationData: operationData.String(),
 	}
 	broker, err := b.findBroker(details.ServiceID)
 	if err != nil {
@@ -214,6 +258,11 @@ func (b *AWSBroker) modifyInstance(id string, details domain.UpdateDetails, asyn
 		return spec, err
 	}
 
+	err = b.checkOperationInProgress(details.ServiceID, id)
+	if err != nil {
+		return spec, err
+	}
+
 	asyncRequired := broker.AsyncOperationRequired(base.ModifyOp)
 	spec.IsAsync = asyncRequired
 
@@ -222,7 +271,7 @@ func (b *AWSBroker) modifyInstance(id string, details domain.UpdateDetails, asyn
 	}
 
 	// Attempt to modify the database instance.
-	err = broker.ModifyInstance(id, details)
+	err = broker.ModifyInstance(id, operationData.ID, details)
 	if err != nil {
 		return spec, err
 	}
@@ -240,14 +289,20 @@ func (b *AWSBroker) modifyInstance(id string, details domain.UpdateDetails, asyn
 }
 
 func (b *AWSBroker) deleteInstance(id string, details domain.DeprovisionDetails, asyncAllowed bool) (domain.DeprovisionServiceSpec, error) {
+	operationData := base.NewOperationData(base.DeleteOp)
 	spec := domain.DeprovisionServiceSpec{
-		OperationData: base.DeleteOp.String(),
+		OperationData: operationData.String(),
 	}
 	broker, err := b.findBroker(details.ServiceID)
 	if err != nil {
 		return spec, err
 	}
 
+	err = b.checkOperationInProgress(details.ServiceID, id)
+	if err != nil {
+		return spec, err
+	}
+
 	asyncRequired := broker.AsyncOperationRequired(base.DeleteOp)
 	spec.IsAsync = asyncRequired
 
@@ -255,7 +310,7 @@ func (b *AWSBroker) deleteInstance(id string, details domain.DeprovisionDetails,
 		return spec, apiresponses.ErrAsyncRequired
 	}
 
-	err = broker.DeleteInstance(id)
+	err = broker.DeleteInstance(id, operationData.ID)
 	if err != nil {
 		return spec, err
 	}
@@ -280,7 +335,7 @@ func (b *AWSBroker) deleteInstance(id string, details domain.DeprovisionDetails,
 	return spec, nil
 }
 
-func (b *AWSBroker) bindInstance(id string, details domain.BindDetails, asyncAllowed bool) (domain.Binding, error) {
+func (b *AWSBroker) bindInstance(id string, bindingID string, details domain.BindDetails, asyncAllowed bool) (domain.Binding, error) {
 	binding := domain.Binding{
 		OperationData: base.BindOp.String(),
 	}
@@ -295,7 +350,201 @@ func (b *AWSBroker) bindInstance(id string, details domain.BindDetails, asyncAll
 		return binding, apiresponses.ErrAsyncRequired
 	}
 
-	return broker.BindInstance(id, details)
+	existing, err := base.FindBinding(b.db, id, bindingID)
+	if err == nil {
+		return b.existingBinding(existing, details)
+	}
+	if err != apiresponses.ErrBindingNotFound {
+		return binding, err
+	}
+
+	binding, err = broker.BindInstance(id, bindingID, details)
+	if err != nil {
+		return binding, err
+	}
+
+	// A binding which cannot be recorded cannot be retrieved either, so the
+	// credentials created for it are removed again.
+	rollback := func() {
+		err := broker.UnbindInstance(id, bindingID, domain.UnbindDetails{ServiceID: details.ServiceID, PlanID: details.PlanID})
+		if err != nil {
+			b.logger.Error("could not remove binding which was not saved", "instance_id", id, "binding_id", bindingID, "err", err)
+		}
+	}
+
+	credentials, ok := binding.Credentials.(map[string]string)
+	if !ok {
+		rollback()
+		return binding, apiresponses.NewFailureResponse(
+			fmt.Errorf("unexpected credentials type %T", binding.Credentials),
+			http.StatusInternalServerError,
+			"save binding",
+		)
+	}
+
+	record, err := base.NewBinding(bindingID, id, details, credentials, b.settings.Keyring())
+	if err != nil {
+		rollback()
+		return binding, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "save binding")
+	}
+
+	err = b.db.Create(record).Error
+	if err != nil {
+		rollback()
+		return binding, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "save binding")
+	}
+
+	return binding, nil
+}
+
+// existingBinding returns a binding which was already created, when it is
+// requested again with the same details.
+func (b *AWSBroker) existingBinding(existing base.Binding, details domain.BindDetails) (domain.Binding, error) {
+	if !existing.Matches(details) {
+		return domain.Binding{}, apiresponses.ErrBindingAlreadyExists
+	}
+
+	credentials, err := existing.GetCredentials(b.settings.Keyring())
+	if err != nil {
+		return domain.Binding{}, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "get binding credentials")
+	}
+
+	return domain.Binding{
+		AlreadyExists: true,
+		OperationData: base.BindOp.String(),
+		Credentials:   credentials,
+	}, nil
+}
+
+func (b *AWSBroker) unbindInstance(id string, bindingID string, details domain.UnbindDetails, asyncAllowed bool) (domain.UnbindSpec, error) {
+	spec := domain.UnbindSpec{}
+
+	broker, err := b.findBroker(details.ServiceID)
+	if err != nil {
+		return spec, err
+	}
+
+	asyncRequired := broker.AsyncOperationRequired(base.UnBindOp)
+	if asyncRequired && !asyncAllowed {
+		return spec, apiresponses.ErrAsyncRequired
+	}
+
+	err = broker.UnbindInstance(id, bindingID, details)
+	if err != nil {
+		return spec, err
+	}
+
+	// Bindings created before bindings were recorded have no record to delete.
+	err = b.db.Where("binding_id = ? AND instance_uuid = ?", bindingID, id).Delete(&base.Binding{}).Error
+	if err != nil {
+		return spec, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "delete binding")
+	}
+
+	return spec, nil
+}
+
+func (b *AWSBroker) getBinding(id string, bindingID string) (domain.GetBindingSpec, error) {
+	spec := domain.GetBindingSpec{}
+
+	binding, err := base.FindBinding(b.db, id, bindingID)
+	if err != nil {
+		return spec, err
+	}
+
+	credentials, err := binding.GetCredentials(b.settings.Keyring())
+	if err != nil {
+		return spec, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "get binding credentials")
+	}
+
+	parameters, err := binding.GetParameters()
+	if err != nil {
+		return spec, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "get binding parameters")
+	}
+
+	spec.Credentials = credentials
+	spec.Parameters = parameters
+	return spec, nil
+}
+
+// Bindings are always created synchronously, so a binding that exists has
+// always finished being created.
+func (b *AWSBroker) lastBindingOperation(id string, bindingID string) (domain.LastOperation, error) {
+	_, err := base.FindBinding(b.db, id, bindingID)
+	if err == apiresponses.ErrBindingNotFound {
+		return domain.LastOperation{}, apiresponses.ErrBindingDoesNotExist
+	}
+	if err != nil {
+		return domain.LastOperation{}, err
+	}
+
+	return domain.LastOperation{
+		State:       domain.Succeeded,
+		Description: "Binding created",
+	}, nil
+}
+
+func (b *AWSBroker) getInstance(id string, details domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error) {
+	instance, err := base.FindBaseInstance(b.db, id)
+	if err == apiresponses.ErrInstanceDoesNotExist {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceNotFound
+	}
+	if err != nil {
+		return domain.GetInstanceDetailsSpec{}, err
+	}
+
+	// The platform may not send the service ID when fetching an instance, so
+	// use the one recorded when the instance was created.
+	broker, err := b.findBroker(instance.ServiceID)
+	if err != nil {
+		return domain.GetInstanceDetailsSpec{}, err
+	}
+	if broker == nil {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceNotFound
+	}
+
+	return broker.GetInstance(id, details)
+}
+
+// checkOperationInProgress returns ErrConcurrentInstanceAccess if an operation
+// is running on the instance. With a job queue, an operation runs for as long
+// as its job is unfinished, whatever the last message it wrote, since a job
+// which is cancelled or discarded may never record that it stopped. This lets
+// a request be refused before any work is done. The job queue checks again in
+// the transaction which inserts the job, so two requests racing past this check
+// cannot both start an operation.
+func (b *AWSBroker) checkOperationInProgress(serviceID string, id string) error {
+	if b.riverClient == nil {
+		inProgress, err := asyncmessage.HasOperationInProgress(b.db, serviceID, id)
+		if err != nil {
+			return apiresponses.NewFailureResponse(
+				err,
+				http.StatusInternalServerError,
+				"check operation in progress",
+			)
+		}
+		if inProgress {
+			return apiresponses.ErrConcurrentInstanceAccess
+		}
+		return nil
+	}
+
+	jobs, err := b.riverClient.ListJobs(b.ctx, queue.ListParams{
+		InstanceID: id,
+		States:     queue.UnfinishedJobStates,
+		Limit:      1,
+	})
+	if err != nil {
+		return apiresponses.NewFailureResponse(
+			err,
+			http.StatusInternalServerError,
+			"list jobs for instance",
+		)
+	}
+	if len(jobs) > 0 {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
+
+	return nil
 }
 
 func (b *AWSBroker) lastOperation(id string, details domain.PollDetails) (domain.LastOperation, error) {
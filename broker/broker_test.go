@@ -0,0 +1,82 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river/rivertype"
+)
+
+type mockJobClient struct {
+	queue.Client
+	jobs []*rivertype.JobRow
+}
+
+func (c *mockJobClient) ListJobs(ctx context.Context, params queue.ListParams) ([]*rivertype.JobRow, error) {
+	jobs := []*rivertype.JobRow{}
+	for _, job := range c.jobs {
+		if len(params.States) == 0 || slices.Contains(params.States, job.State) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func TestCheckOperationInProgress(t *testing.T) {
+	testCases := map[string]struct {
+		riverClient queue.Client
+		state       base.InstanceState
+		expectErr   error
+	}{
+		"message in progress without a job queue": {
+			state:     base.InstanceInProgress,
+			expectErr: apiresponses.ErrConcurrentInstanceAccess,
+		},
+		"message finished without a job queue": {
+			state: base.InstanceReady,
+		},
+		"unfinished job": {
+			riverClient: &mockJobClient{jobs: []*rivertype.JobRow{{State: rivertype.JobStateRunning}}},
+			state:       base.InstanceInProgress,
+			expectErr:   apiresponses.ErrConcurrentInstanceAccess,
+		},
+		"stale message of a finished job": {
+			riverClient: &mockJobClient{jobs: []*rivertype.JobRow{{State: rivertype.JobStateCancelled}}},
+			state:       base.InstanceInProgress,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, err := testutil.TestDbInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AutoMigrate(&asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}); err != nil {
+				t.Fatal(err)
+			}
+
+			serviceID := helpers.RandStr(10)
+			instanceID := helpers.RandStr(10)
+			if err := asyncmessage.WriteAsyncJobMessage(db, serviceID, instanceID, base.ModifyOp, test.state, "message"); err != nil {
+				t.Fatal(err)
+			}
+
+			b := New(t.Context(), &config.Settings{}, db, nil, nil, test.riverClient, slog.New(slog.DiscardHandler))
+			err = b.checkOperationInProgress(serviceID, instanceID)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected error %v, got %v", test.expectErr, err)
+			}
+		})
+	}
+}
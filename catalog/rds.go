@@ -64,6 +64,7 @@ type RDSPlan struct {
 	SecurityGroup         string            `yaml:"securityGroup" json:"-" validate:"required"`
 	ApprovedMajorVersions []string          `yaml:"approvedMajorVersions" json:"-"`
 	ReadReplica           bool              `yaml:"read_replica" json:"-"`
+	FinalSnapshot         bool              `yaml:"final_snapshot" json:"-"`
 }
 
 // CheckVersion verifies that a specific version chosen by the user for a new
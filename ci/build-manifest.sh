@@ -16,6 +16,7 @@ cat << EOF >> built/manifest.yml
     DB_PORT: `${TERRAFORM} output -raw -state=$STATE_FILE rds_internal_rds_port`
     S3_SNAPSHOT_BUCKET: `${TERRAFORM} output -raw -state=$STATE_FILE s3_snapshots_bucket_id`
     ENABLE_FUNCTIONS: true
+    MIGRATE_ON_STARTUP: true
 EOF
 
 # Build secrets for merging into templates
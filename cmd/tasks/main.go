@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
@@ -15,13 +16,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	brokertags "github.com/cloud-gov/go-broker-tags"
 
-	tasksElasticache "github.com/cloud-gov/aws-broker/cmd/tasks/elasticache"
-	tasksOpensearch "github.com/cloud-gov/aws-broker/cmd/tasks/opensearch"
 	tasksRds "github.com/cloud-gov/aws-broker/cmd/tasks/rds"
 
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
 	"github.com/cloud-gov/aws-broker/db"
+	brokerElasticsearch "github.com/cloud-gov/aws-broker/services/elasticsearch"
+	brokerRds "github.com/cloud-gov/aws-broker/services/rds"
+	brokerRedis "github.com/cloud-gov/aws-broker/services/redis"
 
 	"golang.org/x/exp/slices"
 )
@@ -61,7 +63,7 @@ func run() error {
 		return fmt.Errorf("there was an error loading settings: %w", err)
 	}
 
-	db, err := db.InternalDBInit(settings.DbConfig)
+	db, err := db.DBInit(settings.DbConfig)
 	if err != nil {
 		return fmt.Errorf("there was an error with the DB. Error: %s", err.Error())
 	}
@@ -93,21 +95,21 @@ func run() error {
 
 		if slices.Contains(services, "rds") {
 			rdsClient := rds.NewFromConfig(cfg)
-			err := tasksRds.ReconcileResourceTagsForAllRDSDatabases(c, db, rdsClient, logsClient, tagManager)
+			err := brokerRds.ReconcileResourceTagsForAllRDSDatabases(context.TODO(), c, db, rdsClient, logsClient, tagManager, slog.Default())
 			if err != nil {
 				return err
 			}
 		}
 		if slices.Contains(services, "elasticache") {
 			elasticacheClient := elasticache.NewFromConfig(cfg)
-			err := tasksElasticache.ReconcileElasticacheResourceTags(c, db, elasticacheClient, tagManager)
+			err := brokerRedis.ReconcileElasticacheResourceTags(context.TODO(), c, db, elasticacheClient, tagManager, slog.Default())
 			if err != nil {
 				return err
 			}
 		}
 		if slices.Contains(services, "elasticsearch") || slices.Contains(services, "opensearch") {
 			opensearchClient := opensearch.NewFromConfig(cfg)
-			err := tasksOpensearch.ReconcileOpensearchResourceTags(c, db, opensearchClient, tagManager)
+			err := brokerElasticsearch.ReconcileOpensearchResourceTags(context.TODO(), c, db, opensearchClient, tagManager, slog.Default())
 			if err != nil {
 				return err
 			}
@@ -119,7 +121,7 @@ func run() error {
 
 		if slices.Contains(services, "rds") {
 			rdsClient := rds.NewFromConfig(cfg)
-			err := tasksRds.ReconcileRDSCloudwatchLogGroups(logsClient, rdsClient, settings.DbNamePrefix, db)
+			err := brokerRds.ReconcileRDSCloudwatchLogGroups(context.TODO(), logsClient, rdsClient, settings.DbNamePrefix, db, slog.Default())
 			if err != nil {
 				return err
 			}
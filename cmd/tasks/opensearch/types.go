@@ -1,13 +0,0 @@
-package opensearch
-
-import (
-	"context"
-
-	"github.com/aws/aws-sdk-go-v2/service/opensearch"
-)
-
-type OpensearchClientInterface interface {
-	AddTags(ctx context.Context, params *opensearch.AddTagsInput, optFns ...func(*opensearch.Options)) (*opensearch.AddTagsOutput, error)
-	DescribeDomain(ctx context.Context, params *opensearch.DescribeDomainInput, optFns ...func(*opensearch.Options)) (*opensearch.DescribeDomainOutput, error)
-	ListTags(ctx context.Context, params *opensearch.ListTagsInput, optFns ...func(*opensearch.Options)) (*opensearch.ListTagsOutput, error)
-}
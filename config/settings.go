@@ -1,43 +1,77 @@
 package config
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/helpers"
 )
 
+// QueueSettings configures the River queue which works the jobs of a service.
+type QueueSettings struct {
+	// MaxWorkers is how many jobs from the queue each broker works at once.
+	MaxWorkers int
+	// JobTimeout is how long a job from the queue may run before it is cancelled.
+	JobTimeout time.Duration
+}
+
 // Settings stores settings used to run the application
 type Settings struct {
-	EncryptionKey             string
-	DbNamePrefix              string
-	DbShorthandPrefix         string
-	MaxAllocatedStorage       int64
-	DbConfig                  *db.DBConfig
-	Environment               string
-	Region                    string
-	PubliclyAccessibleFeature bool
-	EnableFunctionsFeature    bool
-	SnapshotsBucketName       string
-	SnapshotsRepoName         string
-	LastSnapshotName          string
-	CfApiUrl                  string
-	CfApiClientId             string
-	CfApiClientSecret         string
-	MaxBackupRetention        int64
-	MinBackupRetention        int64
-	pollAwsMaxDurationSeconds int64
-	PollAwsMaxDuration        time.Duration
-	pollAwsMinDelaySeconds    int64
-	PollAwsMinDelay           time.Duration
-	PollAwsMaxRetries         int64
-	Port                      string
-	LogLevel                  slog.Level
+	EncryptionKey               string
+	EncryptionKeyID             string
+	PreviousEncryptionKeys      map[string]string
+	KMSKeyID                    string
+	MasterKeyFile               string
+	KeyProvider                 helpers.KeyProvider
+	DbNamePrefix                string
+	DbShorthandPrefix           string
+	MaxAllocatedStorage         int64
+	DbConfig                    *db.DBConfig
+	Environment                 string
+	Region                      string
+	PubliclyAccessibleFeature   bool
+	EnableFunctionsFeature      bool
+	HealthCheckAWSFeature       bool
+	MigrateOnStartup            bool
+	SnapshotsBucketName         string
+	SnapshotsRepoName           string
+	LastSnapshotName            string
+	CfApiUrl                    string
+	CfApiClientId               string
+	CfApiClientSecret           string
+	MaxBackupRetention          int64
+	MinBackupRetention          int64
+	pollAwsMaxDurationSeconds   int64
+	PollAwsMaxDuration          time.Duration
+	pollAwsMinDelaySeconds      int64
+	PollAwsMinDelay             time.Duration
+	PollAwsMaxRetries           int64
+	httpStopTimeoutSeconds      int64
+	HTTPStopTimeout             time.Duration
+	riverStopSoftTimeoutSeconds int64
+	RiverStopSoftTimeout        time.Duration
+	riverStopHardTimeoutSeconds int64
+	RiverStopHardTimeout        time.Duration
+	RDSQueue                    QueueSettings
+	RedisQueue                  QueueSettings
+	OpenSearchQueue             QueueSettings
+	reconcileIntervalSeconds    int64
+	ReconcileInterval           time.Duration
+	ReconcileQueueMaxWorkers    int
+	finalSnapshotRetentionDays  int64
+	FinalSnapshotRetention      time.Duration
+	Port                        string
+	AdminPort                   string
+	LogLevel                    slog.Level
 }
 
 // LoadFromEnv loads settings from environment variables
@@ -75,11 +109,50 @@ func (s *Settings) LoadFromEnv() error {
 
 	s.DbConfig = &dbConfig
 
-	// Load Encryption Key
+	// Secrets are encrypted with data keys wrapped by an AWS KMS key, or by a
+	// master key read from a file for local development. The KMS key provider
+	// needs the AWS config, so it is set by the caller.
+	s.KMSKeyID = os.Getenv("KMS_KEY_ID")
+	s.MasterKeyFile = os.Getenv("MASTER_KEY_FILE")
+	if s.KMSKeyID != "" && s.MasterKeyFile != "" {
+		return errors.New("only one of KMS_KEY_ID and MASTER_KEY_FILE can be set")
+	}
+	if s.MasterKeyFile != "" {
+		s.KeyProvider, err = helpers.NewFileKeyProvider(s.MasterKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Load Encryption Key. Without a key provider, it encrypts the secrets.
+	// With one, it only decrypts the secrets stored before, until they are
+	// re-encrypted.
 	if val, ok := os.LookupEnv("ENC_KEY"); ok {
 		s.EncryptionKey = val
-	} else {
-		return errors.New("an encryption key is required. Must specify ENC_KEY environment variable")
+	} else if s.KMSKeyID == "" && s.MasterKeyFile == "" {
+		return errors.New("an encryption key is required. Must specify ENC_KEY, KMS_KEY_ID or MASTER_KEY_FILE environment variable")
+	}
+
+	// The ID recorded with the secrets encrypted with ENC_KEY, "default" if it
+	// is not set. Secrets stored before IDs were recorded are decrypted with the
+	// key with the default ID.
+	s.EncryptionKeyID = os.Getenv("ENC_KEY_ID")
+
+	// Keys which were rotated out, as a comma separated list of ID:key pairs.
+	// They are only used to decrypt secrets until those are re-encrypted.
+	if val := os.Getenv("ENC_PREVIOUS_KEYS"); val != "" {
+		s.PreviousEncryptionKeys = map[string]string{}
+		for pair := range strings.SplitSeq(val, ",") {
+			id, key, ok := strings.Cut(pair, ":")
+			if !ok {
+				return errors.New("ENC_PREVIOUS_KEYS must be a comma separated list of ID:key pairs")
+			}
+			s.PreviousEncryptionKeys[id] = key
+		}
+	}
+
+	if err := s.Keyring().Validate(); err != nil {
+		return err
 	}
 
 	s.DbNamePrefix = os.Getenv("DB_PREFIX")
@@ -120,6 +193,20 @@ func (s *Settings) LoadFromEnv() error {
 		s.EnableFunctionsFeature = false
 	}
 
+	// Feature flag to include an AWS API call in the readiness check
+	if _, ok := os.LookupEnv("HEALTH_CHECK_AWS"); ok {
+		s.HealthCheckAWSFeature = true
+	} else {
+		s.HealthCheckAWSFeature = false
+	}
+
+	// Apply pending database migrations on startup instead of refusing to start
+	if _, ok := os.LookupEnv("MIGRATE_ON_STARTUP"); ok {
+		s.MigrateOnStartup = true
+	} else {
+		s.MigrateOnStartup = false
+	}
+
 	// set the bucketname created by TF, empty string is ok.
 	// broker will check for nil and skip snaphot config
 	s.SnapshotsBucketName = os.Getenv("S3_SNAPSHOT_BUCKET")
@@ -212,6 +299,95 @@ func (s *Settings) LoadFromEnv() error {
 		s.PollAwsMaxRetries = 60
 	}
 
+	// Cloud Foundry kills the broker about 10 seconds after SIGTERM, so the
+	// default stop timeouts add up to less than that.
+	if val, ok := os.LookupEnv("HTTP_STOP_TIMEOUT_SECONDS"); ok {
+		s.httpStopTimeoutSeconds, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.httpStopTimeoutSeconds == 0 {
+		s.httpStopTimeoutSeconds = 3
+	}
+
+	s.HTTPStopTimeout = time.Duration(s.httpStopTimeoutSeconds) * time.Second
+
+	if val, ok := os.LookupEnv("RIVER_STOP_SOFT_TIMEOUT_SECONDS"); ok {
+		s.riverStopSoftTimeoutSeconds, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.riverStopSoftTimeoutSeconds == 0 {
+		s.riverStopSoftTimeoutSeconds = 4
+	}
+
+	s.RiverStopSoftTimeout = time.Duration(s.riverStopSoftTimeoutSeconds) * time.Second
+
+	if val, ok := os.LookupEnv("RIVER_STOP_HARD_TIMEOUT_SECONDS"); ok {
+		s.riverStopHardTimeoutSeconds, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.riverStopHardTimeoutSeconds == 0 {
+		s.riverStopHardTimeoutSeconds = 2
+	}
+
+	s.RiverStopHardTimeout = time.Duration(s.riverStopHardTimeoutSeconds) * time.Second
+
+	if s.RDSQueue, err = loadQueueSettings("RDS"); err != nil {
+		return err
+	}
+	if s.RedisQueue, err = loadQueueSettings("REDIS"); err != nil {
+		return err
+	}
+	if s.OpenSearchQueue, err = loadQueueSettings("OPENSEARCH"); err != nil {
+		return err
+	}
+
+	if val, ok := os.LookupEnv("RECONCILE_INTERVAL_SECONDS"); ok {
+		s.reconcileIntervalSeconds, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.reconcileIntervalSeconds == 0 {
+		s.reconcileIntervalSeconds = 24 * 60 * 60
+	}
+
+	s.ReconcileInterval = time.Duration(s.reconcileIntervalSeconds) * time.Second
+
+	// The periodic jobs run one at a time by default, as they are not urgent.
+	s.ReconcileQueueMaxWorkers = 1
+	if val, ok := os.LookupEnv("RECONCILE_QUEUE_MAX_WORKERS"); ok {
+		maxWorkers, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if maxWorkers > 0 {
+			s.ReconcileQueueMaxWorkers = maxWorkers
+		}
+	}
+
+	if val, ok := os.LookupEnv("RDS_FINAL_SNAPSHOT_RETENTION_DAYS"); ok {
+		s.finalSnapshotRetentionDays, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.finalSnapshotRetentionDays == 0 {
+		s.finalSnapshotRetentionDays = 30
+	}
+
+	s.FinalSnapshotRetention = time.Duration(s.finalSnapshotRetentionDays) * 24 * time.Hour
+
 	if val, ok := os.LookupEnv("PORT"); ok {
 		s.Port = val
 	}
@@ -220,6 +396,14 @@ func (s *Settings) LoadFromEnv() error {
 		s.Port = "3000"
 	}
 
+	if val, ok := os.LookupEnv("ADMIN_PORT"); ok {
+		s.AdminPort = val
+	}
+
+	if s.AdminPort == "" {
+		s.AdminPort = "3001"
+	}
+
 	levelString := os.Getenv("LOG_LEVEL")
 	err = s.LogLevel.UnmarshalText([]byte(levelString))
 	if err != nil {
@@ -228,3 +412,49 @@ func (s *Settings) LoadFromEnv() error {
 
 	return nil
 }
+
+// loadQueueSettings loads the settings of a service's job queue from the
+// <prefix>_QUEUE_MAX_WORKERS and <prefix>_JOB_TIMEOUT_SECONDS environment variables.
+func loadQueueSettings(prefix string) (QueueSettings, error) {
+	queue := QueueSettings{
+		// Run as many workers as we have CPU cores available.
+		MaxWorkers: runtime.GOMAXPROCS(0),
+		JobTimeout: 4 * time.Hour,
+	}
+
+	if val, ok := os.LookupEnv(prefix + "_QUEUE_MAX_WORKERS"); ok {
+		maxWorkers, err := strconv.Atoi(val)
+		if err != nil {
+			return queue, err
+		}
+		if maxWorkers > 0 {
+			queue.MaxWorkers = maxWorkers
+		}
+	}
+
+	if val, ok := os.LookupEnv(prefix + "_JOB_TIMEOUT_SECONDS"); ok {
+		timeoutSeconds, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return queue, err
+		}
+		if timeoutSeconds > 0 {
+			queue.JobTimeout = time.Duration(timeoutSeconds) * time.Second
+		}
+	}
+
+	return queue, nil
+}
+
+// Keyring returns the keys used to encrypt the secrets stored by the broker.
+func (s *Settings) Keyring() *helpers.Keyring {
+	keys := helpers.NewKeyring(cmp.Or(s.EncryptionKeyID, helpers.LegacyKeyID), s.EncryptionKey, s.PreviousEncryptionKeys)
+	if s.KeyProvider != nil {
+		return keys.WithKeyProvider(s.KeyProvider)
+	}
+	return keys
+}
+
+// MaxJobTimeout returns the longest timeout of the job queues.
+func (s *Settings) MaxJobTimeout() time.Duration {
+	return max(s.RDSQueue.JobTimeout, s.RedisQueue.JobTimeout, s.OpenSearchQueue.JobTimeout)
+}
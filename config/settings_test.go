@@ -1,16 +1,21 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/helpers"
 	"github.com/go-test/deep"
 )
 
 func TestSettings(t *testing.T) {
 	t.Setenv("AWS_DEFAULT_REGION", "region-1")
-	t.Setenv("ENC_KEY", "fake-key")
+	t.Setenv("ENC_KEY", "fake-key-with-thirty-two-chars!!")
 	t.Setenv("CF_API_URL", "fake-api")
 	t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
 	t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
@@ -24,13 +29,14 @@ func TestSettings(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	defaultQueue := QueueSettings{MaxWorkers: runtime.GOMAXPROCS(0), JobTimeout: 4 * time.Hour}
 	expectedSettings := &Settings{
 		DbConfig: &db.DBConfig{
 			Port:    5432,
 			Sslmode: "require",
 		},
 		Region:                    "region-1",
-		EncryptionKey:             "fake-key",
+		EncryptionKey:             "fake-key-with-thirty-two-chars!!",
 		DbNamePrefix:              "db",
 		DbShorthandPrefix:         "db",
 		MaxAllocatedStorage:       1024,
@@ -46,7 +52,17 @@ func TestSettings(t *testing.T) {
 		PollAwsMinDelay:           30 * time.Second,
 		PollAwsMaxDuration:        7200 * time.Second,
 		PollAwsMaxRetries:         60,
+		HTTPStopTimeout:           3 * time.Second,
+		RiverStopSoftTimeout:      4 * time.Second,
+		RiverStopHardTimeout:      2 * time.Second,
+		RDSQueue:                  defaultQueue,
+		RedisQueue:                defaultQueue,
+		OpenSearchQueue:           defaultQueue,
+		ReconcileInterval:         24 * time.Hour,
+		ReconcileQueueMaxWorkers:  1,
+		FinalSnapshotRetention:    30 * 24 * time.Hour,
 		Port:                      "3000",
+		AdminPort:                 "3001",
 	}
 	if diff := deep.Equal(settings, expectedSettings); diff != nil {
 		t.Error(diff)
@@ -55,7 +71,7 @@ func TestSettings(t *testing.T) {
 
 func TestSettingsPort(t *testing.T) {
 	t.Setenv("AWS_DEFAULT_REGION", "region-1")
-	t.Setenv("ENC_KEY", "fake-key")
+	t.Setenv("ENC_KEY", "fake-key-with-thirty-two-chars!!")
 	t.Setenv("CF_API_URL", "fake-api")
 	t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
 	t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
@@ -70,13 +86,14 @@ func TestSettingsPort(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	defaultQueue := QueueSettings{MaxWorkers: runtime.GOMAXPROCS(0), JobTimeout: 4 * time.Hour}
 	expectedSettings := &Settings{
 		DbConfig: &db.DBConfig{
 			Port:    5432,
 			Sslmode: "require",
 		},
 		Region:                    "region-1",
-		EncryptionKey:             "fake-key",
+		EncryptionKey:             "fake-key-with-thirty-two-chars!!",
 		DbNamePrefix:              "db",
 		DbShorthandPrefix:         "db",
 		MaxAllocatedStorage:       1024,
@@ -92,9 +109,220 @@ func TestSettingsPort(t *testing.T) {
 		PollAwsMinDelay:           30 * time.Second,
 		PollAwsMaxDuration:        7200 * time.Second,
 		PollAwsMaxRetries:         60,
+		HTTPStopTimeout:           3 * time.Second,
+		RiverStopSoftTimeout:      4 * time.Second,
+		RiverStopHardTimeout:      2 * time.Second,
+		RDSQueue:                  defaultQueue,
+		RedisQueue:                defaultQueue,
+		OpenSearchQueue:           defaultQueue,
+		ReconcileInterval:         24 * time.Hour,
+		ReconcileQueueMaxWorkers:  1,
+		FinalSnapshotRetention:    30 * 24 * time.Hour,
 		Port:                      "5000",
+		AdminPort:                 "3001",
 	}
 	if diff := deep.Equal(settings, expectedSettings); diff != nil {
 		t.Error(diff)
 	}
 }
+
+func TestSettingsQueues(t *testing.T) {
+	t.Setenv("AWS_DEFAULT_REGION", "region-1")
+	t.Setenv("ENC_KEY", "fake-key-with-thirty-two-chars!!")
+	t.Setenv("CF_API_URL", "fake-api")
+	t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
+	t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("DB_TYPE", "")
+	t.Setenv("RDS_QUEUE_MAX_WORKERS", "2")
+	t.Setenv("RDS_JOB_TIMEOUT_SECONDS", "86400")
+	t.Setenv("REDIS_QUEUE_MAX_WORKERS", "8")
+
+	settings := &Settings{}
+	err := settings.LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := deep.Equal(settings.RDSQueue, QueueSettings{MaxWorkers: 2, JobTimeout: 24 * time.Hour}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(settings.RedisQueue, QueueSettings{MaxWorkers: 8, JobTimeout: 4 * time.Hour}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(settings.OpenSearchQueue, QueueSettings{MaxWorkers: runtime.GOMAXPROCS(0), JobTimeout: 4 * time.Hour}); diff != nil {
+		t.Error(diff)
+	}
+	if settings.MaxJobTimeout() != 24*time.Hour {
+		t.Errorf("expected the longest job timeout to be 24h, got %s", settings.MaxJobTimeout())
+	}
+
+	t.Setenv("REDIS_QUEUE_MAX_WORKERS", "many")
+	if err := settings.LoadFromEnv(); err == nil {
+		t.Error("expected error for invalid max workers")
+	}
+}
+
+func TestSettingsReconcileInterval(t *testing.T) {
+	t.Setenv("AWS_DEFAULT_REGION", "region-1")
+	t.Setenv("ENC_KEY", "fake-key-with-thirty-two-chars!!")
+	t.Setenv("CF_API_URL", "fake-api")
+	t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
+	t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("DB_TYPE", "")
+	t.Setenv("RECONCILE_INTERVAL_SECONDS", "3600")
+	t.Setenv("RECONCILE_QUEUE_MAX_WORKERS", "2")
+
+	settings := &Settings{}
+	err := settings.LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.ReconcileInterval != time.Hour {
+		t.Errorf("expected reconcile interval of 1h, got %s", settings.ReconcileInterval)
+	}
+	if settings.ReconcileQueueMaxWorkers != 2 {
+		t.Errorf("expected 2 reconcile queue workers, got %d", settings.ReconcileQueueMaxWorkers)
+	}
+}
+
+func TestSettingsEncryptionKeys(t *testing.T) {
+	testCases := map[string]struct {
+		keyID        string
+		previousKeys string
+		expectedKeys map[string]string
+		expectErr    bool
+	}{
+		"previous keys": {
+			keyID:        "key-2",
+			previousKeys: "default:1234567890123456,key-1:12345678901234567890123456789012",
+			expectedKeys: map[string]string{
+				"default": "1234567890123456",
+				"key-1":   "12345678901234567890123456789012",
+			},
+		},
+		"malformed previous keys": {
+			keyID:        "key-2",
+			previousKeys: "1234567890123456",
+			expectErr:    true,
+		},
+		"invalid previous key": {
+			keyID:        "key-2",
+			previousKeys: "key-1:fake-key",
+			expectErr:    true,
+		},
+		"invalid key ID": {
+			keyID:     "key_2",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("AWS_DEFAULT_REGION", "region-1")
+			t.Setenv("ENC_KEY", "fake-key-with-thirty-two-chars!!")
+			t.Setenv("ENC_KEY_ID", test.keyID)
+			t.Setenv("ENC_PREVIOUS_KEYS", test.previousKeys)
+			t.Setenv("CF_API_URL", "fake-api")
+			t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
+			t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
+			t.Setenv("DB_SSLMODE", "")
+			t.Setenv("DB_TYPE", "")
+
+			settings := &Settings{}
+			err := settings.LoadFromEnv()
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if settings.EncryptionKeyID != test.keyID {
+				t.Errorf("expected key ID %s, got %s", test.keyID, settings.EncryptionKeyID)
+			}
+			if diff := deep.Equal(settings.PreviousEncryptionKeys, test.expectedKeys); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSettingsKeyProvider(t *testing.T) {
+	masterKeyFile := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(masterKeyFile, []byte("12345678901234567890123456789012"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		encKey             string
+		kmsKeyID           string
+		masterKeyFile      string
+		expectErr          bool
+		expectFileProvider bool
+	}{
+		"master key file": {
+			masterKeyFile:      masterKeyFile,
+			expectFileProvider: true,
+		},
+		"master key file and previous key": {
+			encKey:             "fake-key-with-thirty-two-chars!!",
+			masterKeyFile:      masterKeyFile,
+			expectFileProvider: true,
+		},
+		"KMS key": {
+			kmsKeyID: "alias/broker",
+		},
+		"KMS key and master key file": {
+			kmsKeyID:      "alias/broker",
+			masterKeyFile: masterKeyFile,
+			expectErr:     true,
+		},
+		"missing master key file": {
+			masterKeyFile: filepath.Join(t.TempDir(), "missing.key"),
+			expectErr:     true,
+		},
+		"no key": {
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("AWS_DEFAULT_REGION", "region-1")
+			t.Setenv("ENC_KEY", test.encKey)
+			if test.encKey == "" {
+				os.Unsetenv("ENC_KEY")
+			}
+			t.Setenv("KMS_KEY_ID", test.kmsKeyID)
+			t.Setenv("MASTER_KEY_FILE", test.masterKeyFile)
+			t.Setenv("CF_API_URL", "fake-api")
+			t.Setenv("CF_API_CLIENT_ID", "fake-client-id")
+			t.Setenv("CF_API_CLIENT_SECRET", "fake-client-secret")
+			t.Setenv("DB_SSLMODE", "")
+			t.Setenv("DB_TYPE", "")
+
+			settings := &Settings{}
+			err := settings.LoadFromEnv()
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if _, ok := settings.KeyProvider.(*helpers.FileKeyProvider); ok != test.expectFileProvider {
+				t.Errorf("expected file key provider: %t, got %T", test.expectFileProvider, settings.KeyProvider)
+			}
+			if test.expectFileProvider {
+				encrypted, err := settings.Keyring().Encrypt("secret")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(encrypted, "envelope:") {
+					t.Errorf("expected secret to be encrypted with a data key, got %s", encrypted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaBehind is returned by Migrator.CheckCurrent when migrations have not
+// been applied to the database.
+var ErrSchemaBehind = errors.New("database schema is behind, run `aws-broker migrate up`")
+
+// Migration is a versioned change to the schema or data of the broker
+// database. Migrations are applied in order of version and must not be changed
+// once released, so they should not use the broker's models, which keep
+// changing: declare the columns a migration works with in the migration.
+//
+// Each step runs in a transaction with the record of the migration. MySQL
+// commits schema changes immediately though, so steps should be safe to run
+// again after a failure.
+type Migration struct {
+	Version     int
+	Description string
+	// Up applies the migration.
+	Up func(tx *gorm.DB) error
+	// Down reverts the migration. Migrations which cannot be reverted leave it
+	// nil.
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration is the record of a migration applied to the database.
+type SchemaMigration struct {
+	Version     int `gorm:"primaryKey;autoIncrement:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus is a migration and whether it has been applied.
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is nil if the migration has not been applied.
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts migrations, recording the versions applied in
+// the schema_migrations table.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+// NewMigrator returns a Migrator for the migrations, which must be ordered by
+// strictly increasing, positive versions.
+func NewMigrator(db *gorm.DB, migrations []Migration, logger *slog.Logger) (*Migrator, error) {
+	for i, migration := range migrations {
+		if migration.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has invalid version %d", migration.Description, migration.Version)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("migration %d is out of order, it follows migration %d", migration.Version, migrations[i-1].Version)
+		}
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up step", migration.Version)
+		}
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		logger:     logger,
+	}, nil
+}
+
+// LatestVersion returns the version of the last migration, or 0 if there are
+// none.
+func (m *Migrator) LatestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status returns every migration with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			s.AppliedAt = &record.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Pending returns the migrations which have not been applied.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// CheckCurrent returns an error wrapping ErrSchemaBehind if any migration has
+// not been applied.
+func (m *Migrator) CheckCurrent(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	versions := make([]int, 0, len(pending))
+	for _, migration := range pending {
+		versions = append(versions, migration.Version)
+	}
+	return fmt.Errorf("%w: pending migrations %v", ErrSchemaBehind, versions)
+}
+
+// Up applies the pending migrations up to and including the target version.
+// A target of 0 applies every pending migration.
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	if target == 0 {
+		target = m.LatestVersion()
+	}
+	if err := m.checkVersion(target); err != nil {
+		return err
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range pending {
+		if migration.Version > target {
+			break
+		}
+		m.logger.Info("applying migration", "version", migration.Version, "description", migration.Description)
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %d: %w", migration.Version, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the applied migrations newer than the target version, newest
+// first. A target of 0 reverts every migration. It returns an error without
+// reverting anything if any of those migrations cannot be reverted.
+func (m *Migrator) Down(ctx context.Context, target int) error {
+	if target != 0 {
+		if err := m.checkVersion(target); err != nil {
+			return err
+		}
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	// Nothing is reverted unless every migration newer than the target can be,
+	// so the schema is not left between versions.
+	var revert []Migration
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= target {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d cannot be reverted", migration.Version)
+		}
+		revert = append(revert, migration)
+	}
+
+	for _, migration := range revert {
+		m.logger.Info("reverting migration", "version", migration.Version, "description", migration.Description)
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error reverting migration %d: %w", migration.Version, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) checkVersion(version int) error {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown migration version %d", version)
+}
+
+// applied returns the records of the applied migrations by version, creating
+// the schema_migrations table if it does not exist yet.
+func (m *Migrator) applied(ctx context.Context) (map[int]SchemaMigration, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	var records []SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	for version := range applied {
+		if m.checkVersion(version) != nil {
+			// The database was migrated by a newer release of the broker. Newer
+			// migrations are expected to stay compatible with the previous
+			// release, so this is not an error.
+			m.logger.Warn("database has a migration applied which is unknown to this release", "version", version)
+		}
+	}
+	return applied, nil
+}
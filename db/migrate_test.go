@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+type gadget struct {
+	ID uint
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "create widgets",
+			Up:          func(tx *gorm.DB) error { return tx.Migrator().CreateTable(&widget{}) },
+			Down:        func(tx *gorm.DB) error { return tx.Migrator().DropTable(&widget{}) },
+		},
+		{
+			Version:     2,
+			Description: "create gadgets",
+			Up:          func(tx *gorm.DB) error { return tx.Migrator().CreateTable(&gadget{}) },
+			Down:        func(tx *gorm.DB) error { return tx.Migrator().DropTable(&gadget{}) },
+		},
+	}
+}
+
+func setupMigrator(t *testing.T, migrations []Migration) (*gorm.DB, *Migrator) {
+	db, err := DBInit(&DBConfig{DbType: "sqlite3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The in-memory database is shared between tests, so start from an empty
+	// database.
+	if err := db.Migrator().DropTable(&widget{}, &gadget{}, &SchemaMigration{}); err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := NewMigrator(db, migrations, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, migrator
+}
+
+func TestNewMigratorValidatesOrder(t *testing.T) {
+	migrations := testMigrations()
+	migrations[1].Version = 1
+	_, err := NewMigrator(nil, migrations, slog.Default())
+	if err == nil {
+		t.Fatal("expected error for migrations out of order")
+	}
+
+	migrations = testMigrations()
+	migrations[0].Up = nil
+	_, err = NewMigrator(nil, migrations, slog.Default())
+	if err == nil {
+		t.Fatal("expected error for migration without up step")
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db, migrator := setupMigrator(t, testMigrations())
+
+	err := migrator.CheckCurrent(ctx)
+	if !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("expected schema to be behind, got %v", err)
+	}
+
+	if err := migrator.Up(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable(&widget{}) || db.Migrator().HasTable(&gadget{}) {
+		t.Fatal("expected only migration 1 to be applied")
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("expected migration 2 to be pending, got %+v", pending)
+	}
+
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.CheckCurrent(ctx); err != nil {
+		t.Fatalf("expected schema to be current, got %v", err)
+	}
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %d to be applied", s.Version)
+		}
+	}
+
+	if err := migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable(&widget{}) || db.Migrator().HasTable(&gadget{}) {
+		t.Fatal("expected only migration 2 to be reverted")
+	}
+
+	if err := migrator.Down(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable(&widget{}) {
+		t.Fatal("expected every migration to be reverted")
+	}
+}
+
+func TestMigrateUpFailure(t *testing.T) {
+	ctx := context.Background()
+	migrations := testMigrations()
+	migrations[1].Up = func(tx *gorm.DB) error {
+		return errors.New("failed")
+	}
+	_, migrator := setupMigrator(t, migrations)
+
+	if err := migrator.Up(ctx, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("expected failed migration to be pending, got %+v", pending)
+	}
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	_, migrator := setupMigrator(t, testMigrations())
+
+	if err := migrator.Up(ctx, 3); err == nil {
+		t.Fatal("expected error for unknown target version")
+	}
+	if err := migrator.Down(ctx, 3); err == nil {
+		t.Fatal("expected error for unknown target version")
+	}
+}
+
+func TestMigrateDownIrreversible(t *testing.T) {
+	ctx := context.Background()
+	migrations := testMigrations()
+	migrations[0].Down = nil
+	db, migrator := setupMigrator(t, migrations)
+
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Down(ctx, 0); err == nil {
+		t.Fatal("expected error reverting irreversible migration")
+	}
+	if !db.Migrator().HasTable(&widget{}) {
+		t.Fatal("expected irreversible migration to stay applied")
+	}
+	// The newer migration is not reverted either.
+	if !db.Migrator().HasTable(&gadget{}) {
+		t.Fatal("expected migration after the irreversible one to stay applied")
+	}
+}
@@ -0,0 +1,209 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/db"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// The baseline migration creates the tables as the broker's models defined them
+// when the schema was migrated with AutoMigrate on every start. AutoMigrate
+// only adds what is missing, so the baseline also adopts databases created by
+// those releases. It cannot be reverted, as that would drop every instance and
+// binding the broker manages.
+
+type baselineInstance struct {
+	Uuid string `gorm:"primaryKey"`
+
+	ServiceID        string
+	PlanID           string
+	OrganizationGUID string
+	SpaceGUID        string
+
+	Host string
+	Port int64
+
+	State uint8
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineInstance) TableName() string { return "instances" }
+
+type baselineBinding struct {
+	InstanceUuid string `gorm:"primaryKey"`
+	BindingID    string `gorm:"primaryKey"`
+	AppGUID      string
+	Parameters   string `gorm:"type:text"`
+	Credentials  string `gorm:"type:text"`
+	Salt         string
+
+	CreatedAt time.Time
+}
+
+func (baselineBinding) TableName() string { return "bindings" }
+
+type baselineRDSInstance struct {
+	Instance baselineInstance `gorm:"embedded"`
+
+	Database string
+	Username string
+	Password string
+	Salt     string
+
+	Tags string
+
+	BackupRetentionPeriod int64
+	AllocatedStorage      int64
+
+	Adapter string
+
+	DbType       string
+	DbVersion    string
+	LicenseModel string
+
+	EnableFunctions    bool
+	BinaryLogFormat    string
+	EnablePgCron       *bool
+	LongQueryTime      *float64
+	PgQueryLogging     string
+	ParameterGroupName string
+	OptionGroupName    string
+
+	EnabledCloudwatchLogGroupExports pq.StringArray `gorm:"type:text[]"`
+
+	StorageType string
+
+	ReplicaDatabase     string
+	ReplicaDatabaseHost string
+}
+
+func (baselineRDSInstance) TableName() string { return "rds_instances" }
+
+type baselineRDSBinding struct {
+	BindingID  string `gorm:"primaryKey"`
+	InstanceID string `gorm:"index"`
+	Username   string
+	Password   string
+	Salt       string
+	CreatedAt  time.Time
+}
+
+func (baselineRDSBinding) TableName() string { return "rds_bindings" }
+
+type baselineRedisInstance struct {
+	Instance baselineInstance `gorm:"embedded"`
+
+	Description string
+
+	Password string
+	Salt     string
+
+	Engine                     string
+	EngineVersion              string
+	ClusterID                  string
+	CacheNodeType              string
+	NumCacheClusters           int
+	ParameterGroup             string
+	PreferredMaintenanceWindow string
+	SnapshotWindow             string
+	SnapshotRetentionLimit     int
+	AutomaticFailoverEnabled   bool
+
+	ParameterGroupName string
+
+	EngineLogsGroupName string
+	SlowLogsGroupName   string
+}
+
+func (baselineRedisInstance) TableName() string { return "redis_instances" }
+
+type baselineElasticsearchInstance struct {
+	Instance baselineInstance `gorm:"embedded"`
+
+	Description string
+
+	Password                       string
+	Salt                           string
+	AccessKey                      string
+	SecretKey                      string
+	IamPolicy                      string
+	IamPolicyARN                   string
+	AccessControlPolicy            string
+	ElasticsearchVersion           string
+	TargetElasticsearchVersion     string
+	MasterCount                    int
+	DataCount                      int
+	InstanceType                   string
+	MasterInstanceType             string
+	VolumeSize                     int
+	VolumeType                     string
+	MasterEnabled                  bool
+	NodeToNodeEncryption           bool
+	EncryptAtRest                  bool
+	AutomatedSnapshotStartHour     int
+	Bucket                         string
+	BrokerSnapshotsEnabled         bool
+	SnapshotARN                    string
+	SnapshotPolicyARN              string
+	SnapshotPath                   string
+	IamPassRolePolicyARN           string
+	IndicesFieldDataCacheSize      string
+	IndicesQueryBoolMaxClauseCount string
+
+	Domain string
+	ARN    string
+
+	SearchSlowLogsGroupARN string
+	IndexSlowLogsGroupARN  string
+	ErrorLogsGroupARN      string
+	AuditLogsGroupARN      string
+}
+
+func (baselineElasticsearchInstance) TableName() string { return "elasticsearch_instances" }
+
+type baselineAsyncJobMsg struct {
+	BrokerId   string `gorm:"primaryKey; not null"`
+	InstanceId string `gorm:"primaryKey; not null"`
+	JobType    uint8  `gorm:"primaryKey; not null"`
+	State      uint8
+	Message    string
+}
+
+func (baselineAsyncJobMsg) TableName() string { return "async_job_msgs" }
+
+type baselineOperationLogEntry struct {
+	ID          uint   `gorm:"primaryKey; autoIncrement"`
+	BrokerId    string `gorm:"not null; index:idx_operation_log_instance"`
+	InstanceId  string `gorm:"not null; index:idx_operation_log_instance"`
+	JobType     uint8  `gorm:"not null"`
+	OperationID string `gorm:"index"`
+	JobID       int64
+	State       uint8
+	Message     string `gorm:"type:text"`
+	CreatedAt   time.Time
+}
+
+func (baselineOperationLogEntry) TableName() string { return "operation_log_entries" }
+
+var baselineModels = []any{
+	&baselineRDSInstance{},
+	&baselineRDSBinding{},
+	&baselineRedisInstance{},
+	&baselineElasticsearchInstance{},
+	&baselineInstance{},
+	&baselineBinding{},
+	&baselineAsyncJobMsg{},
+	&baselineOperationLogEntry{},
+}
+
+var baseline = db.Migration{
+	Version:     1,
+	Description: "create the broker tables",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(baselineModels...)
+	},
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// brokerJob is a job stored in the broker database, which holds the jobs when
+// the broker database is MySQL, as River has no MySQL driver.
+type brokerJob struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	Kind        string `gorm:"not null"`
+	Queue       string `gorm:"not null;index:idx_broker_jobs_fetch,priority:1"`
+	State       string `gorm:"not null;index:idx_broker_jobs_fetch,priority:2"`
+	InstanceID  string `gorm:"index"`
+	Args        []byte
+	Errors      []byte
+	Attempt     int
+	MaxAttempts int
+	AttemptedBy []byte
+	CreatedAt   time.Time
+	ScheduledAt time.Time `gorm:"index:idx_broker_jobs_fetch,priority:3"`
+	AttemptedAt *time.Time
+	FinalizedAt *time.Time
+}
+
+func (brokerJob) TableName() string { return "broker_jobs" }
+
+// brokerLeader records which of the brokers sharing a MySQL database inserts
+// the periodic jobs.
+type brokerLeader struct {
+	Name      string    `gorm:"primaryKey;size:64"`
+	LeaderID  string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+func (brokerLeader) TableName() string { return "broker_leaders" }
+
+// brokerJobs creates the tables on every type of database, although only
+// brokers using MySQL store jobs in them. Brokers which created the tables on
+// startup before this migration keep their jobs, as AutoMigrate only adds
+// what is missing.
+var brokerJobs = db.Migration{
+	Version:     7,
+	Description: "create the broker jobs and leaders tables",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&brokerJob{}, &brokerLeader{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&brokerLeader{}, &brokerJob{})
+	},
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// jobCheckpoint records the steps completed by an asynchronous job, so that a
+// retry of the job resumes after the last completed step.
+type jobCheckpoint struct {
+	ID        uint   `gorm:"primaryKey; autoIncrement"`
+	JobID     int64  `gorm:"not null; uniqueIndex:idx_job_checkpoints_step"`
+	Step      string `gorm:"not null; size:255; uniqueIndex:idx_job_checkpoints_step"`
+	State     []byte
+	CreatedAt time.Time
+}
+
+func (jobCheckpoint) TableName() string { return "job_checkpoints" }
+
+var jobCheckpoints = db.Migration{
+	Version:     2,
+	Description: "create the job checkpoints table",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&jobCheckpoint{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&jobCheckpoint{})
+	},
+}
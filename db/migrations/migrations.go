@@ -0,0 +1,20 @@
+// Package migrations holds the versioned migrations of the broker database.
+//
+// To change the schema, add a migration to the end of All with the next
+// version, and never change a migration once it has been released.
+package migrations
+
+import (
+	"github.com/cloud-gov/aws-broker/db"
+)
+
+// All is every migration of the broker database, in order.
+var All = []db.Migration{
+	baseline,
+	jobCheckpoints,
+	rdsDbName,
+	rdsSnapshots,
+	rdsMaxAllocatedStorage,
+	rdsProvisionedStorage,
+	brokerJobs,
+}
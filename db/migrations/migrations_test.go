@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
+	"github.com/cloud-gov/aws-broker/services/elasticsearch"
+	"github.com/cloud-gov/aws-broker/services/rds"
+	"github.com/cloud-gov/aws-broker/services/redis"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"gorm.io/gorm"
+)
+
+// models are the broker's models stored in tables created by migrations.
+var models = []any{
+	&rds.RDSInstance{},
+	&rds.RDSBinding{},
+	&rds.RDSSnapshot{},
+	&redis.RedisInstance{},
+	&elasticsearch.ElasticsearchInstance{},
+	&base.Instance{},
+	&base.Binding{},
+	&asyncmessage.AsyncJobMsg{},
+	&asyncmessage.OperationLogEntry{},
+	&steps.Checkpoint{},
+	&queue.Job{},
+	&queue.Leader{},
+}
+
+// TestMigrationsMatchModels checks that the migrations create a column for
+// every field of the models, so a field cannot be added without a migration.
+func TestMigrationsMatchModels(t *testing.T) {
+	ctx := context.Background()
+	brokerDB, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := db.NewMigrator(brokerDB, All, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range models {
+		stmt := brokerDB.Model(model).Statement
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !brokerDB.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("table %s has no column for field %s, add a migration", stmt.Schema.Table, field.Name)
+			}
+		}
+	}
+
+	// Every migration after the baseline can be reverted and applied again.
+	baselineTables := map[string]bool{}
+	for _, model := range baselineModels {
+		baselineTables[tableName(t, brokerDB, model)] = true
+	}
+	if err := migrator.Down(ctx, baseline.Version); err != nil {
+		t.Fatal(err)
+	}
+	for _, model := range models {
+		table := tableName(t, brokerDB, model)
+		if brokerDB.Migrator().HasTable(model) != baselineTables[table] {
+			t.Errorf("expected table %s to exist after reverting to the baseline: %t", table, baselineTables[table])
+		}
+	}
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The baseline cannot be reverted.
+	if err := migrator.Down(ctx, 0); err == nil {
+		t.Fatal("expected error reverting the baseline migration")
+	}
+	for _, model := range models {
+		if !brokerDB.Migrator().HasTable(model) {
+			t.Errorf("expected table for %T to be kept", model)
+		}
+	}
+}
+
+func tableName(t *testing.T, brokerDB *gorm.DB, model any) string {
+	stmt := brokerDB.Model(model).Statement
+	if err := stmt.Parse(model); err != nil {
+		t.Fatal(err)
+	}
+	return stmt.Schema.Table
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// rdsInstanceDbName is the column added to the RDS instances for the name of
+// the database of an instance restored from the backup of another instance.
+type rdsInstanceDbName struct {
+	DbName string
+}
+
+func (rdsInstanceDbName) TableName() string { return "rds_instances" }
+
+var rdsDbName = db.Migration{
+	Version:     3,
+	Description: "add the database name to RDS instances",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&rdsInstanceDbName{}, "DbName")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&rdsInstanceDbName{}, "DbName")
+	},
+}
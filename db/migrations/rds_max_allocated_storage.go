@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// rdsInstanceMaxAllocatedStorage is the column added to the RDS instances for
+// the limit up to which RDS grows their storage.
+type rdsInstanceMaxAllocatedStorage struct {
+	MaxAllocatedStorage *int64
+}
+
+func (rdsInstanceMaxAllocatedStorage) TableName() string { return "rds_instances" }
+
+var rdsMaxAllocatedStorage = db.Migration{
+	Version:     5,
+	Description: "add the maximum allocated storage to RDS instances",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&rdsInstanceMaxAllocatedStorage{}, "MaxAllocatedStorage")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&rdsInstanceMaxAllocatedStorage{}, "MaxAllocatedStorage")
+	},
+}
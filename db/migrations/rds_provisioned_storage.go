@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// rdsInstanceProvisionedStorage is the columns added to the RDS instances for
+// the IOPS and throughput provisioned for their storage.
+type rdsInstanceProvisionedStorage struct {
+	Iops              *int64
+	StorageThroughput *int64
+}
+
+func (rdsInstanceProvisionedStorage) TableName() string { return "rds_instances" }
+
+var rdsProvisionedStorage = db.Migration{
+	Version:     6,
+	Description: "add the provisioned IOPS and storage throughput to RDS instances",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"Iops", "StorageThroughput"} {
+			if err := tx.Migrator().AddColumn(&rdsInstanceProvisionedStorage{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, column := range []string{"Iops", "StorageThroughput"} {
+			if err := tx.Migrator().DropColumn(&rdsInstanceProvisionedStorage{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
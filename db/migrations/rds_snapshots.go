@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/db"
+	"gorm.io/gorm"
+)
+
+// rdsInstanceFinalSnapshot is the column added to the RDS instances for the
+// parameter which turns the final snapshot of the database on or off.
+type rdsInstanceFinalSnapshot struct {
+	FinalSnapshot *bool
+}
+
+func (rdsInstanceFinalSnapshot) TableName() string { return "rds_instances" }
+
+// rdsSnapshot records a snapshot of the database of an RDS instance, which
+// outlives the instance.
+type rdsSnapshot struct {
+	Identifier       string `gorm:"primaryKey;size:255"`
+	InstanceID       string `gorm:"size:255;index"`
+	ServiceID        string `gorm:"size:255"`
+	PlanID           string `gorm:"size:255"`
+	OrganizationGUID string `gorm:"size:255"`
+	SpaceGUID        string `gorm:"size:255;index"`
+	Database         string `gorm:"size:255"`
+	DbName           string `gorm:"size:255"`
+	Username         string `gorm:"size:255"`
+	DbType           string `gorm:"size:255"`
+	DbVersion        string `gorm:"size:255"`
+	AllocatedStorage int64
+	CreatedAt        time.Time
+	ExpiresAt        *time.Time `gorm:"index"`
+}
+
+func (rdsSnapshot) TableName() string { return "rds_snapshots" }
+
+var rdsSnapshots = db.Migration{
+	Version:     4,
+	Description: "record the final snapshots of RDS instances",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&rdsInstanceFinalSnapshot{}, "FinalSnapshot"); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&rdsSnapshot{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&rdsSnapshot{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&rdsInstanceFinalSnapshot{}, "FinalSnapshot")
+	},
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cloud-gov/aws-broker/helpers"
+	"gorm.io/gorm"
+)
+
+const reencryptBatchSize = 100
+
+// SecretColumn is a column of a table which holds encrypted secrets.
+type SecretColumn struct {
+	Table  string
+	Column string
+	// SaltColumn holds the IV used to encrypt legacy secrets.
+	SaltColumn string
+	// Check returns whether a decrypted secret looks valid. Legacy secrets are
+	// not authenticated, so decrypting them with the wrong key returns garbage
+	// instead of an error, and re-encrypting that garbage would lose them.
+	Check func(plaintext string) bool
+	// LegacyPlaintext is set for columns whose secrets were stored in plain
+	// text before they were encrypted, instead of with AES-CFB.
+	LegacyPlaintext bool
+}
+
+// ReencryptSecrets re-encrypts the secrets in the column which are not
+// encrypted with the current key of the keyring, and returns how many were
+// re-encrypted. A secret is only replaced if it has not changed since it was
+// read, so secrets can be re-encrypted while the broker is running. Secrets which
+// cannot be re-encrypted are skipped, and returned as errors.
+func ReencryptSecrets(ctx context.Context, db *gorm.DB, keys *helpers.Keyring, column SecretColumn, logger *slog.Logger) (int, error) {
+	db = db.WithContext(ctx)
+
+	var reencrypted int
+	var errs []error
+	// Page through the secrets by value, which does not depend on the primary
+	// key of the table. The empty string is skipped, as are NULLs.
+	last := ""
+	for {
+		var rows []struct {
+			Secret string
+			Salt   string
+		}
+		err := db.Table(column.Table).
+			Select(fmt.Sprintf("%s AS secret, %s AS salt", column.Column, column.SaltColumn)).
+			Where(fmt.Sprintf("%s > ?", column.Column), last).
+			Order(column.Column).
+			Limit(reencryptBatchSize).
+			Scan(&rows).Error
+		if err != nil {
+			return reencrypted, errors.Join(append(errs, err)...)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			last = row.Secret
+			if keys.IsCurrent(row.Secret) {
+				continue
+			}
+
+			var plaintext string
+			var err error
+			if column.LegacyPlaintext && !helpers.IsEncrypted(row.Secret) {
+				plaintext = row.Secret
+			} else {
+				iv, _ := base64.StdEncoding.DecodeString(row.Salt)
+				plaintext, err = keys.Decrypt(row.Secret, iv)
+			}
+			if err == nil && column.Check != nil && !column.Check(plaintext) {
+				err = errors.New("decrypted secret is not valid, check the legacy encryption key")
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not decrypt secret in %s.%s: %w", column.Table, column.Column, err))
+				continue
+			}
+			encrypted, err := keys.Encrypt(plaintext)
+			if err != nil {
+				return reencrypted, errors.Join(append(errs, err)...)
+			}
+
+			result := db.Table(column.Table).
+				Where(fmt.Sprintf("%s = ?", column.Column), row.Secret).
+				Update(column.Column, encrypted)
+			if result.Error != nil {
+				return reencrypted, errors.Join(append(errs, result.Error)...)
+			}
+			reencrypted += int(result.RowsAffected)
+		}
+	}
+
+	logger.Info("re-encrypted secrets", "table", column.Table, "column", column.Column, "count", reencrypted, "errors", len(errs))
+	return reencrypted, errors.Join(errs...)
+}
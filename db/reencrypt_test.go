@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/cloud-gov/aws-broker/helpers"
+)
+
+type secret struct {
+	ID     uint
+	Secret string
+	Salt   string
+}
+
+// encryptCFB encrypts a secret the way the broker did before AES-GCM was used.
+func encryptCFB(t *testing.T, msg, key, salt string) string {
+	iv, _ := base64.StdEncoding.DecodeString(salt)
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, len(msg))
+	//nolint:staticcheck // SA1019: legacy secrets are encrypted with CFB.
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(dst, []byte(msg))
+	return base64.StdEncoding.EncodeToString(dst)
+}
+
+func TestReencryptSecrets(t *testing.T) {
+	ctx := context.Background()
+	db, err := DBInit(&DBConfig{DbType: "sqlite3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrator().DropTable(&secret{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&secret{}); err != nil {
+		t.Fatal(err)
+	}
+
+	legacyKey := helpers.RandStr(32)
+	oldKey := helpers.RandStr(32)
+	oldKeys := helpers.NewKeyring("key-1", oldKey, nil)
+	keys := helpers.NewKeyring("key-2", helpers.RandStr(32), map[string]string{
+		helpers.LegacyKeyID: legacyKey,
+		"key-1":             oldKey,
+	})
+
+	legacySalt := helpers.GenerateSalt(aes.BlockSize)
+	encryptedWithOldKey, _ := oldKeys.Encrypt("old-password")
+	encryptedWithCurrentKey, _ := keys.Encrypt("current-password")
+	invalidSalt := helpers.GenerateSalt(aes.BlockSize)
+	secrets := []secret{
+		{Secret: encryptCFB(t, "legacy-password", legacyKey, legacySalt), Salt: legacySalt},
+		{Secret: encryptedWithOldKey},
+		{Secret: encryptedWithCurrentKey},
+		{Secret: ""},
+		// Encrypted with a legacy key which is not in the keyring.
+		{Secret: encryptCFB(t, "lost-password", helpers.RandStr(32), invalidSalt), Salt: invalidSalt},
+	}
+	if err := db.Create(&secrets).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	column := SecretColumn{
+		Table:      "secrets",
+		Column:     "secret",
+		SaltColumn: "salt",
+		Check: func(plaintext string) bool {
+			for _, c := range []byte(plaintext) {
+				if c < 0x20 || c > 0x7e {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	count, err := ReencryptSecrets(ctx, db, keys, column, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		t.Error("expected error for secret encrypted with unknown legacy key")
+	}
+	if count != 2 {
+		t.Errorf("expected 2 secrets to be re-encrypted, got %d", count)
+	}
+
+	expected := []string{"legacy-password", "old-password", "current-password"}
+	for i, plaintext := range expected {
+		var row secret
+		if err := db.First(&row, secrets[i].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !keys.IsCurrent(row.Secret) {
+			t.Errorf("expected secret %d to be encrypted with the current key, got %s", i, row.Secret)
+		}
+		decrypted, err := keys.Decrypt(row.Secret, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("expected secret %d to decrypt to %s, got %s", i, plaintext, decrypted)
+		}
+	}
+	for _, i := range []int{2, 4} {
+		var unchanged secret
+		if err := db.First(&unchanged, secrets[i].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if unchanged.Secret != secrets[i].Secret {
+			t.Errorf("expected secret %d to be unchanged", i)
+		}
+	}
+
+	// Re-encrypting again has nothing left to do.
+	count, _ = ReencryptSecrets(ctx, db, keys, column, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if count != 0 {
+		t.Errorf("expected no secrets to be re-encrypted, got %d", count)
+	}
+}
+
+func TestReencryptLegacyPlaintextSecrets(t *testing.T) {
+	ctx := context.Background()
+	db, err := DBInit(&DBConfig{DbType: "sqlite3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrator().DropTable(&secret{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&secret{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := helpers.NewKeyring("key-1", helpers.RandStr(32), nil)
+	encrypted, _ := keys.Encrypt("encrypted-key")
+	secrets := []secret{
+		{Secret: "plaintext-key"},
+		{Secret: encrypted},
+	}
+	if err := db.Create(&secrets).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	column := SecretColumn{
+		Table:           "secrets",
+		Column:          "secret",
+		SaltColumn:      "salt",
+		LegacyPlaintext: true,
+	}
+	count, err := ReencryptSecrets(ctx, db, keys, column, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 secret to be encrypted, got %d", count)
+	}
+
+	var row secret
+	if err := db.First(&row, secrets[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := keys.Decrypt(row.Secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != "plaintext-key" {
+		t.Errorf("expected secret to decrypt to plaintext-key, got %s", decrypted)
+	}
+}
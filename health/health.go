@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+
+	// How long a single check may take before it is considered failed.
+	checkTimeout = 5 * time.Second
+
+	// River updates the queues worked by a running client every 10 minutes, so
+	// a queue which has not been updated for longer than this is not being
+	// worked.
+	queueStaleAfter = 30 * time.Minute
+)
+
+// Check is a named check of a dependency of the broker.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// RiverClient is the subset of the River client used to check it is running.
+type RiverClient interface {
+	Stopped() <-chan struct{}
+	QueueGet(ctx context.Context, name string) (*rivertype.Queue, error)
+}
+
+// STSClient is the subset of the STS client used to check AWS connectivity.
+type STSClient interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+type checkResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type response struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// Checker serves the health and readiness endpoints.
+type Checker struct {
+	liveness  []Check
+	readiness []Check
+	logger    *slog.Logger
+}
+
+// New returns a Checker. The liveness checks cover the dependencies the broker
+// cannot recover from losing without a restart, and are run by both endpoints.
+// The readiness checks cover the dependencies it needs to serve requests, and
+// are only run by the readiness endpoint.
+func New(logger *slog.Logger, liveness []Check, readiness []Check) *Checker {
+	return &Checker{
+		liveness:  liveness,
+		readiness: readiness,
+		logger:    logger,
+	}
+}
+
+// Healthz runs the liveness checks.
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	c.serve(w, r, c.liveness)
+}
+
+// Readyz runs the liveness and readiness checks.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	c.serve(w, r, append(append([]Check{}, c.liveness...), c.readiness...))
+}
+
+func (c *Checker) serve(w http.ResponseWriter, r *http.Request, checks []Check) {
+	res := response{
+		Status: statusOK,
+		Checks: map[string]checkResult{},
+	}
+	for _, check := range checks {
+		result := c.run(r.Context(), check)
+		if result.Status != statusOK {
+			res.Status = statusError
+		}
+		res.Checks[check.Name] = result
+	}
+
+	status := http.StatusOK
+	if res.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (c *Checker) run(ctx context.Context, check Check) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := checkResult{
+		Status:   statusOK,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("health: %s check failed", check.Name), "err", err)
+		result.Status = statusError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// DatabaseCheck pings the broker database.
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{
+		Name: "database",
+		Check: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// RiverCheck checks that the River client has not stopped and that each of
+// queues is being worked.
+func RiverCheck(client RiverClient, queues []string) Check {
+	return Check{
+		Name: "river",
+		Check: func(ctx context.Context) error {
+			select {
+			case <-client.Stopped():
+				return errors.New("river client is stopped")
+			default:
+			}
+
+			for _, name := range queues {
+				queue, err := client.QueueGet(ctx, name)
+				if err != nil {
+					return fmt.Errorf("could not get queue %s: %w", name, err)
+				}
+				if queue.PausedAt != nil {
+					return fmt.Errorf("queue %s is paused", queue.Name)
+				}
+				if time.Since(queue.UpdatedAt) > queueStaleAfter {
+					return fmt.Errorf("queue %s has not been worked since %s", queue.Name, queue.UpdatedAt.Format(time.RFC3339))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// AWSCheck checks that the broker can authenticate with AWS. GetCallerIdentity
+// requires no permissions, so it only fails if AWS cannot be reached or the
+// credentials are invalid.
+func AWSCheck(client STSClient) Check {
+	return Check{
+		Name: "aws",
+		Check: func(ctx context.Context) error {
+			_, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+			return err
+		},
+	}
+}
@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river/rivertype"
+)
+
+type mockRiverClient struct {
+	stopped  chan struct{}
+	queues   map[string]*rivertype.Queue
+	queueErr error
+}
+
+func (c *mockRiverClient) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+func (c *mockRiverClient) QueueGet(ctx context.Context, name string) (*rivertype.Queue, error) {
+	if c.queueErr != nil {
+		return nil, c.queueErr
+	}
+	queue, ok := c.queues[name]
+	if !ok {
+		return nil, rivertype.ErrNotFound
+	}
+	return queue, nil
+}
+
+type mockSTSClient struct {
+	err error
+}
+
+func (c *mockSTSClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{}, c.err
+}
+
+func doRequest(handler http.HandlerFunc) (*httptest.ResponseRecorder, response) {
+	res := httptest.NewRecorder()
+	handler(res, httptest.NewRequest("GET", "/", nil))
+	body := response{}
+	_ = json.Unmarshal(res.Body.Bytes(), &body)
+	return res, body
+}
+
+func TestDatabaseCheck(t *testing.T) {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DatabaseCheck(db).Check(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestRiverCheck(t *testing.T) {
+	pausedAt := time.Now()
+	stopped := make(chan struct{})
+	close(stopped)
+	queues := []string{"default", "rds"}
+
+	testCases := map[string]struct {
+		client    *mockRiverClient
+		expectErr bool
+	}{
+		"queues are being worked": {
+			client: &mockRiverClient{
+				queues: map[string]*rivertype.Queue{
+					"default": {Name: "default", UpdatedAt: time.Now()},
+					"rds":     {Name: "rds", UpdatedAt: time.Now()},
+				},
+			},
+		},
+		"client is stopped": {
+			client: &mockRiverClient{
+				stopped: stopped,
+				queues: map[string]*rivertype.Queue{
+					"default": {Name: "default", UpdatedAt: time.Now()},
+					"rds":     {Name: "rds", UpdatedAt: time.Now()},
+				},
+			},
+			expectErr: true,
+		},
+		"error getting queue": {
+			client: &mockRiverClient{
+				queueErr: errors.New("connection refused"),
+			},
+			expectErr: true,
+		},
+		"queue is not found": {
+			client: &mockRiverClient{
+				queues: map[string]*rivertype.Queue{
+					"default": {Name: "default", UpdatedAt: time.Now()},
+				},
+			},
+			expectErr: true,
+		},
+		"queue is paused": {
+			client: &mockRiverClient{
+				queues: map[string]*rivertype.Queue{
+					"default": {Name: "default", UpdatedAt: time.Now()},
+					"rds":     {Name: "rds", UpdatedAt: time.Now(), PausedAt: &pausedAt},
+				},
+			},
+			expectErr: true,
+		},
+		"queue is stale": {
+			client: &mockRiverClient{
+				queues: map[string]*rivertype.Queue{
+					"default": {Name: "default", UpdatedAt: time.Now()},
+					"rds":     {Name: "rds", UpdatedAt: time.Now().Add(-time.Hour)},
+				},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := RiverCheck(test.client, queues).Check(context.Background())
+			if test.expectErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	logger := slog.New(&testutil.MockLogHandler{})
+	river := &mockRiverClient{
+		queues: map[string]*rivertype.Queue{
+			"default": {Name: "default", UpdatedAt: time.Now()},
+		},
+	}
+	checker := New(
+		logger,
+		[]Check{RiverCheck(river, []string{"default"})},
+		[]Check{AWSCheck(&mockSTSClient{err: errors.New("no credentials")})},
+	)
+
+	res, body := doRequest(checker.Healthz)
+	if res.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if body.Status != statusOK || body.Checks["river"].Status != statusOK {
+		t.Errorf("expected healthy response, got %+v", body)
+	}
+	if _, ok := body.Checks["aws"]; ok {
+		t.Error("expected readiness checks not to run for /healthz")
+	}
+
+	res, body = doRequest(checker.Readyz)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, res.Code)
+	}
+	if body.Status != statusError {
+		t.Errorf("expected status %s, got %s", statusError, body.Status)
+	}
+	if body.Checks["river"].Status != statusOK {
+		t.Errorf("expected river check to pass, got %+v", body.Checks["river"])
+	}
+	if body.Checks["aws"].Error != "no credentials" {
+		t.Errorf("expected aws check to fail with its error, got %+v", body.Checks["aws"])
+	}
+}
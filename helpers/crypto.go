@@ -1,11 +1,18 @@
 package helpers
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
 	"math/big"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // RandStr will generate a random alphanumeric string of the specified length.
@@ -32,25 +39,220 @@ func StringWithCharset(length int, charset string) string {
 	return string(b)
 }
 
-// Encrypt will encrypt the given plain text string.
-func Encrypt(msg, key string, iv []byte) (string, error) {
-	src := []byte(msg)
-	dst := make([]byte, len(src))
+// LegacyKeyID is the ID of the key used to decrypt secrets which were
+// encrypted with AES-CFB before key IDs were recorded with the secrets.
+const LegacyKeyID = "default"
+
+// gcmPrefix prefixes the secrets encrypted with AES-GCM, followed by the ID of
+// the key used and a colon. Legacy secrets are plain base64, which never
+// contains a colon.
+const gcmPrefix = "gcm:"
+
+// envelopePrefix prefixes the secrets encrypted with a data key from a
+// KeyProvider, followed by the wrapped data key and a colon.
+const envelopePrefix = "envelope:"
+
+// keyProviderTimeout bounds the calls to the key provider made to encrypt or
+// decrypt a secret.
+const keyProviderTimeout = 30 * time.Second
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Keyring holds the keys used to encrypt the secrets stored by the broker.
+// Secrets are encrypted with the current key and can be decrypted with any key
+// in the keyring, so the current key can be rotated without downtime.
+type Keyring struct {
+	currentID string
+	keys      map[string]string
+	provider  KeyProvider
+}
+
+// NewKeyring returns a keyring which encrypts with the key with ID currentID,
+// and decrypts with that key and the previous keys, which are keyed by ID. The
+// current key may be empty if the keyring is given a key provider.
+func NewKeyring(currentID, currentKey string, previous map[string]string) *Keyring {
+	keys := make(map[string]string, len(previous)+1)
+	maps.Copy(keys, previous)
+	if currentKey != "" {
+		keys[currentID] = currentKey
+	}
+	return &Keyring{
+		currentID: currentID,
+		keys:      keys,
+	}
+}
+
+// WithKeyProvider returns a copy of the keyring which encrypts every secret
+// with a new data key from the provider, stored with the secret wrapped by the
+// provider's master key. The keys of the keyring are then only used to decrypt
+// the secrets encrypted before the provider was configured.
+func (k *Keyring) WithKeyProvider(provider KeyProvider) *Keyring {
+	return &Keyring{
+		currentID: k.currentID,
+		keys:      k.keys,
+		provider:  provider,
+	}
+}
+
+// Validate checks that the key IDs are valid and the keys are valid AES keys.
+func (k *Keyring) Validate() error {
+	for id, key := range k.keys {
+		if !keyIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid encryption key ID %q, must only contain letters, digits and hyphens", id)
+		}
+		if _, err := aes.NewCipher([]byte(key)); err != nil {
+			return fmt.Errorf("invalid encryption key %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Encrypt encrypts the plain text with AES-GCM using a data key from the key
+// provider, or the current key if there is no provider.
+func (k *Keyring) Encrypt(msg string) (string, error) {
+	if k.provider != nil {
+		return k.encryptEnvelope(msg)
+	}
 
-	aesBlockEncrypter, err := aes.NewCipher([]byte(key))
+	aead, err := k.aead(k.currentID)
 	if err != nil {
 		return "", err
 	}
 
-	//nolint:staticcheck // SA1019: CFB is deprecated (unauthenticated, not FIPS 140-3 validated); AEAD migration to an authenticated cipher is pending.
-	aesEncrypter := cipher.NewCFBEncrypter(aesBlockEncrypter, iv)
-	aesEncrypter.XORKeyStream(dst, src)
+	nonce := generateIv(aead.NonceSize())
+	sealed := aead.Seal(nonce, nonce, []byte(msg), nil)
 
-	return base64.StdEncoding.EncodeToString(dst), nil
+	return gcmPrefix + k.currentID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a secret encrypted with any key in the keyring. The iv is
+// only used for legacy secrets encrypted with AES-CFB, which are decrypted with
+// the key with ID LegacyKeyID.
+func (k *Keyring) Decrypt(msg string, iv []byte) (string, error) {
+	if strings.HasPrefix(msg, envelopePrefix) {
+		return k.decryptEnvelope(msg)
+	}
+	if !strings.HasPrefix(msg, gcmPrefix) {
+		key, ok := k.keys[LegacyKeyID]
+		if !ok {
+			return "", fmt.Errorf("no encryption key with ID %q to decrypt legacy secret", LegacyKeyID)
+		}
+		return decryptCFB(msg, key, iv)
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(msg, gcmPrefix), ":")
+	if !ok {
+		return "", errors.New("encrypted secret has no key ID")
+	}
+	aead, err := k.aead(id)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := open(aead, encoded)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret with key %q: %w", id, err)
+	}
+
+	return string(decrypted), nil
+}
+
+// IsCurrent returns whether the secret is encrypted the way the keyring
+// encrypts new secrets, so it does not need to be re-encrypted.
+func (k *Keyring) IsCurrent(msg string) bool {
+	if k.provider != nil {
+		return strings.HasPrefix(msg, envelopePrefix)
+	}
+	return strings.HasPrefix(msg, gcmPrefix+k.currentID+":")
+}
+
+// IsEncrypted returns whether the value is a secret encrypted with AES-GCM,
+// with or without a key provider. Legacy secrets are not recognized.
+func IsEncrypted(msg string) bool {
+	return strings.HasPrefix(msg, gcmPrefix) || strings.HasPrefix(msg, envelopePrefix)
+}
+
+func (k *Keyring) encryptEnvelope(msg string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	dataKey, wrappedKey, err := k.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not generate data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := generateIv(aead.NonceSize())
+	sealed := aead.Seal(nonce, nonce, []byte(msg), nil)
+
+	return envelopePrefix +
+		base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) decryptEnvelope(msg string) (string, error) {
+	if k.provider == nil {
+		return "", errors.New("no key provider to decrypt secret")
+	}
+	encodedKey, encoded, ok := strings.Cut(strings.TrimPrefix(msg, envelopePrefix), ":")
+	if !ok {
+		return "", errors.New("encrypted secret has no data key")
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	dataKey, err := k.provider.DecryptDataKey(ctx, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := open(aead, encoded)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+func (k *Keyring) aead(id string) (cipher.AEAD, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("no encryption key with ID %q", id)
+	}
+	return newGCM([]byte(key))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// open decrypts base64 encoded ciphertext prefixed with its nonce.
+func open(aead cipher.AEAD, encoded string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted secret is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
 }
 
-// Decrypt will decrypt the given encrypted string.
-func Decrypt(msg, key string, iv []byte) (string, error) {
+// decryptCFB decrypts a legacy secret encrypted with AES-CFB.
+func decryptCFB(msg, key string, iv []byte) (string, error) {
 	src, _ := base64.StdEncoding.DecodeString(msg)
 	dst := make([]byte, len(src))
 
@@ -59,7 +261,7 @@ func Decrypt(msg, key string, iv []byte) (string, error) {
 		return "", err
 	}
 
-	//nolint:staticcheck // SA1019: CFB is deprecated (unauthenticated, not FIPS 140-3 validated); AEAD migration to an authenticated cipher is pending. Decrypt path must be retained to read existing ciphertext during any future migration.
+	//nolint:staticcheck // SA1019: CFB is deprecated. It is only used to decrypt the secrets stored before AES-GCM was used, until they are re-encrypted.
 	aesDecrypter := cipher.NewCFBDecrypter(aesBlockDecrypter, iv)
 	aesDecrypter.XORKeyStream(dst, src)
 
@@ -2,52 +2,168 @@ package helpers
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
 	"testing"
 )
 
+// encryptCFB encrypts a secret the way the broker did before AES-GCM was used.
+func encryptCFB(msg, key string, iv []byte) string {
+	src := []byte(msg)
+	dst := make([]byte, len(src))
+	block, _ := aes.NewCipher([]byte(key))
+	//nolint:staticcheck // SA1019: legacy secrets are encrypted with CFB.
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(dst, src)
+	return base64.StdEncoding.EncodeToString(dst)
+}
+
 func TestEncryption(t *testing.T) {
 	msg := "Very secure message"
-	key := "12345678901234567890123456789012"
-	iv := generateIv(aes.BlockSize)
+	keys := NewKeyring("key-1", "12345678901234567890123456789012", nil)
 
-	encrypted, _ := Encrypt(msg, key, iv)
+	encrypted, err := keys.Encrypt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if encrypted == msg {
 		t.Error("encrypted and original can't be the same")
 	}
+	if !strings.HasPrefix(encrypted, "gcm:key-1:") {
+		t.Errorf("expected encrypted secret to record the key ID, got %s", encrypted)
+	}
+	if !keys.IsCurrent(encrypted) {
+		t.Error("expected encrypted secret to use the current key")
+	}
 
-	decrypted, _ := Decrypt(encrypted, key, iv)
+	decrypted, err := keys.Decrypt(encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if decrypted != msg {
 		t.Error("decrypted should be the same as the original")
 	}
 }
 
-func TestIvChangesEncryption(t *testing.T) {
+func TestNonceChangesEncryption(t *testing.T) {
 	msg := "Very secure message"
-	key := "12345678901234567890123456789012"
-	iv1 := generateIv(aes.BlockSize)
-	iv2 := generateIv(aes.BlockSize)
+	keys := NewKeyring("key-1", "12345678901234567890123456789012", nil)
 
-	encrypted1, _ := Encrypt(msg, key, iv1)
-	encrypted2, _ := Encrypt(msg, key, iv2)
+	encrypted1, _ := keys.Encrypt(msg)
+	encrypted2, _ := keys.Encrypt(msg)
 
 	if encrypted1 == encrypted2 {
-		t.Error("different ivs should return different strings")
+		t.Error("encrypting twice should return different strings")
 	}
 }
 
 func TestKeyChangesEncryption(t *testing.T) {
 	msg := "Very secure message"
-	key1 := "12345678901234567890123456789012"
-	key2 := "21098765432109876543210987654321"
+	keys1 := NewKeyring("key-1", "12345678901234567890123456789012", nil)
+	keys2 := NewKeyring("key-1", "21098765432109876543210987654321", nil)
+
+	encrypted, _ := keys1.Encrypt(msg)
+
+	if _, err := keys2.Decrypt(encrypted, nil); err == nil {
+		t.Error("decrypting with a different key should fail")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	keys := NewKeyring("key-1", "12345678901234567890123456789012", nil)
+	encrypted, _ := keys.Encrypt("Very secure message")
+
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, "gcm:key-1:"))
+	sealed[len(sealed)-1] ^= 1
+	tampered := "gcm:key-1:" + base64.StdEncoding.EncodeToString(sealed)
+
+	if _, err := keys.Decrypt(tampered, nil); err == nil {
+		t.Error("decrypting a tampered secret should fail")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	msg := "Very secure message"
+	oldKeys := NewKeyring("key-1", "12345678901234567890123456789012", nil)
+	encrypted, _ := oldKeys.Encrypt(msg)
+
+	newKeys := NewKeyring("key-2", "21098765432109876543210987654321", map[string]string{
+		"key-1": "12345678901234567890123456789012",
+	})
+	if newKeys.IsCurrent(encrypted) {
+		t.Error("secret encrypted with the previous key should not be current")
+	}
+
+	decrypted, err := newKeys.Decrypt(encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != msg {
+		t.Error("decrypted should be the same as the original")
+	}
+
+	reencrypted, _ := newKeys.Encrypt(decrypted)
+	if !strings.HasPrefix(reencrypted, "gcm:key-2:") {
+		t.Errorf("expected secret to be encrypted with the current key, got %s", reencrypted)
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	msg := "Very secure message"
+	key := "12345678901234567890123456789012"
 	iv := generateIv(aes.BlockSize)
+	encrypted := encryptCFB(msg, key, iv)
+
+	keys := NewKeyring("key-2", "21098765432109876543210987654321", map[string]string{
+		LegacyKeyID: key,
+	})
+	if keys.IsCurrent(encrypted) {
+		t.Error("legacy secret should not be current")
+	}
 
-	encrypted1, _ := Encrypt(msg, key1, iv)
-	encrypted2, _ := Encrypt(msg, key2, iv)
+	decrypted, err := keys.Decrypt(encrypted, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != msg {
+		t.Error("decrypted should be the same as the original")
+	}
 
-	if encrypted1 == encrypted2 {
-		t.Error("different ivs should return different strings")
+	keys = NewKeyring("key-2", "21098765432109876543210987654321", nil)
+	if _, err := keys.Decrypt(encrypted, iv); err == nil {
+		t.Error("decrypting a legacy secret without the legacy key should fail")
+	}
+}
+
+func TestKeyringValidate(t *testing.T) {
+	testCases := map[string]struct {
+		keys      *Keyring
+		expectErr bool
+	}{
+		"valid": {
+			keys: NewKeyring("key-2", "21098765432109876543210987654321", map[string]string{
+				LegacyKeyID: "1234567890123456",
+			}),
+		},
+		"invalid key ID": {
+			keys:      NewKeyring("key:2", "21098765432109876543210987654321", nil),
+			expectErr: true,
+		},
+		"invalid key length": {
+			keys:      NewKeyring("key-2", "fake-key", nil),
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := test.keys.Validate()
+			if test.expectErr != (err != nil) {
+				t.Errorf("expected error: %t, got %v", test.expectErr, err)
+			}
+		})
 	}
 }
 
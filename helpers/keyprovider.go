@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// dataKeySize is the size of the AES-256 data keys generated to encrypt
+// secrets.
+const dataKeySize = 32
+
+// KeyProvider generates the data keys used to encrypt secrets, and wraps them
+// with a master key it holds, so the master key never needs to be loaded by
+// the broker.
+type KeyProvider interface {
+	// GenerateDataKey returns a new data key, in plain text and wrapped with
+	// the master key.
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	// DecryptDataKey unwraps a data key returned by GenerateDataKey.
+	DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyProvider wraps data keys with AES-GCM using a master key read from a
+// file. It is meant for tests and local development, where AWS KMS is not
+// available.
+type FileKeyProvider struct {
+	masterKey []byte
+}
+
+// NewFileKeyProvider returns a key provider using the master key in the file
+// at path, which must be a valid AES key. Surrounding whitespace is ignored.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read master key: %w", err)
+	}
+	masterKey := bytes.TrimSpace(contents)
+	if _, err := aes.NewCipher(masterKey); err != nil {
+		return nil, fmt.Errorf("invalid master key in %s: %w", path, err)
+	}
+	return &FileKeyProvider{masterKey: masterKey}, nil
+}
+
+func (p *FileKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	aead, err := newGCM(p.masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey := generateIv(dataKeySize)
+	nonce := generateIv(aead.NonceSize())
+	return dataKey, aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (p *FileKeyProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	aead, err := newGCM(p.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFileKeyProvider(t *testing.T, masterKey string) *FileKeyProvider {
+	path := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(path, []byte(masterKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := newTestFileKeyProvider(t, "12345678901234567890123456789012")
+
+	dataKey, wrapped, err := provider.GenerateDataKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dataKey) != dataKeySize {
+		t.Errorf("expected %d byte data key, got %d", dataKeySize, len(dataKey))
+	}
+
+	unwrapped, err := provider.DecryptDataKey(ctx, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(unwrapped) != string(dataKey) {
+		t.Error("unwrapped data key should be the same as the generated one")
+	}
+
+	other := newTestFileKeyProvider(t, "21098765432109876543210987654321")
+	if _, err := other.DecryptDataKey(ctx, wrapped); err == nil {
+		t.Error("unwrapping with a different master key should fail")
+	}
+}
+
+func TestNewFileKeyProviderErrors(t *testing.T) {
+	if _, err := NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.key")); err == nil {
+		t.Error("expected error for missing master key file")
+	}
+
+	path := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(path, []byte("too-short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileKeyProvider(path); err == nil {
+		t.Error("expected error for invalid master key")
+	}
+}
+
+func TestEnvelopeEncryption(t *testing.T) {
+	msg := "Very secure message"
+	provider := newTestFileKeyProvider(t, "12345678901234567890123456789012")
+	keys := NewKeyring(LegacyKeyID, "", nil).WithKeyProvider(provider)
+
+	encrypted, err := keys.Encrypt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "envelope:") {
+		t.Errorf("expected secret to be encrypted with a data key, got %s", encrypted)
+	}
+	if !keys.IsCurrent(encrypted) || !IsEncrypted(encrypted) {
+		t.Error("expected encrypted secret to be current")
+	}
+
+	decrypted, err := keys.Decrypt(encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != msg {
+		t.Error("decrypted should be the same as the original")
+	}
+
+	if _, err := NewKeyring(LegacyKeyID, "", nil).Decrypt(encrypted, nil); err == nil {
+		t.Error("decrypting without the key provider should fail")
+	}
+	if _, err := NewKeyring(LegacyKeyID, "", nil).Encrypt(msg); err == nil {
+		t.Error("encrypting without a key or key provider should fail")
+	}
+}
+
+func TestEnvelopeEncryptionMigration(t *testing.T) {
+	msg := "Very secure message"
+	staticKeys := NewKeyring("key-1", "12345678901234567890123456789012", nil)
+	encrypted, _ := staticKeys.Encrypt(msg)
+
+	provider := newTestFileKeyProvider(t, "21098765432109876543210987654321")
+	keys := staticKeys.WithKeyProvider(provider)
+	if keys.IsCurrent(encrypted) {
+		t.Error("secret encrypted with a static key should not be current")
+	}
+
+	decrypted, err := keys.Decrypt(encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != msg {
+		t.Error("decrypted should be the same as the original")
+	}
+}
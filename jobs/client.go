@@ -1,21 +1,20 @@
 package jobs
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"runtime"
 	"time"
 
 	"github.com/cloud-gov/aws-broker/asyncmessage"
-	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/db"
-	"github.com/cloud-gov/aws-broker/services/elasticsearch"
-	"github.com/cloud-gov/aws-broker/services/rds"
-	"github.com/cloud-gov/aws-broker/services/redis"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/metrics"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverdatabasesql"
 	"github.com/riverqueue/river/riverdriver/riversqlite"
@@ -24,9 +23,18 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	// How long jobs may run for if no timeout is configured.
+	defaultJobTimeout = 4 * time.Hour
+
+	// How long a job can run past the longest timeout before it is considered stuck.
+	rescueStuckJobsAfter = time.Hour
+)
+
 type CustomErrorHandler struct {
-	db     *gorm.DB
-	logger *slog.Logger
+	db      *gorm.DB
+	logger  *slog.Logger
+	workers *queue.Workers
 }
 
 func (e *CustomErrorHandler) HandleError(ctx context.Context, job *rivertype.JobRow, err error) *river.ErrorHandlerResult {
@@ -36,74 +44,40 @@ func (e *CustomErrorHandler) HandleError(ctx context.Context, job *rivertype.Job
 
 func (e *CustomErrorHandler) HandlePanic(ctx context.Context, job *rivertype.JobRow, panicVal any, trace string) *river.ErrorHandlerResult {
 	e.logger.Error(fmt.Sprintf("Job panicked with: %v, trace: %s", panicVal, trace))
-	e.markJobAsFailed(job)
+	metrics.ObserveJobPanic(job.Kind)
+	e.markJobAsFailed(ctx, job)
 	return &river.ErrorHandlerResult{
 		SetCancelled: true,
 	}
 }
 
-func (e *CustomErrorHandler) markJobAsFailed(job *rivertype.JobRow) {
-	var (
-		err        error
-		instanceID string
-	)
-	switch job.Kind {
-	case rds.ModifyKind:
-		args := rds.ModifyArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.ModifyOp, base.InstanceNotModified, "job panicked")
-	case rds.CreateKind:
-		args := rds.CreateArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.CreateOp, base.InstanceNotCreated, "job panicked")
-	case rds.DeleteKind:
-		args := rds.DeleteArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.DeleteOp, base.InstanceNotGone, "job panicked")
-	case redis.ModifyKind:
-		args := redis.ModifyArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.ModifyOp, base.InstanceNotModified, "job panicked")
-	case redis.DeleteKind:
-		args := redis.DeleteArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.DeleteOp, base.InstanceNotGone, "job panicked")
-	case elasticsearch.DeleteKind:
-		args := elasticsearch.DeleteArgs{}
-		err = json.Unmarshal(job.EncodedArgs, &args)
-		if err != nil {
-			break
-		}
-		instanceID = args.Instance.Uuid
-		err = asyncmessage.WriteAsyncJobMessage(e.db, args.Instance.ServiceID, instanceID, base.DeleteOp, base.InstanceNotGone, "job panicked")
+// markJobAsFailed records that the operation run by a job failed, for jobs whose
+// arguments implement queue.InstanceJobArgs.
+func (e *CustomErrorHandler) markJobAsFailed(ctx context.Context, job *rivertype.JobRow) {
+	instance, err := e.workers.JobInstance(job)
+	if errors.Is(err, queue.ErrNotInstanceJob) {
+		return
+	}
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("Failed to decode arguments for %s job", job.Kind), "err", err)
+		return
 	}
 
+	ctx = asyncmessage.ContextWithJob(ctx, job)
+	ctx = asyncmessage.ContextWithOperationID(ctx, instance.OperationID)
+	err = asyncmessage.WriteAsyncJobMessage(e.db.WithContext(ctx), instance.ServiceID, instance.InstanceID, instance.Operation, instance.FailedState, "job panicked")
 	if err != nil {
-		e.logger.Error(fmt.Sprintf("Failed to update status for %s job, instance %s", job.Kind, instanceID), "err", err)
+		e.logger.Error(fmt.Sprintf("Failed to update status for %s job, instance %s", job.Kind, instance.InstanceID), "err", err)
 	}
 }
 
-func NewClient(ctx context.Context, db *gorm.DB, dbConfig *db.DBConfig, logger *slog.Logger, workers *river.Workers) (*river.Client[*sql.Tx], error) {
+// NewClient returns the job client for the broker database. queues configures
+// the queues which the job kinds declare in their InsertOpts, and the default
+// queue is worked by as many workers as we have CPU cores available unless it
+// is configured too. jobTimeout is the longest timeout of the workers, after
+// which their jobs may be rescued. periodicJobs are inserted on their schedule
+// by the leader of the brokers sharing the database.
+func NewClient(ctx context.Context, db *gorm.DB, dbConfig *db.DBConfig, logger *slog.Logger, workers *queue.Workers, queues map[string]river.QueueConfig, jobTimeout time.Duration, periodicJobs []queue.PeriodicJob) (queue.Client, error) {
 	logger.Info("initializing river client")
 
 	sqlDB, err := db.DB()
@@ -111,21 +85,13 @@ func NewClient(ctx context.Context, db *gorm.DB, dbConfig *db.DBConfig, logger *
 		return nil, err
 	}
 
-	riverConfig := &river.Config{
-		ErrorHandler: &CustomErrorHandler{
-			db:     db,
-			logger: logger,
-		},
-		JobTimeout: 4 * time.Hour,
-		Logger:     logger,
-		Queues: map[string]river.QueueConfig{
-			river.QueueDefault: {MaxWorkers: runtime.GOMAXPROCS(0)}, // Run as many workers as we have CPU cores available.
-		},
-		Workers: workers,
-	}
+	riverConfig := newRiverConfig(db, logger, workers, queues, jobTimeout, periodicJobs)
 
 	switch dbConfig.DbType {
 	case "mysql":
+		// River has no MySQL driver, so jobs are stored in a table of the broker
+		// database instead, which is created by the broker's migrations.
+		return queue.NewDBClient(db, riverConfig, workers, periodicJobs), nil
 	case "postgres":
 		driver := riverdatabasesql.New(sqlDB)
 		client, err := river.NewClient(driver, riverConfig)
@@ -140,7 +106,7 @@ func NewClient(ctx context.Context, db *gorm.DB, dbConfig *db.DBConfig, logger *
 		if err != nil {
 			return nil, err
 		}
-		return client, nil
+		return queue.NewRiverClient(client), nil
 	case "sqlite3":
 		driver := riversqlite.New(sqlDB)
 		client, err := river.NewClient(driver, riverConfig)
@@ -155,12 +121,47 @@ func NewClient(ctx context.Context, db *gorm.DB, dbConfig *db.DBConfig, logger *
 		if err != nil {
 			return nil, err
 		}
-		return client, nil
+		return queue.NewRiverClient(client), nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbConfig.DbType)
 	}
+}
 
-	return nil, errors.New("did not create river client")
+// newRiverConfig returns the config shared by the River and broker_jobs clients.
+func newRiverConfig(db *gorm.DB, logger *slog.Logger, workers *queue.Workers, queues map[string]river.QueueConfig, jobTimeout time.Duration, periodicJobs []queue.PeriodicJob) *river.Config {
+	queues = maps.Clone(queues)
+	if queues == nil {
+		queues = map[string]river.QueueConfig{}
+	}
+	if _, ok := queues[river.QueueDefault]; !ok {
+		queues[river.QueueDefault] = river.QueueConfig{MaxWorkers: runtime.GOMAXPROCS(0)}
+	}
+
+	jobTimeout = cmp.Or(jobTimeout, defaultJobTimeout)
+	riverConfig := &river.Config{
+		ErrorHandler: &CustomErrorHandler{
+			db:      db,
+			logger:  logger,
+			workers: workers,
+		},
+		// Workers may set their own timeout, as the workers of each service do
+		// from the settings of its queue.
+		JobTimeout: jobTimeout,
+		Logger:     logger,
+		Middleware: []rivertype.Middleware{
+			&metricsMiddleware{},
+		},
+		Queues: queues,
+		// Jobs still running an hour after the longest timeout of any worker
+		// are rescued, so that a job with a long timeout is not rescued and
+		// worked again while it is still running.
+		RescueStuckJobsAfter: jobTimeout + rescueStuckJobsAfter,
+		Workers:              workers.River(),
+	}
+	for _, job := range periodicJobs {
+		riverConfig.PeriodicJobs = append(riverConfig.PeriodicJobs, job.River())
+	}
+	return riverConfig
 }
 
 func runRiverMigration(ctx context.Context, migrator *rivermigrate.Migrator[*sql.Tx], logger *slog.Logger) error {
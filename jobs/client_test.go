@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+type instanceArgs struct {
+	ServiceID   string `json:"service_id"`
+	InstanceID  string `json:"instance_id"`
+	OperationID string `json:"operation_id"`
+}
+
+func (instanceArgs) Kind() string { return "instance-test" }
+
+func (a instanceArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.ServiceID,
+		InstanceID:  a.InstanceID,
+		OperationID: a.OperationID,
+		Operation:   base.ModifyOp,
+		FailedState: base.InstanceNotModified,
+	}
+}
+
+type instanceWorker struct {
+	river.WorkerDefaults[instanceArgs]
+}
+
+func (w *instanceWorker) Work(ctx context.Context, job *river.Job[instanceArgs]) error {
+	return nil
+}
+
+func TestHandlePanicMarksOperationAsFailed(t *testing.T) {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	workers := queue.NewWorkers()
+	queue.AddWorker(workers, &instanceWorker{})
+	queue.AddWorker(workers, &blockingWorker{})
+	handler := &CustomErrorHandler{
+		db:      db,
+		logger:  slog.New(&testutil.MockLogHandler{}),
+		workers: workers,
+	}
+
+	args := instanceArgs{
+		ServiceID:   helpers.RandStr(10),
+		InstanceID:  helpers.RandStr(10),
+		OperationID: helpers.RandStr(10),
+	}
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := handler.HandlePanic(t.Context(), &rivertype.JobRow{ID: 1, Kind: args.Kind(), EncodedArgs: encodedArgs}, "panic", "")
+	if result == nil || !result.SetCancelled {
+		t.Error("expected panicked job to be cancelled")
+	}
+	msg, err := asyncmessage.GetAsyncJobMessage(db, args.ServiceID, args.InstanceID, base.ModifyOp, args.OperationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.JobState.State != base.InstanceNotModified {
+		t.Errorf("expected state %s, got %s", base.InstanceNotModified, msg.JobState.State)
+	}
+
+	// jobs which do not run for an instance have no operation to mark as failed
+	result = handler.HandlePanic(t.Context(), &rivertype.JobRow{ID: 2, Kind: blockingArgs{}.Kind(), EncodedArgs: []byte("{}")}, "panic", "")
+	if result == nil || !result.SetCancelled {
+		t.Error("expected panicked job to be cancelled")
+	}
+}
+
+func TestNewRiverConfigRescuesAfterLongestTimeout(t *testing.T) {
+	workers := queue.NewWorkers()
+	queue.AddWorker(workers, &instanceWorker{})
+
+	config := newRiverConfig(nil, slog.New(&testutil.MockLogHandler{}), workers, nil, 6*time.Hour, nil)
+	if config.JobTimeout != 6*time.Hour {
+		t.Errorf("expected job timeout of 6h, got %s", config.JobTimeout)
+	}
+	if config.RescueStuckJobsAfter != 7*time.Hour {
+		t.Errorf("expected stuck jobs to be rescued after 7h, got %s", config.RescueStuckJobsAfter)
+	}
+}
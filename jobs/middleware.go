@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/metrics"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// metricsMiddleware records the outcome and duration of every job worked.
+// Panics skip the code after doInner, so they are recorded by
+// CustomErrorHandler.HandlePanic instead.
+type metricsMiddleware struct {
+	river.WorkerMiddlewareDefaults
+}
+
+func (m *metricsMiddleware) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	start := time.Now()
+	err := doInner(ctx)
+	metrics.ObserveJob(job.Kind, start, err)
+	return err
+}
@@ -0,0 +1,719 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// How often jobs which were being worked by a client that went away are
+	// checked for.
+	rescueInterval = time.Minute
+
+	// How long a job can run past its timeout before it is considered stuck.
+	rescueStuckJobsAfter = time.Hour
+)
+
+// Job is a job in the broker_jobs table. It has the same fields as a River job.
+type Job struct {
+	ID          int64              `gorm:"primaryKey;autoIncrement"`
+	Kind        string             `gorm:"not null"`
+	Queue       string             `gorm:"not null;index:idx_broker_jobs_fetch,priority:1"`
+	State       rivertype.JobState `gorm:"not null;index:idx_broker_jobs_fetch,priority:2"`
+	InstanceID  string             `gorm:"index"`
+	Args        []byte
+	Errors      []byte
+	Attempt     int
+	MaxAttempts int
+	AttemptedBy []byte
+	CreatedAt   time.Time
+	ScheduledAt time.Time `gorm:"index:idx_broker_jobs_fetch,priority:3"`
+	AttemptedAt *time.Time
+	FinalizedAt *time.Time
+}
+
+func (Job) TableName() string {
+	return "broker_jobs"
+}
+
+func (j *Job) jobRow() *rivertype.JobRow {
+	row := &rivertype.JobRow{
+		ID:          j.ID,
+		Attempt:     j.Attempt,
+		AttemptedAt: j.AttemptedAt,
+		CreatedAt:   j.CreatedAt,
+		EncodedArgs: j.Args,
+		FinalizedAt: j.FinalizedAt,
+		Kind:        j.Kind,
+		MaxAttempts: j.MaxAttempts,
+		Queue:       j.Queue,
+		ScheduledAt: j.ScheduledAt,
+		State:       j.State,
+	}
+	_ = json.Unmarshal(j.Errors, &row.Errors)
+	_ = json.Unmarshal(j.AttemptedBy, &row.AttemptedBy)
+	return row
+}
+
+type dbClient struct {
+	id            string
+	db            *gorm.DB
+	config        *river.Config
+	workers       *Workers
+	periodicJobs  []PeriodicJob
+	logger        *slog.Logger
+	electInterval time.Duration
+	leaderTTL     time.Duration
+
+	mu           sync.Mutex
+	started      bool
+	startedAt    time.Time
+	fetchedAt    map[string]time.Time
+	cancelFetch  context.CancelFunc
+	cancelWork   context.CancelCauseFunc
+	runningJobs  map[int64]context.CancelCauseFunc
+	wg           sync.WaitGroup
+	stopped      chan struct{}
+	stoppedClose sync.Once
+}
+
+// NewDBClient returns a Client which stores jobs in the broker_jobs table of the
+// broker database, for databases River has no driver for. It is configured
+// with the same River config as a River client, and honours its ErrorHandler,
+// JobTimeout, Logger, MaxAttempts, Middleware, Queues and RetryPolicy.
+//
+// River's periodic jobs cannot be read from its config, so they are given
+// separately. The clients sharing the database elect a leader in the
+// broker_leaders table to insert them.
+func NewDBClient(db *gorm.DB, config *river.Config, workers *Workers, periodicJobs []PeriodicJob) Client {
+	return &dbClient{
+		id:            uuid.NewString(),
+		db:            db,
+		config:        config,
+		workers:       workers,
+		periodicJobs:  periodicJobs,
+		logger:        cmp.Or(config.Logger, slog.Default()),
+		electInterval: electInterval,
+		leaderTTL:     leaderTTL,
+		fetchedAt:     map[string]time.Time{},
+		runningJobs:   map[int64]context.CancelCauseFunc{},
+		stopped:       make(chan struct{}),
+	}
+}
+
+func (c *dbClient) ID() string {
+	return c.id
+}
+
+func (c *dbClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return errors.New("job queue client is already started")
+	}
+	c.started = true
+	c.startedAt = time.Now().UTC()
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	workCtx, cancelWork := context.WithCancelCause(ctx)
+	c.cancelFetch = cancelFetch
+	c.cancelWork = cancelWork
+
+	for name, queueConfig := range c.config.Queues {
+		c.wg.Go(func() {
+			c.fetchLoop(fetchCtx, workCtx, name, queueConfig)
+		})
+	}
+	c.wg.Go(func() {
+		c.rescueLoop(fetchCtx)
+	})
+	if len(c.periodicJobs) > 0 {
+		c.wg.Go(func() {
+			c.periodicLoop(fetchCtx)
+		})
+	}
+
+	// Like River, cancelling the context the client was started with stops it
+	// without waiting for jobs to finish.
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.cancelFetch()
+			c.cancelWork(ctx.Err())
+		case <-c.stopped:
+		}
+	}()
+	go func() {
+		c.wg.Wait()
+		c.stoppedClose.Do(func() { close(c.stopped) })
+	}()
+	return nil
+}
+
+// Stop stops fetching new jobs and waits for the jobs being worked to finish.
+func (c *dbClient) Stop(ctx context.Context) error {
+	if !c.isStarted() {
+		return nil
+	}
+	c.cancelFetch()
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StopAndCancel stops fetching new jobs and cancels the jobs being worked.
+func (c *dbClient) StopAndCancel(ctx context.Context) error {
+	if !c.isStarted() {
+		return nil
+	}
+	c.cancelFetch()
+	c.cancelWork(ErrStopped)
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *dbClient) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+func (c *dbClient) isStarted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started
+}
+
+func (c *dbClient) InsertTx(ctx context.Context, tx *sql.Tx, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode arguments for %s job: %w", args.Kind(), err)
+	}
+
+	if opts == nil {
+		opts = &river.InsertOpts{}
+	}
+	argsOpts := river.InsertOpts{}
+	if withOpts, ok := args.(river.JobArgsWithInsertOpts); ok {
+		argsOpts = withOpts.InsertOpts()
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		Kind:        args.Kind(),
+		Queue:       cmp.Or(opts.Queue, argsOpts.Queue, river.QueueDefault),
+		State:       rivertype.JobStateAvailable,
+		InstanceID:  instanceID(encodedArgs),
+		Args:        encodedArgs,
+		MaxAttempts: cmp.Or(opts.MaxAttempts, argsOpts.MaxAttempts, c.config.MaxAttempts, river.MaxAttemptsDefault),
+		CreatedAt:   now,
+		ScheduledAt: cmp.Or(opts.ScheduledAt, argsOpts.ScheduledAt, now).UTC(),
+	}
+	if job.ScheduledAt.After(now) {
+		job.State = rivertype.JobStateScheduled
+	}
+
+	if instanceArgs, ok := args.(InstanceJobArgs); ok && instanceArgs.JobInstance().InstanceID != "" {
+		if err := c.checkNoUnfinishedJob(ctx, tx, instanceArgs.JobInstance().InstanceID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Jobs are inserted with plain SQL, which MySQL and SQLite both accept, so
+	// they are inserted in the transaction of the caller.
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO broker_jobs (kind, queue, state, instance_id, args, attempt, max_attempts, created_at, scheduled_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		job.Kind, job.Queue, job.State, job.InstanceID, job.Args, job.Attempt, job.MaxAttempts, job.CreatedAt, job.ScheduledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &rivertype.JobInsertResult{Job: job.jobRow()}, nil
+}
+
+// checkNoUnfinishedJob returns ErrOperationInProgress if the instance has an
+// unfinished job. On MySQL, the unfinished jobs of the instance are selected for
+// update, which also locks the gap where a new one would be inserted, so of two
+// concurrent inserts for the instance only one can commit. SQLite has no row
+// locks, and only allows a single writer anyway.
+func (c *dbClient) checkNoUnfinishedJob(ctx context.Context, tx *sql.Tx, instanceID string) error {
+	query := "SELECT id FROM broker_jobs WHERE instance_id = ? AND state IN (?" + strings.Repeat(", ?", len(UnfinishedJobStates)-1) + ") LIMIT 1"
+	if c.db.Dialector.Name() != "sqlite" {
+		query += " FOR UPDATE"
+	}
+	queryArgs := []any{instanceID}
+	for _, state := range UnfinishedJobStates {
+		queryArgs = append(queryArgs, state)
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, query, queryArgs...).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("could not check unfinished jobs of instance %s: %w", instanceID, err)
+	default:
+		return ErrOperationInProgress
+	}
+}
+
+func (c *dbClient) ListJobs(ctx context.Context, params ListParams) ([]*rivertype.JobRow, error) {
+	query := c.db.WithContext(ctx).Order("id desc").Limit(params.limit())
+	if params.InstanceID != "" {
+		query = query.Where("instance_id = ?", params.InstanceID)
+	}
+	if len(params.States) > 0 {
+		query = query.Where("state IN ?", params.States)
+	}
+
+	jobs := []Job{}
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	rows := []*rivertype.JobRow{}
+	for _, job := range jobs {
+		rows = append(rows, job.jobRow())
+	}
+	return rows, nil
+}
+
+func (c *dbClient) JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	job, err := c.getJob(c.db.WithContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	return job.jobRow(), nil
+}
+
+// JobRetry makes a job available to be worked immediately. Jobs which were
+// discarded after running out of attempts are given another attempt.
+func (c *dbClient) JobRetry(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	job := &Job{}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		job, err = c.getJob(lockForUpdate(tx, false), id)
+		if err != nil {
+			return err
+		}
+		if job.State == rivertype.JobStateRunning {
+			return nil
+		}
+		job.State = rivertype.JobStateAvailable
+		job.ScheduledAt = time.Now().UTC()
+		job.FinalizedAt = nil
+		if job.Attempt >= job.MaxAttempts {
+			job.MaxAttempts = job.Attempt + 1
+		}
+		return tx.Save(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job.jobRow(), nil
+}
+
+// JobCancel cancels a job which has not finished. If the job is being worked
+// by this client, its context is cancelled.
+func (c *dbClient) JobCancel(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	job := &Job{}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		job, err = c.getJob(lockForUpdate(tx, false), id)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(UnfinishedJobStates, job.State) {
+			return nil
+		}
+		now := time.Now().UTC()
+		job.State = rivertype.JobStateCancelled
+		job.FinalizedAt = &now
+		return tx.Save(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if cancel, ok := c.runningJobs[id]; ok {
+		cancel(errors.New("job cancelled"))
+	}
+	c.mu.Unlock()
+	return job.jobRow(), nil
+}
+
+// QueueGet returns a queue worked by this client. The queue is updated every
+// time the client fetches jobs for it.
+func (c *dbClient) QueueGet(ctx context.Context, name string) (*rivertype.Queue, error) {
+	if _, ok := c.config.Queues[name]; !ok {
+		return nil, rivertype.ErrNotFound
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &rivertype.Queue{
+		Name:      name,
+		CreatedAt: c.startedAt,
+		UpdatedAt: c.fetchedAt[name],
+	}, nil
+}
+
+func (c *dbClient) getJob(db *gorm.DB, id int64) (*Job, error) {
+	job := &Job{}
+	result := db.Where("id = ?", id).Limit(1).Find(job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, rivertype.ErrNotFound
+	}
+	return job, nil
+}
+
+func (c *dbClient) fetchLoop(fetchCtx context.Context, workCtx context.Context, name string, queueConfig river.QueueConfig) {
+	pollInterval := cmp.Or(queueConfig.FetchPollInterval, c.config.FetchPollInterval, river.FetchPollIntervalDefault)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	running := make(chan struct{}, max(queueConfig.MaxWorkers, 1))
+	for {
+		select {
+		case <-fetchCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		available := cap(running) - len(running)
+		jobs, err := c.fetch(fetchCtx, name, available)
+		if err != nil {
+			if fetchCtx.Err() == nil {
+				c.logger.Error("could not fetch jobs", "queue", name, "err", err)
+			}
+			continue
+		}
+		for _, job := range jobs {
+			running <- struct{}{}
+			c.wg.Go(func() {
+				defer func() { <-running }()
+				c.work(workCtx, job)
+			})
+		}
+	}
+}
+
+// fetch claims up to limit jobs which are ready to be worked from a queue.
+func (c *dbClient) fetch(ctx context.Context, name string, limit int) ([]*Job, error) {
+	c.mu.Lock()
+	c.fetchedAt[name] = time.Now().UTC()
+	c.mu.Unlock()
+	if limit == 0 {
+		return nil, nil
+	}
+
+	jobs := []*Job{}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := lockForUpdate(tx, true).
+			Where("queue = ?", name).
+			Where("state IN ?", []rivertype.JobState{rivertype.JobStateAvailable, rivertype.JobStateRetryable, rivertype.JobStateScheduled}).
+			Where("scheduled_at <= ?", now).
+			Order("scheduled_at, id").
+			Limit(limit).
+			Find(&jobs).Error
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			attemptedBy := []string{}
+			_ = json.Unmarshal(job.AttemptedBy, &attemptedBy)
+			job.AttemptedBy, _ = json.Marshal(append(attemptedBy, c.id))
+			job.State = rivertype.JobStateRunning
+			job.Attempt++
+			job.AttemptedAt = &now
+			if err := tx.Save(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+func (c *dbClient) work(workCtx context.Context, job *Job) {
+	row := job.jobRow()
+	ctx, cancel := context.WithCancelCause(workCtx)
+	defer cancel(nil)
+	c.mu.Lock()
+	c.runningJobs[job.ID] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.runningJobs, job.ID)
+		c.mu.Unlock()
+	}()
+
+	unit, err := c.bind(row)
+	var (
+		panicVal any
+		trace    string
+	)
+	if err == nil {
+		panicVal, trace, err = c.execute(ctx, unit, row)
+	}
+
+	// The job's context may have been cancelled, but its result still needs to
+	// be recorded.
+	c.complete(context.WithoutCancel(ctx), job, row, unit, err, panicVal, trace)
+}
+
+func (c *dbClient) bind(row *rivertype.JobRow) (workUnit, error) {
+	factory, ok := c.workers.units[row.Kind]
+	if !ok {
+		return nil, fmt.Errorf("no worker registered for %s jobs", row.Kind)
+	}
+	return factory(row)
+}
+
+// execute works the job through the configured middleware, recovering from panics.
+//
+//nolint:nonamedreturns
+func (c *dbClient) execute(ctx context.Context, unit workUnit, row *rivertype.JobRow) (panicVal any, trace string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicVal = recovered
+			trace = string(debug.Stack())
+		}
+	}()
+
+	timeout := cmp.Or(unit.timeout(), c.config.JobTimeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	middleware := []rivertype.WorkerMiddleware{}
+	for _, m := range c.config.Middleware {
+		if workerMiddleware, ok := m.(rivertype.WorkerMiddleware); ok {
+			middleware = append(middleware, workerMiddleware)
+		}
+	}
+	middleware = append(middleware, unit.middleware()...)
+
+	doInner := unit.work
+	for i := len(middleware) - 1; i >= 0; i-- {
+		next := doInner
+		m := middleware[i]
+		doInner = func(ctx context.Context) error {
+			return m.Work(ctx, row, next)
+		}
+	}
+	return nil, "", doInner(ctx)
+}
+
+// complete records the result of working a job, following the same rules as River.
+func (c *dbClient) complete(ctx context.Context, job *Job, row *rivertype.JobRow, unit workUnit, err error, panicVal any, trace string) {
+	now := time.Now().UTC()
+	var (
+		cancelErr *rivertype.JobCancelError
+		snoozeErr *rivertype.JobSnoozeError
+	)
+
+	switch {
+	case panicVal != nil:
+		c.logger.Error("job panicked", "job_id", job.ID, "kind", job.Kind, "panic_val", fmt.Sprintf("%v", panicVal))
+		c.recordError(job, row, now, fmt.Sprintf("panic: %v", panicVal), trace)
+		if c.config.ErrorHandler != nil && c.handled(func() *river.ErrorHandlerResult {
+			return c.config.ErrorHandler.HandlePanic(ctx, row, panicVal, trace)
+		}) {
+			job.State = rivertype.JobStateCancelled
+			job.FinalizedAt = &now
+		} else {
+			c.retryOrDiscard(job, row, unit, now)
+		}
+	case err == nil:
+		job.State = rivertype.JobStateCompleted
+		job.FinalizedAt = &now
+	case errors.As(err, &snoozeErr):
+		job.State = rivertype.JobStateScheduled
+		job.ScheduledAt = now.Add(snoozeErr.Duration)
+		// Snoozing does not use up an attempt.
+		job.MaxAttempts++
+	case errors.As(err, &cancelErr):
+		c.recordError(job, row, now, err.Error(), "")
+		job.State = rivertype.JobStateCancelled
+		job.FinalizedAt = &now
+	default:
+		c.recordError(job, row, now, err.Error(), "")
+		if c.config.ErrorHandler != nil && c.handled(func() *river.ErrorHandlerResult {
+			return c.config.ErrorHandler.HandleError(ctx, row, err)
+		}) {
+			job.State = rivertype.JobStateCancelled
+			job.FinalizedAt = &now
+		} else {
+			c.retryOrDiscard(job, row, unit, now)
+		}
+	}
+
+	// Jobs cancelled while they were running keep their cancelled state.
+	result := c.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ?", job.ID).
+		Where("state = ?", rivertype.JobStateRunning).
+		Select("state", "errors", "max_attempts", "scheduled_at", "finalized_at").
+		Updates(job)
+	if result.Error != nil {
+		c.logger.Error("could not record job result", "job_id", job.ID, "kind", job.Kind, "err", result.Error)
+	}
+}
+
+// handled calls an error handler, reporting whether it asked for the job to be cancelled.
+func (c *dbClient) handled(handle func() *river.ErrorHandlerResult) (cancelled bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			c.logger.Error("job error handler panicked", "panic_val", fmt.Sprintf("%v", recovered))
+			cancelled = false
+		}
+	}()
+	result := handle()
+	return result != nil && result.SetCancelled
+}
+
+func (c *dbClient) recordError(job *Job, row *rivertype.JobRow, at time.Time, message string, trace string) {
+	row.Errors = append(row.Errors, rivertype.AttemptError{
+		At:      at,
+		Attempt: job.Attempt,
+		Error:   message,
+		Trace:   trace,
+	})
+	job.Errors, _ = json.Marshal(row.Errors)
+}
+
+func (c *dbClient) retryOrDiscard(job *Job, row *rivertype.JobRow, unit workUnit, now time.Time) {
+	if job.Attempt >= job.MaxAttempts {
+		job.State = rivertype.JobStateDiscarded
+		job.FinalizedAt = &now
+		return
+	}
+
+	var nextRetry time.Time
+	if unit != nil {
+		nextRetry = unit.nextRetry()
+	}
+	if nextRetry.IsZero() {
+		retryPolicy := c.config.RetryPolicy
+		if retryPolicy == nil {
+			retryPolicy = &river.DefaultClientRetryPolicy{}
+		}
+		nextRetry = retryPolicy.NextRetry(row)
+	}
+	job.State = rivertype.JobStateRetryable
+	job.ScheduledAt = nextRetry.UTC()
+}
+
+// rescueLoop periodically rescues jobs which have been running for longer than
+// they could have, because the client working them went away.
+func (c *dbClient) rescueLoop(ctx context.Context) {
+	ticker := time.NewTicker(rescueInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.rescueStuckJobs(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("could not rescue stuck jobs", "err", err)
+		}
+	}
+}
+
+func (c *dbClient) rescueStuckJobs(ctx context.Context) error {
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		jobs := []*Job{}
+		err := lockForUpdate(tx, true).
+			Where("state = ?", rivertype.JobStateRunning).
+			Where("attempted_at < ?", now.Add(-rescueStuckJobsAfter)).
+			Find(&jobs).Error
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			row := job.jobRow()
+			// Jobs may run for as long as the timeout of their worker, which
+			// differs between the queues of the services.
+			if now.Sub(*job.AttemptedAt) < c.timeout(row)+rescueStuckJobsAfter {
+				continue
+			}
+			c.logger.Warn("rescuing stuck job", "job_id", job.ID, "kind", job.Kind)
+			c.recordError(job, row, now, "stuck job rescued", "")
+			c.retryOrDiscard(job, row, nil, now)
+			if err := tx.Save(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// timeout returns how long a job may run for, which is the timeout of its
+// worker or the client's JobTimeout.
+func (c *dbClient) timeout(row *rivertype.JobRow) time.Duration {
+	var timeout time.Duration
+	if unit, err := c.bind(row); err == nil {
+		timeout = unit.timeout()
+	}
+	return cmp.Or(timeout, c.config.JobTimeout)
+}
+
+// lockForUpdate locks the rows selected in a transaction. With skipLocked, rows
+// locked by other broker instances are skipped instead of waited for. SQLite
+// has no row locks, and only allows a single writer anyway.
+func lockForUpdate(tx *gorm.DB, skipLocked bool) *gorm.DB {
+	if tx.Dialector.Name() == "sqlite" {
+		return tx
+	}
+	locking := clause.Locking{Strength: clause.LockingStrengthUpdate}
+	if skipLocked {
+		locking.Options = clause.LockingOptionsSkipLocked
+	}
+	return tx.Clauses(locking)
+}
+
+// instanceID returns the ID of the service instance a job is run for. Every
+// job's arguments carry the instance record.
+func instanceID(encodedArgs []byte) string {
+	args := struct {
+		Instance struct {
+			Uuid string
+		} `json:"instance"`
+	}{}
+	_ = json.Unmarshal(encodedArgs, &args)
+	return args.Instance.Uuid
+}
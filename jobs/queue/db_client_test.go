@@ -0,0 +1,480 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+type testInstance struct {
+	Uuid string
+}
+
+type testArgs struct {
+	Instance testInstance `json:"instance"`
+	Action   string       `json:"action"`
+}
+
+func (testArgs) Kind() string { return "queue-test" }
+
+func (a testArgs) JobInstance() JobInstance {
+	return JobInstance{InstanceID: a.Instance.Uuid}
+}
+
+type testWorker struct {
+	river.WorkerDefaults[testArgs]
+}
+
+func (w *testWorker) Work(ctx context.Context, job *river.Job[testArgs]) error {
+	switch job.Args.Action {
+	case "error":
+		return errors.New("failed")
+	case "cancel":
+		return river.JobCancel(errors.New("cannot continue"))
+	case "panic":
+		panic("worker panicked")
+	case "block":
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+type longArgs struct{}
+
+func (longArgs) Kind() string { return "queue-test-long" }
+
+// longWorker works jobs which may run for longer than River's default rescue
+// interval of an hour past the job timeout.
+type longWorker struct {
+	river.WorkerDefaults[longArgs]
+}
+
+func (w *longWorker) Timeout(*river.Job[longArgs]) time.Duration {
+	return 6 * time.Hour
+}
+
+func (w *longWorker) Work(ctx context.Context, job *river.Job[longArgs]) error {
+	return nil
+}
+
+type testErrorHandler struct {
+	panics int
+}
+
+func (h *testErrorHandler) HandleError(ctx context.Context, job *rivertype.JobRow, err error) *river.ErrorHandlerResult {
+	return nil
+}
+
+func (h *testErrorHandler) HandlePanic(ctx context.Context, job *rivertype.JobRow, panicVal any, trace string) *river.ErrorHandlerResult {
+	h.panics++
+	return &river.ErrorHandlerResult{SetCancelled: true}
+}
+
+func setup(t *testing.T, maxAttempts int) (*gorm.DB, Client, *testErrorHandler) {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Job{}); err != nil {
+		t.Fatal(err)
+	}
+	// The test database is shared between tests, so remove the jobs created by
+	// any previous test.
+	if err := db.Where("1 = 1").Delete(&Job{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	workers := NewWorkers()
+	AddWorker(workers, &testWorker{})
+	AddWorker(workers, &longWorker{})
+	errorHandler := &testErrorHandler{}
+	client := NewDBClient(db, &river.Config{
+		ErrorHandler:      errorHandler,
+		FetchPollInterval: 10 * time.Millisecond,
+		Logger:            slog.New(&testutil.MockLogHandler{}),
+		MaxAttempts:       maxAttempts,
+		Queues: map[string]river.QueueConfig{
+			river.QueueDefault: {MaxWorkers: 2},
+		},
+	}, workers, nil)
+	return db, client, errorHandler
+}
+
+func insertJob(t *testing.T, db *gorm.DB, client Client, args testArgs) *rivertype.JobRow {
+	tx := db.Begin()
+	defer tx.Rollback()
+	result, err := client.InsertTx(context.Background(), tx.Statement.ConnPool.(*sql.Tx), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	return result.Job
+}
+
+func waitForState(t *testing.T, client Client, id int64, states ...rivertype.JobState) *rivertype.JobRow {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := client.JobGet(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, state := range states {
+			if job.State == state {
+				return job
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected job to reach one of %v, got %s", states, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInsertTxRollback(t *testing.T) {
+	db, client, _ := setup(t, 0)
+
+	tx := db.Begin()
+	_, err := client.InsertTx(context.Background(), tx.Statement.ConnPool.(*sql.Tx), testArgs{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback().Error; err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := client.ListJobs(context.Background(), ListParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected no jobs after rolling back, got %d", len(jobs))
+	}
+}
+
+func TestInsertTxOperationInProgress(t *testing.T) {
+	db, client, _ := setup(t, 0)
+	args := testArgs{Instance: testInstance{Uuid: "instance-1"}}
+	first := insertJob(t, db, client, args)
+
+	tx := db.Begin()
+	_, err := client.InsertTx(context.Background(), tx.Statement.ConnPool.(*sql.Tx), args, nil)
+	tx.Rollback()
+	if !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("expected ErrOperationInProgress inserting a second job for the instance, got %v", err)
+	}
+
+	insertJob(t, db, client, testArgs{Instance: testInstance{Uuid: "instance-2"}})
+
+	if err := db.Model(&Job{}).Where("id = ?", first.ID).Update("state", rivertype.JobStateCompleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	insertJob(t, db, client, args)
+}
+
+func TestWorkJobs(t *testing.T) {
+	testCases := map[string]struct {
+		action        string
+		maxAttempts   int
+		expectedState rivertype.JobState
+		expectErrors  bool
+		expectPanic   bool
+	}{
+		"completed": {
+			expectedState: rivertype.JobStateCompleted,
+		},
+		"errored with attempts left": {
+			action:        "error",
+			expectedState: rivertype.JobStateRetryable,
+			expectErrors:  true,
+		},
+		"errored without attempts left": {
+			action:        "error",
+			maxAttempts:   1,
+			expectedState: rivertype.JobStateDiscarded,
+			expectErrors:  true,
+		},
+		"cancelled": {
+			action:        "cancel",
+			expectedState: rivertype.JobStateCancelled,
+			expectErrors:  true,
+		},
+		"panicked": {
+			action:        "panic",
+			expectedState: rivertype.JobStateCancelled,
+			expectErrors:  true,
+			expectPanic:   true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, client, errorHandler := setup(t, test.maxAttempts)
+			ctx := context.Background()
+			if err := client.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = client.StopAndCancel(ctx) }()
+
+			inserted := insertJob(t, db, client, testArgs{Action: test.action})
+			job := waitForState(t, client, inserted.ID, test.expectedState)
+
+			if job.Attempt != 1 {
+				t.Errorf("expected 1 attempt, got %d", job.Attempt)
+			}
+			if len(job.AttemptedBy) != 1 || job.AttemptedBy[0] != client.ID() {
+				t.Errorf("expected job to be attempted by %s, got %v", client.ID(), job.AttemptedBy)
+			}
+			if test.expectErrors != (len(job.Errors) > 0) {
+				t.Errorf("expected errors: %t, got %+v", test.expectErrors, job.Errors)
+			}
+			if test.expectPanic != (errorHandler.panics == 1) {
+				t.Errorf("expected panic to be handled: %t, handled %d panics", test.expectPanic, errorHandler.panics)
+			}
+		})
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	db, client, _ := setup(t, 0)
+	first := insertJob(t, db, client, testArgs{Instance: testInstance{Uuid: "instance-1"}})
+	insertJob(t, db, client, testArgs{Instance: testInstance{Uuid: "instance-2"}})
+
+	jobs, err := client.ListJobs(context.Background(), ListParams{InstanceID: "instance-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != first.ID {
+		t.Errorf("expected only job %d, got %+v", first.ID, jobs)
+	}
+
+	jobs, err = client.ListJobs(context.Background(), ListParams{States: []rivertype.JobState{rivertype.JobStateRunning}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected no running jobs, got %d", len(jobs))
+	}
+}
+
+func TestJobRetry(t *testing.T) {
+	db, client, _ := setup(t, 1)
+	ctx := context.Background()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.StopAndCancel(ctx) }()
+
+	inserted := insertJob(t, db, client, testArgs{Action: "error"})
+	waitForState(t, client, inserted.ID, rivertype.JobStateDiscarded)
+
+	job, err := client.JobRetry(ctx, inserted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.MaxAttempts != 2 {
+		t.Errorf("expected the job to be given another attempt, got %d max attempts", job.MaxAttempts)
+	}
+
+	job = waitForState(t, client, inserted.ID, rivertype.JobStateDiscarded)
+	if job.Attempt != 2 {
+		t.Errorf("expected the job to be attempted again, got %d attempts", job.Attempt)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	db, client, _ := setup(t, 0)
+	ctx := context.Background()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.StopAndCancel(ctx) }()
+
+	inserted := insertJob(t, db, client, testArgs{Action: "block"})
+	waitForState(t, client, inserted.ID, rivertype.JobStateRunning)
+
+	if _, err := client.JobCancel(ctx, inserted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker returns once its context is cancelled, and the job keeps the
+	// cancelled state.
+	time.Sleep(100 * time.Millisecond)
+	job := waitForState(t, client, inserted.ID, rivertype.JobStateCancelled)
+	if job.FinalizedAt == nil {
+		t.Error("expected the cancelled job to be finalized")
+	}
+}
+
+func TestStop(t *testing.T) {
+	db, client, _ := setup(t, 0)
+	ctx := context.Background()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	inserted := insertJob(t, db, client, testArgs{Action: "block"})
+	waitForState(t, client, inserted.ID, rivertype.JobStateRunning)
+
+	stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := client.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected stop to time out waiting for the running job, got %v", err)
+	}
+
+	if err := client.StopAndCancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-client.Stopped():
+	default:
+		t.Error("expected client to be stopped")
+	}
+	waitForState(t, client, inserted.ID, rivertype.JobStateRetryable)
+}
+
+func TestRescueStuckJobs(t *testing.T) {
+	db, client, _ := setup(t, 0)
+
+	now := time.Now().UTC()
+	running := func(kind string, attemptedFor time.Duration) *Job {
+		attemptedAt := now.Add(-attemptedFor)
+		job := &Job{
+			Kind:        kind,
+			Queue:       river.QueueDefault,
+			State:       rivertype.JobStateRunning,
+			Args:        []byte("{}"),
+			Attempt:     1,
+			MaxAttempts: river.MaxAttemptsDefault,
+			CreatedAt:   attemptedAt,
+			ScheduledAt: attemptedAt,
+			AttemptedAt: &attemptedAt,
+		}
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	stuck := running(testArgs{}.Kind(), 2*time.Hour)
+	withinTimeout := running(longArgs{}.Kind(), 6*time.Hour+30*time.Minute)
+	pastTimeout := running(longArgs{}.Kind(), 7*time.Hour+30*time.Minute)
+
+	if err := client.(*dbClient).rescueStuckJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		job      *Job
+		expected rivertype.JobState
+	}{
+		"stuck job": {
+			job:      stuck,
+			expected: rivertype.JobStateRetryable,
+		},
+		"job running within its worker's timeout": {
+			job:      withinTimeout,
+			expected: rivertype.JobStateRunning,
+		},
+		"job running past its worker's timeout": {
+			job:      pastTimeout,
+			expected: rivertype.JobStateRetryable,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			job, err := client.JobGet(context.Background(), test.job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.State != test.expected {
+				t.Errorf("expected job to be %s, got %s", test.expected, job.State)
+			}
+		})
+	}
+}
+
+func TestQueueGet(t *testing.T) {
+	_, client, _ := setup(t, 0)
+	ctx := context.Background()
+
+	if _, err := client.QueueGet(ctx, "unknown"); !errors.Is(err, rivertype.ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.StopAndCancel(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	queue, err := client.QueueGet(ctx, river.QueueDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(queue.UpdatedAt) > time.Second {
+		t.Errorf("expected the queue to have been fetched recently, got %s", queue.UpdatedAt)
+	}
+}
+
+func TestPeriodicJobs(t *testing.T) {
+	db, _, _ := setup(t, 0)
+	if err := db.AutoMigrate(&Leader{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("1 = 1").Delete(&Leader{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// The clients work no queues, so the inserted jobs are left to be counted.
+	clients := map[string]*dbClient{}
+	for range 2 {
+		client := NewDBClient(db, &river.Config{
+			Logger: slog.New(&testutil.MockLogHandler{}),
+		}, NewWorkers(), []PeriodicJob{
+			{Interval: time.Hour, Args: testArgs{Action: "periodic"}},
+		}).(*dbClient)
+		client.electInterval = 10 * time.Millisecond
+		if err := client.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.StopAndCancel(ctx) }()
+		clients[client.ID()] = client
+	}
+
+	countJobs := func() int64 {
+		var count int64
+		if err := db.Model(&Job{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if count := countJobs(); count != 1 {
+		t.Fatalf("expected only the leader to insert the periodic job, got %d jobs", count)
+	}
+
+	leader := &Leader{}
+	if err := db.First(leader).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := clients[leader.LeaderID].StopAndCancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if count := countJobs(); count != 2 {
+		t.Errorf("expected the new leader to insert the periodic job, got %d jobs", count)
+	}
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// How often a client tries to become, or stay, the leader.
+	electInterval = 5 * time.Second
+
+	// How long a leader keeps its leadership without renewing it.
+	leaderTTL = 30 * time.Second
+
+	leaderName = "default"
+)
+
+// PeriodicJob is a job inserted on a schedule. Only the leader of the brokers
+// sharing the database inserts periodic jobs, so each runs once per interval
+// however many brokers are running. The job is also inserted when a broker is
+// elected leader, so a job with a long interval still runs when the brokers
+// are restarted more often than that.
+type PeriodicJob struct {
+	// Interval is how often the job is inserted.
+	Interval time.Duration
+	// Args are the arguments of the inserted job.
+	Args river.JobArgs
+}
+
+// River returns the periodic job for a River client, which elects its own leader.
+func (j PeriodicJob) River() *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(j.Interval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return j.Args, nil
+		},
+		&river.PeriodicJobOpts{ID: j.Args.Kind(), RunOnStart: true},
+	)
+}
+
+// Leader is the row in the broker_leaders table which records which client
+// inserts the periodic jobs.
+type Leader struct {
+	Name      string    `gorm:"primaryKey;size:64"`
+	LeaderID  string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+func (Leader) TableName() string {
+	return "broker_leaders"
+}
+
+// periodicLoop inserts the periodic jobs while the client is the leader.
+func (c *dbClient) periodicLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.electInterval)
+	defer ticker.Stop()
+	defer c.resign()
+
+	// The next time each periodic job is inserted, while this client is the leader.
+	var next []time.Time
+	for {
+		leader, err := c.elect(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.logger.Error("could not elect leader", "err", err)
+		}
+		switch {
+		case !leader && next != nil:
+			c.logger.Info("lost leadership")
+			next = nil
+		case leader && next == nil:
+			c.logger.Info("elected leader")
+			next = make([]time.Time, len(c.periodicJobs))
+		}
+
+		now := time.Now().UTC()
+		for i, job := range c.periodicJobs {
+			if !leader || now.Before(next[i]) {
+				continue
+			}
+			if err := c.insertPeriodicJob(ctx, job); err != nil {
+				if ctx.Err() == nil {
+					c.logger.Error("could not insert periodic job", "kind", job.Args.Kind(), "err", err)
+				}
+				continue
+			}
+			next[i] = now.Add(job.Interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// elect makes the client the leader if there is none, or renews its
+// leadership, reporting whether the client is the leader.
+func (c *dbClient) elect(ctx context.Context) (bool, error) {
+	db := c.db.WithContext(ctx)
+	now := time.Now().UTC()
+	expiresAt := now.Add(c.leaderTTL)
+
+	result := db.Model(&Leader{}).
+		Where("name = ?", leaderName).
+		Where("leader_id = ? OR expires_at < ?", c.id, now).
+		Updates(map[string]any{"leader_id": c.id, "expires_at": expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// The first client to run creates the row. Any other client which tries at
+	// the same time inserts nothing.
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Leader{
+		Name:      leaderName,
+		LeaderID:  c.id,
+		ExpiresAt: expiresAt,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// resign gives up the leadership of a stopping client, so another client can
+// take over without waiting for it to expire.
+func (c *dbClient) resign() {
+	err := c.db.Where("name = ?", leaderName).Where("leader_id = ?", c.id).Delete(&Leader{}).Error
+	if err != nil {
+		c.logger.Error("could not resign leadership", "err", err)
+	}
+}
+
+func (c *dbClient) insertPeriodicJob(ctx context.Context, job PeriodicJob) error {
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := c.InsertTx(ctx, tx.Statement.ConnPool.(*sql.Tx), job.Args, nil)
+		return err
+	})
+}
@@ -0,0 +1,279 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// UnfinishedJobStates are the states of jobs which have not reached a final state.
+var UnfinishedJobStates = []rivertype.JobState{
+	rivertype.JobStateAvailable,
+	rivertype.JobStatePending,
+	rivertype.JobStateRetryable,
+	rivertype.JobStateRunning,
+	rivertype.JobStateScheduled,
+}
+
+// ErrStopped is the cause of the cancellation of the jobs which a client was
+// working when it was stopped with StopAndCancel.
+var ErrStopped = errors.New("job queue client stopped")
+
+// Interrupted reports whether the context of a job was cancelled by its client
+// being stopped, rather than by the job timing out or being cancelled.
+func Interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrStopped)
+}
+
+// ErrOperationInProgress is returned when inserting a job for a service
+// instance which already has an unfinished job.
+var ErrOperationInProgress = errors.New("an operation is in progress on the instance")
+
+// Client is the job queue used by the broker. River provides it for Postgres
+// and SQLite, and the queue stored in the broker_jobs table provides it for
+// MySQL, which River has no driver for. Both work the same River workers.
+type Client interface {
+	// ID returns the ID of the client, which is recorded on the jobs it works.
+	ID() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	StopAndCancel(ctx context.Context) error
+	Stopped() <-chan struct{}
+
+	// InsertTx inserts a job in a transaction of the broker database, so the job
+	// is only worked if the transaction commits. A job run for a service
+	// instance is refused with ErrOperationInProgress if the instance has an
+	// unfinished job, which is checked in the same transaction, so two requests
+	// cannot both start an operation on the instance.
+	InsertTx(ctx context.Context, tx *sql.Tx, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error)
+	ListJobs(ctx context.Context, params ListParams) ([]*rivertype.JobRow, error)
+	JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error)
+	JobRetry(ctx context.Context, id int64) (*rivertype.JobRow, error)
+	JobCancel(ctx context.Context, id int64) (*rivertype.JobRow, error)
+	QueueGet(ctx context.Context, name string) (*rivertype.Queue, error)
+}
+
+// ListParams filters the jobs returned by Client.ListJobs. Jobs are returned
+// newest first.
+type ListParams struct {
+	// InstanceID only returns the jobs run for the service instance.
+	InstanceID string
+	// States only returns the jobs in these states.
+	States []rivertype.JobState
+	// Limit is the maximum number of jobs returned, 100 by default.
+	Limit int
+}
+
+func (p ListParams) limit() int {
+	return cmp.Or(p.Limit, 100)
+}
+
+// InstanceJobArgs are the arguments of a job which runs an operation on a
+// service instance.
+type InstanceJobArgs interface {
+	river.JobArgs
+	// JobInstance returns the instance and operation the job runs for.
+	JobInstance() JobInstance
+}
+
+// JobInstance identifies the operation a job runs on a service instance.
+type JobInstance struct {
+	ServiceID   string
+	InstanceID  string
+	OperationID string
+	Operation   base.Operation
+	// FailedState is the state of the operation when the job fails.
+	FailedState base.InstanceState
+}
+
+// Workers holds the workers for every kind of job, for both River and the
+// broker_jobs queue.
+type Workers struct {
+	river     *river.Workers
+	units     map[string]workUnitFactory
+	instances map[string]func(encodedArgs []byte) (JobInstance, error)
+	queues    map[string]string
+}
+
+// NewWorkers returns an empty set of workers.
+func NewWorkers() *Workers {
+	return &Workers{
+		river:     river.NewWorkers(),
+		units:     map[string]workUnitFactory{},
+		instances: map[string]func(encodedArgs []byte) (JobInstance, error){},
+		queues:    map[string]string{},
+	}
+}
+
+// Kinds returns the kinds of job which have a worker, in order.
+func (w *Workers) Kinds() []string {
+	return slices.Sorted(maps.Keys(w.units))
+}
+
+// Queue returns the queue which jobs of kind are inserted into by default.
+func (w *Workers) Queue(kind string) string {
+	return w.queues[kind]
+}
+
+// JobInstance returns the instance and operation a job runs for. It returns
+// ErrNotInstanceJob if the arguments of the job's kind do not implement
+// InstanceJobArgs.
+func (w *Workers) JobInstance(row *rivertype.JobRow) (JobInstance, error) {
+	decode, ok := w.instances[row.Kind]
+	if !ok {
+		return JobInstance{}, fmt.Errorf("%w: %s", ErrNotInstanceJob, row.Kind)
+	}
+	return decode(row.EncodedArgs)
+}
+
+// ErrNotInstanceJob is returned for jobs which do not run for a service instance.
+var ErrNotInstanceJob = errors.New("job does not run for a service instance")
+
+// River returns the workers for a River client.
+func (w *Workers) River() *river.Workers {
+	return w.river
+}
+
+// AddWorker registers a worker for the kind of job given by its arguments.
+func AddWorker[T river.JobArgs](workers *Workers, worker river.Worker[T]) {
+	river.AddWorker(workers.river, worker)
+
+	var args T
+	workers.units[args.Kind()] = func(row *rivertype.JobRow) (workUnit, error) {
+		job := &river.Job[T]{JobRow: row}
+		if err := json.Unmarshal(row.EncodedArgs, &job.Args); err != nil {
+			return nil, fmt.Errorf("could not decode arguments for %s job: %w", row.Kind, err)
+		}
+		return &boundWorker[T]{worker: worker, job: job}, nil
+	}
+
+	workers.queues[args.Kind()] = river.QueueDefault
+	if withOpts, ok := any(args).(river.JobArgsWithInsertOpts); ok && withOpts.InsertOpts().Queue != "" {
+		workers.queues[args.Kind()] = withOpts.InsertOpts().Queue
+	}
+
+	if _, ok := any(args).(InstanceJobArgs); ok {
+		workers.instances[args.Kind()] = func(encodedArgs []byte) (JobInstance, error) {
+			var args T
+			if err := json.Unmarshal(encodedArgs, &args); err != nil {
+				return JobInstance{}, fmt.Errorf("could not decode arguments for %s job: %w", args.Kind(), err)
+			}
+			return any(args).(InstanceJobArgs).JobInstance(), nil
+		}
+	}
+}
+
+// workUnit is a worker bound to the job it works.
+type workUnit interface {
+	middleware() []rivertype.WorkerMiddleware
+	nextRetry() time.Time
+	timeout() time.Duration
+	work(ctx context.Context) error
+}
+
+type workUnitFactory func(row *rivertype.JobRow) (workUnit, error)
+
+type boundWorker[T river.JobArgs] struct {
+	worker river.Worker[T]
+	job    *river.Job[T]
+}
+
+func (w *boundWorker[T]) middleware() []rivertype.WorkerMiddleware {
+	return w.worker.Middleware(w.job.JobRow)
+}
+
+func (w *boundWorker[T]) nextRetry() time.Time {
+	return w.worker.NextRetry(w.job)
+}
+
+func (w *boundWorker[T]) timeout() time.Duration {
+	return w.worker.Timeout(w.job)
+}
+
+func (w *boundWorker[T]) work(ctx context.Context) error {
+	return w.worker.Work(ctx, w.job)
+}
+
+type riverClient struct {
+	*river.Client[*sql.Tx]
+
+	cancelWork context.CancelCauseFunc
+}
+
+// NewRiverClient returns a Client backed by River.
+func NewRiverClient(client *river.Client[*sql.Tx]) Client {
+	return &riverClient{Client: client}
+}
+
+func (c *riverClient) Start(ctx context.Context) error {
+	// River cancels the jobs it is working with a cause of its own, which it
+	// does not export, so they are cancelled with ErrStopped first.
+	ctx, c.cancelWork = context.WithCancelCause(ctx)
+	return c.Client.Start(ctx)
+}
+
+func (c *riverClient) StopAndCancel(ctx context.Context) error {
+	if c.cancelWork != nil {
+		c.cancelWork(ErrStopped)
+	}
+	return c.Client.StopAndCancel(ctx)
+}
+
+func (c *riverClient) InsertTx(ctx context.Context, tx *sql.Tx, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	if instanceArgs, ok := args.(InstanceJobArgs); ok && instanceArgs.JobInstance().InstanceID != "" {
+		instanceID := instanceArgs.JobInstance().InstanceID
+		// The lock is held until the transaction ends, so a concurrent insert
+		// for the instance waits to see this job. SQLite only allows a single
+		// writer, so it needs no lock.
+		if c.Driver().DatabaseName() == "postgres" {
+			if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", instanceID); err != nil {
+				return nil, fmt.Errorf("could not lock jobs of instance %s: %w", instanceID, err)
+			}
+		}
+		result, err := c.JobListTx(ctx, tx, jobListParams(ListParams{
+			InstanceID: instanceID,
+			States:     UnfinishedJobStates,
+			Limit:      1,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Jobs) > 0 {
+			return nil, ErrOperationInProgress
+		}
+	}
+	return c.Client.InsertTx(ctx, tx, args, opts)
+}
+
+func (c *riverClient) ListJobs(ctx context.Context, params ListParams) ([]*rivertype.JobRow, error) {
+	result, err := c.JobList(ctx, jobListParams(params))
+	if err != nil {
+		return nil, err
+	}
+	return result.Jobs, nil
+}
+
+func jobListParams(params ListParams) *river.JobListParams {
+	listParams := river.NewJobListParams().
+		OrderBy(river.JobListOrderByID, river.SortOrderDesc).
+		First(params.limit())
+	if len(params.States) > 0 {
+		listParams = listParams.States(params.States...)
+	}
+	if params.InstanceID != "" {
+		// The `->` and `->>` operators with key names work for both the Postgres
+		// and SQLite River drivers.
+		listParams = listParams.Where("args -> 'instance' ->> 'Uuid' = @instance_id", river.NamedArgs{"instance_id": params.InstanceID})
+	}
+	return listParams
+}
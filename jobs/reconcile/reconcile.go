@@ -0,0 +1,66 @@
+// Package reconcile runs the periodic jobs which bring the AWS resources of
+// every instance of a service in line with the broker's records.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"gorm.io/gorm"
+)
+
+// Queue is the queue of the periodic jobs, which is worked separately from the
+// queues of the services so that a sweep over every instance cannot hold up
+// provisioning.
+const Queue = "reconcile"
+
+// Instances reconciles every instance of type T recorded in the database.
+// instance returns the base record of an instance, and reconcile brings its
+// AWS resources in line, returning a description of each change made.
+//
+// Instances with an operation in progress are left to the job running it.
+// Changes and failures are written to the operation log of each instance as a
+// reconcile operation, naming the resources of the service, such as "RDS".
+func Instances[T any](
+	ctx context.Context,
+	db *gorm.DB,
+	logger *slog.Logger,
+	resources string,
+	instance func(*T) *base.Instance,
+	reconcile func(context.Context, *T) ([]string, error),
+) error {
+	instances := []*T{}
+	if err := db.WithContext(ctx).Find(&instances).Error; err != nil {
+		return fmt.Errorf("could not list instances: %w", err)
+	}
+
+	var errs error
+	for _, i := range instances {
+		b := instance(i)
+		inProgress, err := asyncmessage.HasOperationInProgress(db.WithContext(ctx), b.ServiceID, b.Uuid)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if inProgress {
+			logger.Info("skipping reconciliation of instance with an operation in progress", "instance_id", b.Uuid)
+			continue
+		}
+
+		changes, err := reconcile(ctx, i)
+		if err != nil {
+			asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, b.ServiceID, b.Uuid, base.ReconcileOp, base.InstanceNotModified, fmt.Sprintf("Error reconciling %s resources: %s", resources, err))
+			errs = errors.Join(errs, fmt.Errorf("instance %s: %w", b.Uuid, err))
+			continue
+		}
+		if len(changes) > 0 {
+			asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, b.ServiceID, b.Uuid, base.ReconcileOp, base.InstanceReady, fmt.Sprintf("Reconciled %s resources: %s", resources, strings.Join(changes, ", ")))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,122 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/testutil"
+)
+
+type testInstance struct {
+	base.Instance
+}
+
+func TestInstances(t *testing.T) {
+	testCases := map[string]struct {
+		changes             []string
+		reconcileErr        error
+		operationInProgress bool
+		expectErr           bool
+		expectReconciled    bool
+		expectedState       base.InstanceState
+		expectedMessage     string
+	}{
+		"records changes": {
+			changes:          []string{"updated tags of database db-1", "updated tags of parameter group pgroup-1"},
+			expectReconciled: true,
+			expectedState:    base.InstanceReady,
+			expectedMessage:  "Reconciled RDS resources: updated tags of database db-1, updated tags of parameter group pgroup-1",
+		},
+		"records nothing when nothing changed": {
+			expectReconciled: true,
+		},
+		"records failures": {
+			reconcileErr:     errors.New("access denied"),
+			expectErr:        true,
+			expectReconciled: true,
+			expectedState:    base.InstanceNotModified,
+			expectedMessage:  "Error reconciling RDS resources: access denied",
+		},
+		"skips instances with an operation in progress": {
+			operationInProgress: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, err := testutil.TestDbInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.AutoMigrate(&testInstance{}, &asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The test database is shared between tests, so remove the instances
+			// created by any previous test.
+			if err := db.Where("1 = 1").Delete(&testInstance{}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			instance := &testInstance{
+				Instance: base.Instance{
+					Uuid:    helpers.RandStr(10),
+					Request: request.Request{ServiceID: helpers.RandStr(10)},
+				},
+			}
+			if err := db.Create(instance).Error; err != nil {
+				t.Fatal(err)
+			}
+			if test.operationInProgress {
+				err := asyncmessage.WriteAsyncJobMessage(db, instance.ServiceID, instance.Uuid, base.ModifyOp, base.InstanceInProgress, "Modifying")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reconciled := false
+			err = Instances(t.Context(), db, slog.New(&testutil.MockLogHandler{}), "RDS",
+				func(i *testInstance) *base.Instance { return &i.Instance },
+				func(ctx context.Context, i *testInstance) ([]string, error) {
+					reconciled = i.Uuid == instance.Uuid
+					return test.changes, test.reconcileErr
+				},
+			)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if test.expectReconciled != reconciled {
+				t.Errorf("expected instance to be reconciled: %t, got: %t", test.expectReconciled, reconciled)
+			}
+
+			entries, err := asyncmessage.GetOperationLog(db, instance.ServiceID, instance.Uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reconcileEntries := []asyncmessage.OperationLogEntry{}
+			for _, entry := range entries {
+				if entry.JobType == base.ReconcileOp {
+					reconcileEntries = append(reconcileEntries, entry)
+				}
+			}
+			expectOperationLogEntry := test.expectedMessage != ""
+			if expectOperationLogEntry != (len(reconcileEntries) == 1) {
+				t.Fatalf("expected operation log entry: %t, got %+v", expectOperationLogEntry, reconcileEntries)
+			}
+			if expectOperationLogEntry {
+				if reconcileEntries[0].State != test.expectedState {
+					t.Errorf("expected state %s, got %s", test.expectedState, reconcileEntries[0].State)
+				}
+				if reconcileEntries[0].Message != test.expectedMessage {
+					t.Errorf("expected message %q, got %q", test.expectedMessage, reconcileEntries[0].Message)
+				}
+			}
+		})
+	}
+}
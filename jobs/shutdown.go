@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// Stop stops the job queue client from fetching new jobs and waits up to softTimeout
+// for the jobs it is working to finish. Jobs still running after that are
+// cancelled and logged, and the client waits up to hardTimeout for them to
+// return. Cancelled jobs are retried once the broker is running again.
+func Stop(ctx context.Context, client queue.Client, softTimeout time.Duration, hardTimeout time.Duration, logger *slog.Logger) error {
+	logger.Info("stopping river client", "timeout", softTimeout)
+	softCtx, cancelSoft := context.WithTimeout(ctx, softTimeout)
+	defer cancelSoft()
+	err := client.Stop(softCtx)
+	if err == nil {
+		logger.Info("river client stopped")
+		return nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	logger.Warn("river jobs did not finish in time, cancelling them", "timeout", hardTimeout)
+	logInterruptedJobs(ctx, client, logger)
+
+	hardCtx, cancelHard := context.WithTimeout(ctx, hardTimeout)
+	defer cancelHard()
+	return client.StopAndCancel(hardCtx)
+}
+
+// logInterruptedJobs logs the jobs being worked by the client, so operators can
+// follow up on the instances they were run for.
+func logInterruptedJobs(ctx context.Context, client queue.Client, logger *slog.Logger) {
+	jobs, err := client.ListJobs(ctx, queue.ListParams{
+		States: []rivertype.JobState{rivertype.JobStateRunning},
+		Limit:  1000,
+	})
+	if err != nil {
+		logger.Error("could not list running river jobs", "err", err)
+		return
+	}
+
+	for _, job := range jobs {
+		// Running jobs may be worked by the clients of other broker instances,
+		// which are not stopping. The last client to attempt a running job is the
+		// one working it.
+		if len(job.AttemptedBy) == 0 || job.AttemptedBy[len(job.AttemptedBy)-1] != client.ID() {
+			continue
+		}
+		args := struct {
+			Instance struct {
+				Uuid string
+			} `json:"instance"`
+			OperationID string `json:"operation_id"`
+		}{}
+		_ = json.Unmarshal(job.EncodedArgs, &args)
+		logger.Warn(
+			"river job interrupted by shutdown",
+			"job_id", job.ID,
+			"kind", job.Kind,
+			"attempt", job.Attempt,
+			"instance_id", args.Instance.Uuid,
+			"operation_id", args.OperationID,
+		)
+	}
+}
@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+type blockingArgs struct{}
+
+func (blockingArgs) Kind() string { return "blocking-test" }
+
+// blockingWorker works jobs until they are cancelled.
+type blockingWorker struct {
+	river.WorkerDefaults[blockingArgs]
+	started chan struct{}
+	cause   error
+}
+
+func (w *blockingWorker) Work(ctx context.Context, job *river.Job[blockingArgs]) error {
+	close(w.started)
+	<-ctx.Done()
+	w.cause = context.Cause(ctx)
+	return ctx.Err()
+}
+
+func TestStopCancelsJobsAfterSoftTimeout(t *testing.T) {
+	ctx := context.Background()
+	dbConfig, err := testutil.InitTestDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+
+	worker := &blockingWorker{started: make(chan struct{})}
+	workers := queue.NewWorkers()
+	queue.AddWorker(workers, worker)
+
+	client, err := NewClient(ctx, db, dbConfig, logger, workers, nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	result, err := client.InsertTx(ctx, tx.Statement.ConnPool.(*sql.Tx), blockingArgs{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-worker.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("job was not worked")
+	}
+
+	if err := Stop(ctx, client, 100*time.Millisecond, 5*time.Second, logger); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !errors.Is(worker.cause, queue.ErrStopped) {
+		t.Errorf("expected the job to be cancelled by the client stopping, got %v", worker.cause)
+	}
+
+	job, err := client.JobGet(ctx, result.Job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != rivertype.JobStateAvailable && job.State != rivertype.JobStateRetryable {
+		t.Errorf("expected the cancelled job to be retried, got %s", job.State)
+	}
+	if !strings.Contains(logs.String(), "river job interrupted by shutdown") || !strings.Contains(logs.String(), "kind=blocking-test") {
+		t.Errorf("expected the interrupted job to be logged, got:\n%s", logs.String())
+	}
+}
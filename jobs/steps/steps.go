@@ -0,0 +1,288 @@
+// Package steps runs the steps of an asynchronous job, recording a checkpoint
+// after each step completes so that a retry of the job resumes after the last
+// completed step instead of starting again from the top.
+package steps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+// Checkpoint records that a step of a job completed, along with the state of
+// the job after the step, so that a retry of the job can skip the step.
+type Checkpoint struct {
+	ID        uint   `gorm:"primaryKey; autoIncrement"`
+	JobID     int64  `gorm:"not null; uniqueIndex:idx_job_checkpoints_step"`
+	Step      string `gorm:"not null; size:255; uniqueIndex:idx_job_checkpoints_step"`
+	State     []byte
+	CreatedAt time.Time
+}
+
+func (Checkpoint) TableName() string { return "job_checkpoints" }
+
+// Operation identifies the operation a job runs for an instance, for the async
+// job messages written by a Runner.
+type Operation struct {
+	ServiceID  string
+	InstanceID string
+	Operation  base.Operation
+	// FailedState is the state written when the operation fails permanently,
+	// such as InstanceNotCreated.
+	FailedState base.InstanceState
+}
+
+// Step is a single step of a job.
+type Step struct {
+	// Name identifies the checkpoint recorded once the step completes, such as
+	// "primary available". Steps without a name are run on every attempt.
+	Name string
+	// Message is written as an in progress async job message before the step runs.
+	Message string
+	// ErrorMessage describes a failure of the step in the async job message.
+	ErrorMessage string
+	Run          func(ctx context.Context) error
+	// Rollback removes what the step created. Once the step has completed, its
+	// rollback is run if a later step fails permanently.
+	Rollback func(ctx context.Context) error
+}
+
+// Runner runs the steps of the job carried by its context. Steps completed by
+// an earlier attempt of the job are skipped, and the state of the job is
+// restored from the last checkpoint.
+//
+// When a step fails with a transient error and the job has attempts left, the
+// error is returned for River to retry the job. Any other failure rolls back
+// the completed steps and cancels the job.
+//
+// Without a job in the context, as when a worker is called directly, nothing
+// is recorded and every failure is permanent.
+type Runner struct {
+	db        *gorm.DB
+	logger    *slog.Logger
+	job       *rivertype.JobRow
+	operation Operation
+	state     any
+	completed map[string]bool
+	rollbacks []Step
+}
+
+// NewRunner returns a Runner for the job carried by ctx. state is saved with
+// every checkpoint as JSON, and is decoded from the last checkpoint of an
+// earlier attempt of the job.
+func NewRunner(ctx context.Context, db *gorm.DB, logger *slog.Logger, operation Operation, state any) (*Runner, error) {
+	r := &Runner{
+		db:        db,
+		logger:    logger,
+		job:       asyncmessage.JobFromContext(ctx),
+		operation: operation,
+		state:     state,
+		completed: map[string]bool{},
+	}
+	if r.job == nil {
+		return r, nil
+	}
+
+	checkpoints := []Checkpoint{}
+	if err := db.WithContext(ctx).Where("job_id = ?", r.job.ID).Order("id").Find(&checkpoints).Error; err != nil {
+		return nil, fmt.Errorf("could not load checkpoints of job %d: %w", r.job.ID, err)
+	}
+	for _, checkpoint := range checkpoints {
+		r.completed[checkpoint.Step] = true
+	}
+	if len(checkpoints) > 0 && state != nil {
+		last := checkpoints[len(checkpoints)-1]
+		if err := json.Unmarshal(last.State, state); err != nil {
+			return nil, fmt.Errorf("could not restore state of job %d from checkpoint %q: %w", r.job.ID, last.Step, err)
+		}
+		logger.Info("resuming job from checkpoint", "job_id", r.job.ID, "step", last.Step)
+	}
+	return r, nil
+}
+
+// Run runs a step unless it was completed by an earlier attempt of the job.
+// The returned error should be returned by the worker as it is.
+func (r *Runner) Run(ctx context.Context, step Step) error {
+	if step.Name != "" && r.completed[step.Name] {
+		r.addRollback(step)
+		return nil
+	}
+
+	if step.Message != "" {
+		r.writeMessage(ctx, base.InstanceInProgress, step.Message)
+	}
+	if err := step.Run(ctx); err != nil {
+		return r.fail(ctx, step, err)
+	}
+
+	r.addRollback(step)
+	if step.Name != "" && r.job != nil {
+		r.checkpoint(ctx, step.Name)
+	}
+	return nil
+}
+
+// Finish removes the checkpoints of a job which has completed.
+func (r *Runner) Finish(ctx context.Context) {
+	if r.job == nil {
+		return
+	}
+	err := r.db.WithContext(context.WithoutCancel(ctx)).Where("job_id = ?", r.job.ID).Delete(&Checkpoint{}).Error
+	if err != nil {
+		r.logger.Error("could not remove job checkpoints", "job_id", r.job.ID, "err", err)
+	}
+}
+
+func (r *Runner) addRollback(step Step) {
+	if step.Rollback != nil {
+		r.rollbacks = append(r.rollbacks, step)
+	}
+}
+
+func (r *Runner) checkpoint(ctx context.Context, name string) {
+	r.completed[name] = true
+
+	state, err := json.Marshal(r.state)
+	if err != nil {
+		r.logger.Error("could not encode job state", "job_id", r.job.ID, "step", name, "err", err)
+		return
+	}
+	// A missing checkpoint only means the step is run again by a retry.
+	err = r.db.WithContext(ctx).Create(&Checkpoint{JobID: r.job.ID, Step: name, State: state}).Error
+	if err != nil {
+		r.logger.Error("could not record job checkpoint", "job_id", r.job.ID, "step", name, "err", err)
+	}
+}
+
+func (r *Runner) fail(ctx context.Context, step Step, err error) error {
+	wrapped := fmt.Errorf("%s: %w", step.ErrorMessage, err)
+
+	// Jobs interrupted by the broker shutting down are retried once it is
+	// running again, so nothing is rolled back. A job which timed out or was
+	// cancelled fails like any other.
+	if r.retryable() && (IsTransient(err) || queue.Interrupted(ctx)) {
+		r.logger.Warn("job step failed, retrying", "job_id", r.job.ID, "step", step.Name, "attempt", r.job.Attempt, "err", err)
+		r.writeMessage(ctx, base.InstanceInProgress, fmt.Sprintf("%s, retrying: %s", step.ErrorMessage, err))
+		return wrapped
+	}
+
+	r.logger.Error("job step failed", "step", step.Name, "err", err)
+	r.rollback(ctx)
+	r.writeMessage(ctx, r.operation.FailedState, fmt.Sprintf("%s: %s", step.ErrorMessage, err))
+	r.Finish(ctx)
+	return river.JobCancel(wrapped)
+}
+
+func (r *Runner) retryable() bool {
+	return r.job != nil && r.job.Attempt < r.job.MaxAttempts
+}
+
+// rollback runs the rollbacks of the completed steps in reverse order. A
+// failed rollback is logged and does not stop the others.
+func (r *Runner) rollback(ctx context.Context) {
+	if len(r.rollbacks) == 0 {
+		return
+	}
+	r.writeMessage(ctx, base.InstanceInProgress, "Removing partially created resources")
+
+	// Removing resources should not be cut short by the job being cancelled.
+	ctx = context.WithoutCancel(ctx)
+	for i := len(r.rollbacks) - 1; i >= 0; i-- {
+		if err := r.rollbacks[i].Rollback(ctx); err != nil {
+			r.logger.Error("could not roll back job step", "step", r.rollbacks[i].Name, "err", err)
+		}
+	}
+	r.rollbacks = nil
+}
+
+func (r *Runner) writeMessage(ctx context.Context, state base.InstanceState, message string) {
+	asyncmessage.WriteAsyncJobMessageAndLogError(
+		r.db.WithContext(ctx),
+		r.logger,
+		r.operation.ServiceID,
+		r.operation.InstanceID,
+		r.operation.Operation,
+		state,
+		message,
+	)
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks an error as transient, for failures which AWS does not
+// report as retryable but which are expected to clear, such as an instance
+// which is not yet in a state to accept a request.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether a step failing with err may succeed if it is run
+// again: the error was not caused by the job's context being done, and it was
+// marked with Transient, or it is an AWS error which the
+// SDK treats as retryable or as throttling, including one which used up the
+// SDK's own retries.
+func IsTransient(err error) bool {
+	// The SDK treats errors with a Timeout method as retryable, which includes
+	// the job running out of time.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var maxAttempts *retry.MaxAttemptsError
+	if errors.As(err, &maxAttempts) {
+		return true
+	}
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary {
+		return true
+	}
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// RetryIfInterrupted returns err as it is, unless ctx was cancelled by the
+// broker shutting down, rather than by the job timing out or being cancelled.
+// Workers which do not run their work through a Runner cancel the job on any
+// failure, so an interrupted job is instead recorded as in progress and its
+// error returned without the cancellation, for River to retry the job once the
+// broker is running again.
+func RetryIfInterrupted(ctx context.Context, db *gorm.DB, logger *slog.Logger, operation Operation, err error) error {
+	if err == nil || !queue.Interrupted(ctx) || asyncmessage.JobFromContext(ctx) == nil {
+		return err
+	}
+	logger.Warn("job interrupted by shutdown, retrying", "instance_id", operation.InstanceID, "err", err)
+	asyncmessage.WriteAsyncJobMessageAndLogError(
+		db.WithContext(ctx),
+		logger,
+		operation.ServiceID,
+		operation.InstanceID,
+		operation.Operation,
+		base.InstanceInProgress,
+		"Interrupted by the broker shutting down, retrying",
+	)
+	// The error is formatted rather than wrapped, as wrapping a cancellation
+	// would still cancel the job.
+	return fmt.Errorf("job interrupted: %v", err)
+}
@@ -0,0 +1,406 @@
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+)
+
+type testState struct {
+	Created []string `json:"created"`
+}
+
+func testDBInit(t *testing.T) *gorm.DB {
+	db, err := testutil.TestDbInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}, &Checkpoint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testOperation() Operation {
+	return Operation{
+		ServiceID:   helpers.RandStr(10),
+		InstanceID:  helpers.RandStr(10),
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}
+}
+
+// runSteps runs three steps which each record their name in the state, with
+// the second step failing with err if it is not nil.
+func runSteps(ctx context.Context, t *testing.T, db *gorm.DB, operation Operation, err error, calls *[]string) (*testState, error) {
+	state := &testState{}
+	runner, newErr := NewRunner(ctx, db, slog.New(&testutil.MockLogHandler{}), operation, state)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+
+	for _, name := range []string{"first", "second", "third"} {
+		runErr := runner.Run(ctx, Step{
+			Name:         name,
+			Message:      "Running " + name,
+			ErrorMessage: "Error running " + name,
+			Run: func(ctx context.Context) error {
+				*calls = append(*calls, name)
+				if name == "second" && err != nil {
+					return err
+				}
+				state.Created = append(state.Created, name)
+				return nil
+			},
+			Rollback: func(ctx context.Context) error {
+				*calls = append(*calls, "rollback "+name)
+				return nil
+			},
+		})
+		if runErr != nil {
+			return state, runErr
+		}
+	}
+	runner.Finish(ctx)
+	return state, nil
+}
+
+func TestRunnerResumesFromCheckpoint(t *testing.T) {
+	db := testDBInit(t)
+	operation := testOperation()
+	job := &rivertype.JobRow{ID: 1, Attempt: 1, MaxAttempts: 3}
+	ctx := asyncmessage.ContextWithJob(context.Background(), job)
+
+	throttled := &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}
+	calls := []string{}
+	_, err := runSteps(ctx, t, db, operation, throttled, &calls)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var cancelErr *rivertype.JobCancelError
+	if errors.As(err, &cancelErr) {
+		t.Fatal("expected transient error not to cancel the job")
+	}
+	msg, err := asyncmessage.GetLastAsyncJobMessage(db, operation.ServiceID, operation.InstanceID, operation.Operation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.JobState.State != base.InstanceInProgress {
+		t.Errorf("expected state in progress, got %s", msg.JobState.State)
+	}
+
+	job.Attempt++
+	state, err := runSteps(ctx, t, db, operation, nil, &calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(calls, []string{"first", "second", "second", "third"}) {
+		t.Errorf("expected first step not to run again, got calls %v", calls)
+	}
+	if !slices.Equal(state.Created, []string{"first", "second", "third"}) {
+		t.Errorf("expected state to be restored from checkpoint, got %v", state.Created)
+	}
+
+	var count int64
+	if err := db.Model(&Checkpoint{}).Where("job_id = ?", job.ID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected checkpoints to be removed when the job finishes, got %d", count)
+	}
+}
+
+func TestRunnerFailure(t *testing.T) {
+	testCases := map[string]struct {
+		job           *rivertype.JobRow
+		err           error
+		expectCancel  bool
+		expectedCalls []string
+	}{
+		"permanent error rolls back completed steps": {
+			job:           &rivertype.JobRow{ID: 2, Attempt: 1, MaxAttempts: 3},
+			err:           errors.New("invalid parameter"),
+			expectCancel:  true,
+			expectedCalls: []string{"first", "second", "rollback first"},
+		},
+		"transient error on last attempt rolls back completed steps": {
+			job:           &rivertype.JobRow{ID: 3, Attempt: 3, MaxAttempts: 3},
+			err:           Transient(errors.New("instance not available")),
+			expectCancel:  true,
+			expectedCalls: []string{"first", "second", "rollback first"},
+		},
+		"transient error without a job is permanent": {
+			err:           Transient(errors.New("instance not available")),
+			expectCancel:  true,
+			expectedCalls: []string{"first", "second", "rollback first"},
+		},
+		"transient error is retried": {
+			job:           &rivertype.JobRow{ID: 4, Attempt: 1, MaxAttempts: 3},
+			err:           Transient(errors.New("instance not available")),
+			expectedCalls: []string{"first", "second"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := testDBInit(t)
+			operation := testOperation()
+			ctx := asyncmessage.ContextWithJob(context.Background(), test.job)
+
+			calls := []string{}
+			_, err := runSteps(ctx, t, db, operation, test.err, &calls)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var cancelErr *rivertype.JobCancelError
+			if errors.As(err, &cancelErr) != test.expectCancel {
+				t.Errorf("expected job cancelled: %t, got error %s", test.expectCancel, err)
+			}
+			if !slices.Equal(calls, test.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", test.expectedCalls, calls)
+			}
+
+			msg, err := asyncmessage.GetLastAsyncJobMessage(db, operation.ServiceID, operation.InstanceID, operation.Operation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedState := base.InstanceInProgress
+			if test.expectCancel {
+				expectedState = base.InstanceNotCreated
+			}
+			if msg.JobState.State != expectedState {
+				t.Errorf("expected state %s, got %s", expectedState, msg.JobState.State)
+			}
+		})
+	}
+}
+
+// cancelledWith returns a context which has been cancelled with cause.
+func cancelledWith(cause error) func(ctx context.Context) (context.Context, context.CancelFunc) {
+	return func(ctx context.Context) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancelCause(ctx)
+		cancel(cause)
+		return ctx, func() {}
+	}
+}
+
+// timedOut returns a context whose deadline has passed.
+func timedOut(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 0)
+}
+
+func TestRunnerFailureOnCancelledContext(t *testing.T) {
+	testCases := map[string]struct {
+		job           *rivertype.JobRow
+		cancel        func(ctx context.Context) (context.Context, context.CancelFunc)
+		expectCancel  bool
+		expectedCalls []string
+	}{
+		"interrupted by shutdown is retried": {
+			job:           &rivertype.JobRow{ID: 5, Attempt: 1, MaxAttempts: 3},
+			cancel:        cancelledWith(queue.ErrStopped),
+			expectedCalls: []string{"first", "second"},
+		},
+		"timed out rolls back completed steps": {
+			job:           &rivertype.JobRow{ID: 6, Attempt: 1, MaxAttempts: 3},
+			cancel:        timedOut,
+			expectCancel:  true,
+			expectedCalls: []string{"first", "second", "rollback first"},
+		},
+		"cancelled rolls back completed steps": {
+			job:           &rivertype.JobRow{ID: 7, Attempt: 1, MaxAttempts: 3},
+			cancel:        cancelledWith(rivertype.ErrJobCancelledRemotely),
+			expectCancel:  true,
+			expectedCalls: []string{"first", "second", "rollback first"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := testDBInit(t)
+			operation := testOperation()
+			ctx := asyncmessage.ContextWithJob(t.Context(), test.job)
+			runner, err := NewRunner(ctx, db, slog.New(&testutil.MockLogHandler{}), operation, &testState{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := []string{}
+			err = runner.Run(ctx, Step{
+				Name: "first",
+				Run: func(ctx context.Context) error {
+					calls = append(calls, "first")
+					return nil
+				},
+				Rollback: func(ctx context.Context) error {
+					calls = append(calls, "rollback first")
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stepCtx, cancel := test.cancel(ctx)
+			defer cancel()
+			err = runner.Run(stepCtx, Step{
+				Name:         "second",
+				ErrorMessage: "Error running second",
+				Run: func(ctx context.Context) error {
+					calls = append(calls, "second")
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var cancelErr *rivertype.JobCancelError
+			if errors.As(err, &cancelErr) != test.expectCancel {
+				t.Errorf("expected job cancelled: %t, got error %s", test.expectCancel, err)
+			}
+			if !slices.Equal(calls, test.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", test.expectedCalls, calls)
+			}
+
+			msg, err := asyncmessage.GetLastAsyncJobMessage(db, operation.ServiceID, operation.InstanceID, operation.Operation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedState := base.InstanceInProgress
+			if test.expectCancel {
+				expectedState = base.InstanceNotCreated
+			}
+			if msg.JobState.State != expectedState {
+				t.Errorf("expected state %s, got %s", expectedState, msg.JobState.State)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"plain error": {
+			err: errors.New("invalid parameter"),
+		},
+		"marked transient": {
+			err:      Transient(errors.New("instance not available")),
+			expected: true,
+		},
+		"throttling": {
+			err:      &smithy.GenericAPIError{Code: "ThrottlingException"},
+			expected: true,
+		},
+		"retryable AWS error code": {
+			err:      &smithy.GenericAPIError{Code: "RequestTimeout"},
+			expected: true,
+		},
+		"non-retryable AWS error code": {
+			err: &smithy.GenericAPIError{Code: "InvalidParameterValue"},
+		},
+		"job timed out": {
+			err: fmt.Errorf("error describing instance: %w", context.DeadlineExceeded),
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if IsTransient(test.err) != test.expected {
+				t.Errorf("expected transient: %t", test.expected)
+			}
+		})
+	}
+}
+
+func TestRetryIfInterrupted(t *testing.T) {
+	testCases := map[string]struct {
+		err           error
+		cancel        func(ctx context.Context) (context.Context, context.CancelFunc)
+		expectCancel  bool
+		expectedState base.InstanceState
+	}{
+		"failure cancels the job": {
+			err:           river.JobCancel(errors.New("error modifying database")),
+			expectCancel:  true,
+			expectedState: base.InstanceNotModified,
+		},
+		"failure on shutdown is retried": {
+			err:           river.JobCancel(errors.New("error modifying database")),
+			cancel:        cancelledWith(queue.ErrStopped),
+			expectedState: base.InstanceInProgress,
+		},
+		"failure on timeout cancels the job": {
+			err:           river.JobCancel(errors.New("error modifying database")),
+			cancel:        timedOut,
+			expectCancel:  true,
+			expectedState: base.InstanceNotModified,
+		},
+		"failure when the job is cancelled cancels the job": {
+			err:           river.JobCancel(errors.New("error modifying database")),
+			cancel:        cancelledWith(rivertype.ErrJobCancelledRemotely),
+			expectCancel:  true,
+			expectedState: base.InstanceNotModified,
+		},
+		"success on shutdown": {
+			cancel:        cancelledWith(queue.ErrStopped),
+			expectedState: base.InstanceNotModified,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := testDBInit(t)
+			operation := Operation{
+				ServiceID:  helpers.RandStr(10),
+				InstanceID: helpers.RandStr(10),
+				Operation:  base.ModifyOp,
+			}
+			// The worker writes a failure before returning its error.
+			err := asyncmessage.WriteAsyncJobMessage(db, operation.ServiceID, operation.InstanceID, operation.Operation, base.InstanceNotModified, "Error modifying database")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := asyncmessage.ContextWithJob(t.Context(), &rivertype.JobRow{ID: 1})
+			if test.cancel != nil {
+				var cancel context.CancelFunc
+				ctx, cancel = test.cancel(ctx)
+				defer cancel()
+			}
+
+			err = RetryIfInterrupted(ctx, db, slog.New(&testutil.MockLogHandler{}), operation, test.err)
+			if (err != nil) != (test.err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.err != nil, err)
+			}
+			var cancelErr *rivertype.JobCancelError
+			if errors.As(err, &cancelErr) != test.expectCancel {
+				t.Errorf("expected job cancelled: %t, got error %v", test.expectCancel, err)
+			}
+
+			msg, err := asyncmessage.GetLastAsyncJobMessage(db, operation.ServiceID, operation.InstanceID, operation.Operation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.JobState.State != test.expectedState {
+				t.Errorf("expected state %s, got %s", test.expectedState, msg.JobState.State)
+			}
+		})
+	}
+}
@@ -5,21 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/brokerapi/v13"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/elasticache"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/opensearch"
 	awsRds "github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/cloud-gov/aws-broker/asyncmessage"
-	"github.com/cloud-gov/aws-broker/base"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/cloud-gov/aws-broker/admin"
+	brokerAws "github.com/cloud-gov/aws-broker/aws"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/health"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
+	"github.com/cloud-gov/aws-broker/metrics"
 	"github.com/cloud-gov/aws-broker/services/elasticsearch"
 	"github.com/cloud-gov/aws-broker/services/rds"
 	"github.com/cloud-gov/aws-broker/services/redis"
@@ -32,11 +44,15 @@ import (
 	"github.com/cloud-gov/aws-broker/broker"
 	"github.com/cloud-gov/aws-broker/db"
 	jobs "github.com/cloud-gov/aws-broker/jobs"
+	"gorm.io/gorm"
 )
 
 func run(ctx context.Context, out io.Writer) error {
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancel()
+	// Signals start a graceful shutdown, so they cancel a separate context from
+	// the one used to run the broker. Cancelling the context River was started
+	// with would stop it without letting the jobs it is working finish.
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	var settings config.Settings
 
@@ -59,13 +75,10 @@ func run(ctx context.Context, out io.Writer) error {
 		return fmt.Errorf("error initializing database: %s", err)
 	}
 
-	logger.Debug("run: Migrating GORM models")
-	// Automigrate!
-	err = db.AutoMigrate(&rds.RDSInstance{}, &redis.RedisInstance{}, &elasticsearch.ElasticsearchInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{}) // Add all your models here to help setup the database tables
-	if err != nil {
-		return fmt.Errorf("error migrating GORM models: %s", err)
+	logger.Debug("run: checking database migrations")
+	if err := checkMigrations(ctx, db, &settings, logger); err != nil {
+		return fmt.Errorf("error checking database migrations: %w", err)
 	}
-	logger.Debug("run: Migrated GORM models")
 
 	cfg, err := awsConfig.LoadDefaultConfig(
 		ctx,
@@ -74,51 +87,8 @@ func run(ctx context.Context, out io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("error loading AWS config: %s", err)
 	}
-
-	logger.Debug("run: initializing River workers and client")
-	workers := river.NewWorkers()
-
-	// RDS workers
-	rdsClient := awsRds.NewFromConfig(cfg)
-	parameterGroupClient := rds.NewAwsParameterGroupClient(ctx, rdsClient, &settings, logger)
-	optionGroupClient := rds.NewAwsOptionGroupClient(ctx, rdsClient, &settings, logger)
-	credentialUtils := &rds.RDSCredentialUtils{}
-	river.AddWorker(workers, rds.NewCreateWorker(
-		db, &settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
-	))
-	river.AddWorker(workers, rds.NewModifyWorker(
-		db, &settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
-	))
-	river.AddWorker(workers, rds.NewDeleteWorker(
-		db, &settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
-	))
-
-	// ElastiCache workers
-	elasticacheClient := elasticache.NewFromConfig(cfg)
-	s3 := s3.NewFromConfig(cfg)
-	river.AddWorker(workers, redis.NewModifyWorker(
-		db, &settings, elasticacheClient, logger,
-	))
-	river.AddWorker(workers, redis.NewDeleteWorker(
-		db, &settings, elasticacheClient, s3, logger,
-	))
-
-	// OpenSearch workers
-	opensearch := opensearch.NewFromConfig(cfg)
-	iamSvc := iam.NewFromConfig(cfg)
-	river.AddWorker(workers, elasticsearch.NewDeleteWorker(
-		db, &settings, opensearch, iamSvc, s3, logger,
-	))
-
-	riverClient, err := jobs.NewClient(ctx, db, settings.DbConfig, logger, workers)
-	if err != nil {
-		return fmt.Errorf("error creating river client: %w", err)
-	}
-
-	logger.Debug("run: starting River server")
-	if err = riverClient.Start(ctx); err != nil {
-		return fmt.Errorf("error starting river client: %w", err)
-	}
+	metrics.InstrumentAWSConfig(&cfg)
+	configureKeyProvider(&settings, cfg)
 
 	logger.Debug("run: initializing tags manager")
 	tagManager, err := brokertags.NewCFTagManager(
@@ -135,6 +105,21 @@ func run(ctx context.Context, out io.Writer) error {
 	path, _ := os.Getwd()
 	c := catalog.InitCatalog(path)
 
+	logger.Debug("run: initializing River workers and client")
+	stsClient := sts.NewFromConfig(cfg)
+	workers := newWorkers(ctx, db, &settings, c, tagManager, cfg, stsClient, logger)
+
+	queues := newQueues(&settings)
+	riverClient, err := jobs.NewClient(ctx, db, settings.DbConfig, logger, workers, queues, settings.MaxJobTimeout(), newPeriodicJobs(&settings))
+	if err != nil {
+		return fmt.Errorf("error creating river client: %w", err)
+	}
+
+	logger.Debug("run: starting River server")
+	if err = riverClient.Start(ctx); err != nil {
+		return fmt.Errorf("error starting river client: %w", err)
+	}
+
 	username := os.Getenv("AUTH_USER")
 	password := os.Getenv("AUTH_PASS")
 
@@ -155,8 +140,50 @@ func run(ctx context.Context, out io.Writer) error {
 	)
 	brokerAPI := brokerapi.New(serviceBroker, logger, credentials)
 
+	adminUsername := os.Getenv("ADMIN_USER")
+	adminPassword := os.Getenv("ADMIN_PASS")
+	var adminSrv *http.Server
+	if adminUsername != "" && adminPassword != "" {
+		logger.Debug("run: starting admin web server")
+		adminAPI := admin.New(db, c, riverClient, logger, admin.Credentials{
+			Username: adminUsername,
+			Password: adminPassword,
+		})
+		adminSrv = &http.Server{
+			Addr:              fmt.Sprintf(":%s", settings.AdminPort),
+			Handler:           adminAPI,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		}
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("admin web server failed", "err", err)
+			}
+		}()
+	} else {
+		// The metrics are only served by the admin web server, so make it clear
+		// that they are missing too.
+		logger.Warn("run: ADMIN_USER and ADMIN_PASS are not set, not starting admin web server; the admin API and the Prometheus metrics at /metrics are not served")
+	}
+
+	logger.Debug("run: initializing health checks")
+	livenessChecks := []health.Check{
+		health.DatabaseCheck(db),
+		// the client works the default queue as well as the queues of the services
+		health.RiverCheck(riverClient, append([]string{river.QueueDefault}, slices.Sorted(maps.Keys(queues))...)),
+	}
+	readinessChecks := []health.Check{}
+	if settings.HealthCheckAWSFeature {
+		readinessChecks = append(readinessChecks, health.AWSCheck(stsClient))
+	}
+	healthChecker := health.New(logger, livenessChecks, readinessChecks)
+
 	logger.Debug("run: starting web server")
 	http.Handle("/", brokerAPI)
+	http.HandleFunc("/healthz", healthChecker.Healthz)
+	http.HandleFunc("/readyz", healthChecker.Readyz)
 	// Use an explicit http.Server with timeouts rather than http.ListenAndServe,
 	// which sets none (Slowloris exposure on this network-facing OSBAPI server;
 	// gosec G114). Handler is nil so it uses DefaultServeMux, preserving the
@@ -171,16 +198,160 @@ func run(ctx context.Context, out io.Writer) error {
 		WriteTimeout:      180 * time.Second,
 		IdleTimeout:       120 * time.Second,
 	}
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return err
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-serverErr:
+		logger.Error("run: web server failed", "err", serveErr)
+	case <-signalCtx.Done():
+		logger.Info("run: received signal, shutting down")
 	}
+	// Restore the default behavior of signals, so a second signal kills the
+	// broker without waiting for the shutdown to finish.
+	stop()
 
-	return nil
+	return errors.Join(serveErr, shutdown(ctx, &settings, logger, riverClient, srv, adminSrv))
+}
+
+// newWorkers returns the workers for every kind of job run by the broker.
+func newWorkers(ctx context.Context, db *gorm.DB, settings *config.Settings, catalog *catalog.Catalog, tagManager brokertags.TagManager, cfg aws.Config, stsClient *sts.Client, logger *slog.Logger) *queue.Workers {
+	workers := queue.NewWorkers()
+
+	// RDS workers
+	rdsClient := awsRds.NewFromConfig(cfg)
+	parameterGroupClient := rds.NewAwsParameterGroupClient(ctx, rdsClient, settings, logger)
+	optionGroupClient := rds.NewAwsOptionGroupClient(ctx, rdsClient, settings, logger)
+	credentialUtils := &rds.RDSCredentialUtils{}
+	queue.AddWorker(workers, rds.NewCreateWorker(
+		db, settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
+	))
+	queue.AddWorker(workers, rds.NewModifyWorker(
+		db, settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
+	))
+	queue.AddWorker(workers, rds.NewDeleteWorker(
+		db, settings, rdsClient, logger, parameterGroupClient, optionGroupClient, credentialUtils,
+	))
+	queue.AddWorker(workers, rds.NewReconcileWorker(
+		db, settings, catalog, rdsClient, cloudwatchlogs.NewFromConfig(cfg), tagManager, logger,
+	))
+	queue.AddWorker(workers, rds.NewSnapshotWorker(
+		db, settings, rdsClient, logger,
+	))
+	queue.AddWorker(workers, rds.NewSnapshotPurgeWorker(
+		db, settings, rdsClient, logger,
+	))
+
+	// ElastiCache workers
+	elasticacheClient := elasticache.NewFromConfig(cfg)
+	s3 := s3.NewFromConfig(cfg)
+	queue.AddWorker(workers, redis.NewCreateWorker(
+		db, settings, elasticacheClient, logger,
+	))
+	queue.AddWorker(workers, redis.NewModifyWorker(
+		db, settings, elasticacheClient, logger,
+	))
+	queue.AddWorker(workers, redis.NewDeleteWorker(
+		db, settings, elasticacheClient, s3, logger,
+	))
+	queue.AddWorker(workers, redis.NewReconcileWorker(
+		db, settings, catalog, elasticacheClient, tagManager, logger,
+	))
+
+	// OpenSearch workers
+	opensearch := opensearch.NewFromConfig(cfg)
+	iamSvc := iam.NewFromConfig(cfg)
+	queue.AddWorker(workers, elasticsearch.NewCreateWorker(
+		db, settings, opensearch, iamSvc, stsClient, logger,
+	))
+	queue.AddWorker(workers, elasticsearch.NewModifyWorker(
+		db, settings, opensearch, logger,
+	))
+	queue.AddWorker(workers, elasticsearch.NewDeleteWorker(
+		db, settings, opensearch, iamSvc, s3, logger,
+	))
+	queue.AddWorker(workers, elasticsearch.NewReconcileWorker(
+		db, settings, catalog, opensearch, tagManager, logger,
+	))
+
+	return workers
+}
+
+// newQueues returns the configuration of the queue which works the jobs of each
+// service, so that slow jobs of one service cannot hold up the others, and of
+// the queue which works the periodic jobs.
+func newQueues(settings *config.Settings) map[string]river.QueueConfig {
+	return map[string]river.QueueConfig{
+		rds.Queue:           {MaxWorkers: settings.RDSQueue.MaxWorkers},
+		redis.Queue:         {MaxWorkers: settings.RedisQueue.MaxWorkers},
+		elasticsearch.Queue: {MaxWorkers: settings.OpenSearchQueue.MaxWorkers},
+		reconcile.Queue:     {MaxWorkers: settings.ReconcileQueueMaxWorkers},
+	}
+}
+
+// newPeriodicJobs returns the jobs which reconcile the AWS resources of every
+// instance with the broker's records, and purge the expired RDS snapshots.
+func newPeriodicJobs(settings *config.Settings) []queue.PeriodicJob {
+	return []queue.PeriodicJob{
+		{Interval: settings.ReconcileInterval, Args: rds.ReconcileArgs{}},
+		{Interval: settings.ReconcileInterval, Args: redis.ReconcileArgs{}},
+		{Interval: settings.ReconcileInterval, Args: elasticsearch.ReconcileArgs{}},
+		{Interval: settings.ReconcileInterval, Args: rds.SnapshotPurgeArgs{}},
+	}
+}
+
+// configureKeyProvider encrypts the secrets stored by the broker with data keys
+// wrapped by AWS KMS, if a KMS key is configured.
+func configureKeyProvider(settings *config.Settings, cfg aws.Config) {
+	if settings.KMSKeyID != "" {
+		settings.KeyProvider = brokerAws.NewKMSKeyProvider(kms.NewFromConfig(cfg), settings.KMSKeyID)
+	}
+}
+
+// shutdown stops the web servers accepting new requests and waits for the
+// requests in progress to finish, then stops River.
+func shutdown(
+	ctx context.Context,
+	settings *config.Settings,
+	logger *slog.Logger,
+	riverClient queue.Client,
+	servers ...*http.Server,
+) error {
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		wg.Go(func() {
+			shutdownCtx, cancel := context.WithTimeout(ctx, settings.HTTPStopTimeout)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Error("run: web server did not shut down cleanly", "addr", server.Addr, "err", err)
+			}
+		})
+	}
+	wg.Wait()
+	logger.Info("run: web servers stopped")
+
+	return jobs.Stop(ctx, riverClient, settings.RiverStopSoftTimeout, settings.RiverStopHardTimeout, logger)
 }
 
 func main() {
 	ctx := context.Background()
-	err := run(ctx, os.Stdout)
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "migrate":
+		err = runMigrate(ctx, os.Args[2:], os.Stdout)
+	case len(os.Args) > 1 && os.Args[1] == "reencrypt":
+		err = runReencrypt(ctx, os.Stdout)
+	default:
+		err = run(ctx, os.Stdout)
+	}
 	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
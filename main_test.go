@@ -20,18 +20,25 @@ import (
 	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/broker"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/db/migrations"
 	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
 	"github.com/cloud-gov/aws-broker/mocks"
 	"github.com/cloud-gov/aws-broker/services/elasticsearch"
 	"github.com/cloud-gov/aws-broker/services/rds"
 	"github.com/cloud-gov/aws-broker/services/redis"
 	"github.com/cloud-gov/aws-broker/testutil"
 	"github.com/google/uuid"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
 )
 
 var brokerDB *gorm.DB
@@ -58,15 +65,22 @@ func setup() http.Handler {
 	if err != nil {
 		log.Fatal(err)
 	}
-	brokerDB.AutoMigrate(&rds.RDSInstance{}, &redis.RedisInstance{}, &elasticsearch.ElasticsearchInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{}) //nolint:errcheck // test setup; AutoMigrate failure surfaces as a later test failure
-
-	path, _ := os.Getwd()
-	c := catalog.InitCatalog(path)
 
 	handler := slog.NewTextHandler(os.Stdout, nil)
 	logger := slog.New(handler)
 	ctx := context.Background()
 
+	migrator, err := db.NewMigrator(brokerDB, migrations.All, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := migrator.Up(ctx, 0); err != nil {
+		log.Fatal(err)
+	}
+
+	path, _ := os.Getwd()
+	c := catalog.InitCatalog(path)
+
 	serviceBroker := broker.New(
 		ctx,
 		&s,
@@ -137,8 +151,13 @@ func isAsyncOperationResponse(t *testing.T, response *httptest.ResponseRecorder,
 	if err := json.Unmarshal(response.Body.Bytes(), &responseData); err != nil {
 		t.Fatal(err)
 	}
-	if responseData["operation"] != expectedOperation.String() {
-		t.Fatalf("expected async operation: %s, got: %s", expectedOperation, responseData["operation"])
+	operation, _ := responseData["operation"].(string)
+	operationData := base.ParseOperationData(operation)
+	if operationData.Operation != expectedOperation {
+		t.Fatalf("expected async operation: %s, got: %s", expectedOperation, operation)
+	}
+	if operationData.ID == "" {
+		t.Fatalf("expected async operation %s to have an operation ID", operation)
 	}
 }
 
@@ -149,6 +168,58 @@ func TestMain(m *testing.M) {
 	os.Exit(exitCode)
 }
 
+// TestWorkersRunForInstances checks that the arguments of every kind of job
+// other than the periodic ones implement queue.InstanceJobArgs, so that a job
+// which panics marks the operation it runs as failed.
+func TestWorkersRunForInstances(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	workers := newWorkers(context.Background(), nil, &config.Settings{}, &catalog.Catalog{}, &mocks.MockTagGenerator{}, aws.Config{}, sts.NewFromConfig(aws.Config{}), logger)
+
+	// Periodic jobs run for every instance rather than one.
+	periodicKinds := []string{}
+	for _, job := range newPeriodicJobs(&config.Settings{}) {
+		periodicKinds = append(periodicKinds, job.Args.Kind())
+	}
+
+	for _, kind := range workers.Kinds() {
+		if slices.Contains(periodicKinds, kind) {
+			continue
+		}
+		_, err := workers.JobInstance(&rivertype.JobRow{Kind: kind, EncodedArgs: []byte(`{"instance": {}}`)})
+		if err != nil {
+			t.Errorf("%s job: %s", kind, err)
+		}
+	}
+}
+
+// TestQueuesConfiguredForJobs checks that the queue of every kind of job is
+// worked by the client, which always works the default queue.
+func TestQueuesConfiguredForJobs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	workers := newWorkers(context.Background(), nil, &config.Settings{}, &catalog.Catalog{}, &mocks.MockTagGenerator{}, aws.Config{}, sts.NewFromConfig(aws.Config{}), logger)
+	queues := newQueues(&config.Settings{})
+
+	for _, kind := range workers.Kinds() {
+		queue := workers.Queue(kind)
+		if _, ok := queues[queue]; !ok && queue != river.QueueDefault {
+			t.Errorf("%s job: queue %q is not configured", kind, queue)
+		}
+	}
+}
+
+// TestPeriodicJobsUseReconcileQueue checks that the periodic jobs do not take
+// workers from the queues of the services.
+func TestPeriodicJobsUseReconcileQueue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	workers := newWorkers(context.Background(), nil, &config.Settings{}, &catalog.Catalog{}, &mocks.MockTagGenerator{}, aws.Config{}, sts.NewFromConfig(aws.Config{}), logger)
+
+	for _, job := range newPeriodicJobs(&config.Settings{}) {
+		if queue := workers.Queue(job.Args.Kind()); queue != reconcile.Queue {
+			t.Errorf("%s job: expected queue %q, got %q", job.Args.Kind(), reconcile.Queue, queue)
+		}
+	}
+}
+
 func TestCatalog(t *testing.T) {
 	url := "/v2/catalog"
 	res := requestHandler.doRequest(url, "GET", false, nil)
@@ -187,6 +258,12 @@ func TestCatalog(t *testing.T) {
 		if serviceName, ok := catalogService["name"].(string); ok {
 			foundServices = append(foundServices, serviceName)
 		}
+		if bindingsRetrievable, _ := catalogService["bindings_retrievable"].(bool); !bindingsRetrievable {
+			t.Error("Catalog service should have retrievable bindings")
+		}
+		if instancesRetrievable, _ := catalogService["instances_retrievable"].(bool); !instancesRetrievable {
+			t.Error("Catalog service should have retrievable instances")
+		}
 	}
 
 	if !reflect.DeepEqual(foundServices, []string{"rds", "aws-elasticsearch", "redis"}) {
@@ -884,10 +961,38 @@ func TestRDSBindInstance(t *testing.T) {
 
 func TestRDSUnbind(t *testing.T) {
 	instanceUUID := uuid.NewString()
-	url := fmt.Sprintf("/v2/service_instances/%s/service_bindings/the_binding?service_id=%s&plan_id=%s", instanceUUID, rdsServiceId, originalRDSPlanID)
+	bindingID := uuid.NewString()
+	url := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s?service_id=%s&plan_id=%s", instanceUUID, bindingID, rdsServiceId, originalRDSPlanID)
 	res := requestHandler.doRequest(url, "DELETE", true, nil)
 
+	// Without the instance
+	if res.Code != http.StatusGone {
+		t.Error(url, "with auth should return 410 and it returned", res.Code)
+	}
+
+	// Create the instance and bind it
+	res = requestHandler.doRequest(fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID), "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 202 and it returned", res.Code)
+	}
+
+	bindURL := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", instanceUUID, bindingID)
+	res = requestHandler.doRequest(bindURL, "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if res.Code != http.StatusCreated {
+		t.Logf("Unable to bind instance. Body is: %s", res.Body.String())
+		t.Error(bindURL, "with auth should return 201 and it returned", res.Code)
+	}
+
+	var count int64
+	brokerDB.Model(&rds.RDSBinding{}).Where("binding_id = ?", bindingID).Count(&count)
+	if count != 1 {
+		t.Error("The binding should be in the DB")
+	}
+
+	res = requestHandler.doRequest(url, "DELETE", true, nil)
 	if res.Code != http.StatusOK {
+		t.Logf("Unable to unbind instance. Body is: %s", res.Body.String())
 		t.Error(url, "with auth should return 200 and it returned", res.Code)
 	}
 
@@ -898,6 +1003,139 @@ func TestRDSUnbind(t *testing.T) {
 	if strings.TrimSpace(res.Body.String()) != "{}" {
 		t.Error(url, "should return an empty JSON")
 	}
+
+	brokerDB.Model(&rds.RDSBinding{}).Where("binding_id = ?", bindingID).Count(&count)
+	if count != 0 {
+		t.Error("The binding should have been removed from the DB")
+	}
+
+	// Unbinding again should report that the binding is gone
+	res = requestHandler.doRequest(url, "DELETE", true, nil)
+	if res.Code != http.StatusGone {
+		t.Error(url, "with auth should return 410 and it returned", res.Code)
+	}
+}
+
+func TestRDSGetBinding(t *testing.T) {
+	instanceUUID := uuid.NewString()
+	bindingID := uuid.NewString()
+	url := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s?service_id=%s&plan_id=%s", instanceUUID, bindingID, rdsServiceId, originalRDSPlanID)
+	res := requestHandler.doRequest(url, "GET", true, nil)
+
+	// Without the binding
+	if res.Code != http.StatusNotFound {
+		t.Error(url, "with auth should return 404 and it returned", res.Code)
+	}
+
+	// Create the instance and bind it
+	res = requestHandler.doRequest(fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID), "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 202 and it returned", res.Code)
+	}
+
+	bindURL := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", instanceUUID, bindingID)
+	bindRes := requestHandler.doRequest(bindURL, "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if bindRes.Code != http.StatusCreated {
+		t.Logf("Unable to bind instance. Body is: %s", bindRes.Body.String())
+		t.Error(bindURL, "with auth should return 201 and it returned", bindRes.Code)
+	}
+
+	// Binding again with the same details should return the binding
+	rebindRes := requestHandler.doRequest(bindURL, "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if rebindRes.Code != http.StatusOK {
+		t.Logf("Unable to bind instance again. Body is: %s", rebindRes.Body.String())
+		t.Error(bindURL, "with auth should return 200 and it returned", rebindRes.Code)
+	}
+
+	// Binding again with other details should conflict
+	otherBindReq := fmt.Sprintf(`{"service_id":"%s","plan_id":"%s","app_guid":"another-app"}`, rdsServiceId, originalRDSPlanID)
+	res = requestHandler.doRequest(bindURL, "PUT", true, bytes.NewBufferString(otherBindReq))
+	if res.Code != http.StatusConflict {
+		t.Error(bindURL, "with auth should return 409 and it returned", res.Code)
+	}
+
+	res = requestHandler.doRequest(url, "GET", true, nil)
+	if res.Code != http.StatusOK {
+		t.Logf("Unable to get binding. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 200 and it returned", res.Code)
+	}
+
+	type response struct {
+		Credentials map[string]string
+	}
+
+	var bound, rebound, fetched response
+	json.Unmarshal(bindRes.Body.Bytes(), &bound)     //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+	json.Unmarshal(rebindRes.Body.Bytes(), &rebound) //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+	json.Unmarshal(res.Body.Bytes(), &fetched)       //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+
+	if fetched.Credentials["uri"] == "" || !reflect.DeepEqual(bound.Credentials, fetched.Credentials) {
+		t.Error(url, "should return the credentials from the binding")
+	}
+	if !reflect.DeepEqual(bound.Credentials, rebound.Credentials) {
+		t.Error(bindURL, "binding again should return the credentials from the binding")
+	}
+
+	binding := base.Binding{}
+	brokerDB.Where("binding_id = ?", bindingID).First(&binding)
+	if binding.InstanceUuid != instanceUUID {
+		t.Error("The binding should be in the DB")
+	}
+	if binding.Credentials == "" || strings.Contains(binding.Credentials, fetched.Credentials["password"]) {
+		t.Error("The binding credentials should be stored encrypted")
+	}
+
+	// Unbind and the binding should no longer be retrievable
+	res = requestHandler.doRequest(url, "DELETE", true, nil)
+	if res.Code != http.StatusOK {
+		t.Logf("Unable to unbind instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 200 and it returned", res.Code)
+	}
+
+	res = requestHandler.doRequest(url, "GET", true, nil)
+	if res.Code != http.StatusNotFound {
+		t.Error(url, "with auth should return 404 and it returned", res.Code)
+	}
+}
+
+func TestRDSGetInstance(t *testing.T) {
+	instanceUUID := uuid.NewString()
+	url := fmt.Sprintf("/v2/service_instances/%s", instanceUUID)
+	res := requestHandler.doRequest(url, "GET", true, nil)
+
+	// Without the instance
+	if res.Code != http.StatusNotFound {
+		t.Error(url, "with auth should return 404 and it returned", res.Code)
+	}
+
+	// Create the instance and try again
+	res = requestHandler.doRequest(fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID), "PUT", true, bytes.NewBuffer(createRDSInstanceReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 202 and it returned", res.Code)
+	}
+
+	res = requestHandler.doRequest(url, "GET", true, nil)
+	if res.Code != http.StatusOK {
+		t.Logf("Unable to get instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 200 and it returned", res.Code)
+	}
+
+	var r struct {
+		ServiceID  string         `json:"service_id"`
+		PlanID     string         `json:"plan_id"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &r) //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+
+	if r.ServiceID != rdsServiceId || r.PlanID != originalRDSPlanID {
+		t.Error(url, "should return the service and plan of the instance and it returned", r.ServiceID, r.PlanID)
+	}
+
+	if _, ok := r.Parameters["storage"]; !ok {
+		t.Error(url, "should return the storage parameter")
+	}
 }
 
 func TestRDSDeleteInstance(t *testing.T) {
@@ -928,6 +1166,56 @@ func TestRDSDeleteInstance(t *testing.T) {
 	isAsyncOperationResponse(t, res, base.DeleteOp)
 }
 
+// testOperationInProgress checks that an instance cannot be modified or deleted
+// while a previous asynchronous operation on it is still in progress.
+func testOperationInProgress(t *testing.T, serviceID string, planID string, createReq []byte, modifyReq []byte) {
+	instanceUUID := uuid.NewString()
+	createURL := fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID)
+	res := requestHandler.doRequest(createURL, "PUT", true, bytes.NewBuffer(createReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Fatal(createURL, "with auth should return 202 and it returned", res.Code)
+	}
+
+	err := asyncmessage.WriteAsyncJobMessage(brokerDB, serviceID, instanceUUID, base.ModifyOp, base.InstanceInProgress, "Modification in progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modifyURL := fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID)
+	res = requestHandler.doRequest(modifyURL, "PATCH", true, bytes.NewBuffer(modifyReq))
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Logf("Body is: %s", res.Body.String())
+		t.Fatal(modifyURL, "with an operation in progress should return 422 and it returned", res.Code)
+	}
+	if !strings.Contains(res.Body.String(), "ConcurrencyError") {
+		t.Errorf("expected ConcurrencyError in response body, got: %s", res.Body.String())
+	}
+
+	deleteURL := fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true&service_id=%s&plan_id=%s", instanceUUID, serviceID, planID)
+	res = requestHandler.doRequest(deleteURL, "DELETE", true, nil)
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Logf("Body is: %s", res.Body.String())
+		t.Fatal(deleteURL, "with an operation in progress should return 422 and it returned", res.Code)
+	}
+
+	// Once the operation has finished, the instance can be changed again.
+	err = asyncmessage.WriteAsyncJobMessage(brokerDB, serviceID, instanceUUID, base.ModifyOp, base.InstanceReady, "Modification complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = requestHandler.doRequest(deleteURL, "DELETE", true, nil)
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to delete instance. Body is: %s", res.Body.String())
+		t.Error(deleteURL, "with auth should return 202 and it returned", res.Code)
+	}
+}
+
+func TestRDSOperationInProgress(t *testing.T) {
+	testOperationInProgress(t, rdsServiceId, originalRDSPlanID, createRDSInstanceReq, modifyRDSInstanceReq)
+}
+
 /*
 	Testing Redis
 */
@@ -1214,6 +1502,45 @@ func TestRedisUnbind(t *testing.T) {
 	}
 }
 
+func TestRedisGetInstance(t *testing.T) {
+	instanceUUID := uuid.NewString()
+	url := fmt.Sprintf("/v2/service_instances/%s", instanceUUID)
+	res := requestHandler.doRequest(url, "GET", true, nil)
+
+	// Without the instance
+	if res.Code != http.StatusNotFound {
+		t.Error(url, "with auth should return 404 and it returned", res.Code)
+	}
+
+	// Create the instance and try again
+	res = requestHandler.doRequest(fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID), "PUT", true, bytes.NewBuffer(createRedisInstanceReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 202 and it returned", res.Code)
+	}
+
+	res = requestHandler.doRequest(url, "GET", true, nil)
+	if res.Code != http.StatusOK {
+		t.Logf("Unable to get instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 200 and it returned", res.Code)
+	}
+
+	var r struct {
+		ServiceID  string         `json:"service_id"`
+		PlanID     string         `json:"plan_id"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &r) //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+
+	if r.ServiceID != redisServiceId || r.PlanID != originalRedisPlanID {
+		t.Error(url, "should return the service and plan of the instance and it returned", r.ServiceID, r.PlanID)
+	}
+
+	if _, ok := r.Parameters["engine_version"]; !ok {
+		t.Error(url, "should return the engine_version parameter")
+	}
+}
+
 func TestRedisDeleteInstance(t *testing.T) {
 	instanceUUID := uuid.NewString()
 	url := fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true&service_id=%s&plan_id=%s", instanceUUID, redisServiceId, originalRedisPlanID)
@@ -1242,6 +1569,10 @@ func TestRedisDeleteInstance(t *testing.T) {
 	isAsyncOperationResponse(t, res, base.DeleteOp)
 }
 
+func TestRedisOperationInProgress(t *testing.T) {
+	testOperationInProgress(t, redisServiceId, originalRedisPlanID, createRedisInstanceReq, modifyRedisInstanceReq)
+}
+
 /*
 	Tests for elasticsearch
 */
@@ -1548,6 +1879,45 @@ func TestElasticsearchUnbind(t *testing.T) {
 	}
 }
 
+func TestElasticsearchGetInstance(t *testing.T) {
+	instanceUUID := uuid.NewString()
+	url := fmt.Sprintf("/v2/service_instances/%s", instanceUUID)
+	res := requestHandler.doRequest(url, "GET", true, nil)
+
+	// Without the instance
+	if res.Code != http.StatusNotFound {
+		t.Error(url, "with auth should return 404 and it returned", res.Code)
+	}
+
+	// Create the instance and try again
+	res = requestHandler.doRequest(fmt.Sprintf("/v2/service_instances/%s?accepts_incomplete=true", instanceUUID), "PUT", true, bytes.NewBuffer(createElasticsearchInstanceReq))
+	if res.Code != http.StatusAccepted {
+		t.Logf("Unable to create instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 202 and it returned", res.Code)
+	}
+
+	res = requestHandler.doRequest(url, "GET", true, nil)
+	if res.Code != http.StatusOK {
+		t.Logf("Unable to get instance. Body is: %s", res.Body.String())
+		t.Error(url, "with auth should return 200 and it returned", res.Code)
+	}
+
+	var r struct {
+		ServiceID  string         `json:"service_id"`
+		PlanID     string         `json:"plan_id"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &r) //nolint:errcheck // test assertion; a bad unmarshal fails the surrounding checks
+
+	if r.ServiceID != elasticsearchServiceId || r.PlanID != originalElasticsearchPlanID {
+		t.Error(url, "should return the service and plan of the instance and it returned", r.ServiceID, r.PlanID)
+	}
+
+	if _, ok := r.Parameters["elasticsearchVersion"]; !ok {
+		t.Error(url, "should return the elasticsearchVersion parameter")
+	}
+}
+
 func TestElasticsearchDeleteInstance(t *testing.T) {
 	instanceUUID := uuid.NewString()
 	url := fmt.Sprintf("/v2/service_instances/%s?service_id=%s&plan_id=%s&accepts_incomplete=true", instanceUUID, elasticsearchServiceId, originalElasticsearchPlanID)
@@ -1575,3 +1945,7 @@ func TestElasticsearchDeleteInstance(t *testing.T) {
 
 	isAsyncOperationResponse(t, res, base.DeleteOp)
 }
+
+func TestElasticsearchOperationInProgress(t *testing.T) {
+	testOperationInProgress(t, elasticsearchServiceId, originalElasticsearchPlanID, createElasticsearchInstanceReq, modifyElasticsearchInstanceParamsReq)
+}
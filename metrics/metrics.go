@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/riverqueue/river/rivertype"
+)
+
+const namespace = "aws_broker"
+
+// Outcomes of River jobs.
+const (
+	JobCompleted = "completed"
+	JobErrored   = "errored"
+	JobCancelled = "cancelled"
+	JobSnoozed   = "snoozed"
+	JobPanicked  = "panicked"
+)
+
+var (
+	brokerRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "osbapi_requests_total",
+		Help:      "Number of OSBAPI requests handled, by service, operation and outcome.",
+	}, []string{"service", "operation", "outcome"})
+
+	brokerRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "osbapi_request_duration_seconds",
+		Help:      "Time taken to handle OSBAPI requests, by service and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation"})
+
+	jobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "river_jobs_total",
+		Help:      "Number of River jobs worked, by kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "river_job_duration_seconds",
+		Help:      "Time taken to work River jobs, by kind.",
+		// Jobs wait on AWS resources, which can take anywhere from seconds to hours.
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"kind"})
+
+	awsAPICalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aws_api_calls_total",
+		Help:      "Number of AWS API calls made, by client and operation.",
+	}, []string{"client", "operation"})
+
+	awsAPIErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aws_api_errors_total",
+		Help:      "Number of AWS API calls which failed, by client and operation.",
+	}, []string{"client", "operation"})
+
+	waitForDbReadyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rds_wait_for_db_ready_seconds",
+		Help:      "Time spent polling for RDS databases to become available, by outcome.",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"outcome"})
+)
+
+// Handler returns the handler serving the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveBrokerRequest records an OSBAPI request which started at start and returned err.
+func ObserveBrokerRequest(service string, operation string, start time.Time, err error) {
+	brokerRequestDuration.WithLabelValues(service, operation).Observe(time.Since(start).Seconds())
+	brokerRequests.WithLabelValues(service, operation, outcome(err)).Inc()
+}
+
+// ObserveJob records a River job which started at start and returned err.
+func ObserveJob(kind string, start time.Time, err error) {
+	jobDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	jobs.WithLabelValues(kind, JobOutcome(err)).Inc()
+}
+
+// ObserveJobPanic records a River job which panicked. Panics never return to
+// the code observing jobs, so they are recorded by the River error handler.
+func ObserveJobPanic(kind string) {
+	jobs.WithLabelValues(kind, JobPanicked).Inc()
+}
+
+// JobOutcome returns the outcome of a River job which returned err.
+func JobOutcome(err error) string {
+	var (
+		cancelErr *rivertype.JobCancelError
+		snoozeErr *rivertype.JobSnoozeError
+	)
+	switch {
+	case err == nil:
+		return JobCompleted
+	case errors.As(err, &cancelErr):
+		return JobCancelled
+	case errors.As(err, &snoozeErr):
+		return JobSnoozed
+	default:
+		return JobErrored
+	}
+}
+
+// ObserveWaitForDbReady records time spent waiting for an RDS database which
+// started at start and returned err.
+func ObserveWaitForDbReady(start time.Time, err error) {
+	waitForDbReadyDuration.WithLabelValues(outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentAWSConfig adds middleware to the AWS config which records the API
+// calls made by every client created from it.
+func InstrumentAWSConfig(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		// Added after the service metadata middleware, so the client and
+		// operation names are available from the context.
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("BrokerMetrics", func(
+			ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			client := awsmiddleware.GetServiceID(ctx)
+			operation := awsmiddleware.GetOperationName(ctx)
+			awsAPICalls.WithLabelValues(client, operation).Inc()
+			if err != nil {
+				awsAPIErrors.WithLabelValues(client, operation).Inc()
+			}
+			return out, metadata, err
+		}), middleware.After)
+	})
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/riverqueue/river"
+)
+
+type failingHTTPClient struct{}
+
+func (c *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestJobOutcome(t *testing.T) {
+	testCases := map[string]struct {
+		err             error
+		expectedOutcome string
+	}{
+		"no error": {
+			expectedOutcome: JobCompleted,
+		},
+		"error": {
+			err:             errors.New("fail"),
+			expectedOutcome: JobErrored,
+		},
+		"cancelled": {
+			err:             fmt.Errorf("wrapped: %w", river.JobCancel(errors.New("fail"))),
+			expectedOutcome: JobCancelled,
+		},
+		"snoozed": {
+			err:             river.JobSnooze(time.Minute),
+			expectedOutcome: JobSnoozed,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outcome := JobOutcome(test.err)
+			if outcome != test.expectedOutcome {
+				t.Errorf("expected outcome %s, got %s", test.expectedOutcome, outcome)
+			}
+		})
+	}
+}
+
+func TestObserveBrokerRequest(t *testing.T) {
+	before := testutil.ToFloat64(brokerRequests.WithLabelValues("rds", "provision", "error"))
+
+	ObserveBrokerRequest("rds", "provision", time.Now(), errors.New("fail"))
+
+	after := testutil.ToFloat64(brokerRequests.WithLabelValues("rds", "provision", "error"))
+	if after-before != 1 {
+		t.Errorf("expected the failed request to be counted once, got %v", after-before)
+	}
+}
+
+func TestObserveJob(t *testing.T) {
+	before := testutil.ToFloat64(jobs.WithLabelValues("test-kind", JobCompleted))
+
+	ObserveJob("test-kind", time.Now(), nil)
+
+	after := testutil.ToFloat64(jobs.WithLabelValues("test-kind", JobCompleted))
+	if after-before != 1 {
+		t.Errorf("expected the completed job to be counted once, got %v", after-before)
+	}
+}
+
+func TestInstrumentAWSConfig(t *testing.T) {
+	cfg := aws.Config{
+		Region:           "us-gov-west-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		HTTPClient:       &failingHTTPClient{},
+		RetryMaxAttempts: 1,
+	}
+	InstrumentAWSConfig(&cfg)
+
+	callsBefore := testutil.ToFloat64(awsAPICalls.WithLabelValues("STS", "GetCallerIdentity"))
+	errorsBefore := testutil.ToFloat64(awsAPIErrors.WithLabelValues("STS", "GetCallerIdentity"))
+
+	client := sts.NewFromConfig(cfg)
+	_, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	callsAfter := testutil.ToFloat64(awsAPICalls.WithLabelValues("STS", "GetCallerIdentity"))
+	if callsAfter-callsBefore != 1 {
+		t.Errorf("expected the call to be counted once, got %v", callsAfter-callsBefore)
+	}
+	errorsAfter := testutil.ToFloat64(awsAPIErrors.WithLabelValues("STS", "GetCallerIdentity"))
+	if errorsAfter-errorsBefore != 1 {
+		t.Errorf("expected the error to be counted once, got %v", errorsAfter-errorsBefore)
+	}
+}
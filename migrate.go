@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/db/migrations"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage:
+  aws-broker migrate up [version]   apply pending migrations, up to version if given
+  aws-broker migrate down <version> revert migrations newer than version, which must be at least 1
+  aws-broker migrate status         list migrations and when they were applied`
+
+// runMigrate runs the migrate subcommand, which applies, reverts and lists the
+// migrations of the broker database.
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	var settings config.Settings
+	if err := settings.LoadFromEnv(); err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: settings.LogLevel,
+	}))
+
+	brokerDB, err := db.DBInit(settings.DbConfig)
+	if err != nil {
+		return fmt.Errorf("error initializing database: %s", err)
+	}
+	migrator, err := db.NewMigrator(brokerDB, migrations.All, logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		target := 0
+		if len(args) > 1 {
+			if target, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid version %q: %w", args[1], err)
+			}
+		}
+		return migrator.Up(ctx, target)
+	case "down":
+		// Reverting migrations can drop data, so the version to revert to is
+		// required.
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+		// The baseline migration adopts the tables of existing databases, so
+		// it is never reverted.
+		if target < 1 {
+			return fmt.Errorf("invalid version %d, the baseline migration 1 cannot be reverted", target)
+		}
+		return migrator.Down(ctx, target)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, applied, s.Description)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// checkMigrations refuses to start the broker if migrations have not been
+// applied to the database, unless the broker is configured to apply them on
+// startup. SQLite databases are in memory, so they are always migrated.
+func checkMigrations(ctx context.Context, brokerDB *gorm.DB, settings *config.Settings, logger *slog.Logger) error {
+	migrator, err := db.NewMigrator(brokerDB, migrations.All, logger)
+	if err != nil {
+		return err
+	}
+	if settings.MigrateOnStartup || settings.DbConfig.DbType == "sqlite3" {
+		return migrator.Up(ctx, 0)
+	}
+	return migrator.CheckCurrent(ctx)
+}
@@ -5,7 +5,7 @@ import (
 )
 
 type MockTagGenerator struct {
-	tags map[string]string
+	Tags map[string]string
 }
 
 func (mt *MockTagGenerator) GenerateTags(
@@ -15,5 +15,5 @@ func (mt *MockTagGenerator) GenerateTags(
 	resourceGUIDs brokertags.ResourceGUIDs,
 	getMissingResources bool,
 ) (map[string]string, error) {
-	return mt.tags, nil
+	return mt.Tags, nil
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/db"
+)
+
+// secretColumns are the columns of the broker database which hold encrypted
+// secrets.
+var secretColumns = []db.SecretColumn{
+	{Table: "rds_instances", Column: "password", SaltColumn: "salt", Check: isPassword},
+	{Table: "rds_bindings", Column: "password", SaltColumn: "salt", Check: isPassword},
+	{Table: "redis_instances", Column: "password", SaltColumn: "salt", Check: isPassword},
+	{Table: "elasticsearch_instances", Column: "password", SaltColumn: "salt", Check: isPassword},
+	{Table: "bindings", Column: "credentials", SaltColumn: "salt", Check: isCredentials},
+	{Table: "elasticsearch_instances", Column: "access_key", SaltColumn: "salt", Check: isPassword, LegacyPlaintext: true},
+	{Table: "elasticsearch_instances", Column: "secret_key", SaltColumn: "salt", Check: isPassword, LegacyPlaintext: true},
+}
+
+// isPassword returns whether the secret looks like a password generated by the
+// broker, which only contain printable ASCII characters.
+func isPassword(secret string) bool {
+	if secret == "" {
+		return false
+	}
+	for _, c := range []byte(secret) {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// isCredentials returns whether the secret looks like the credentials of a
+// binding, which are stored as JSON.
+func isCredentials(secret string) bool {
+	return json.Valid([]byte(secret))
+}
+
+// runReencrypt runs the reencrypt subcommand, which re-encrypts the secrets in
+// the broker database that are not encrypted with the current key.
+func runReencrypt(ctx context.Context, out io.Writer) error {
+	var settings config.Settings
+	if err := settings.LoadFromEnv(); err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: settings.LogLevel,
+	}))
+
+	brokerDB, err := db.DBInit(settings.DbConfig)
+	if err != nil {
+		return fmt.Errorf("error initializing database: %s", err)
+	}
+	if err := checkMigrations(ctx, brokerDB, &settings, logger); err != nil {
+		return fmt.Errorf("error checking database migrations: %w", err)
+	}
+
+	if settings.KMSKeyID != "" {
+		cfg, err := awsConfig.LoadDefaultConfig(ctx, awsConfig.WithRegion(settings.Region))
+		if err != nil {
+			return fmt.Errorf("error loading AWS config: %s", err)
+		}
+		configureKeyProvider(&settings, cfg)
+	}
+
+	keys := settings.Keyring()
+	var errs []error
+	for _, column := range secretColumns {
+		if _, err := db.ReencryptSecrets(ctx, brokerDB, keys, column, logger); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
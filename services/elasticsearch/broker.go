@@ -2,7 +2,6 @@ package elasticsearch
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,7 +18,7 @@ import (
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
-	"github.com/riverqueue/river"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 
 	brokertags "github.com/cloud-gov/go-broker-tags"
 )
@@ -64,7 +63,7 @@ func InitElasticsearchBroker(
 	brokerDB *gorm.DB,
 	settings *config.Settings,
 	tagManager brokertags.TagManager,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 	logger *slog.Logger,
 ) (base.Broker, error) {
 	adapter, err := initializeAdapter(ctx, brokerDB, settings, logger, riverClient)
@@ -98,7 +97,7 @@ func (broker *elasticsearchBroker) AsyncOperationRequired(o base.Operation) bool
 	}
 }
 
-func (broker *elasticsearchBroker) CreateInstance(id string, details domain.ProvisionDetails) error {
+func (broker *elasticsearchBroker) CreateInstance(id string, operationID string, details domain.ProvisionDetails) error {
 	newInstance := ElasticsearchInstance{}
 
 	options := ElasticsearchOptions{}
@@ -174,7 +173,7 @@ func (broker *elasticsearchBroker) CreateInstance(id string, details domain.Prov
 	}
 
 	// Create the elasticsearch instance.
-	status, err := broker.adapter.createElasticsearch(&newInstance, newInstance.ClearPassword)
+	status, err := broker.adapter.createElasticsearch(&newInstance, operationID)
 	if err != nil {
 		return apiresponses.NewFailureResponse(
 			err,
@@ -210,7 +209,7 @@ func (broker *elasticsearchBroker) CreateInstance(id string, details domain.Prov
 	}
 }
 
-func (broker *elasticsearchBroker) ModifyInstance(id string, details domain.UpdateDetails) error {
+func (broker *elasticsearchBroker) ModifyInstance(id string, operationID string, details domain.UpdateDetails) error {
 
 	esInstance := ElasticsearchInstance{}
 	options := ElasticsearchOptions{}
@@ -257,7 +256,10 @@ func (broker *elasticsearchBroker) ModifyInstance(id string, details domain.Upda
 		return apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "updating service instance")
 	}
 
-	state, err := broker.adapter.modifyElasticsearch(&esInstance)
+	state, err := broker.adapter.modifyElasticsearch(&esInstance, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 	if err != nil {
 		broker.logger.Error("AWS call updating instance failed", "err", err)
 		return apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "modifying Elasticsearch instance")
@@ -275,12 +277,13 @@ func (broker *elasticsearchBroker) ModifyInstance(id string, details domain.Upda
 
 func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollDetails) (domain.LastOperation, error) {
 	lastOperation := domain.LastOperation{}
+	operationData := base.ParseOperationData(details.OperationData)
 	existingInstance := ElasticsearchInstance{}
 
 	baseInstance, err := base.FindBaseInstance(broker.brokerDB, id)
 	if err != nil {
 		if apiErr, ok := err.(*apiresponses.FailureResponse); ok {
-			if apiErr.ValidatedStatusCode(nil) == http.StatusGone && details.OperationData != base.DeleteOp.String() {
+			if apiErr.ValidatedStatusCode(nil) == http.StatusGone && operationData.Operation != base.DeleteOp {
 				return lastOperation, err
 			}
 		} else {
@@ -290,7 +293,7 @@ func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollD
 
 	var count int64
 	if err := broker.brokerDB.Where("uuid = ?", id).First(&existingInstance).Count(&count).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) || (errors.Is(err, gorm.ErrRecordNotFound) && details.OperationData != base.DeleteOp.String()) {
+		if !errors.Is(err, gorm.ErrRecordNotFound) || (errors.Is(err, gorm.ErrRecordNotFound) && operationData.Operation != base.DeleteOp) {
 			return lastOperation, apiresponses.NewFailureResponse(
 				err,
 				http.StatusInternalServerError,
@@ -298,13 +301,13 @@ func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollD
 			)
 		}
 	}
-	if count == 0 && details.OperationData != base.DeleteOp.String() {
+	if count == 0 && operationData.Operation != base.DeleteOp {
 		return lastOperation, apiresponses.ErrInstanceDoesNotExist
 	}
 
 	// When asynchronous deletion has finished, the instance record no longer exists, so
 	// return a last operation status indicating that the deletion was successful.
-	if count == 0 && details.OperationData == base.DeleteOp.String() {
+	if count == 0 && operationData.Operation == base.DeleteOp {
 		return domain.LastOperation{
 			State:       domain.Succeeded,
 			Description: "Successfully deleted instance",
@@ -316,8 +319,14 @@ func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollD
 	var instanceOperation base.Operation
 	var statusMessage string
 
-	switch details.OperationData {
-	case base.DeleteOp.String():
+	switch operationData.Operation {
+	case base.CreateOp:
+		needAsyncJobState = broker.AsyncOperationRequired(base.CreateOp)
+		instanceOperation = base.CreateOp
+	case base.ModifyOp:
+		needAsyncJobState = broker.AsyncOperationRequired(base.ModifyOp)
+		instanceOperation = base.ModifyOp
+	case base.DeleteOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.DeleteOp)
 		instanceOperation = base.DeleteOp
 	default: //all other ops use synchronous checking of aws api
@@ -325,7 +334,7 @@ func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollD
 	}
 
 	if needAsyncJobState {
-		asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation)
+		asyncJobMsg, err := asyncmessage.GetAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation, operationData.ID)
 		if err != nil {
 			return lastOperation, apiresponses.NewFailureResponse(
 				err,
@@ -368,7 +377,7 @@ func (broker *elasticsearchBroker) LastOperation(id string, details domain.PollD
 	}, nil
 }
 
-func (broker *elasticsearchBroker) BindInstance(id string, details domain.BindDetails) (domain.Binding, error) {
+func (broker *elasticsearchBroker) BindInstance(id string, bindingID string, details domain.BindDetails) (domain.Binding, error) {
 	binding := domain.Binding{
 		OperationData: base.BindOp.String(),
 	}
@@ -392,7 +401,7 @@ func (broker *elasticsearchBroker) BindInstance(id string, details domain.BindDe
 		return binding, apiresponses.ErrInstanceDoesNotExist
 	}
 
-	password, err := existingInstance.getPassword(broker.settings.EncryptionKey)
+	password, err := existingInstance.getPassword(broker.settings.Keyring())
 	if err != nil {
 		return binding, apiresponses.NewFailureResponse(
 			fmt.Errorf("unable to get instance password: %s", err),
@@ -401,6 +410,14 @@ func (broker *elasticsearchBroker) BindInstance(id string, details domain.BindDe
 		)
 	}
 
+	if err := existingInstance.loadAccessKey(broker.settings.Keyring()); err != nil {
+		return binding, apiresponses.NewFailureResponse(
+			fmt.Errorf("unable to get instance access key: %s", err),
+			http.StatusInternalServerError,
+			"get instance access key",
+		)
+	}
+
 	// Get the correct database logic depending on the type of plan
 	var credentials map[string]string
 	// Bind the database instance to the application.
@@ -426,7 +443,30 @@ func (broker *elasticsearchBroker) BindInstance(id string, details domain.BindDe
 	return binding, nil
 }
 
-func (broker *elasticsearchBroker) DeleteInstance(id string) error {
+// UnbindInstance is a no-op since every binding to an Elasticsearch instance shares
+// the instance credentials.
+func (broker *elasticsearchBroker) UnbindInstance(id string, bindingID string, details domain.UnbindDetails) error {
+	return nil
+}
+
+func (broker *elasticsearchBroker) GetInstance(id string, details domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error) {
+	existingInstance := ElasticsearchInstance{}
+
+	var count int64
+	broker.brokerDB.Where("uuid = ?", id).First(&existingInstance).Count(&count)
+	if count == 0 {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceNotFound
+	}
+
+	return domain.GetInstanceDetailsSpec{
+		ServiceID:    existingInstance.ServiceID,
+		PlanID:       existingInstance.PlanID,
+		DashboardURL: existingInstance.getDashboardURL(),
+		Parameters:   existingInstance.getParameters(),
+	}, nil
+}
+
+func (broker *elasticsearchBroker) DeleteInstance(id string, operationID string) error {
 	existingInstance := ElasticsearchInstance{}
 	var count int64
 
@@ -435,7 +475,7 @@ func (broker *elasticsearchBroker) DeleteInstance(id string) error {
 		return apiresponses.ErrInstanceDoesNotExist
 	}
 
-	password, err := existingInstance.getPassword(broker.settings.EncryptionKey)
+	password, err := existingInstance.getPassword(broker.settings.Keyring())
 	if err != nil {
 		return apiresponses.NewFailureResponse(
 			fmt.Errorf("unable to get instance password: %s", err),
@@ -445,7 +485,10 @@ func (broker *elasticsearchBroker) DeleteInstance(id string) error {
 	}
 
 	// send async deletion request.
-	status, err := broker.adapter.deleteElasticsearch(&existingInstance, password)
+	status, err := broker.adapter.deleteElasticsearch(&existingInstance, password, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 	switch status {
 	case base.InstanceGone: // somehow the instance is gone already
 		broker.brokerDB.Unscoped().Delete(&existingInstance)
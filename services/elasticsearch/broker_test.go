@@ -16,6 +16,7 @@ import (
 	"github.com/cloud-gov/aws-broker/mocks"
 	"github.com/cloud-gov/aws-broker/testutil"
 	brokertags "github.com/cloud-gov/go-broker-tags"
+	"github.com/google/uuid"
 )
 
 func TestValidate(t *testing.T) {
@@ -101,7 +102,7 @@ func TestCreateInstance(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := test.elasticsearchBroker.CreateInstance(test.instance.Uuid, test.provisionDetails)
+			err := test.elasticsearchBroker.CreateInstance(test.instance.Uuid, uuid.NewString(), test.provisionDetails)
 
 			if err != nil {
 				t.Fatal(err)
@@ -192,7 +193,7 @@ func TestModifyInstance(t *testing.T) {
 				logger:     slog.New(&testutil.MockLogHandler{}),
 			}
 
-			err = broker.ModifyInstance(instanceId, updateDetails)
+			err = broker.ModifyInstance(instanceId, uuid.NewString(), updateDetails)
 			if test.expectedErrMsg != "" {
 				if err == nil {
 					t.Fatalf("expected error containing %q, got nil", test.expectedErrMsg)
@@ -261,6 +262,45 @@ func TestLastOperation(t *testing.T) {
 			expectedState:       base.InstanceReady,
 			createTestInstances: true,
 		},
+		"create in progress": {
+			pollDetails: domain.PollDetails{
+				OperationData: base.CreateOp.String(),
+			},
+			catalog: &catalog.Catalog{
+				RdsService: catalog.RDSService{
+					RDSPlans: []catalog.RDSPlan{
+						{
+							ServicePlan: domain.ServicePlan{
+								ID: "123",
+							},
+						},
+					},
+				},
+			},
+			planID: "123",
+			dbInstance: &ElasticsearchInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			},
+			asyncJobMsg: &asyncmessage.AsyncJobMsg{
+				JobType: base.CreateOp,
+				JobState: asyncmessage.AsyncJobState{
+					Message: "Creating domain",
+					State:   base.InstanceInProgress,
+				},
+			},
+			expectedState:       base.InstanceInProgress,
+			createTestInstances: true,
+		},
 		"modify": {
 			pollDetails: domain.PollDetails{
 				OperationData: base.ModifyOp.String(),
@@ -0,0 +1,382 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/awsiam"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	CreateKind = "opensearch-create"
+)
+
+type CreateArgs struct {
+	Instance    *ElasticsearchInstance `json:"instance"`
+	OperationID string                 `json:"operation_id"`
+}
+
+func (CreateArgs) Kind() string { return CreateKind }
+
+func (CreateArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a CreateArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}
+}
+
+type CreateWorker struct {
+	river.WorkerDefaults[CreateArgs]
+	db         *gorm.DB
+	settings   *config.Settings
+	opensearch OpensearchClientInterface
+	iam        awsiam.IAMClientInterface
+	sts        STSClientInterface
+	logger     *slog.Logger
+}
+
+func NewCreateWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	opensearch OpensearchClientInterface,
+	iam awsiam.IAMClientInterface,
+	sts STSClientInterface,
+	logger *slog.Logger,
+) *CreateWorker {
+	return &CreateWorker{
+		db:         db,
+		settings:   settings,
+		opensearch: opensearch,
+		iam:        iam,
+		sts:        sts,
+		logger:     logger,
+	}
+}
+
+func (w *CreateWorker) Timeout(*river.Job[CreateArgs]) time.Duration {
+	return w.settings.OpenSearchQueue.JobTimeout
+}
+
+func (w *CreateWorker) Work(ctx context.Context, job *river.Job[CreateArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	return w.asyncCreateElasticsearch(ctx, job.Args.Instance)
+}
+
+func (w *CreateWorker) asyncCreateElasticsearch(ctx context.Context, i *ElasticsearchInstance) error {
+	runner, err := steps.NewRunner(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:   i.ServiceID,
+		InstanceID:  i.Uuid,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}, i)
+	if err != nil {
+		return fmt.Errorf("asyncCreateElasticsearch: %w", err)
+	}
+
+	iamTags := awsiam.ConvertTagsMapToIAMTags(i.Tags)
+	policy := `{"Version": "2012-10-17","Statement": [{"Action": ["es:*"],"Effect": "Allow","Resource": {{resources "/*"}}}]}`
+
+	// Every step that creates a resource removes it when a later step fails, so that
+	// a failed creation does not leave IAM users, keys and policies behind.
+	createSteps := []steps.Step{
+		{
+			// IAM User and policy before domain starts creating so it can be used to create access control policy
+			Name:         "IAM user created",
+			Message:      "Creating IAM user",
+			ErrorMessage: "Error creating IAM user",
+			Run: func(ctx context.Context) error {
+				_, err := w.iam.CreateUser(ctx, &iam.CreateUserInput{
+					UserName: aws.String(i.Domain),
+					Tags:     iamTags,
+				})
+				return err
+			},
+			Rollback: func(ctx context.Context) error {
+				_, err := w.iam.DeleteUser(ctx, &iam.DeleteUserInput{
+					UserName: aws.String(i.Domain),
+				})
+				return err
+			},
+		},
+		{
+			Name:         "IAM access key created",
+			Message:      "Creating IAM access key",
+			ErrorMessage: "Error creating IAM access key",
+			Run: func(ctx context.Context) error {
+				createAccessKeyOutput, err := w.iam.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{
+					UserName: aws.String(i.Domain),
+				})
+				if err != nil {
+					return err
+				}
+				err = i.setAccessKey(
+					aws.ToString(createAccessKeyOutput.AccessKey.AccessKeyId),
+					aws.ToString(createAccessKeyOutput.AccessKey.SecretAccessKey),
+					w.settings.Keyring(),
+				)
+				if err != nil {
+					// the key cannot be recorded, so it is removed straight away
+					w.deleteAccessKey(ctx, i.Domain, aws.ToString(createAccessKeyOutput.AccessKey.AccessKeyId))
+					return fmt.Errorf("error encrypting IAM access key: %w", err)
+				}
+				return nil
+			},
+			Rollback: func(ctx context.Context) error {
+				// the clear access key is not saved with a checkpoint
+				if err := i.loadAccessKey(w.settings.Keyring()); err != nil {
+					return err
+				}
+				_, err := w.iam.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+					UserName:    aws.String(i.Domain),
+					AccessKeyId: aws.String(i.ClearAccessKey),
+				})
+				return err
+			},
+		},
+		{
+			Name:         "domain created",
+			Message:      "Creating domain",
+			ErrorMessage: "Error creating domain",
+			Run: func(ctx context.Context) error {
+				accessControlPolicy, err := w.getAccessControlPolicy(ctx, i)
+				if err != nil {
+					return fmt.Errorf("error generating domain access policy: %w", err)
+				}
+				params, err := prepareCreateDomainInput(i, accessControlPolicy)
+				if err != nil {
+					return fmt.Errorf("error generating domain creation params: %w", err)
+				}
+				resp, err := w.createDomain(ctx, params)
+				if err != nil {
+					return err
+				}
+				i.ARN = aws.ToString(resp.DomainStatus.ARN)
+				return nil
+			},
+			Rollback: func(ctx context.Context) error {
+				_, err := w.opensearch.DeleteDomain(ctx, &opensearch.DeleteDomainInput{
+					DomainName: aws.String(i.Domain),
+				})
+				return err
+			},
+		},
+		{
+			Name:         "IAM policy created",
+			Message:      "Creating IAM policy for domain",
+			ErrorMessage: "Error creating IAM policy",
+			Run: func(ctx context.Context) error {
+				policyARN, err := awsiam.CreatePolicyFromTemplate(ctx, w.iam, w.logger, i.Domain, "/", policy, []string{i.ARN}, iamTags)
+				if err != nil {
+					return err
+				}
+				i.IamPolicy = policy
+				i.IamPolicyARN = policyARN
+				return nil
+			},
+			Rollback: func(ctx context.Context) error {
+				return awsiam.DeletePolicy(ctx, w.iam, w.logger, i.IamPolicyARN)
+			},
+		},
+		{
+			Name:         "IAM policy attached",
+			ErrorMessage: "Error attaching IAM policy",
+			Run: func(ctx context.Context) error {
+				_, err := w.iam.AttachUserPolicy(ctx, &iam.AttachUserPolicyInput{
+					PolicyArn: aws.String(i.IamPolicyARN),
+					UserName:  aws.String(i.Domain),
+				})
+				return err
+			},
+			Rollback: func(ctx context.Context) error {
+				_, err := w.iam.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{
+					PolicyArn: aws.String(i.IamPolicyARN),
+					UserName:  aws.String(i.Domain),
+				})
+				return err
+			},
+		},
+		{
+			Name:         "snapshot role created",
+			Message:      "Creating snapshot role and policies",
+			ErrorMessage: "Error creating snapshot role and policies",
+			Run: func(ctx context.Context) error {
+				err := createUpdateBucketRolesAndPolicies(ctx, w.iam, w.logger, i, w.settings.SnapshotsBucketName, i.SnapshotPath, iamTags)
+				if err != nil {
+					// the snapshot resources are created by a single call that may fail part
+					// way through, so whichever of them were recorded are removed
+					if cleanupErr := w.cleanupSnapshotRolesAndPolicies(context.WithoutCancel(ctx), i); cleanupErr != nil {
+						w.logger.Error("asyncCreateElasticsearch: could not remove snapshot role and policies", "domain", i.Domain, "err", cleanupErr)
+					}
+					return err
+				}
+				i.BrokerSnapshotsEnabled = true
+				return nil
+			},
+			Rollback: func(ctx context.Context) error {
+				return w.cleanupSnapshotRolesAndPolicies(ctx, i)
+			},
+		},
+		{
+			Name:         "domain available",
+			Message:      "Waiting for domain to be available",
+			ErrorMessage: "Error waiting for domain to become available",
+			Run: func(ctx context.Context) error {
+				return w.waitForDomain(ctx, i)
+			},
+		},
+	}
+
+	for _, step := range createSteps {
+		if err := runner.Run(ctx, step); err != nil {
+			return err
+		}
+	}
+
+	// The domain and its IAM user have been created by now, so failing to save
+	// the record is left for River to retry from the last checkpoint instead of
+	// rolling them back.
+	i.State = base.InstanceReady
+	if err := w.db.WithContext(ctx).Save(i).Error; err != nil {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceInProgress, fmt.Sprintf("Error saving record, retrying: %s", err))
+		return fmt.Errorf("asyncCreateElasticsearch: error saving record: %w", err)
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceReady, "Finished creating OpenSearch resources")
+	runner.Finish(ctx)
+	return nil
+}
+
+func (w *CreateWorker) deleteAccessKey(ctx context.Context, userName string, accessKeyID string) {
+	_, err := w.iam.DeleteAccessKey(context.WithoutCancel(ctx), &iam.DeleteAccessKeyInput{
+		UserName:    aws.String(userName),
+		AccessKeyId: aws.String(accessKeyID),
+	})
+	if err != nil {
+		w.logger.Error("asyncCreateElasticsearch: could not remove access key", "user", userName, "err", err)
+	}
+}
+
+// getAccessControlPolicy returns a domain access policy that allows the instance IAM user.
+func (w *CreateWorker) getAccessControlPolicy(ctx context.Context, i *ElasticsearchInstance) (string, error) {
+	userResp, err := w.iam.GetUser(ctx, &iam.GetUserInput{
+		UserName: aws.String(i.Domain),
+	})
+	if err != nil {
+		return "", err
+	}
+	uniqueUserArn := aws.ToString(userResp.User.Arn)
+
+	result, err := w.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	accountID := aws.ToString(result.Account)
+
+	return "{\"Version\": \"2012-10-17\",\"Statement\": [{\"Effect\": \"Allow\",\"Principal\": {\"AWS\": \"" + uniqueUserArn + "\"},\"Action\": \"es:*\",\"Resource\": \"arn:aws-us-gov:es:" + w.settings.Region + ":" + accountID + ":domain/" + i.Domain + "/*\"}]}", nil
+}
+
+// createDomain creates the domain, retrying while the new IAM user is not yet visible to OpenSearch.
+func (w *CreateWorker) createDomain(ctx context.Context, params *opensearch.CreateDomainInput) (*opensearch.CreateDomainOutput, error) {
+	resp, err := w.opensearch.CreateDomain(ctx, params)
+	attempts := 1
+
+	// IAM is eventually consistent, meaning new IAM users may not be immediately available for read, such as when
+	// Opensearch goes to validate the IAM user specified as the AWS principal in the access
+	// policy. The error returned in this case is an "InvalidTypeException", so we retry the domain creation
+	// to allow IAM to become consistent.
+	//
+	// see https://docs.aws.amazon.com/IAM/latest/UserGuide/troubleshoot_general.html#troubleshoot_general_eventual-consistency
+	for isInvalidTypeException(err) && attempts < int(w.settings.PollAwsMaxRetries) {
+		w.logger.Info("Retrying domain creation because of possible IAM eventual consistency issue", "attempt", attempts)
+		attempts += 1
+		if err := pollDelay(ctx, w.settings.PollAwsMinDelay); err != nil {
+			return nil, err
+		}
+		resp, err = w.opensearch.CreateDomain(ctx, params)
+	}
+
+	return resp, err
+}
+
+// waitForDomain polls until the domain has been created and is no longer processing.
+func (w *CreateWorker) waitForDomain(ctx context.Context, i *ElasticsearchInstance) error {
+	attempts := 1
+
+	for attempts <= int(w.settings.PollAwsMaxRetries) {
+		state, err := getDomainState(ctx, w.opensearch, w.logger, i)
+		if err != nil && !errors.Is(err, errDomainNotCreated) {
+			return err
+		}
+		if state == base.InstanceReady {
+			return nil
+		}
+
+		attempts += 1
+		if err := pollDelay(ctx, w.settings.PollAwsMinDelay); err != nil {
+			return err
+		}
+	}
+
+	// the domain may still become available, so the job is retried
+	return steps.Transient(errors.New("could not verify creation of domain"))
+}
+
+// in which we clean up the snapshot role and policies recorded on the instance
+func (w *CreateWorker) cleanupSnapshotRolesAndPolicies(ctx context.Context, i *ElasticsearchInstance) error {
+	var errs []error
+	snapshotRoleName := i.Domain + "-to-s3-SnapshotRole"
+
+	if i.SnapshotPolicyARN != "" {
+		if _, err := w.iam.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(i.SnapshotPolicyARN),
+			RoleName:  aws.String(snapshotRoleName),
+		}); err != nil {
+			errs = append(errs, err)
+		}
+		if err := awsiam.DeletePolicy(ctx, w.iam, w.logger, i.SnapshotPolicyARN); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if i.SnapshotARN != "" {
+		if _, err := w.iam.DeleteRole(ctx, &iam.DeleteRoleInput{
+			RoleName: aws.String(snapshotRoleName),
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if i.IamPassRolePolicyARN != "" {
+		if _, err := w.iam.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{
+			PolicyArn: aws.String(i.IamPassRolePolicyARN),
+			UserName:  aws.String(i.Domain),
+		}); err != nil {
+			errs = append(errs, err)
+		}
+		if err := awsiam.DeletePolicy(ctx, w.iam, w.logger, i.IamPassRolePolicyARN); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
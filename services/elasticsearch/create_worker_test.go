@@ -0,0 +1,390 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	opensearchTypes "github.com/aws/aws-sdk-go-v2/service/opensearch/types"
+	"github.com/aws/smithy-go"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func newTestCreateInstance() *ElasticsearchInstance {
+	return &ElasticsearchInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid: helpers.RandStr(10),
+		},
+		Domain:       helpers.RandStr(10),
+		DataCount:    1,
+		SubnetID2AZ2: "az-2",
+		SecGroup:     "group-1",
+		VolumeSize:   10,
+		VolumeType:   "gp3",
+		InstanceType: "m5.2xlarge.search",
+		SnapshotPath: "/org/space/service/instance",
+	}
+}
+
+func newTestCreateIamClient() *mockIamClient {
+	return &mockIamClient{
+		createAccessKeyOutput: &iam.CreateAccessKeyOutput{
+			AccessKey: &iamTypes.AccessKey{
+				AccessKeyId:     aws.String("access-key-id"),
+				SecretAccessKey: aws.String("secret-access-key"),
+			},
+		},
+		getUserOutput: &iam.GetUserOutput{
+			User: &iamTypes.User{
+				Arn: aws.String("user-arn"),
+			},
+		},
+		createRoleOutput: []*iam.CreateRoleOutput{
+			{
+				Role: &iamTypes.Role{
+					Arn:      aws.String("role-arn"),
+					RoleName: aws.String("role-name"),
+				},
+			},
+		},
+		createPolicyOutput: &iam.CreatePolicyOutput{
+			Policy: &iamTypes.Policy{
+				Arn: aws.String("policy-arn"),
+			},
+		},
+		listPolicyVersionsOutput: &iam.ListPolicyVersionsOutput{
+			Versions: []iamTypes.PolicyVersion{},
+		},
+	}
+}
+
+func newTestCreateOpensearchClient() *mockOpensearchClient {
+	return &mockOpensearchClient{
+		createDomainOutput: &opensearch.CreateDomainOutput{
+			DomainStatus: &opensearchTypes.DomainStatus{
+				ARN: aws.String("domain-arn"),
+			},
+		},
+		describeDomainResults: []*opensearch.DescribeDomainOutput{
+			domainStatus(true, false, "OpenSearch_2.3"),
+			domainStatus(false, false, "OpenSearch_2.3"),
+		},
+	}
+}
+
+func TestCreateWorkerWork(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:     helpers.RandStr(32),
+		PollAwsMinDelay:   1 * time.Millisecond,
+		PollAwsMaxRetries: 3,
+	}
+	instance := newTestCreateInstance()
+	worker := NewCreateWorker(
+		brokerDB,
+		settings,
+		newTestCreateOpensearchClient(),
+		newTestCreateIamClient(),
+		&mockStsClient{},
+		slog.New(&testutil.MockLogHandler{}),
+	)
+
+	err = worker.Work(t.Context(), &river.Job[CreateArgs]{Args: CreateArgs{
+		Instance: instance,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := ElasticsearchInstance{}
+	if err := brokerDB.Where("uuid = ?", instance.Uuid).First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.ARN != "domain-arn" || saved.IamPolicyARN != "policy-arn" || !saved.BrokerSnapshotsEnabled {
+		t.Errorf("expected created resources to be saved, got ARN: %s, IAM policy ARN: %s", saved.ARN, saved.IamPolicyARN)
+	}
+	if err := saved.loadAccessKey(settings.Keyring()); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ClearAccessKey != "access-key-id" {
+		t.Errorf("expected saved access key access-key-id, got %s", saved.ClearAccessKey)
+	}
+}
+
+func TestAsyncCreateElasticsearch(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:     helpers.RandStr(32),
+		PollAwsMinDelay:   1 * time.Millisecond,
+		PollAwsMaxRetries: 3,
+	}
+
+	testCases := map[string]struct {
+		iamClient                 *mockIamClient
+		opensearchClient          *mockOpensearchClient
+		stsClient                 *mockStsClient
+		expectedState             base.InstanceState
+		expectedMessage           string
+		expectedDeletedUsers      int
+		expectedDeletedAccessKeys int
+		expectedDeletedPolicies   int
+		expectedDeletedRoles      int
+		expectDomainDeleted       bool
+	}{
+		"success": {
+			iamClient:        newTestCreateIamClient(),
+			opensearchClient: newTestCreateOpensearchClient(),
+			stsClient:        &mockStsClient{},
+			expectedState:    base.InstanceReady,
+			expectedMessage:  "Finished creating OpenSearch resources",
+		},
+		"retries domain creation while IAM user is not visible": {
+			iamClient: newTestCreateIamClient(),
+			opensearchClient: func() *mockOpensearchClient {
+				client := newTestCreateOpensearchClient()
+				client.createDomainErrs = []error{&opensearchTypes.InvalidTypeException{}}
+				return client
+			}(),
+			stsClient:       &mockStsClient{},
+			expectedState:   base.InstanceReady,
+			expectedMessage: "Finished creating OpenSearch resources",
+		},
+		"error creating IAM user does not roll back": {
+			iamClient: func() *mockIamClient {
+				client := newTestCreateIamClient()
+				client.createUserErr = errors.New("error creating user")
+				return client
+			}(),
+			opensearchClient: newTestCreateOpensearchClient(),
+			stsClient:        &mockStsClient{},
+			expectedState:    base.InstanceNotCreated,
+		},
+		"error getting caller identity removes IAM user and access key": {
+			iamClient:                 newTestCreateIamClient(),
+			opensearchClient:          newTestCreateOpensearchClient(),
+			stsClient:                 &mockStsClient{getCallerIdentityErr: errors.New("error getting caller identity")},
+			expectedState:             base.InstanceNotCreated,
+			expectedDeletedUsers:      1,
+			expectedDeletedAccessKeys: 1,
+		},
+		"error creating domain removes IAM user and access key": {
+			iamClient: newTestCreateIamClient(),
+			opensearchClient: func() *mockOpensearchClient {
+				client := newTestCreateOpensearchClient()
+				client.createDomainErrs = []error{errors.New("error creating domain")}
+				return client
+			}(),
+			stsClient:                 &mockStsClient{},
+			expectedState:             base.InstanceNotCreated,
+			expectedDeletedUsers:      1,
+			expectedDeletedAccessKeys: 1,
+		},
+		"error attaching IAM policy removes domain and IAM resources": {
+			iamClient: func() *mockIamClient {
+				client := newTestCreateIamClient()
+				client.attachUserPolicyErr = errors.New("error attaching policy")
+				return client
+			}(),
+			opensearchClient:          newTestCreateOpensearchClient(),
+			stsClient:                 &mockStsClient{},
+			expectedState:             base.InstanceNotCreated,
+			expectedDeletedUsers:      1,
+			expectedDeletedAccessKeys: 1,
+			expectedDeletedPolicies:   1,
+			expectDomainDeleted:       true,
+		},
+		"error waiting for domain removes all created resources": {
+			iamClient: newTestCreateIamClient(),
+			opensearchClient: func() *mockOpensearchClient {
+				client := newTestCreateOpensearchClient()
+				client.describeDomainErrs = []error{errors.New("error describing domain")}
+				return client
+			}(),
+			stsClient:                 &mockStsClient{},
+			expectedState:             base.InstanceNotCreated,
+			expectedDeletedUsers:      1,
+			expectedDeletedAccessKeys: 1,
+			expectedDeletedPolicies:   3,
+			expectedDeletedRoles:      1,
+			expectDomainDeleted:       true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			instance := newTestCreateInstance()
+			worker := NewCreateWorker(brokerDB, settings, test.opensearchClient, test.iamClient, test.stsClient, slog.New(&testutil.MockLogHandler{}))
+			err := worker.asyncCreateElasticsearch(t.Context(), instance)
+			if test.expectedState == base.InstanceReady && err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != base.InstanceReady && err == nil {
+				t.Fatal("expected error")
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.CreateOp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != asyncJobMsg.JobState.State {
+				t.Fatalf("expected async job state: %s, got: %s", test.expectedState, asyncJobMsg.JobState.State)
+			}
+			if test.expectedMessage != "" && test.expectedMessage != asyncJobMsg.JobState.Message {
+				t.Errorf("expected async job message: %s, got: %s", test.expectedMessage, asyncJobMsg.JobState.Message)
+			}
+
+			if len(test.iamClient.deletedUsers) != test.expectedDeletedUsers {
+				t.Errorf("expected %d deleted users, got %d", test.expectedDeletedUsers, len(test.iamClient.deletedUsers))
+			}
+			if len(test.iamClient.deletedAccessKeys) != test.expectedDeletedAccessKeys {
+				t.Errorf("expected %d deleted access keys, got %d", test.expectedDeletedAccessKeys, len(test.iamClient.deletedAccessKeys))
+			}
+			if test.expectedDeletedAccessKeys > 0 && !slices.Contains(test.iamClient.deletedAccessKeys, "access-key-id") {
+				t.Errorf("expected created access key to be deleted, got %v", test.iamClient.deletedAccessKeys)
+			}
+			if len(test.iamClient.deletedPolicies) != test.expectedDeletedPolicies {
+				t.Errorf("expected %d deleted policies, got %d", test.expectedDeletedPolicies, len(test.iamClient.deletedPolicies))
+			}
+			if len(test.iamClient.deletedRoles) != test.expectedDeletedRoles {
+				t.Errorf("expected %d deleted roles, got %d", test.expectedDeletedRoles, len(test.iamClient.deletedRoles))
+			}
+			if test.opensearchClient.deleteDomainCalled != test.expectDomainDeleted {
+				t.Errorf("expected domain deleted: %t, got: %t", test.expectDomainDeleted, test.opensearchClient.deleteDomainCalled)
+			}
+		})
+	}
+}
+
+func TestAsyncCreateElasticsearchResumesFromCheckpoint(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:     helpers.RandStr(32),
+		PollAwsMinDelay:   1 * time.Millisecond,
+		PollAwsMaxRetries: 3,
+	}
+	iamClient := newTestCreateIamClient()
+	iamClient.attachUserPolicyErr = &smithy.GenericAPIError{Code: "Throttling"}
+	opensearchClient := newTestCreateOpensearchClient()
+	worker := NewCreateWorker(brokerDB, settings, opensearchClient, iamClient, &mockStsClient{}, slog.New(&testutil.MockLogHandler{}))
+
+	job := &rivertype.JobRow{ID: 1, Attempt: 1, MaxAttempts: 3}
+	ctx := asyncmessage.ContextWithJob(t.Context(), job)
+	instance := newTestCreateInstance()
+
+	err = worker.asyncCreateElasticsearch(ctx, instance)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var cancelErr *river.JobCancelError
+	if errors.As(err, &cancelErr) {
+		t.Fatalf("expected throttling error to be retried, got %s", err)
+	}
+	if len(iamClient.deletedUsers) != 0 || opensearchClient.deleteDomainCalled {
+		t.Fatal("expected created resources to be kept for the retry")
+	}
+
+	// a retry decodes the instance from the job arguments again
+	job.Attempt++
+	iamClient.attachUserPolicyErr = nil
+	instance = &ElasticsearchInstance{
+		Instance:     instance.Instance,
+		Domain:       instance.Domain,
+		DataCount:    instance.DataCount,
+		SubnetID2AZ2: instance.SubnetID2AZ2,
+		SecGroup:     instance.SecGroup,
+		VolumeSize:   instance.VolumeSize,
+		VolumeType:   instance.VolumeType,
+		InstanceType: instance.InstanceType,
+		SnapshotPath: instance.SnapshotPath,
+	}
+	err = worker.asyncCreateElasticsearch(ctx, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opensearchClient.createDomainCallNum != 1 {
+		t.Errorf("expected domain to be created once, got %d calls", opensearchClient.createDomainCallNum)
+	}
+	if instance.ARN != "domain-arn" || instance.IamPolicyARN != "policy-arn" {
+		t.Errorf("expected instance to be restored from checkpoint, got ARN: %s, IAM policy ARN: %s", instance.ARN, instance.IamPolicyARN)
+	}
+
+	asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.CreateOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asyncJobMsg.JobState.State != base.InstanceReady {
+		t.Errorf("expected async job state: %s, got: %s", base.InstanceReady, asyncJobMsg.JobState.State)
+	}
+}
+
+func TestAsyncCreateElasticsearchStopsWaitingWhenInterrupted(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:     helpers.RandStr(32),
+		PollAwsMinDelay:   time.Hour,
+		PollAwsMaxRetries: 3,
+	}
+	iamClient := newTestCreateIamClient()
+	opensearchClient := newTestCreateOpensearchClient()
+	worker := NewCreateWorker(brokerDB, settings, opensearchClient, iamClient, &mockStsClient{}, slog.New(&testutil.MockLogHandler{}))
+
+	job := &rivertype.JobRow{ID: 2, Attempt: 1, MaxAttempts: 3}
+	ctx, cancel := context.WithCancelCause(asyncmessage.ContextWithJob(t.Context(), job))
+	defer cancel(nil)
+	time.AfterFunc(50*time.Millisecond, func() { cancel(queue.ErrStopped) })
+
+	done := make(chan error)
+	go func() {
+		done <- worker.asyncCreateElasticsearch(ctx, newTestCreateInstance())
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected waiting for the domain to stop when the job is interrupted")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context cancelled error, got %v", err)
+	}
+	var cancelErr *river.JobCancelError
+	if errors.As(err, &cancelErr) {
+		t.Fatalf("expected interrupted job to be retried, got %s", err)
+	}
+	if len(iamClient.deletedUsers) != 0 || opensearchClient.deleteDomainCalled {
+		t.Fatal("expected created resources to be kept for the retry")
+	}
+}
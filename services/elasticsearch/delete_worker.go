@@ -20,6 +20,8 @@ import (
 	"github.com/cloud-gov/aws-broker/awsiam"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
@@ -29,11 +31,24 @@ const (
 )
 
 type DeleteArgs struct {
-	Instance *ElasticsearchInstance `json:"instance"`
+	Instance    *ElasticsearchInstance `json:"instance"`
+	OperationID string                 `json:"operation_id"`
 }
 
 func (DeleteArgs) Kind() string { return DeleteKind }
 
+func (DeleteArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a DeleteArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.DeleteOp,
+		FailedState: base.InstanceNotGone,
+	}
+}
+
 type DeleteWorker struct {
 	river.WorkerDefaults[DeleteArgs]
 	db         *gorm.DB
@@ -62,18 +77,39 @@ func NewDeleteWorker(
 	}
 }
 
+func (w *DeleteWorker) Timeout(*river.Job[DeleteArgs]) time.Duration {
+	return w.settings.OpenSearchQueue.JobTimeout
+}
+
 func (w *DeleteWorker) Work(ctx context.Context, job *river.Job[DeleteArgs]) error {
-	return w.asyncDeleteElasticSearchDomain(ctx, job.Args.Instance)
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	err := w.asyncDeleteElasticSearchDomain(ctx, job.Args.Instance)
+	return steps.RetryIfInterrupted(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:  job.Args.Instance.ServiceID,
+		InstanceID: job.Args.Instance.Uuid,
+		Operation:  base.DeleteOp,
+	}, err)
 }
 
 func (w *DeleteWorker) asyncDeleteElasticSearchDomain(ctx context.Context, i *ElasticsearchInstance) error {
 	operation := base.DeleteOp
 
-	err := w.takeLastSnapshot(ctx, i)
+	// The access key is not serialized with the job arguments, so it is
+	// decrypted from the instance.
+	err := i.loadAccessKey(w.settings.Keyring())
+	if err != nil {
+		errorMsg := "asyncDeleteElasticSearchDomain - \t loadAccessKey returned error"
+		w.logger.Error(errorMsg, "err", err)
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
+		return river.JobCancel(fmt.Errorf("%s: %w ", errorMsg, err))
+	}
+
+	err = w.takeLastSnapshot(ctx, i)
 	if err != nil {
 		errorMsg := "asyncDeleteElasticSearchDomain - \t takeLastSnapshot returned error"
 		w.logger.Error(errorMsg, "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
 		return river.JobCancel(fmt.Errorf("%s: %w ", errorMsg, err))
 	}
 
@@ -81,7 +117,7 @@ func (w *DeleteWorker) asyncDeleteElasticSearchDomain(ctx context.Context, i *El
 	if err != nil {
 		errorMsg := "asyncDeleteElasticSearchDomain - \t writeManifestToS3 returned error"
 		w.logger.Error(errorMsg, "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
 		return river.JobCancel(fmt.Errorf("%s: %w ", errorMsg, err))
 	}
 
@@ -89,7 +125,7 @@ func (w *DeleteWorker) asyncDeleteElasticSearchDomain(ctx context.Context, i *El
 	if err != nil {
 		errorMsg := "asyncDeleteElasticSearchDomain - \t cleanupRolesAndPolicies returned error"
 		w.logger.Error(errorMsg, "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
 		return river.JobCancel(fmt.Errorf("%s: %w ", errorMsg, err))
 	}
 
@@ -97,11 +133,11 @@ func (w *DeleteWorker) asyncDeleteElasticSearchDomain(ctx context.Context, i *El
 	if err != nil {
 		errorMsg := "asyncDeleteElasticSearchDomain - \t cleanupElasticSearchDomain returned error"
 		w.logger.Error(errorMsg, "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("%s: %s ", errorMsg, err))
 		return river.JobCancel(fmt.Errorf("%s: %w ", errorMsg, err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Successfully deleted resources")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Successfully deleted resources")
 	return nil
 }
 
@@ -210,7 +246,7 @@ func (w *DeleteWorker) cleanupRolesAndPolicies(ctx context.Context, i *Elasticse
 
 	if _, err := w.iam.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
 		UserName:    aws.String(i.Domain),
-		AccessKeyId: aws.String(i.AccessKey),
+		AccessKeyId: aws.String(i.ClearAccessKey),
 	}); err != nil {
 		w.logger.Error("cleanupRolesAndPolicies: DeleteAccessKey failed", "err", err)
 		return err
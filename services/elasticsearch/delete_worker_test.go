@@ -61,14 +61,23 @@ func (s *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput,
 }
 
 type mockIamClient struct {
+	createAccessKeyOutput    *iam.CreateAccessKeyOutput
 	createPolicyOutput       *iam.CreatePolicyOutput
 	createRoleCallNum        int
 	createRoleOutput         []*iam.CreateRoleOutput
+	createUserErr            error
+	attachUserPolicyErr      error
+	getUserOutput            *iam.GetUserOutput
 	listPolicyVersionsOutput *iam.ListPolicyVersionsOutput
+
+	deletedAccessKeys []string
+	deletedPolicies   []string
+	deletedRoles      []string
+	deletedUsers      []string
 }
 
 func (m *mockIamClient) CreateAccessKey(ctx context.Context, params *iam.CreateAccessKeyInput, optFns ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
-	return nil, nil
+	return m.createAccessKeyOutput, nil
 }
 
 func (m *mockIamClient) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
@@ -76,14 +85,17 @@ func (m *mockIamClient) CreatePolicy(ctx context.Context, params *iam.CreatePoli
 }
 
 func (m *mockIamClient) DeleteAccessKey(ctx context.Context, params *iam.DeleteAccessKeyInput, optFns ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+	m.deletedAccessKeys = append(m.deletedAccessKeys, aws.ToString(params.AccessKeyId))
 	return nil, nil
 }
 
 func (m *mockIamClient) DeleteRole(ctx context.Context, params *iam.DeleteRoleInput, optFns ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	m.deletedRoles = append(m.deletedRoles, aws.ToString(params.RoleName))
 	return nil, nil
 }
 
 func (m *mockIamClient) DeleteUser(ctx context.Context, params *iam.DeleteUserInput, optFns ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+	m.deletedUsers = append(m.deletedUsers, aws.ToString(params.UserName))
 	return nil, nil
 }
 
@@ -100,7 +112,7 @@ func (m *mockIamClient) AttachRolePolicy(ctx context.Context, params *iam.Attach
 }
 
 func (m *mockIamClient) AttachUserPolicy(ctx context.Context, params *iam.AttachUserPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
-	return nil, nil
+	return nil, m.attachUserPolicyErr
 }
 
 func (m *mockIamClient) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
@@ -114,10 +126,11 @@ func (m *mockIamClient) CreateRole(ctx context.Context, params *iam.CreateRoleIn
 }
 
 func (m *mockIamClient) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
-	return nil, nil
+	return nil, m.createUserErr
 }
 
 func (m *mockIamClient) DeletePolicy(ctx context.Context, params *iam.DeletePolicyInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	m.deletedPolicies = append(m.deletedPolicies, aws.ToString(params.PolicyArn))
 	return nil, nil
 }
 
@@ -138,7 +151,7 @@ func (m *mockIamClient) GetRole(ctx context.Context, params *iam.GetRoleInput, o
 }
 
 func (m *mockIamClient) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
-	return nil, nil
+	return m.getUserOutput, nil
 }
 
 func (m *mockIamClient) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
@@ -4,15 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"log/slog"
 	"slices"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -22,7 +19,6 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/awsiam"
 	"github.com/cloud-gov/aws-broker/base"
@@ -30,27 +26,28 @@ import (
 	brokerAws "github.com/cloud-gov/aws-broker/aws"
 	"github.com/cloud-gov/aws-broker/common"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 
 	"fmt"
 )
 
 type ElasticsearchAdapter interface {
-	createElasticsearch(i *ElasticsearchInstance, password string) (base.InstanceState, error)
-	modifyElasticsearch(i *ElasticsearchInstance) (base.InstanceState, error)
+	createElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error)
+	modifyElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error)
 	checkElasticsearchStatus(i *ElasticsearchInstance) (base.InstanceState, error)
 	checkCompatibleVersions(domainName, targetVersion string) error
 	bindElasticsearchToApp(i *ElasticsearchInstance, password string) (map[string]string, error)
-	deleteElasticsearch(i *ElasticsearchInstance, passoword string) (base.InstanceState, error)
+	deleteElasticsearch(i *ElasticsearchInstance, passoword string, operationID string) (base.InstanceState, error)
 }
 
 type mockElasticsearchAdapter struct {
 }
 
-func (d *mockElasticsearchAdapter) createElasticsearch(i *ElasticsearchInstance, password string) (base.InstanceState, error) {
+func (d *mockElasticsearchAdapter) createElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
-func (d *mockElasticsearchAdapter) modifyElasticsearch(i *ElasticsearchInstance) (base.InstanceState, error) {
+func (d *mockElasticsearchAdapter) modifyElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
@@ -66,12 +63,12 @@ func (d *mockElasticsearchAdapter) bindElasticsearchToApp(i *ElasticsearchInstan
 	return i.getCredentials()
 }
 
-func (d *mockElasticsearchAdapter) deleteElasticsearch(i *ElasticsearchInstance, password string) (base.InstanceState, error) {
+func (d *mockElasticsearchAdapter) deleteElasticsearch(i *ElasticsearchInstance, password string, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
 // initializeAdapter is the main function to create database instances
-func initializeAdapter(ctx context.Context, db *gorm.DB, s *config.Settings, logger *slog.Logger, riverClient *river.Client[*sql.Tx]) (ElasticsearchAdapter, error) {
+func initializeAdapter(ctx context.Context, db *gorm.DB, s *config.Settings, logger *slog.Logger, riverClient queue.Client) (ElasticsearchAdapter, error) {
 	var elasticsearchAdapter ElasticsearchAdapter
 
 	if s.Environment == "test" {
@@ -96,7 +93,6 @@ func initializeAdapter(ctx context.Context, db *gorm.DB, s *config.Settings, log
 		logger:      logger,
 		opensearch:  opensearch.NewFromConfig(cfg),
 		iam:         iamSvc,
-		sts:         sts.NewFromConfig(cfg),
 		s3:          s3.NewFromConfig(cfg),
 		riverClient: riverClient,
 	}
@@ -110,127 +106,70 @@ type dedicatedElasticsearchAdapter struct {
 	settings    config.Settings
 	logger      *slog.Logger
 	iam         awsiam.IAMClientInterface
-	sts         STSClientInterface
 	opensearch  OpensearchClientInterface
 	s3          brokerAws.S3ClientInterface
-	riverClient *river.Client[*sql.Tx]
+	riverClient queue.Client
 }
 
 // This is the prefix for all pgroups created by the broker.
 const PgroupPrefix = "cg-elasticsearch-broker-"
 
-func (d *dedicatedElasticsearchAdapter) createElasticsearch(i *ElasticsearchInstance, password string) (base.InstanceState, error) {
-	// IAM User and policy before domain starts creating so it can be used to create access control policy
-	iamTags := awsiam.ConvertTagsMapToIAMTags(i.Tags)
-	_, err := d.iam.CreateUser(d.ctx, &iam.CreateUserInput{
-		UserName: aws.String(i.Domain),
-		Path:     nil,
-		Tags:     iamTags,
-	})
-	if err != nil {
-		d.logger.Error("createElasticsearch: user.Create err", "err", err)
-		return base.InstanceNotCreated, err
-	}
-
-	createAccessKeyOutput, err := d.iam.CreateAccessKey(d.ctx, &iam.CreateAccessKeyInput{
-		UserName: aws.String(i.Domain),
-	})
+// we make the creation async, set status to in-progress and rollup to return a 202
+func (d *dedicatedElasticsearchAdapter) createElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceInProgress, "Domain creation in progress")
 	if err != nil {
 		return base.InstanceNotCreated, err
 	}
-	i.AccessKey = *createAccessKeyOutput.AccessKey.AccessKeyId
-	i.SecretKey = *createAccessKeyOutput.AccessKey.SecretAccessKey
-
-	userParams := &iam.GetUserInput{
-		UserName: aws.String(i.Domain),
-	}
-	userResp, _ := d.iam.GetUser(d.ctx, userParams)
-	uniqueUserArn := *(userResp.User.Arn)
-	stsInput := &sts.GetCallerIdentityInput{}
-	result, err := d.sts.GetCallerIdentity(d.ctx, stsInput)
-	if err != nil {
-		d.logger.Error("createElasticsearch: GetCallerIdentity err", "err", err)
-		return base.InstanceNotCreated, nil
-	}
-
-	accountID := result.Account
-
-	time.Sleep(5 * time.Second)
 
-	accessControlPolicy := "{\"Version\": \"2012-10-17\",\"Statement\": [{\"Effect\": \"Allow\",\"Principal\": {\"AWS\": \"" + uniqueUserArn + "\"},\"Action\": \"es:*\",\"Resource\": \"arn:aws-us-gov:es:" + d.settings.Region + ":" + *accountID + ":domain/" + i.Domain + "/*\"}]}"
-	params, err := prepareCreateDomainInput(i, accessControlPolicy)
-	if err != nil {
-		d.logger.Error("createElasticsearch: prepareCreateDomainInput err", "err", err)
+	tx := d.db.Begin()
+	if err := tx.Error; err != nil {
 		return base.InstanceNotCreated, err
 	}
+	defer tx.Rollback()
 
-	resp, err := d.opensearch.CreateDomain(d.ctx, params)
-	if isInvalidTypeException(err) {
-		// IAM is eventually consistent, meaning new IAM users may not be immediately available for read, such as when
-		// Opensearch goes to validate the IAM user specified as the AWS principal in the access
-		// policy. The error returned in this case is an "InvalidTypeException", so if we catch that specific error,
-		// we wait for 5 seconds to retry the domain creation to hopefully allow IAM to become consistent.
-		//
-		// see https://docs.aws.amazon.com/IAM/latest/UserGuide/troubleshoot_general.html#troubleshoot_general_eventual-consistency
-		log.Println("Retrying domain creation because of possible IAM eventual consistency issue")
-		time.Sleep(5 * time.Second)
-		resp, err = d.opensearch.CreateDomain(d.ctx, params)
-	}
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
-	// Decide if AWS service call was successful
+	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &CreateArgs{
+		Instance:    i,
+		OperationID: operationID,
+	}, nil)
 	if err != nil {
-		d.logger.Error("createElasticsearch: CreateDomain err", "err", err)
 		return base.InstanceNotCreated, err
 	}
 
-	i.ARN = *(resp.DomainStatus.ARN)
-	esARNs := make([]string, 0)
-	esARNs = append(esARNs, i.ARN)
-	policy := `{"Version": "2012-10-17","Statement": [{"Action": ["es:*"],"Effect": "Allow","Resource": {{resources "/*"}}}]}`
-	policyARN, err := awsiam.CreatePolicyFromTemplate(d.ctx, d.iam, d.logger, i.Domain, "/", policy, esARNs, iamTags)
-	if err != nil {
+	if err := tx.Commit().Error; err != nil {
 		return base.InstanceNotCreated, err
 	}
 
-	if _, err = d.iam.AttachUserPolicy(d.ctx, &iam.AttachUserPolicyInput{
-		PolicyArn: aws.String(policyARN),
-		UserName:  aws.String(i.Domain),
-	}); err != nil {
-		return base.InstanceNotCreated, err
-	}
-	i.IamPolicy = policy
-	i.IamPolicyARN = policyARN
+	return base.InstanceInProgress, nil
+}
 
-	//try setup of roles and policies on create
-	err = createUpdateBucketRolesAndPolicies(d.ctx, d.iam, d.logger, i, d.settings.SnapshotsBucketName, i.SnapshotPath, iamTags)
+// we make the modification async, set status to in-progress and rollup to return a 202
+func (d *dedicatedElasticsearchAdapter) modifyElasticsearch(i *ElasticsearchInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Domain modification in progress")
 	if err != nil {
-		return base.InstanceNotCreated, nil
+		return base.InstanceNotModified, err
 	}
-	i.BrokerSnapshotsEnabled = true
-	return base.InstanceInProgress, nil
-}
 
-func (d *dedicatedElasticsearchAdapter) modifyElasticsearch(i *ElasticsearchInstance) (base.InstanceState, error) {
-	if i.versionUpgradeInProgress() {
-		_, err := d.opensearch.UpgradeDomain(d.ctx, &opensearch.UpgradeDomainInput{
-			DomainName:    aws.String(i.Domain),
-			TargetVersion: aws.String(i.TargetElasticsearchVersion),
-		})
-		if err != nil {
-			d.logger.Error("modifyElasticsearch: UpgradeDomain err", "err", err)
-			return base.InstanceNotModified, err
-		}
-		return base.InstanceInProgress, nil
+	tx := d.db.Begin()
+	if err := tx.Error; err != nil {
+		return base.InstanceNotModified, err
 	}
+	defer tx.Rollback()
 
-	params, err := prepareUpdateDomainConfigInput(i)
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+
+	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &ModifyArgs{
+		Instance:    i,
+		OperationID: operationID,
+	}, nil)
 	if err != nil {
 		return base.InstanceNotModified, err
 	}
 
-	_, err = d.opensearch.UpdateDomainConfig(d.ctx, params)
-	if err != nil {
-		d.logger.Error("modifyElasticsearch: UpdateDomainConfig err", "err", err)
+	if err := tx.Commit().Error; err != nil {
 		return base.InstanceNotModified, err
 	}
 
@@ -242,8 +181,9 @@ func (d *dedicatedElasticsearchAdapter) bindElasticsearchToApp(i *ElasticsearchI
 }
 
 // we make the deletion async, set status to in-progress and rollup to return a 202
-func (d *dedicatedElasticsearchAdapter) deleteElasticsearch(i *ElasticsearchInstance, password string) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deleting resources")
+func (d *dedicatedElasticsearchAdapter) deleteElasticsearch(i *ElasticsearchInstance, password string, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deleting resources")
 	if err != nil {
 		return base.InstanceNotGone, err
 	}
@@ -272,7 +212,8 @@ func (d *dedicatedElasticsearchAdapter) deleteElasticsearch(i *ElasticsearchInst
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &DeleteArgs{
-		Instance: i,
+		Instance:    i,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotGone, err
@@ -291,49 +232,9 @@ func (d *dedicatedElasticsearchAdapter) checkElasticsearchStatus(i *Elasticsearc
 	// Only search for details if the instance was not indicated as ready.
 
 	if i.State != base.InstanceReady {
-		params := &opensearch.DescribeDomainInput{
-			DomainName: aws.String(i.Domain), // Required
-		}
-
-		resp, err := d.opensearch.DescribeDomain(d.ctx, params)
-		if err != nil {
-			d.logger.Error("checkElasticsearchStatus: UpdateDomainConfig err", "err", err)
-			return base.InstanceNotCreated, err
-		}
-
-		d.logger.Debug(fmt.Sprintf("domain status: %+v\n", resp.DomainStatus))
-
-		if resp.DomainStatus.Created != nil && *(resp.DomainStatus.Created) {
-			if i.versionUpgradeInProgress() {
-				if aws.ToBool(resp.DomainStatus.UpgradeProcessing) {
-					return base.InstanceInProgress, nil
-				}
-				if aws.ToString(resp.DomainStatus.EngineVersion) == i.TargetElasticsearchVersion {
-					i.ElasticsearchVersion = i.TargetElasticsearchVersion
-					i.TargetElasticsearchVersion = ""
-					return base.InstanceReady, nil
-				}
-				d.logger.Error(
-					"checkElasticsearchStatus: version upgrade did not complete",
-					"domain", i.Domain,
-					"engineVersion", aws.ToString(resp.DomainStatus.EngineVersion),
-					"targetVersion", i.TargetElasticsearchVersion,
-				)
-				i.TargetElasticsearchVersion = ""
-				return base.InstanceNotModified, nil
-			}
-
-			if aws.ToBool(resp.DomainStatus.Processing) {
-				return base.InstanceInProgress, nil
-			}
-			return base.InstanceReady, nil
-		} else {
-			// Instance not up yet.
-			return base.InstanceNotCreated, errors.New("instance not available yet. Please wait and try again")
-		}
+		return getDomainState(d.ctx, d.opensearch, d.logger, i)
 	}
 	return base.InstanceNotCreated, nil
-
 }
 
 func (d *dedicatedElasticsearchAdapter) checkCompatibleVersions(domainName, targetVersion string) error {
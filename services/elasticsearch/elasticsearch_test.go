@@ -2,14 +2,20 @@ package elasticsearch
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"log/slog"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
 	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/google/uuid"
 
 	"github.com/aws/aws-sdk-go-v2/service/opensearch"
 	opensearchTypes "github.com/aws/aws-sdk-go-v2/service/opensearch/types"
@@ -349,75 +355,106 @@ func TestCheckElasticsearchStatus(t *testing.T) {
 	}
 }
 
-func TestModifyElasticsearch(t *testing.T) {
-	testCases := map[string]struct {
-		instance            *ElasticsearchInstance
-		upgradeDomainErr    error
-		expectUpgradeCalled bool
-		expectErr           bool
-		expectedState       base.InstanceState
-	}{
-		"version upgrae calls UpgradeDomain": {
-			instance: &ElasticsearchInstance{
-				Domain:                     "test-domain",
-				ElasticsearchVersion:       "OpenSearch_1.3",
-				TargetElasticsearchVersion: "OpenSearch_2.3",
-			},
-			expectUpgradeCalled: true,
-			expectedState:       base.InstanceInProgress,
-		},
-		"UpgradeDomain error returns InstanceNotModified": {
-			instance: &ElasticsearchInstance{
-				Domain:                     "test-domain",
-				ElasticsearchVersion:       "OpenSearch_1.3",
-				TargetElasticsearchVersion: "OpenSearch_2.3",
+func TestCreateElasticsearch(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter := NewTestDedicatedElasticsearchAdapter(t.Context(), &config.Settings{}, brokerDB, &mockOpensearchClient{}, &mockIamClient{}, &mockS3Client{})
+	instance := &ElasticsearchInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
 			},
-			upgradeDomainErr:    errors.New("upgrade failed"),
-			expectUpgradeCalled: true,
-			expectErr:           true,
-			expectedState:       base.InstanceNotModified,
+			Uuid: helpers.RandStr(10),
 		},
-		"non-version modify calls UpdateDomainConfig": {
-			instance: &ElasticsearchInstance{
-				Domain: "test-domain",
+		ClearPassword: helpers.RandStr(10),
+	}
+
+	state, err := adapter.createElasticsearch(instance, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != base.InstanceInProgress {
+		t.Errorf("expected state: %s, got: %s", base.InstanceInProgress, state)
+	}
+
+	asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.CreateOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asyncJobMsg.JobState.State != base.InstanceInProgress {
+		t.Errorf("expected async job state: %s, got: %s", base.InstanceInProgress, asyncJobMsg.JobState.State)
+	}
+
+	tx := brokerDB.Begin()
+	if err := tx.Error; err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+	job, err := testutil.RequireInsertedTx(t.Context(), t, sqlTx, &CreateArgs{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Args.Instance.Uuid != instance.Uuid {
+		t.Fatal("Did not receive expected instance as create worker argument")
+	}
+	if job.Args.Instance.ClearPassword != "" {
+		t.Error("expected clear password not to be serialized with the job arguments")
+	}
+}
+
+func TestModifyElasticsearch(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter := NewTestDedicatedElasticsearchAdapter(t.Context(), &config.Settings{}, brokerDB, &mockOpensearchClient{}, &mockIamClient{}, &mockS3Client{})
+	instance := &ElasticsearchInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
 			},
-			expectUpgradeCalled: false,
-			expectedState:       base.InstanceInProgress,
+			Uuid: helpers.RandStr(10),
 		},
+		Domain:                     "test-domain",
+		ElasticsearchVersion:       "OpenSearch_1.3",
+		TargetElasticsearchVersion: "OpenSearch_2.3",
 	}
 
-	for name, test := range testCases {
-		t.Run(name, func(t *testing.T) {
-			mock := &mockOpensearchClient{upgradeDomainErr: test.upgradeDomainErr}
-			adapter := &dedicatedElasticsearchAdapter{
-				ctx:        context.Background(),
-				opensearch: mock,
-				logger:     slog.New(&testutil.MockLogHandler{}),
-			}
+	state, err := adapter.modifyElasticsearch(instance, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != base.InstanceInProgress {
+		t.Errorf("expected state: %s, got: %s", base.InstanceInProgress, state)
+	}
 
-			state, err := adapter.modifyElasticsearch(test.instance)
-			if test.expectErr && err == nil {
-				t.Fatalf("expected error, got nil")
-			}
-			if !test.expectErr && err != nil {
-				t.Fatalf("unexpected error: %s", err)
-			}
-			if state != test.expectedState {
-				t.Errorf("expected state %v, got %v", test.expectedState, state)
-			}
-			upgradeCalled := mock.upgradeDomainInput != nil
-			if upgradeCalled != test.expectUpgradeCalled {
-				t.Errorf("UpgradeDomain called=%v, want=%v", upgradeCalled, test.expectUpgradeCalled)
-			}
-			if test.expectUpgradeCalled && mock.upgradeDomainInput != nil {
-				if diff := deep.Equal(mock.upgradeDomainInput, &opensearch.UpgradeDomainInput{
-					DomainName:    aws.String(test.instance.Domain),
-					TargetVersion: aws.String(test.instance.TargetElasticsearchVersion),
-				}); diff != nil {
-					t.Error(diff)
-				}
-			}
-		})
+	asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.ModifyOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asyncJobMsg.JobState.State != base.InstanceInProgress {
+		t.Errorf("expected async job state: %s, got: %s", base.InstanceInProgress, asyncJobMsg.JobState.State)
+	}
+
+	tx := brokerDB.Begin()
+	if err := tx.Error; err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+	job, err := testutil.RequireInsertedTx(t.Context(), t, sqlTx, &ModifyArgs{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Args.Instance.TargetElasticsearchVersion != instance.TargetElasticsearchVersion {
+		t.Errorf("expected target version %s as modify worker argument, got %s", instance.TargetElasticsearchVersion, job.Args.Instance.TargetElasticsearchVersion)
 	}
 }
 
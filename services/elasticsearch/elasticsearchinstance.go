@@ -49,7 +49,9 @@ type ElasticsearchInstance struct {
 	IndicesFieldDataCacheSize      string `sql:"size(255)"`
 	IndicesQueryBoolMaxClauseCount string `sql:"size(255)"`
 
-	ClearPassword string `gorm:"-"`
+	ClearPassword  string `gorm:"-" json:"-"`
+	ClearAccessKey string `gorm:"-" json:"-"`
+	ClearSecretKey string `gorm:"-" json:"-"`
 
 	Domain string `sql:"size(255)"`
 	ARN    string `sql:"size(255)"`
@@ -69,14 +71,38 @@ type ElasticsearchInstance struct {
 	Protocol string `gorm:"-"`
 }
 
-func (i *ElasticsearchInstance) setPassword(password, key string) error {
+// getParameters returns the effective values of the instance parameters,
+// keyed the same way as ElasticsearchOptions where possible.
+func (i *ElasticsearchInstance) getParameters() map[string]any {
+	return map[string]any{
+		"elasticsearchVersion": i.ElasticsearchVersion,
+		"volume_size":          i.VolumeSize,
+		"volume_type":          i.VolumeType,
+		"advanced_options": ElasticsearchAdvancedOptions{
+			IndicesFieldDataCacheSize:      i.IndicesFieldDataCacheSize,
+			IndicesQueryBoolMaxClauseCount: i.IndicesQueryBoolMaxClauseCount,
+		},
+	}
+}
+
+// getDashboardURL returns the URL of Kibana or OpenSearch Dashboards for the
+// domain, once the domain endpoint is known.
+func (i *ElasticsearchInstance) getDashboardURL() string {
+	if i.Host == "" {
+		return ""
+	}
+	if strings.HasPrefix(i.ElasticsearchVersion, "Elasticsearch_") {
+		return fmt.Sprintf("https://%s/_plugin/kibana/", i.Host)
+	}
+	return fmt.Sprintf("https://%s/_dashboards/", i.Host)
+}
+
+func (i *ElasticsearchInstance) setPassword(password string, keys *helpers.Keyring) error {
 	if i.Salt == "" {
 		return errors.New("salt has to be set before writing the password")
 	}
 
-	iv, _ := base64.StdEncoding.DecodeString(i.Salt)
-
-	encrypted, err := helpers.Encrypt(password, key, iv)
+	encrypted, err := keys.Encrypt(password)
 	if err != nil {
 		return err
 	}
@@ -87,14 +113,14 @@ func (i *ElasticsearchInstance) setPassword(password, key string) error {
 	return nil
 }
 
-func (i *ElasticsearchInstance) getPassword(key string) (string, error) {
+func (i *ElasticsearchInstance) getPassword(keys *helpers.Keyring) (string, error) {
 	if i.Salt == "" || i.Password == "" {
 		return "", errors.New("salt and password has to be set before writing the password")
 	}
 
 	iv, _ := base64.StdEncoding.DecodeString(i.Salt)
 
-	decrypted, err := helpers.Decrypt(i.Password, key, iv)
+	decrypted, err := keys.Decrypt(i.Password, iv)
 	if err != nil {
 		return "", err
 	}
@@ -102,6 +128,47 @@ func (i *ElasticsearchInstance) getPassword(key string) (string, error) {
 	return decrypted, nil
 }
 
+// setAccessKey encrypts the IAM access key of the instance user.
+func (i *ElasticsearchInstance) setAccessKey(accessKeyID, secretAccessKey string, keys *helpers.Keyring) error {
+	encryptedAccessKey, err := keys.Encrypt(accessKeyID)
+	if err != nil {
+		return err
+	}
+	encryptedSecretKey, err := keys.Encrypt(secretAccessKey)
+	if err != nil {
+		return err
+	}
+
+	i.AccessKey = encryptedAccessKey
+	i.SecretKey = encryptedSecretKey
+	i.ClearAccessKey = accessKeyID
+	i.ClearSecretKey = secretAccessKey
+
+	return nil
+}
+
+// loadAccessKey decrypts the IAM access key of the instance user. Access keys
+// stored before they were encrypted are in plain text.
+func (i *ElasticsearchInstance) loadAccessKey(keys *helpers.Keyring) error {
+	accessKey, secretKey := i.AccessKey, i.SecretKey
+	var err error
+	if helpers.IsEncrypted(accessKey) {
+		if accessKey, err = keys.Decrypt(accessKey, nil); err != nil {
+			return err
+		}
+	}
+	if helpers.IsEncrypted(secretKey) {
+		if secretKey, err = keys.Decrypt(secretKey, nil); err != nil {
+			return err
+		}
+	}
+
+	i.ClearAccessKey = accessKey
+	i.ClearSecretKey = secretKey
+
+	return nil
+}
+
 func (i *ElasticsearchInstance) getCredentials() (map[string]string, error) {
 	var credentials map[string]string
 
@@ -117,8 +184,8 @@ func (i *ElasticsearchInstance) getCredentials() (map[string]string, error) {
 	if len(i.Bucket) > 0 {
 		credentials = map[string]string{
 			"uri":                           uri,
-			"access_key":                    i.AccessKey,
-			"secret_key":                    i.SecretKey,
+			"access_key":                    i.ClearAccessKey,
+			"secret_key":                    i.ClearSecretKey,
 			"host":                          i.Host,
 			"current_elasticsearch_version": i.ElasticsearchVersion,
 			"bucket":                        i.Bucket,
@@ -127,8 +194,8 @@ func (i *ElasticsearchInstance) getCredentials() (map[string]string, error) {
 	} else {
 		credentials = map[string]string{
 			"uri":                           uri,
-			"access_key":                    i.AccessKey,
-			"secret_key":                    i.SecretKey,
+			"access_key":                    i.ClearAccessKey,
+			"secret_key":                    i.ClearSecretKey,
 			"host":                          i.Host,
 			"current_elasticsearch_version": i.ElasticsearchVersion,
 		}
@@ -164,7 +231,7 @@ func (i *ElasticsearchInstance) init(
 
 	i.Salt = helpers.GenerateSalt(aes.BlockSize)
 	password := helpers.RandStr(25)
-	if err := i.setPassword(password, s.EncryptionKey); err != nil {
+	if err := i.setPassword(password, s.Keyring()); err != nil {
 		return err
 	}
 
@@ -112,3 +112,83 @@ func TestUpdateInstance(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDashboardURL(t *testing.T) {
+	testCases := map[string]struct {
+		instance    *ElasticsearchInstance
+		expectedURL string
+	}{
+		"no host": {
+			instance: &ElasticsearchInstance{
+				ElasticsearchVersion: "OpenSearch_2.3",
+			},
+			expectedURL: "",
+		},
+		"OpenSearch": {
+			instance: &ElasticsearchInstance{
+				ElasticsearchVersion: "OpenSearch_2.3",
+			},
+			expectedURL: "https://search.example.com/_dashboards/",
+		},
+		"Elasticsearch": {
+			instance: &ElasticsearchInstance{
+				ElasticsearchVersion: "Elasticsearch_7.10",
+			},
+			expectedURL: "https://search.example.com/_plugin/kibana/",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if test.expectedURL != "" {
+				test.instance.Host = "search.example.com"
+			}
+			if url := test.instance.getDashboardURL(); url != test.expectedURL {
+				t.Errorf("expected %s, got %s", test.expectedURL, url)
+			}
+		})
+	}
+}
+
+func TestAccessKeyEncryption(t *testing.T) {
+	keys := helpers.NewKeyring("key-1", "12345678901234567890123456789012", nil)
+
+	instance := &ElasticsearchInstance{}
+	if err := instance.setAccessKey("access-key-id", "secret-access-key", keys); err != nil {
+		t.Fatal(err)
+	}
+	if instance.AccessKey == "access-key-id" || instance.SecretKey == "secret-access-key" {
+		t.Fatal("expected access key to be stored encrypted")
+	}
+
+	loaded := &ElasticsearchInstance{
+		AccessKey: instance.AccessKey,
+		SecretKey: instance.SecretKey,
+	}
+	if err := loaded.loadAccessKey(keys); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := loaded.getCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials["access_key"] != "access-key-id" || credentials["secret_key"] != "secret-access-key" {
+		t.Errorf("expected decrypted access key in credentials, got %s/%s", credentials["access_key"], credentials["secret_key"])
+	}
+}
+
+func TestLoadPlaintextAccessKey(t *testing.T) {
+	keys := helpers.NewKeyring("key-1", "12345678901234567890123456789012", nil)
+
+	// Access keys stored before they were encrypted
+	instance := &ElasticsearchInstance{
+		AccessKey: "access-key-id",
+		SecretKey: "secret-access-key",
+	}
+	if err := instance.loadAccessKey(keys); err != nil {
+		t.Fatal(err)
+	}
+	if instance.ClearAccessKey != "access-key-id" || instance.ClearSecretKey != "secret-access-key" {
+		t.Errorf("expected plain text access key, got %s/%s", instance.ClearAccessKey, instance.ClearSecretKey)
+	}
+}
@@ -2,12 +2,24 @@ package elasticsearch
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"log/slog"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/opensearch"
 	opensearchTypes "github.com/aws/aws-sdk-go-v2/service/opensearch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
+	brokerAws "github.com/cloud-gov/aws-broker/aws"
+	"github.com/cloud-gov/aws-broker/awsiam"
 	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
 
@@ -17,11 +29,67 @@ func testDBInit() (*gorm.DB, error) {
 		return nil, err
 	}
 	// Automigrate!
-	err = db.AutoMigrate(&ElasticsearchInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{})
+	err = db.AutoMigrate(&ElasticsearchInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}, &steps.Checkpoint{})
 	return db, err
 }
 
+func NewTestDedicatedElasticsearchAdapter(
+	ctx context.Context,
+	s *config.Settings,
+	brokerDB *gorm.DB,
+	opensearch OpensearchClientInterface,
+	iam awsiam.IAMClientInterface,
+	s3 brokerAws.S3ClientInterface,
+) *dedicatedElasticsearchAdapter {
+	logger := slog.New(&testutil.MockLogHandler{})
+
+	workers := river.NewWorkers()
+	river.AddWorker(workers, NewCreateWorker(brokerDB, s, opensearch, iam, &mockStsClient{}, logger))
+	river.AddWorker(workers, NewModifyWorker(brokerDB, s, opensearch, logger))
+	river.AddWorker(workers, NewDeleteWorker(brokerDB, s, opensearch, iam, s3, logger))
+
+	if s.DbConfig == nil {
+		s.DbConfig = &db.DBConfig{
+			DbType: "sqlite3",
+		}
+	}
+
+	riverClient, err := testutil.GetRiverClient(ctx, brokerDB, s.DbConfig, workers, logger)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error creating river client: %w", err))
+	}
+
+	return &dedicatedElasticsearchAdapter{
+		ctx:         ctx,
+		db:          brokerDB,
+		settings:    *s,
+		logger:      logger,
+		opensearch:  opensearch,
+		iam:         iam,
+		s3:          s3,
+		riverClient: queue.NewRiverClient(riverClient),
+	}
+}
+
+type mockStsClient struct {
+	getCallerIdentityErr error
+}
+
+func (m *mockStsClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if m.getCallerIdentityErr != nil {
+		return nil, m.getCallerIdentityErr
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+	}, nil
+}
+
 type mockOpensearchClient struct {
+	createDomainCallNum int
+	createDomainErrs    []error
+	createDomainOutput  *opensearch.CreateDomainOutput
+	deleteDomainCalled  bool
+
 	describeDomainCallNum int
 	describeDomainErrs    []error
 	describeDomainResults []*opensearch.DescribeDomainOutput
@@ -33,13 +101,28 @@ type mockOpensearchClient struct {
 
 	compatibleVersions    []opensearchTypes.CompatibleVersionsMap
 	compatibleVersionsErr error
+
+	addTagsInputs  []*opensearch.AddTagsInput
+	addTagsErr     error
+	listTagsOutput *opensearch.ListTagsOutput
+}
+
+func (o *mockOpensearchClient) AddTags(ctx context.Context, params *opensearch.AddTagsInput, optFns ...func(*opensearch.Options)) (*opensearch.AddTagsOutput, error) {
+	o.addTagsInputs = append(o.addTagsInputs, params)
+	return nil, o.addTagsErr
 }
 
 func (o *mockOpensearchClient) CreateDomain(ctx context.Context, params *opensearch.CreateDomainInput, optFns ...func(*opensearch.Options)) (*opensearch.CreateDomainOutput, error) {
-	return nil, nil
+	if o.createDomainCallNum < len(o.createDomainErrs) && o.createDomainErrs[o.createDomainCallNum] != nil {
+		o.createDomainCallNum++
+		return nil, o.createDomainErrs[o.createDomainCallNum-1]
+	}
+	o.createDomainCallNum++
+	return o.createDomainOutput, nil
 }
 
 func (o *mockOpensearchClient) DeleteDomain(ctx context.Context, params *opensearch.DeleteDomainInput, optFns ...func(*opensearch.Options)) (*opensearch.DeleteDomainOutput, error) {
+	o.deleteDomainCalled = true
 	return nil, nil
 }
 
@@ -67,3 +150,10 @@ func (o *mockOpensearchClient) UpgradeDomain(ctx context.Context, params *opense
 func (o *mockOpensearchClient) GetCompatibleVersions(ctx context.Context, params *opensearch.GetCompatibleVersionsInput, optFns ...func(*opensearch.Options)) (*opensearch.GetCompatibleVersionsOutput, error) {
 	return &opensearch.GetCompatibleVersionsOutput{CompatibleVersions: o.compatibleVersions}, o.compatibleVersionsErr
 }
+
+func (o *mockOpensearchClient) ListTags(ctx context.Context, params *opensearch.ListTagsInput, optFns ...func(*opensearch.Options)) (*opensearch.ListTagsOutput, error) {
+	if o.listTagsOutput != nil {
+		return o.listTagsOutput, nil
+	}
+	return &opensearch.ListTagsOutput{}, nil
+}
@@ -0,0 +1,159 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	ModifyKind = "opensearch-modify"
+)
+
+type ModifyArgs struct {
+	Instance    *ElasticsearchInstance `json:"instance"`
+	OperationID string                 `json:"operation_id"`
+}
+
+func (ModifyArgs) Kind() string { return ModifyKind }
+
+func (ModifyArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a ModifyArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.ModifyOp,
+		FailedState: base.InstanceNotModified,
+	}
+}
+
+type ModifyWorker struct {
+	river.WorkerDefaults[ModifyArgs]
+	db         *gorm.DB
+	settings   *config.Settings
+	opensearch OpensearchClientInterface
+	logger     *slog.Logger
+}
+
+func NewModifyWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	opensearch OpensearchClientInterface,
+	logger *slog.Logger,
+) *ModifyWorker {
+	return &ModifyWorker{
+		db:         db,
+		settings:   settings,
+		opensearch: opensearch,
+		logger:     logger,
+	}
+}
+
+func (w *ModifyWorker) Timeout(*river.Job[ModifyArgs]) time.Duration {
+	return w.settings.OpenSearchQueue.JobTimeout
+}
+
+func (w *ModifyWorker) Work(ctx context.Context, job *river.Job[ModifyArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	err := w.asyncModifyElasticsearch(ctx, job.Args.Instance)
+	return steps.RetryIfInterrupted(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:  job.Args.Instance.ServiceID,
+		InstanceID: job.Args.Instance.Uuid,
+		Operation:  base.ModifyOp,
+	}, err)
+}
+
+func (w *ModifyWorker) asyncModifyElasticsearch(ctx context.Context, i *ElasticsearchInstance) error {
+	operation := base.ModifyOp
+
+	if i.versionUpgradeInProgress() {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, fmt.Sprintf("Upgrading domain to %s", i.TargetElasticsearchVersion))
+		_, err := w.opensearch.UpgradeDomain(ctx, &opensearch.UpgradeDomainInput{
+			DomainName:    aws.String(i.Domain),
+			TargetVersion: aws.String(i.TargetElasticsearchVersion),
+		})
+		if err != nil {
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error upgrading domain: %s", err))
+			w.logger.Error("asyncModifyElasticsearch: UpgradeDomain err", "err", err)
+			return river.JobCancel(fmt.Errorf("asyncModifyElasticsearch: UpgradeDomain error: %w ", err))
+		}
+	} else {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Updating domain configuration")
+		params, err := prepareUpdateDomainConfigInput(i)
+		if err != nil {
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error generating domain configuration params: %s", err))
+			return river.JobCancel(fmt.Errorf("asyncModifyElasticsearch: prepareUpdateDomainConfigInput error: %w ", err))
+		}
+
+		_, err = w.opensearch.UpdateDomainConfig(ctx, params)
+		if err != nil {
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error updating domain configuration: %s", err))
+			w.logger.Error("asyncModifyElasticsearch: UpdateDomainConfig err", "err", err)
+			return river.JobCancel(fmt.Errorf("asyncModifyElasticsearch: UpdateDomainConfig error: %w ", err))
+		}
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Waiting for domain changes to complete")
+	state, err := w.waitForDomain(ctx, i)
+	if err != nil {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error waiting for domain changes to complete: %s", err))
+		return river.JobCancel(fmt.Errorf("asyncModifyElasticsearch: error waiting for domain: %w ", err))
+	}
+
+	// waiting for the domain updates the instance version once an upgrade has finished
+	i.State = state
+	err = w.db.WithContext(ctx).Save(i).Error
+	if err != nil {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error saving record: %s", err))
+		w.logger.Error("asyncModifyElasticsearch: error saving record", "err", err)
+		return river.JobCancel(fmt.Errorf("asyncModifyElasticsearch: error saving record %w ", err))
+	}
+
+	if state == base.InstanceNotModified {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, "Domain version upgrade did not complete")
+		return river.JobCancel(errors.New("asyncModifyElasticsearch: version upgrade did not complete"))
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceReady, "Finished modifying OpenSearch resources")
+	return nil
+}
+
+// waitForDomain polls until the domain has finished processing the changes,
+// returning InstanceNotModified if a version upgrade did not complete.
+func (w *ModifyWorker) waitForDomain(ctx context.Context, i *ElasticsearchInstance) (base.InstanceState, error) {
+	attempts := 1
+
+	for attempts <= int(w.settings.PollAwsMaxRetries) {
+		// the domain may not report the change as processing straight away
+		if err := pollDelay(ctx, w.settings.PollAwsMinDelay); err != nil {
+			return base.InstanceInProgress, err
+		}
+
+		state, err := getDomainState(ctx, w.opensearch, w.logger, i)
+		if err != nil {
+			return state, err
+		}
+		if state == base.InstanceReady || state == base.InstanceNotModified {
+			return state, nil
+		}
+
+		attempts += 1
+	}
+
+	return base.InstanceNotModified, errors.New("could not verify modification of domain")
+}
@@ -0,0 +1,192 @@
+package elasticsearch
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/go-test/deep"
+	"github.com/riverqueue/river"
+)
+
+func newTestModifyInstance(targetVersion string) *ElasticsearchInstance {
+	return &ElasticsearchInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid:  helpers.RandStr(10),
+			State: base.InstanceInProgress,
+		},
+		Domain:                     "test-domain",
+		ElasticsearchVersion:       "OpenSearch_1.3",
+		TargetElasticsearchVersion: targetVersion,
+	}
+}
+
+func TestModifyWorkerWork(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewModifyWorker(
+		brokerDB,
+		&config.Settings{
+			PollAwsMinDelay:   1 * time.Millisecond,
+			PollAwsMaxRetries: 1,
+		},
+		&mockOpensearchClient{
+			describeDomainResults: []*opensearch.DescribeDomainOutput{
+				domainStatus(false, false, "OpenSearch_1.3"),
+			},
+		},
+		slog.New(&testutil.MockLogHandler{}),
+	)
+
+	err = worker.Work(t.Context(), &river.Job[ModifyArgs]{Args: ModifyArgs{
+		Instance: newTestModifyInstance(""),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncModifyElasticsearch(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		PollAwsMinDelay:   1 * time.Millisecond,
+		PollAwsMaxRetries: 3,
+	}
+
+	testCases := map[string]struct {
+		instance                *ElasticsearchInstance
+		opensearchClient        *mockOpensearchClient
+		expectUpgradeCalled     bool
+		expectedState           base.InstanceState
+		expectedMessage         string
+		expectedESVersion       string
+		expectedTargetESVersion string
+	}{
+		"version upgrade calls UpgradeDomain and updates version": {
+			instance: newTestModifyInstance("OpenSearch_2.3"),
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{
+					domainStatus(false, true, "OpenSearch_1.3"),
+					domainStatus(false, false, "OpenSearch_2.3"),
+				},
+			},
+			expectUpgradeCalled: true,
+			expectedState:       base.InstanceReady,
+			expectedMessage:     "Finished modifying OpenSearch resources",
+			expectedESVersion:   "OpenSearch_2.3",
+		},
+		"UpgradeDomain error": {
+			instance: newTestModifyInstance("OpenSearch_2.3"),
+			opensearchClient: &mockOpensearchClient{
+				upgradeDomainErr: errors.New("upgrade failed"),
+			},
+			expectUpgradeCalled:     true,
+			expectedState:           base.InstanceNotModified,
+			expectedESVersion:       "OpenSearch_1.3",
+			expectedTargetESVersion: "OpenSearch_2.3",
+		},
+		"version upgrade that does not complete": {
+			instance: newTestModifyInstance("OpenSearch_2.3"),
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{
+					domainStatus(false, false, "OpenSearch_1.3"),
+				},
+			},
+			expectUpgradeCalled: true,
+			expectedState:       base.InstanceNotModified,
+			expectedMessage:     "Domain version upgrade did not complete",
+			expectedESVersion:   "OpenSearch_1.3",
+		},
+		"non-version modify calls UpdateDomainConfig": {
+			instance: newTestModifyInstance(""),
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{
+					domainStatus(true, false, "OpenSearch_1.3"),
+					domainStatus(false, false, "OpenSearch_1.3"),
+				},
+			},
+			expectedState:     base.InstanceReady,
+			expectedMessage:   "Finished modifying OpenSearch resources",
+			expectedESVersion: "OpenSearch_1.3",
+		},
+		"UpdateDomainConfig error": {
+			instance: newTestModifyInstance(""),
+			opensearchClient: &mockOpensearchClient{
+				updateDomainConfigErr: errors.New("update failed"),
+			},
+			expectedState:     base.InstanceNotModified,
+			expectedESVersion: "OpenSearch_1.3",
+		},
+		"error waiting for domain": {
+			instance: newTestModifyInstance(""),
+			opensearchClient: &mockOpensearchClient{
+				describeDomainErrs: []error{errors.New("describe failed")},
+			},
+			expectedState:     base.InstanceNotModified,
+			expectedESVersion: "OpenSearch_1.3",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			worker := NewModifyWorker(brokerDB, settings, test.opensearchClient, slog.New(&testutil.MockLogHandler{}))
+			err := worker.asyncModifyElasticsearch(t.Context(), test.instance)
+			if test.expectedState == base.InstanceReady && err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != base.InstanceReady && err == nil {
+				t.Fatal("expected error")
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, test.instance.ServiceID, test.instance.Uuid, base.ModifyOp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != asyncJobMsg.JobState.State {
+				t.Fatalf("expected async job state: %s, got: %s", test.expectedState, asyncJobMsg.JobState.State)
+			}
+			if test.expectedMessage != "" && test.expectedMessage != asyncJobMsg.JobState.Message {
+				t.Errorf("expected async job message: %s, got: %s", test.expectedMessage, asyncJobMsg.JobState.Message)
+			}
+
+			upgradeCalled := test.opensearchClient.upgradeDomainInput != nil
+			if upgradeCalled != test.expectUpgradeCalled {
+				t.Errorf("UpgradeDomain called=%v, want=%v", upgradeCalled, test.expectUpgradeCalled)
+			}
+			if test.expectUpgradeCalled {
+				if diff := deep.Equal(test.opensearchClient.upgradeDomainInput, &opensearch.UpgradeDomainInput{
+					DomainName:    aws.String(test.instance.Domain),
+					TargetVersion: aws.String("OpenSearch_2.3"),
+				}); diff != nil {
+					t.Error(diff)
+				}
+			}
+
+			if test.instance.ElasticsearchVersion != test.expectedESVersion {
+				t.Errorf("expected ElasticsearchVersion=%q, got %q", test.expectedESVersion, test.instance.ElasticsearchVersion)
+			}
+			if test.instance.TargetElasticsearchVersion != test.expectedTargetESVersion {
+				t.Errorf("expected TargetElasticsearchVersion=%q, got %q", test.expectedTargetESVersion, test.instance.TargetElasticsearchVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	opensearchTypes "github.com/aws/aws-sdk-go-v2/service/opensearch/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"gorm.io/gorm"
+)
+
+// ReconcileResourceTags applies the tags generated for the instance to its
+// domain, reporting whether it was missing any of them. Domains which do not
+// exist are skipped.
+func ReconcileResourceTags(
+	ctx context.Context,
+	i *ElasticsearchInstance,
+	catalog *catalog.Catalog,
+	opensearchClient OpensearchClientInterface,
+	tagManager brokertags.TagManager,
+) (bool, error) {
+	resp, err := opensearchClient.DescribeDomain(ctx, &opensearch.DescribeDomainInput{
+		DomainName: aws.String(i.Domain),
+	})
+	if err != nil {
+		var notFoundException *opensearchTypes.ResourceNotFoundException
+		if errors.As(err, &notFoundException) {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not describe domain: %w", err)
+	}
+	if resp == nil || resp.DomainStatus == nil {
+		return false, nil
+	}
+	arn := resp.DomainStatus.ARN
+
+	plan, err := catalog.ElasticsearchService.FetchPlan(i.PlanID)
+	if err != nil {
+		return false, fmt.Errorf("could not find plan %s: %w", i.PlanID, err)
+	}
+	tags, err := i.ReconcileTags(tagManager, catalog.ElasticsearchService.Name, plan.Name)
+	if err != nil {
+		return false, fmt.Errorf("could not generate tags: %w", err)
+	}
+
+	existing, err := opensearchClient.ListTags(ctx, &opensearch.ListTagsInput{
+		ARN: arn,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not list tags: %w", err)
+	}
+	existingTags := map[string]string{}
+	for _, tag := range existing.TagList {
+		existingTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if base.HasTags(existingTags, tags) {
+		return false, nil
+	}
+
+	_, err = opensearchClient.AddTags(ctx, &opensearch.AddTagsInput{
+		ARN:     arn,
+		TagList: ConvertTagsToOpensearchTags(tags),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not add tags: %w", err)
+	}
+	return true, nil
+}
+
+// ReconcileOpensearchResourceTags applies the tags generated for every instance
+// to its domain.
+func ReconcileOpensearchResourceTags(
+	ctx context.Context,
+	catalog *catalog.Catalog,
+	db *gorm.DB,
+	opensearchClient OpensearchClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) error {
+	instances := []*ElasticsearchInstance{}
+	if err := db.WithContext(ctx).Find(&instances).Error; err != nil {
+		return fmt.Errorf("could not list OpenSearch instances: %w", err)
+	}
+
+	var errs error
+	for _, i := range instances {
+		tagged, err := ReconcileResourceTags(ctx, i, catalog, opensearchClient, tagManager)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("domain %s: %w", i.Domain, err))
+			continue
+		}
+		if tagged {
+			logger.Info("updated tags", "domain", i.Domain)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,100 @@
+package elasticsearch
+
+import (
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	opensearchTypes "github.com/aws/aws-sdk-go-v2/service/opensearch/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/mocks"
+)
+
+func TestReconcileResourceTags(t *testing.T) {
+	testCatalog := &catalog.Catalog{
+		ElasticsearchService: catalog.ElasticsearchService{
+			Service: catalog.Service{Name: "aws-elasticsearch"},
+			ElasticsearchPlans: []catalog.ElasticsearchPlan{
+				{ServicePlan: domain.ServicePlan{ID: "plan-1", Name: "es-dev"}},
+			},
+		},
+	}
+	tagManager := &mocks.MockTagGenerator{Tags: map[string]string{"Space GUID": "space-1"}}
+	domainOutput := &opensearch.DescribeDomainOutput{
+		DomainStatus: &opensearchTypes.DomainStatus{ARN: aws.String("domain-arn")},
+	}
+
+	testCases := map[string]struct {
+		opensearchClient *mockOpensearchClient
+		planID           string
+		expectErr        bool
+		expectTagged     bool
+		expectedAdded    int
+	}{
+		"applies missing tags": {
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{domainOutput},
+			},
+			planID:        "plan-1",
+			expectTagged:  true,
+			expectedAdded: 1,
+		},
+		"leaves tags which are up to date": {
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{domainOutput},
+				listTagsOutput: &opensearch.ListTagsOutput{
+					TagList: []opensearchTypes.Tag{{Key: aws.String("Space GUID"), Value: aws.String("space-1")}},
+				},
+			},
+			planID: "plan-1",
+		},
+		"skips domains which do not exist": {
+			opensearchClient: &mockOpensearchClient{
+				describeDomainErrs: []error{&opensearchTypes.ResourceNotFoundException{}},
+			},
+			planID: "plan-1",
+		},
+		"unknown plan": {
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{domainOutput},
+			},
+			planID:    "unknown",
+			expectErr: true,
+		},
+		"error adding tags": {
+			opensearchClient: &mockOpensearchClient{
+				describeDomainResults: []*opensearch.DescribeDomainOutput{domainOutput},
+				addTagsErr:            errors.New("access denied"),
+			},
+			planID:        "plan-1",
+			expectErr:     true,
+			expectedAdded: 1,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			instance := &ElasticsearchInstance{
+				Instance: base.Instance{
+					Request: request.Request{PlanID: test.planID},
+				},
+				Domain: "domain-1",
+			}
+
+			tagged, err := ReconcileResourceTags(t.Context(), instance, testCatalog, test.opensearchClient, tagManager)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if test.expectTagged != tagged {
+				t.Errorf("expected tagged: %t, got: %t", test.expectTagged, tagged)
+			}
+			if len(test.opensearchClient.addTagsInputs) != test.expectedAdded {
+				t.Errorf("expected %d calls to add tags, got %d", test.expectedAdded, len(test.opensearchClient.addTagsInputs))
+			}
+		})
+	}
+}
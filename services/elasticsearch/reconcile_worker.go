@@ -0,0 +1,80 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	ReconcileKind = "opensearch-reconcile"
+)
+
+// ReconcileArgs are the arguments of the periodic job which brings the
+// OpenSearch resources of every instance in line with the broker's records.
+type ReconcileArgs struct{}
+
+func (ReconcileArgs) Kind() string { return ReconcileKind }
+
+// A failed job is not retried, as the job runs again on its schedule.
+func (ReconcileArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: reconcile.Queue, MaxAttempts: 1}
+}
+
+type ReconcileWorker struct {
+	river.WorkerDefaults[ReconcileArgs]
+	db         *gorm.DB
+	settings   *config.Settings
+	catalog    *catalog.Catalog
+	opensearch OpensearchClientInterface
+	tagManager brokertags.TagManager
+	logger     *slog.Logger
+}
+
+func NewReconcileWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	catalog *catalog.Catalog,
+	opensearch OpensearchClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) *ReconcileWorker {
+	return &ReconcileWorker{
+		db:         db,
+		settings:   settings,
+		catalog:    catalog,
+		opensearch: opensearch,
+		tagManager: tagManager,
+		logger:     logger,
+	}
+}
+
+func (w *ReconcileWorker) Timeout(*river.Job[ReconcileArgs]) time.Duration {
+	return w.settings.OpenSearchQueue.JobTimeout
+}
+
+// Work applies the tags generated for every instance to its domain.
+func (w *ReconcileWorker) Work(ctx context.Context, job *river.Job[ReconcileArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	instance := func(i *ElasticsearchInstance) *base.Instance { return &i.Instance }
+	return reconcile.Instances(ctx, w.db, w.logger, "OpenSearch", instance, w.reconcileInstance)
+}
+
+// reconcileInstance returns a description of each change made to the instance.
+func (w *ReconcileWorker) reconcileInstance(ctx context.Context, i *ElasticsearchInstance) ([]string, error) {
+	tagged, err := ReconcileResourceTags(ctx, i, w.catalog, w.opensearch, w.tagManager)
+	if err != nil || !tagged {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("updated tags of domain %s", i.Domain)}, nil
+}
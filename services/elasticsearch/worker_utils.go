@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
@@ -46,11 +47,12 @@ func createUpdateBucketRolesAndPolicies(
 		policyname := i.Domain + "-to-S3-ESRolePolicy"
 		username := i.Domain
 		policyarn, err := awsiam.CreateUserPolicy(ctx, iam, logger, policy, policyname, username, iamTags)
+		// the policy ARN is recorded even if attaching the policy failed, so the policy can be cleaned up
+		i.IamPassRolePolicyARN = policyarn
 		if err != nil {
 			logger.Error("createUpdateBucketRolesAndPolcies -- CreateUserPolicy Error", "err", err)
 			return err
 		}
-		i.IamPassRolePolicyARN = policyarn
 	}
 
 	// Create PolicyDoc Statements
@@ -86,11 +88,11 @@ func createUpdateBucketRolesAndPolicies(
 			return err
 		}
 		policyarn, err := awsiam.CreatePolicyAttachRole(ctx, iam, logger, policyname, policy, *snapshotRole, iamTags)
+		i.SnapshotPolicyARN = policyarn
 		if err != nil {
 			logger.Error("createUpdateBucketRolesAndPolcies -- CreatePolicyAttachRole Error", "err", err)
 			return err
 		}
-		i.SnapshotPolicyARN = policyarn
 
 	} else {
 		// snaphost policy has already been created so we need to add the new statements for this new bucket
@@ -164,3 +166,63 @@ func bindElasticsearchToApp(ctx context.Context, opensearchClient OpensearchClie
 	// If we get here that means the instance is up and we have the information for it.
 	return i.getCredentials()
 }
+
+// errDomainNotCreated is returned by getDomainState until the domain has been created.
+var errDomainNotCreated = errors.New("instance not available yet. Please wait and try again")
+
+// getDomainState describes the domain and maps its status to an instance state.
+// When a version upgrade has finished, the instance version is updated so that
+// the caller can save it.
+func getDomainState(ctx context.Context, opensearchClient OpensearchClientInterface, logger *slog.Logger, i *ElasticsearchInstance) (base.InstanceState, error) {
+	params := &opensearch.DescribeDomainInput{
+		DomainName: aws.String(i.Domain), // Required
+	}
+
+	resp, err := opensearchClient.DescribeDomain(ctx, params)
+	if err != nil {
+		logger.Error("getDomainState: DescribeDomain err", "err", err)
+		return base.InstanceNotCreated, err
+	}
+
+	logger.Debug(fmt.Sprintf("domain status: %+v\n", resp.DomainStatus))
+
+	if resp.DomainStatus.Created == nil || !*(resp.DomainStatus.Created) {
+		// Instance not up yet.
+		return base.InstanceNotCreated, errDomainNotCreated
+	}
+
+	if i.versionUpgradeInProgress() {
+		if aws.ToBool(resp.DomainStatus.UpgradeProcessing) {
+			return base.InstanceInProgress, nil
+		}
+		if aws.ToString(resp.DomainStatus.EngineVersion) == i.TargetElasticsearchVersion {
+			i.ElasticsearchVersion = i.TargetElasticsearchVersion
+			i.TargetElasticsearchVersion = ""
+			return base.InstanceReady, nil
+		}
+		logger.Error(
+			"getDomainState: version upgrade did not complete",
+			"domain", i.Domain,
+			"engineVersion", aws.ToString(resp.DomainStatus.EngineVersion),
+			"targetVersion", i.TargetElasticsearchVersion,
+		)
+		i.TargetElasticsearchVersion = ""
+		return base.InstanceNotModified, nil
+	}
+
+	if aws.ToBool(resp.DomainStatus.Processing) {
+		return base.InstanceInProgress, nil
+	}
+	return base.InstanceReady, nil
+}
+
+// pollDelay waits for delay before AWS is polled again, returning the error of
+// ctx if the job is cancelled first, such as by the broker shutting down.
+func pollDelay(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
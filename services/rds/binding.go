@@ -0,0 +1,52 @@
+package rds
+
+import (
+	"crypto/aes"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+)
+
+// RDSBinding represents a database user that was created for a single
+// service binding. Each binding gets its own user so that its credentials
+// can be revoked on unbind without affecting any other binding.
+type RDSBinding struct {
+	BindingID  string `gorm:"primaryKey" sql:"size(255)"`
+	InstanceID string `gorm:"index" sql:"size(255)"`
+	Username   string `sql:"size(255)"`
+	Password   string `sql:"size(255)"`
+	Salt       string `sql:"size(255)"`
+	CreatedAt  time.Time
+}
+
+// newRDSBinding generates a username and password for a new binding. The
+// clear text password is returned separately since only the encrypted
+// password is stored.
+func newRDSBinding(bindingID string, i *RDSInstance, settings *config.Settings) (*RDSBinding, string, error) {
+	password := helpers.RandStrNoCaps(25)
+	salt := helpers.GenerateSalt(aes.BlockSize)
+	encrypted, err := i.credentialUtils.generatePassword(salt, password, settings.Keyring())
+	if err != nil {
+		return nil, "", err
+	}
+	return &RDSBinding{
+		BindingID:  bindingID,
+		InstanceID: i.Uuid,
+		Username:   buildUsername(),
+		Password:   encrypted,
+		Salt:       salt,
+	}, password, nil
+}
+
+// supportsBindingUsers returns whether the broker can create a dedicated
+// database user for each binding to an instance of the given database type.
+// Other database types are bound using the instance's master credentials.
+func supportsBindingUsers(dbType string) bool {
+	switch dbType {
+	case "postgres", "mysql":
+		return true
+	default:
+		return false
+	}
+}
@@ -2,25 +2,27 @@ package rds
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/brokerapi/v13/domain"
 	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
+	"github.com/aws/aws-sdk-go-v2/aws"
 
 	brokertags "github.com/cloud-gov/go-broker-tags"
-	"github.com/riverqueue/river"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 )
 
 // PgQqueryLoggingOptions contains optional PostgreSQL query logging parameters
@@ -42,6 +44,7 @@ type PgQueryLoggingOptions struct {
 // they are passed in via the "-c <JSON string or file>" flag.
 type Options struct {
 	AllocatedStorage                int64                  `json:"storage"`
+	MaxAllocatedStorage             *int64                 `json:"max_allocated_storage"`
 	EnableFunctions                 bool                   `json:"enable_functions"`
 	PubliclyAccessible              bool                   `json:"publicly_accessible"`
 	Version                         string                 `json:"version"`
@@ -50,10 +53,17 @@ type Options struct {
 	EnablePgCron                    *bool                  `json:"enable_pg_cron"`
 	RotateCredentials               *bool                  `json:"rotate_credentials"`
 	StorageType                     string                 `json:"storage_type"`
+	Iops                            *int64                 `json:"iops"`
+	StorageThroughput               *int64                 `json:"storage_throughput"`
 	EnableCloudWatchLogGroupExports []string               `json:"enable_cloudwatch_log_groups_exports"`
 	LongQueryTime                   *float64               `json:"long_query_time"`
 	PgQueryLogging                  *PgQueryLoggingOptions `json:"pg_query_logging"`
 	AllowMajorVersionUpgrade        *bool                  `json:"allow_major_version_upgrade"`
+	RestoreFromInstance             string                 `json:"restore_from_instance"`
+	RestoreTime                     *time.Time             `json:"restore_time"`
+	RestoreFromSnapshot             string                 `json:"restore_from_snapshot"`
+	FinalSnapshot                   *bool                  `json:"final_snapshot"`
+	CreateSnapshot                  string                 `json:"create_snapshot"`
 }
 
 // Validate the custom parameters passed in via the "-c <JSON string or file>"
@@ -65,6 +75,10 @@ func (o Options) Validate(settings *config.Settings) error {
 		return fmt.Errorf("invalid storage %d; must be <= %d", o.AllocatedStorage, settings.MaxAllocatedStorage)
 	}
 
+	if err := validateMaxAllocatedStorage(o, settings); err != nil {
+		return err
+	}
+
 	if o.BackupRetentionPeriod != nil && *o.BackupRetentionPeriod > settings.MaxBackupRetention {
 		return fmt.Errorf("invalid Retention Period %d; must be <= %d", o.BackupRetentionPeriod, settings.MaxBackupRetention)
 	}
@@ -81,6 +95,14 @@ func (o Options) Validate(settings *config.Settings) error {
 		return err
 	}
 
+	if o.Iops != nil && *o.Iops < 0 {
+		return fmt.Errorf("invalid iops %d; must be >= 0", *o.Iops)
+	}
+
+	if o.StorageThroughput != nil && *o.StorageThroughput < 0 {
+		return fmt.Errorf("invalid storage_throughput %d; must be >= 0", *o.StorageThroughput)
+	}
+
 	if err := validateLongQueryTime(o.LongQueryTime); err != nil {
 		return err
 	}
@@ -89,9 +111,22 @@ func (o Options) Validate(settings *config.Settings) error {
 		return err
 	}
 
+	if err := validateRestore(o); err != nil {
+		return err
+	}
+
+	if err := validateSnapshotName(o.CreateSnapshot); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// isRestore reports whether the options create the database from a backup.
+func (o Options) isRestore() bool {
+	return o.RestoreFromInstance != "" || o.RestoreFromSnapshot != ""
+}
+
 type rdsBroker struct {
 	ctx         context.Context
 	brokerDB    *gorm.DB
@@ -99,7 +134,7 @@ type rdsBroker struct {
 	settings    *config.Settings
 	tagManager  brokertags.TagManager
 	dbAdapter   dbAdapter
-	riverClient *river.Client[*sql.Tx]
+	riverClient queue.Client
 }
 
 // InitRDSBroker is the constructor for the rdsBroker.
@@ -109,7 +144,7 @@ func InitRDSBroker(
 	brokerDB *gorm.DB,
 	settings *config.Settings,
 	tagManager brokertags.TagManager,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 	logger *slog.Logger,
 ) (base.Broker, error) {
 	dbAdapter, err := initializeAdapter(ctx, settings, brokerDB, logger, riverClient)
@@ -143,7 +178,7 @@ func (broker *rdsBroker) AsyncOperationRequired(o base.Operation) bool {
 	}
 }
 
-func (broker *rdsBroker) CreateInstance(id string, details domain.ProvisionDetails) error {
+func (broker *rdsBroker) CreateInstance(id string, operationID string, details domain.ProvisionDetails) error {
 	newInstance := NewRDSInstance()
 
 	options := Options{}
@@ -156,6 +191,9 @@ func (broker *rdsBroker) CreateInstance(id string, details domain.ProvisionDetai
 		if err != nil {
 			return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "validate input parameters")
 		}
+		if options.CreateSnapshot != "" {
+			return apiresponses.NewFailureResponse(errors.New("create_snapshot can only be set when updating a service instance"), http.StatusBadRequest, "validate input parameters")
+		}
 	}
 
 	var count int64
@@ -219,8 +257,14 @@ func (broker *rdsBroker) CreateInstance(id string, details domain.ProvisionDetai
 		)
 	}
 
+	if options.isRestore() {
+		if err := broker.setRestoreSource(newInstance, plan, options); err != nil {
+			return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "checking restore source")
+		}
+	}
+
 	// Create the database instance.
-	status, err := broker.dbAdapter.createDB(newInstance, plan)
+	status, err := broker.dbAdapter.createDB(newInstance, plan, operationID)
 	if err != nil {
 		return apiresponses.NewFailureResponse(
 			err,
@@ -269,11 +313,116 @@ func (broker *rdsBroker) parseModifyOptionsFromRequest(
 		if err != nil {
 			return options, err
 		}
+		if options.isRestore() {
+			return options, errors.New("restore_from_instance and restore_from_snapshot can only be set when creating a service instance")
+		}
+		if options.CreateSnapshot != "" {
+			parameters := map[string]json.RawMessage{}
+			if err := json.Unmarshal(details.RawParameters, &parameters); err != nil {
+				return options, err
+			}
+			if len(parameters) > 1 {
+				return options, errors.New("create_snapshot cannot be combined with other parameters")
+			}
+		}
 	}
 	return options, nil
 }
 
-func (broker *rdsBroker) ModifyInstance(id string, details domain.UpdateDetails) error {
+// setRestoreSource sets the backup which a new instance is restored from. The
+// backup must be of the database of an instance in the same space, or the final
+// snapshot of a deleted instance which was in the space, with the same engine
+// and storage encryption as the plan of the new instance.
+func (broker *rdsBroker) setRestoreSource(i *RDSInstance, plan *catalog.RDSPlan, options Options) error {
+	source := NewRDSInstance()
+	var engineVersion *string
+	var allocatedStorage *int32
+
+	if options.RestoreFromInstance != "" {
+		err := broker.brokerDB.Where("uuid = ? AND space_guid = ?", options.RestoreFromInstance, i.SpaceGUID).First(source).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("could not find instance %s to restore from in this space", options.RestoreFromInstance)
+		}
+		if err != nil {
+			return err
+		}
+
+		dbInstance, err := broker.dbAdapter.describeDatabaseInstance(source.Database)
+		if err != nil {
+			return fmt.Errorf("could not find database of instance %s: %w", options.RestoreFromInstance, err)
+		}
+		if dbInstance != nil {
+			engineVersion = dbInstance.EngineVersion
+			allocatedStorage = dbInstance.AllocatedStorage
+		}
+
+		i.RestoreSourceDatabase = source.Database
+		i.RestoreTime = options.RestoreTime
+	} else {
+		snapshot, err := broker.dbAdapter.describeDBSnapshot(options.RestoreFromSnapshot)
+		if err != nil {
+			return err
+		}
+		if aws.ToString(snapshot.Status) != "available" {
+			return fmt.Errorf("snapshot %s is not available", options.RestoreFromSnapshot)
+		}
+
+		// The final snapshot of a deleted instance is recorded with what the
+		// instance it was taken of had.
+		record := &RDSSnapshot{}
+		err = broker.brokerDB.Where("identifier = ? AND space_guid = ?", options.RestoreFromSnapshot, i.SpaceGUID).First(record).Error
+		switch {
+		case err == nil:
+			source = record.sourceInstance()
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// database is a reserved word in MySQL, so let gorm quote the columns
+			err = broker.brokerDB.Where(map[string]any{
+				"database":   aws.ToString(snapshot.DBInstanceIdentifier),
+				"space_guid": i.SpaceGUID,
+			}).First(source).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("snapshot %s is not of an instance in this space", options.RestoreFromSnapshot)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		engineVersion = snapshot.EngineVersion
+		allocatedStorage = snapshot.AllocatedStorage
+
+		i.RestoreSnapshot = options.RestoreFromSnapshot
+	}
+
+	if source.DbType != plan.DbType {
+		return fmt.Errorf("cannot restore a %s database with a %s plan", source.DbType, plan.DbType)
+	}
+	if sourcePlan, err := broker.catalog.RdsService.FetchPlan(source.PlanID); err == nil && sourcePlan.Encrypted != plan.Encrypted {
+		return errors.New("the plan must have the same storage encryption as the plan of the instance restored from")
+	}
+
+	// The restored database keeps the name, master user and version of its
+	// backup, and cannot have less storage.
+	i.DbName = source.dbName()
+	i.Username = source.Username
+	if engineVersion != nil {
+		i.DbVersion = *engineVersion
+	}
+	if allocatedStorage != nil && i.AllocatedStorage < int64(*allocatedStorage) {
+		i.AllocatedStorage = int64(*allocatedStorage)
+		if err := i.validateMaxAllocatedStorage(); err != nil {
+			return err
+		}
+		if err := validateProvisionedStorage(i.DbType, i.StorageType, i.AllocatedStorage, i.Iops, i.StorageThroughput); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (broker *rdsBroker) ModifyInstance(id string, operationID string, details domain.UpdateDetails) error {
 	existingInstance := NewRDSInstance()
 
 	// Load the existing instance provided.
@@ -288,6 +437,10 @@ func (broker *rdsBroker) ModifyInstance(id string, details domain.UpdateDetails)
 		return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "validate input parameters")
 	}
 
+	if options.CreateSnapshot != "" {
+		return broker.snapshotInstance(existingInstance, operationID, details, options.CreateSnapshot)
+	}
+
 	// Fetch the current plan.
 	currentPlan, err := broker.catalog.RdsService.FetchPlan(existingInstance.PlanID)
 	if err != nil {
@@ -351,7 +504,10 @@ func (broker *rdsBroker) ModifyInstance(id string, details domain.UpdateDetails)
 	}
 
 	// Modify the database instance.
-	status, err := broker.dbAdapter.modifyDB(modifiedInstance, newPlan)
+	status, err := broker.dbAdapter.modifyDB(modifiedInstance, newPlan, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 
 	switch status {
 	case base.InstanceNotModified:
@@ -382,17 +538,18 @@ func (broker *rdsBroker) ModifyInstance(id string, details domain.UpdateDetails)
 
 func (broker *rdsBroker) LastOperation(id string, details domain.PollDetails) (domain.LastOperation, error) {
 	lastOperation := domain.LastOperation{}
+	operationData := base.ParseOperationData(details.OperationData)
 	existingInstance := NewRDSInstance()
 
 	var count int64
 	broker.brokerDB.Where("uuid = ?", id).First(existingInstance).Count(&count)
-	if count == 0 && details.OperationData != base.DeleteOp.String() {
+	if count == 0 && operationData.Operation != base.DeleteOp {
 		return lastOperation, apiresponses.ErrInstanceDoesNotExist
 	}
 
 	// When asynchronous deletion has finished, the instance record no longer exists, so
 	// return a last operation status indicating that the deletion was successful.
-	if count == 0 && details.OperationData == base.DeleteOp.String() {
+	if count == 0 && operationData.Operation == base.DeleteOp {
 		return domain.LastOperation{
 			State:       domain.Succeeded,
 			Description: "Successfully deleted instance",
@@ -404,14 +561,14 @@ func (broker *rdsBroker) LastOperation(id string, details domain.PollDetails) (d
 	var instanceOperation base.Operation
 	var statusMessage string
 
-	switch details.OperationData {
-	case base.CreateOp.String():
+	switch operationData.Operation {
+	case base.CreateOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.CreateOp)
 		instanceOperation = base.CreateOp
-	case base.ModifyOp.String():
+	case base.ModifyOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.ModifyOp)
 		instanceOperation = base.ModifyOp
-	case base.DeleteOp.String():
+	case base.DeleteOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.DeleteOp)
 		instanceOperation = base.DeleteOp
 	default:
@@ -419,7 +576,7 @@ func (broker *rdsBroker) LastOperation(id string, details domain.PollDetails) (d
 	}
 
 	if needAsyncJobState {
-		asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation)
+		asyncJobMsg, err := asyncmessage.GetAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation, operationData.ID)
 		if err != nil {
 			return lastOperation, apiresponses.NewFailureResponse(
 				err,
@@ -448,7 +605,7 @@ func (broker *rdsBroker) LastOperation(id string, details domain.PollDetails) (d
 	}, nil
 }
 
-func (broker *rdsBroker) BindInstance(id string, details domain.BindDetails) (domain.Binding, error) {
+func (broker *rdsBroker) BindInstance(id string, bindingID string, details domain.BindDetails) (domain.Binding, error) {
 	binding := domain.Binding{
 		OperationData: base.BindOp.String(),
 	}
@@ -460,10 +617,17 @@ func (broker *rdsBroker) BindInstance(id string, details domain.BindDetails) (do
 		return binding, apiresponses.ErrInstanceDoesNotExist
 	}
 
+	if supportsBindingUsers(existingInstance.DbType) {
+		broker.brokerDB.Model(&RDSBinding{}).Where("binding_id = ?", bindingID).Count(&count)
+		if count != 0 {
+			return binding, apiresponses.ErrBindingAlreadyExists
+		}
+	}
+
 	password, err := existingInstance.credentialUtils.getPassword(
 		existingInstance.Salt,
 		existingInstance.Password,
-		broker.settings.EncryptionKey,
+		broker.settings.Keyring(),
 	)
 	if err != nil {
 		return binding, apiresponses.NewFailureResponse(
@@ -484,6 +648,18 @@ func (broker *rdsBroker) BindInstance(id string, details domain.BindDetails) (do
 		)
 	}
 
+	// Create a database user specific to this binding, so that its credentials
+	// can be revoked without affecting other bindings to the instance.
+	if supportsBindingUsers(existingInstance.DbType) {
+		if credentials, err = broker.createBindingUser(existingInstance, bindingID, password); err != nil {
+			return binding, apiresponses.NewFailureResponse(
+				fmt.Errorf("there was an error creating the database user for the binding: %s", err),
+				http.StatusInternalServerError,
+				"create binding user",
+			)
+		}
+	}
+
 	binding.Credentials = credentials
 
 	// If the state of the instance has changed, update it.
@@ -500,7 +676,161 @@ func (broker *rdsBroker) BindInstance(id string, details domain.BindDetails) (do
 	return binding, nil
 }
 
-func (broker *rdsBroker) DeleteInstance(id string) error {
+func (broker *rdsBroker) createBindingUser(i *RDSInstance, bindingID string, masterPassword string) (map[string]string, error) {
+	rdsBinding, password, err := newRDSBinding(bindingID, i, broker.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := broker.dbAdapter.createBindingUser(i, masterPassword, rdsBinding.Username, password); err != nil {
+		return nil, err
+	}
+
+	if err := broker.brokerDB.Create(rdsBinding).Error; err != nil {
+		// Don't leave behind a database user that the broker has no record of.
+		if dropErr := broker.dbAdapter.dropBindingUser(i, masterPassword, rdsBinding.Username); dropErr != nil {
+			return nil, errors.Join(err, dropErr)
+		}
+		return nil, err
+	}
+
+	return i.getBindingCredentials(rdsBinding.Username, password)
+}
+
+func (broker *rdsBroker) UnbindInstance(id string, bindingID string, details domain.UnbindDetails) error {
+	existingInstance := NewRDSInstance()
+
+	// A binding cannot outlive its instance, so without the instance the
+	// binding is reported as gone.
+	result := broker.brokerDB.Where("uuid = ?", id).Limit(1).Find(existingInstance)
+	if result.Error != nil {
+		return apiresponses.NewFailureResponse(result.Error, http.StatusInternalServerError, "find instance")
+	}
+	if result.RowsAffected == 0 {
+		return apiresponses.ErrBindingDoesNotExist
+	}
+
+	// Bindings to database types that do not support binding users share the
+	// master credentials, so there is nothing to revoke.
+	if !supportsBindingUsers(existingInstance.DbType) {
+		return nil
+	}
+
+	rdsBinding := RDSBinding{}
+	result = broker.brokerDB.Where("binding_id = ? AND instance_id = ?", bindingID, id).Limit(1).Find(&rdsBinding)
+	if result.Error != nil {
+		return apiresponses.NewFailureResponse(result.Error, http.StatusInternalServerError, "find binding")
+	}
+	if result.RowsAffected == 0 {
+		return apiresponses.ErrBindingDoesNotExist
+	}
+
+	password, err := existingInstance.credentialUtils.getPassword(
+		existingInstance.Salt,
+		existingInstance.Password,
+		broker.settings.Keyring(),
+	)
+	if err != nil {
+		return apiresponses.NewFailureResponse(
+			fmt.Errorf("unable to get instance password: %s", err),
+			http.StatusInternalServerError,
+			"get instance password",
+		)
+	}
+
+	if err := broker.dbAdapter.dropBindingUser(existingInstance, password, rdsBinding.Username); err != nil {
+		return apiresponses.NewFailureResponse(
+			fmt.Errorf("there was an error dropping the database user for the binding: %s", err),
+			http.StatusInternalServerError,
+			"drop binding user",
+		)
+	}
+
+	if err := broker.brokerDB.Delete(&rdsBinding).Error; err != nil {
+		return apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "delete binding")
+	}
+
+	return nil
+}
+
+// snapshotInstance takes a snapshot of the database of an instance with the
+// name given for it, instead of modifying the instance.
+func (broker *rdsBroker) snapshotInstance(i *RDSInstance, operationID string, details domain.UpdateDetails, name string) error {
+	if details.PlanID != "" && details.PlanID != i.PlanID {
+		return apiresponses.NewFailureResponse(
+			errors.New("create_snapshot cannot be combined with a plan change"),
+			http.StatusBadRequest,
+			"validate input parameters",
+		)
+	}
+
+	// The snapshot is recorded before the job taking it is queued, so that a
+	// concurrent request for a snapshot with the same name is rejected by the
+	// primary key. Restoring the snapshot waits for it to be available in AWS.
+	snapshot := i.generateSnapshotName(broker.settings, name)
+	result := broker.brokerDB.Clauses(clause.OnConflict{DoNothing: true}).Create(newRDSSnapshot(snapshot, i, nil))
+	if result.Error != nil {
+		return apiresponses.NewFailureResponse(result.Error, http.StatusInternalServerError, "snapshot RDS instance")
+	}
+	if result.RowsAffected == 0 {
+		return apiresponses.NewFailureResponse(
+			fmt.Errorf("a snapshot named %s already exists for this instance", name),
+			http.StatusBadRequest,
+			"snapshot RDS instance",
+		)
+	}
+
+	status, err := broker.dbAdapter.snapshotDB(i, snapshot, operationID)
+	switch status {
+	case base.InstanceInProgress:
+		err = broker.brokerDB.Model(RDSInstance{}).Where("uuid", i.Uuid).Update("state", status).Error
+		if err != nil {
+			return apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "snapshot RDS instance")
+		}
+		return nil
+	default:
+		// the snapshot is not taken, so its name is released
+		if deleteErr := broker.brokerDB.Where("identifier = ?", snapshot).Delete(&RDSSnapshot{}).Error; deleteErr != nil {
+			err = errors.Join(err, deleteErr)
+		} else if errors.Is(err, queue.ErrOperationInProgress) {
+			return apiresponses.ErrConcurrentInstanceAccess
+		}
+		return apiresponses.NewFailureResponse(
+			fmt.Errorf("error taking a snapshot of the instance: %s", err),
+			http.StatusInternalServerError,
+			"snapshot RDS instance",
+		)
+	}
+}
+
+func (broker *rdsBroker) GetInstance(id string, details domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error) {
+	existingInstance := NewRDSInstance()
+
+	var count int64
+	broker.brokerDB.Where("uuid = ?", id).First(existingInstance).Count(&count)
+	if count == 0 {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceNotFound
+	}
+
+	snapshots := []RDSSnapshot{}
+	err := broker.brokerDB.Where("instance_id = ?", existingInstance.Uuid).Order("created_at").Find(&snapshots).Error
+	if err != nil {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "list RDS snapshots")
+	}
+
+	// The snapshots are listed with the parameters, which are what
+	// "cf service --params" shows.
+	parameters := existingInstance.getParameters()
+	parameters["snapshots"] = listSnapshots(snapshots)
+
+	return domain.GetInstanceDetailsSpec{
+		ServiceID:  existingInstance.ServiceID,
+		PlanID:     existingInstance.PlanID,
+		Parameters: parameters,
+	}, nil
+}
+
+func (broker *rdsBroker) DeleteInstance(id string, operationID string) error {
 	existingInstance := NewRDSInstance()
 	var count int64
 	broker.brokerDB.Where("uuid = ?", id).First(existingInstance).Count(&count)
@@ -508,8 +838,18 @@ func (broker *rdsBroker) DeleteInstance(id string) error {
 		return apiresponses.ErrInstanceDoesNotExist
 	}
 
+	// The plan of an instance may have been removed from the catalog, in which
+	// case the final snapshot is only taken if turned on with a parameter.
+	plan, _ := broker.catalog.RdsService.FetchPlan(existingInstance.PlanID)
+	if existingInstance.takesFinalSnapshot(plan) {
+		existingInstance.FinalSnapshotIdentifier = existingInstance.generateFinalSnapshotName(broker.settings)
+	}
+
 	// Delete the database instance.
-	status, err := broker.dbAdapter.deleteDB(existingInstance)
+	status, err := broker.dbAdapter.deleteDB(existingInstance, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 	if err != nil {
 		return apiresponses.NewFailureResponse(err, http.StatusInternalServerError, "delete RDS instance")
 	}
@@ -1,14 +1,18 @@
 package rds
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"code.cloudfoundry.org/brokerapi/v13/domain"
 	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
@@ -51,11 +55,54 @@ func TestValidate(t *testing.T) {
 		},
 		"invalid storage type": {
 			options: Options{
-				StorageType: "io1",
+				StorageType: "standard",
 			},
 			settings:    &config.Settings{},
 			expectedErr: true,
 		},
+		"valid max_allocated_storage": {
+			options: Options{
+				MaxAllocatedStorage: aws.Int64(100),
+			},
+			settings:    &config.Settings{MaxAllocatedStorage: 1024},
+			expectedErr: false,
+		},
+		"max_allocated_storage above the maximum storage": {
+			options: Options{
+				MaxAllocatedStorage: aws.Int64(2048),
+			},
+			settings:    &config.Settings{MaxAllocatedStorage: 1024},
+			expectedErr: true,
+		},
+		"max_allocated_storage when restoring from a snapshot": {
+			options: Options{
+				MaxAllocatedStorage: aws.Int64(100),
+				RestoreFromSnapshot: "db-final-uuid",
+			},
+			settings:    &config.Settings{MaxAllocatedStorage: 1024},
+			expectedErr: true,
+		},
+		"invalid iops": {
+			options: Options{
+				Iops: aws.Int64(-1),
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
+		"invalid storage_throughput": {
+			options: Options{
+				StorageThroughput: aws.Int64(-1),
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
+		"cleared iops": {
+			options: Options{
+				Iops: aws.Int64(0),
+			},
+			settings:    &config.Settings{},
+			expectedErr: false,
+		},
 		"valid long_query_time": {
 			options: Options{
 				LongQueryTime: aws.Float64(0.5),
@@ -90,6 +137,46 @@ func TestValidate(t *testing.T) {
 			settings:    &config.Settings{},
 			expectedErr: true,
 		},
+		"restore from instance at a point in time": {
+			options: Options{
+				RestoreFromInstance: "instance-1",
+				RestoreTime:         aws.Time(time.Now().Add(-time.Hour)),
+			},
+			settings:    &config.Settings{},
+			expectedErr: false,
+		},
+		"restore from instance and snapshot": {
+			options: Options{
+				RestoreFromInstance: "instance-1",
+				RestoreFromSnapshot: "snapshot-1",
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
+		"restore time without instance": {
+			options: Options{
+				RestoreFromSnapshot: "snapshot-1",
+				RestoreTime:         aws.Time(time.Now().Add(-time.Hour)),
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
+		"restore time in the future": {
+			options: Options{
+				RestoreFromInstance: "instance-1",
+				RestoreTime:         aws.Time(time.Now().Add(time.Hour)),
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
+		"restore with version": {
+			options: Options{
+				RestoreFromSnapshot: "snapshot-1",
+				Version:             "16",
+			},
+			settings:    &config.Settings{},
+			expectedErr: true,
+		},
 	}
 
 	for name, test := range testCases {
@@ -296,6 +383,42 @@ func TestParseModifyOptionsFromRequest(t *testing.T) {
 				},
 			},
 		},
+		"restore rejected": {
+			broker: &rdsBroker{
+				settings: &config.Settings{},
+			},
+			updateDetails: domain.UpdateDetails{
+				RawParameters: []byte(`{"restore_from_snapshot": "snapshot-1"}`),
+			},
+			expectedOptions: Options{
+				RestoreFromSnapshot: "snapshot-1",
+			},
+			expectErr: true,
+		},
+		"create snapshot": {
+			broker: &rdsBroker{
+				settings: &config.Settings{},
+			},
+			updateDetails: domain.UpdateDetails{
+				RawParameters: []byte(`{"create_snapshot": "pre-migration"}`),
+			},
+			expectedOptions: Options{
+				CreateSnapshot: "pre-migration",
+			},
+		},
+		"create snapshot with other parameters rejected": {
+			broker: &rdsBroker{
+				settings: &config.Settings{},
+			},
+			updateDetails: domain.UpdateDetails{
+				RawParameters: []byte(`{"create_snapshot": "pre-migration", "enable_pg_cron": true}`),
+			},
+			expectedOptions: Options{
+				CreateSnapshot: "pre-migration",
+				EnablePgCron:   aws.Bool(true),
+			},
+			expectErr: true,
+		},
 		"invalid pg_query_logging rejected ": {
 			broker: &rdsBroker{
 				settings: &config.Settings{},
@@ -335,6 +458,7 @@ func TestCreateInstanceSuccess(t *testing.T) {
 		settings         *config.Settings
 		catalog          *catalog.Catalog
 		provisionDetails domain.ProvisionDetails
+		expectedInstance *RDSInstance
 	}{
 		"success": {
 			catalog: &catalog.Catalog{
@@ -363,6 +487,43 @@ func TestCreateInstanceSuccess(t *testing.T) {
 				PlanID: "123",
 			},
 		},
+		"provisioned iops storage": {
+			catalog: &catalog.Catalog{
+				RdsService: catalog.RDSService{
+					RDSPlans: []catalog.RDSPlan{
+						{
+							ServicePlan: domain.ServicePlan{
+								ID: "123",
+							},
+							DbType:           "postgres",
+							StorageType:      "gp3",
+							AllocatedStorage: 20,
+						},
+					},
+				},
+			},
+			planID: "123",
+			dbInstance: &RDSInstance{
+				Instance: base.Instance{
+					Uuid: helpers.RandStr(10),
+				},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey:       helpers.RandStr(32),
+				Environment:         "test", // use the mock adapter
+				MaxAllocatedStorage: 1024,
+			},
+			provisionDetails: domain.ProvisionDetails{
+				PlanID:        "123",
+				RawParameters: json.RawMessage(`{"storage_type": "io1", "storage": 100, "iops": 3000}`),
+			},
+			expectedInstance: &RDSInstance{
+				StorageType:      "io1",
+				AllocatedStorage: 100,
+				Iops:             aws.Int64(3000),
+			},
+		},
 	}
 
 	for name, test := range testCases {
@@ -380,10 +541,253 @@ func TestCreateInstanceSuccess(t *testing.T) {
 				dbAdapter:  &mockDBAdapter{},
 			}
 
-			err = broker.CreateInstance(test.dbInstance.Uuid, test.provisionDetails)
+			err = broker.CreateInstance(test.dbInstance.Uuid, uuid.NewString(), test.provisionDetails)
 			if err != nil {
 				t.Fatal(err)
 			}
+
+			if test.expectedInstance == nil {
+				return
+			}
+			createdInstance := &RDSInstance{}
+			if err := brokerDB.First(createdInstance, "uuid = ?", test.dbInstance.Uuid).Error; err != nil {
+				t.Fatal(err)
+			}
+			if createdInstance.StorageType != test.expectedInstance.StorageType ||
+				createdInstance.AllocatedStorage != test.expectedInstance.AllocatedStorage ||
+				!reflect.DeepEqual(createdInstance.Iops, test.expectedInstance.Iops) {
+				t.Errorf("expected storage %s of %d GB with %v IOPS, got %s of %d GB with %v IOPS",
+					test.expectedInstance.StorageType, test.expectedInstance.AllocatedStorage, aws.ToInt64(test.expectedInstance.Iops),
+					createdInstance.StorageType, createdInstance.AllocatedStorage, aws.ToInt64(createdInstance.Iops))
+			}
+
+			worker := &CreateWorker{
+				settings:          test.settings,
+				rds:               &mockRDSClient{},
+				optionGroupClient: &mockOptionGroupClient{},
+				parameterGroupClient: &mockParameterGroupClient{
+					rds: &mockRDSClient{},
+				},
+			}
+			params, err := worker.prepareCreateDbInput(createdInstance, &test.catalog.RdsService.RDSPlans[0], "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aws.ToString(params.StorageType) != test.expectedInstance.StorageType || int64(aws.ToInt32(params.Iops)) != aws.ToInt64(test.expectedInstance.Iops) {
+				t.Errorf("expected the database to be created with %s storage and %d IOPS, got %+v", test.expectedInstance.StorageType, aws.ToInt64(test.expectedInstance.Iops), params)
+			}
+		})
+	}
+}
+
+func TestSetRestoreSource(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spaceGUID := helpers.RandStr(10)
+	source := &RDSInstance{
+		Instance: base.Instance{
+			Uuid: helpers.RandStr(10),
+			Request: request.Request{
+				PlanID:    "source-plan",
+				SpaceGUID: spaceGUID,
+			},
+		},
+		Database:         "db" + helpers.RandStr(10),
+		Username:         "source-user",
+		DbType:           "postgres",
+		DbVersion:        "15.4",
+		AllocatedStorage: 50,
+	}
+	if err := brokerDB.Create(source).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The final snapshot of an instance which was deleted.
+	finalSnapshot := &RDSSnapshot{
+		Identifier: "db-final-" + helpers.RandStr(10),
+		PlanID:     "source-plan",
+		SpaceGUID:  spaceGUID,
+		Database:   "db" + helpers.RandStr(10),
+		DbName:     "deleted_db",
+		Username:   "deleted-user",
+		DbType:     "postgres",
+	}
+	if err := brokerDB.Create(finalSnapshot).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	testCatalog := &catalog.Catalog{
+		RdsService: catalog.RDSService{
+			RDSPlans: []catalog.RDSPlan{
+				{ServicePlan: domain.ServicePlan{ID: "source-plan"}, DbType: "postgres", Encrypted: true},
+				{ServicePlan: domain.ServicePlan{ID: "unencrypted-plan"}, DbType: "postgres"},
+			},
+		},
+	}
+	encryptedPlan := &catalog.RDSPlan{DbType: "postgres", Encrypted: true}
+
+	testCases := map[string]struct {
+		options          Options
+		spaceGUID        string
+		plan             *catalog.RDSPlan
+		dbAdapter        *mockDBAdapter
+		expectErr        bool
+		expectedInstance *RDSInstance
+	}{
+		"restore from instance": {
+			options:   Options{RestoreFromInstance: source.Uuid},
+			spaceGUID: spaceGUID,
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbInstance: &rdsTypes.DBInstance{EngineVersion: aws.String("15.7"), AllocatedStorage: aws.Int32(60)},
+			},
+			expectedInstance: &RDSInstance{
+				RestoreSourceDatabase: source.Database,
+				DbName:                source.dbName(),
+				Username:              "source-user",
+				DbVersion:             "15.7",
+				AllocatedStorage:      60,
+			},
+		},
+		"restore from snapshot": {
+			options:   Options{RestoreFromSnapshot: "snapshot-1"},
+			spaceGUID: spaceGUID,
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbSnapshot: &rdsTypes.DBSnapshot{
+					DBInstanceIdentifier: aws.String(source.Database),
+					Status:               aws.String("available"),
+					EngineVersion:        aws.String("15.4"),
+					AllocatedStorage:     aws.Int32(50),
+				},
+			},
+			expectedInstance: &RDSInstance{
+				RestoreSnapshot:  "snapshot-1",
+				DbName:           source.dbName(),
+				Username:         "source-user",
+				DbVersion:        "15.4",
+				AllocatedStorage: 50,
+			},
+		},
+		"restore from final snapshot of deleted instance": {
+			options:   Options{RestoreFromSnapshot: finalSnapshot.Identifier},
+			spaceGUID: spaceGUID,
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbSnapshot: &rdsTypes.DBSnapshot{
+					DBInstanceIdentifier: aws.String(finalSnapshot.Database),
+					Status:               aws.String("available"),
+					EngineVersion:        aws.String("15.4"),
+					AllocatedStorage:     aws.Int32(50),
+				},
+			},
+			expectedInstance: &RDSInstance{
+				RestoreSnapshot:  finalSnapshot.Identifier,
+				DbName:           "deleted_db",
+				Username:         "deleted-user",
+				DbVersion:        "15.4",
+				AllocatedStorage: 50,
+			},
+		},
+		"final snapshot of instance in another space": {
+			options:   Options{RestoreFromSnapshot: finalSnapshot.Identifier},
+			spaceGUID: helpers.RandStr(10),
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbSnapshot: &rdsTypes.DBSnapshot{
+					DBInstanceIdentifier: aws.String(finalSnapshot.Database),
+					Status:               aws.String("available"),
+				},
+			},
+			expectErr: true,
+		},
+		"instance in another space": {
+			options:   Options{RestoreFromInstance: source.Uuid},
+			spaceGUID: helpers.RandStr(10),
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{},
+			expectErr: true,
+		},
+		"snapshot of an instance in another space": {
+			options:   Options{RestoreFromSnapshot: "snapshot-1"},
+			spaceGUID: helpers.RandStr(10),
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbSnapshot: &rdsTypes.DBSnapshot{
+					DBInstanceIdentifier: aws.String(source.Database),
+					Status:               aws.String("available"),
+				},
+			},
+			expectErr: true,
+		},
+		"snapshot not available": {
+			options:   Options{RestoreFromSnapshot: "snapshot-1"},
+			spaceGUID: spaceGUID,
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{
+				dbSnapshot: &rdsTypes.DBSnapshot{
+					DBInstanceIdentifier: aws.String(source.Database),
+					Status:               aws.String("creating"),
+				},
+			},
+			expectErr: true,
+		},
+		"snapshot not found": {
+			options:   Options{RestoreFromSnapshot: "snapshot-1"},
+			spaceGUID: spaceGUID,
+			plan:      encryptedPlan,
+			dbAdapter: &mockDBAdapter{},
+			expectErr: true,
+		},
+		"different engine": {
+			options:   Options{RestoreFromInstance: source.Uuid},
+			spaceGUID: spaceGUID,
+			plan:      &catalog.RDSPlan{DbType: "mysql", Encrypted: true},
+			dbAdapter: &mockDBAdapter{},
+			expectErr: true,
+		},
+		"different encryption": {
+			options:   Options{RestoreFromInstance: source.Uuid},
+			spaceGUID: spaceGUID,
+			plan:      &catalog.RDSPlan{DbType: "postgres"},
+			dbAdapter: &mockDBAdapter{},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			broker := &rdsBroker{
+				brokerDB:  brokerDB,
+				catalog:   testCatalog,
+				dbAdapter: test.dbAdapter,
+			}
+			i := &RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{SpaceGUID: test.spaceGUID},
+				},
+				AllocatedStorage: 20,
+			}
+
+			err := broker.setRestoreSource(i, test.plan, test.options)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if test.expectedInstance == nil {
+				return
+			}
+
+			test.expectedInstance.SpaceGUID = test.spaceGUID
+			if diff := deep.Equal(i, test.expectedInstance); diff != nil {
+				t.Error(diff)
+			}
+			// the username is ignored by deep.Equal
+			if i.Username != test.expectedInstance.Username {
+				t.Errorf("expected username %s, got %s", test.expectedInstance.Username, i.Username)
+			}
 		})
 	}
 }
@@ -421,8 +825,165 @@ func TestModify(t *testing.T) {
 						},
 						{
 							ServicePlan: domain.ServicePlan{
-								ID: "456",
+								ID: "456",
+							},
+						},
+					},
+				},
+			},
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Uuid: uuid.NewString(),
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "456",
+					},
+				},
+			}),
+			expectedDbInstance: &RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "123",
+					},
+					State: base.InstanceInProgress,
+				},
+				Tags: map[string]string{},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			},
+			updateDetails: domain.UpdateDetails{
+				PlanID: "123",
+			},
+			dbAdapter: &mockDBAdapter{
+				db: brokerDB,
+			},
+		},
+		"change to io1 storage with provisioned iops": {
+			catalog: &catalog.Catalog{
+				RdsService: catalog.RDSService{
+					RDSPlans: []catalog.RDSPlan{
+						{
+							ServicePlan: domain.ServicePlan{
+								ID:            "123",
+								PlanUpdatable: aws.Bool(true),
+							},
+							DbType:      "postgres",
+							StorageType: "gp3",
+						},
+					},
+				},
+			},
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Uuid: uuid.NewString(),
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "123",
+					},
+				},
+				DbType:           "postgres",
+				AllocatedStorage: 400,
+				StorageType:      "gp3",
+			}),
+			expectedDbInstance: &RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "123",
+					},
+					State: base.InstanceInProgress,
+				},
+				DbType:           "postgres",
+				AllocatedStorage: 400,
+				StorageType:      "io1",
+				Iops:             aws.Int64(10000),
+				Tags:             map[string]string{},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			},
+			updateDetails: domain.UpdateDetails{
+				PlanID:        "123",
+				RawParameters: json.RawMessage(`{"storage_type": "io1", "iops": 10000}`),
+			},
+			dbAdapter: &mockDBAdapter{
+				db: brokerDB,
+			},
+		},
+		"clear provisioned iops and throughput": {
+			catalog: &catalog.Catalog{
+				RdsService: catalog.RDSService{
+					RDSPlans: []catalog.RDSPlan{
+						{
+							ServicePlan: domain.ServicePlan{
+								ID:            "123",
+								PlanUpdatable: aws.Bool(true),
+							},
+							DbType:      "postgres",
+							StorageType: "gp3",
+						},
+					},
+				},
+			},
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Uuid: uuid.NewString(),
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "123",
+					},
+				},
+				DbType:            "postgres",
+				AllocatedStorage:  400,
+				StorageType:       "gp3",
+				Iops:              aws.Int64(16000),
+				StorageThroughput: aws.Int64(1000),
+			}),
+			expectedDbInstance: &RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "123",
+					},
+					State: base.InstanceInProgress,
+				},
+				DbType:            "postgres",
+				AllocatedStorage:  400,
+				StorageType:       "gp3",
+				Iops:              aws.Int64(0),
+				StorageThroughput: aws.Int64(0),
+				Tags:              map[string]string{},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			},
+			updateDetails: domain.UpdateDetails{
+				PlanID:        "123",
+				RawParameters: json.RawMessage(`{"storage_type": "gp3", "iops": 0, "storage_throughput": 0}`),
+			},
+			dbAdapter: &mockDBAdapter{
+				db: brokerDB,
+			},
+		},
+		"storage type change drops provisioned iops": {
+			catalog: &catalog.Catalog{
+				RdsService: catalog.RDSService{
+					RDSPlans: []catalog.RDSPlan{
+						{
+							ServicePlan: domain.ServicePlan{
+								ID:            "123",
+								PlanUpdatable: aws.Bool(true),
 							},
+							DbType:      "postgres",
+							StorageType: "gp2",
 						},
 					},
 				},
@@ -432,9 +993,14 @@ func TestModify(t *testing.T) {
 					Uuid: uuid.NewString(),
 					Request: request.Request{
 						ServiceID: "service-1",
-						PlanID:    "456",
+						PlanID:    "123",
 					},
 				},
+				DbType:            "postgres",
+				AllocatedStorage:  400,
+				StorageType:       "gp3",
+				Iops:              aws.Int64(16000),
+				StorageThroughput: aws.Int64(1000),
 			}),
 			expectedDbInstance: &RDSInstance{
 				Instance: base.Instance{
@@ -444,7 +1010,10 @@ func TestModify(t *testing.T) {
 					},
 					State: base.InstanceInProgress,
 				},
-				Tags: map[string]string{},
+				DbType:           "postgres",
+				AllocatedStorage: 400,
+				StorageType:      "gp2",
+				Tags:             map[string]string{},
 			},
 			tagManager: &mocks.MockTagGenerator{},
 			settings: &config.Settings{
@@ -452,7 +1021,8 @@ func TestModify(t *testing.T) {
 				Environment:   "test", // use the mock adapter
 			},
 			updateDetails: domain.UpdateDetails{
-				PlanID: "123",
+				PlanID:        "123",
+				RawParameters: json.RawMessage(`{}`),
 			},
 			dbAdapter: &mockDBAdapter{
 				db: brokerDB,
@@ -810,7 +1380,7 @@ func TestModify(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = broker.ModifyInstance(test.dbInstance.Uuid, test.updateDetails)
+			err = broker.ModifyInstance(test.dbInstance.Uuid, uuid.NewString(), test.updateDetails)
 			if err != nil {
 				if !test.expectErr {
 					t.Fatal(err)
@@ -839,6 +1409,146 @@ func TestModify(t *testing.T) {
 	}
 }
 
+func TestSnapshotInstance(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := &config.Settings{DbNamePrefix: "db"}
+
+	testCases := map[string]struct {
+		updateDetails    domain.UpdateDetails
+		existingSnapshot bool
+		expectErr        bool
+		expectedSnapshot string
+	}{
+		"success": {
+			updateDetails: domain.UpdateDetails{
+				PlanID:        "plan-1",
+				RawParameters: []byte(`{"create_snapshot": "pre-migration"}`),
+			},
+			expectedSnapshot: "db-pre-migration-%s",
+		},
+		"plan change rejected": {
+			updateDetails: domain.UpdateDetails{
+				PlanID:        "plan-2",
+				RawParameters: []byte(`{"create_snapshot": "pre-migration"}`),
+			},
+			expectErr: true,
+		},
+		"existing snapshot name rejected": {
+			updateDetails: domain.UpdateDetails{
+				PlanID:        "plan-1",
+				RawParameters: []byte(`{"create_snapshot": "pre-migration"}`),
+			},
+			existingSnapshot: true,
+			expectErr:        true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			instance := createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Uuid: uuid.NewString(),
+					Request: request.Request{
+						ServiceID: "service-1",
+						PlanID:    "plan-1",
+					},
+				},
+				Database: helpers.RandStr(10),
+			})
+			if err := brokerDB.Create(instance).Error; err != nil {
+				t.Fatal(err)
+			}
+			if test.existingSnapshot {
+				snapshot := &RDSSnapshot{Identifier: instance.generateSnapshotName(settings, "pre-migration"), InstanceID: instance.Uuid}
+				if err := brokerDB.Create(snapshot).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			adapter := &mockDBAdapter{}
+			broker := &rdsBroker{
+				brokerDB:  brokerDB,
+				settings:  settings,
+				dbAdapter: adapter,
+			}
+			err := broker.ModifyInstance(instance.Uuid, "operation-1", test.updateDetails)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				if adapter.snapshot != "" {
+					t.Errorf("expected no snapshot to be taken, got %s", adapter.snapshot)
+				}
+				return
+			}
+
+			expectedSnapshot := fmt.Sprintf(test.expectedSnapshot, instance.Uuid)
+			if adapter.snapshot != expectedSnapshot {
+				t.Errorf("expected snapshot %s, got %s", expectedSnapshot, adapter.snapshot)
+			}
+			saved := &RDSInstance{}
+			if err := brokerDB.Where("uuid = ?", instance.Uuid).First(saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.State != base.InstanceInProgress {
+				t.Errorf("expected state %s, got %s", base.InstanceInProgress, saved.State)
+			}
+			// the snapshot is recorded to reserve its name
+			var count int64
+			if err := brokerDB.Model(&RDSSnapshot{}).Where("identifier = ? AND instance_id = ?", expectedSnapshot, instance.Uuid).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Errorf("expected snapshot %s to be recorded, got %d records", expectedSnapshot, count)
+			}
+		})
+	}
+}
+
+func TestGetInstanceListsSnapshots(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := createTestRdsInstance(&RDSInstance{
+		Instance: base.Instance{
+			Uuid: uuid.NewString(),
+			Request: request.Request{
+				ServiceID: "service-1",
+				PlanID:    "plan-1",
+			},
+		},
+		Database: helpers.RandStr(10),
+	})
+	if err := brokerDB.Create(instance).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, snapshot := range []*RDSSnapshot{
+		{Identifier: "db-pre-migration-" + instance.Uuid, InstanceID: instance.Uuid},
+		{Identifier: "db-other-" + helpers.RandStr(10), InstanceID: helpers.RandStr(10)},
+	} {
+		if err := brokerDB.Create(snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broker := &rdsBroker{brokerDB: brokerDB}
+	spec, err := broker.GetInstance(instance.Uuid, domain.FetchInstanceDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parameters := spec.Parameters.(map[string]any)
+	snapshots, ok := parameters["snapshots"].([]snapshotListing)
+	if !ok || len(snapshots) != 1 || snapshots[0].Identifier != "db-pre-migration-"+instance.Uuid {
+		t.Errorf("expected only the snapshot of the instance to be listed, got %+v", parameters["snapshots"])
+	}
+}
+
 func TestLastOperation(t *testing.T) {
 	testCases := map[string]struct {
 		planID        string
@@ -1008,3 +1718,261 @@ func TestLastOperation(t *testing.T) {
 		})
 	}
 }
+
+func TestLastOperationWithOperationID(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &rdsBroker{
+		brokerDB:  brokerDB,
+		settings:  &config.Settings{EncryptionKey: helpers.RandStr(32)},
+		dbAdapter: &mockDBAdapter{},
+	}
+
+	dbInstance := &RDSInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid: helpers.RandStr(10),
+		},
+	}
+	err = brokerDB.Create(dbInstance).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A modify operation failed and was superseded by a second one that is
+	// still running.
+	firstOperation := base.NewOperationData(base.ModifyOp)
+	secondOperation := base.NewOperationData(base.ModifyOp)
+	writes := []struct {
+		operation base.OperationData
+		state     base.InstanceState
+	}{
+		{firstOperation, base.InstanceInProgress},
+		{firstOperation, base.InstanceNotModified},
+		{secondOperation, base.InstanceInProgress},
+	}
+	for _, write := range writes {
+		db := brokerDB.WithContext(asyncmessage.ContextWithOperationID(context.Background(), write.operation.ID))
+		err = asyncmessage.WriteAsyncJobMessage(db, dbInstance.ServiceID, dbInstance.Uuid, base.ModifyOp, write.state, write.state.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := map[string]struct {
+		operationData string
+		expectedState base.InstanceState
+	}{
+		"superseded operation": {
+			operationData: firstOperation.String(),
+			expectedState: base.InstanceNotModified,
+		},
+		"current operation": {
+			operationData: secondOperation.String(),
+			expectedState: base.InstanceInProgress,
+		},
+		"operation without an ID": {
+			operationData: base.ModifyOp.String(),
+			expectedState: base.InstanceInProgress,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			lastOperation, err := broker.LastOperation(dbInstance.Uuid, domain.PollDetails{
+				OperationData: test.operationData,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lastOperation.State != test.expectedState.ToLastOperationState() {
+				t.Errorf("expected: %s, got: %s", test.expectedState.ToLastOperationState(), lastOperation.State)
+			}
+		})
+	}
+}
+
+func TestBindInstance(t *testing.T) {
+	testCases := map[string]struct {
+		dbType            string
+		expectBindingUser bool
+	}{
+		"postgres creates a binding user": {
+			dbType:            "postgres",
+			expectBindingUser: true,
+		},
+		"mysql creates a binding user": {
+			dbType:            "mysql",
+			expectBindingUser: true,
+		},
+		"oracle uses the master credentials": {
+			dbType:            "oracle-se2",
+			expectBindingUser: false,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			settings := &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			}
+
+			instance := NewRDSInstance()
+			instance.Uuid = uuid.NewString()
+			instance.Database = "db" + helpers.RandStrNoCaps(10)
+			instance.Username = "master"
+			instance.DbType = test.dbType
+			instance.Host = "localhost"
+			instance.Port = 5432
+			instance.State = base.InstanceReady
+			err = instance.generateCredentials(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = brokerDB.Create(instance).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			broker := &rdsBroker{
+				brokerDB:  brokerDB,
+				settings:  settings,
+				dbAdapter: &mockDBAdapter{db: brokerDB},
+			}
+
+			bindingID := uuid.NewString()
+			binding, err := broker.BindInstance(instance.Uuid, bindingID, domain.BindDetails{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			credentials, ok := binding.Credentials.(map[string]string)
+			if !ok {
+				t.Fatalf("expected credentials map, got %T", binding.Credentials)
+			}
+
+			var count int64
+			brokerDB.Model(&RDSBinding{}).Where("binding_id = ?", bindingID).Count(&count)
+
+			if !test.expectBindingUser {
+				if credentials["username"] != instance.Username {
+					t.Fatalf("expected username %s, got %s", instance.Username, credentials["username"])
+				}
+				if count != 0 {
+					t.Fatal("expected no binding record")
+				}
+				return
+			}
+
+			if credentials["username"] == instance.Username {
+				t.Fatal("expected binding to have its own username")
+			}
+			if count != 1 {
+				t.Fatal("expected binding record to be created")
+			}
+
+			rdsBinding := RDSBinding{}
+			brokerDB.Where("binding_id = ?", bindingID).First(&rdsBinding)
+			if rdsBinding.Username != credentials["username"] {
+				t.Fatalf("expected username %s, got %s", rdsBinding.Username, credentials["username"])
+			}
+			if rdsBinding.Password == credentials["password"] {
+				t.Fatal("expected binding password to be stored encrypted")
+			}
+
+			_, err = broker.BindInstance(instance.Uuid, bindingID, domain.BindDetails{})
+			if err != apiresponses.ErrBindingAlreadyExists {
+				t.Fatalf("expected error %s, got %s", apiresponses.ErrBindingAlreadyExists, err)
+			}
+		})
+	}
+}
+
+func TestUnbindInstance(t *testing.T) {
+	testCases := map[string]struct {
+		createInstance bool
+		createBinding  bool
+		expectedErr    error
+	}{
+		"success": {
+			createInstance: true,
+			createBinding:  true,
+		},
+		"binding does not exist": {
+			createInstance: true,
+			expectedErr:    apiresponses.ErrBindingDoesNotExist,
+		},
+		"instance does not exist": {
+			expectedErr: apiresponses.ErrBindingDoesNotExist,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			settings := &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			}
+
+			instance := NewRDSInstance()
+			instance.Uuid = uuid.NewString()
+			instance.Username = "master"
+			instance.DbType = "postgres"
+			err = instance.generateCredentials(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.createInstance {
+				err = brokerDB.Create(instance).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			bindingID := uuid.NewString()
+			if test.createBinding {
+				rdsBinding, _, err := newRDSBinding(bindingID, instance, settings)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = brokerDB.Create(rdsBinding).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			broker := &rdsBroker{
+				brokerDB:  brokerDB,
+				settings:  settings,
+				dbAdapter: &mockDBAdapter{db: brokerDB},
+			}
+
+			err = broker.UnbindInstance(instance.Uuid, bindingID, domain.UnbindDetails{})
+			if err != test.expectedErr {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+
+			var count int64
+			brokerDB.Model(&RDSBinding{}).Where("binding_id = ?", bindingID).Count(&count)
+			if count != 0 {
+				t.Fatal("expected binding record to be removed")
+			}
+		})
+	}
+}
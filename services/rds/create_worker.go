@@ -15,6 +15,8 @@ import (
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/common"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
@@ -24,12 +26,25 @@ const (
 )
 
 type CreateArgs struct {
-	Instance *RDSInstance     `json:"instance"`
-	Plan     *catalog.RDSPlan `json:"plan"`
+	Instance    *RDSInstance     `json:"instance"`
+	Plan        *catalog.RDSPlan `json:"plan"`
+	OperationID string           `json:"operation_id"`
 }
 
 func (CreateArgs) Kind() string { return CreateKind }
 
+func (CreateArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a CreateArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}
+}
+
 type CreateWorker struct {
 	river.WorkerDefaults[CreateArgs]
 	db                   *gorm.DB
@@ -61,7 +76,13 @@ func NewCreateWorker(
 	}
 }
 
+func (w *CreateWorker) Timeout(*river.Job[CreateArgs]) time.Duration {
+	return w.settings.RDSQueue.JobTimeout
+}
+
 func (w *CreateWorker) Work(ctx context.Context, job *river.Job[CreateArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
 	err := w.asyncCreateDB(ctx, job.Args.Instance, job.Args.Plan)
 	return err
 }
@@ -89,7 +110,7 @@ func (w *CreateWorker) prepareCreateDbInput(
 		// Instance class is defined by the plan
 		DBInstanceClass:         &plan.InstanceClass,
 		DBInstanceIdentifier:    &i.Database,
-		DBName:                  aws.String(formatDBName(i.Database, i.DbType)),
+		DBName:                  aws.String(i.dbName()),
 		Engine:                  aws.String(i.DbType),
 		MasterUserPassword:      &password,
 		MasterUsername:          &i.Username,
@@ -109,6 +130,12 @@ func (w *CreateWorker) prepareCreateDbInput(
 	if i.DbVersion != "" {
 		params.EngineVersion = aws.String(i.DbVersion)
 	}
+	if params.MaxAllocatedStorage, err = i.maxAllocatedStorage(); err != nil {
+		return nil, err
+	}
+	if params.Iops, params.StorageThroughput, err = i.provisionedStorage(); err != nil {
+		return nil, err
+	}
 	if i.LicenseModel != "" {
 		params.LicenseModel = aws.String(i.LicenseModel)
 	}
@@ -117,21 +144,151 @@ func (w *CreateWorker) prepareCreateDbInput(
 		params.EnableCloudwatchLogsExports = i.EnabledCloudwatchLogGroupExports
 	}
 
+	if err := w.provisionGroups(i, rdsTags); err != nil {
+		return nil, err
+	}
+	if i.ParameterGroupName != "" {
+		params.DBParameterGroupName = aws.String(i.ParameterGroupName)
+	}
+	if i.OptionGroupName != "" {
+		params.OptionGroupName = aws.String(i.OptionGroupName)
+	}
+
+	return params, nil
+}
+
+// provisionGroups creates the parameter and option groups of the instance.
+func (w *CreateWorker) provisionGroups(i *RDSInstance, rdsTags []rdsTypes.Tag) error {
 	// If a custom parameter has been requested, and the feature is enabled,
 	// create/update a custom parameter group for our custom parameters.
-	err = w.parameterGroupClient.ProvisionNewCustomParameterGroup(i, rdsTags)
+	err := w.parameterGroupClient.ProvisionNewCustomParameterGroup(i, rdsTags)
+	if err != nil {
+		return err
+	}
+
+	// Attach the engine's baseline option group (Oracle SE2: SSL/TCPS). No-op
+	// for postgres/mysql. Fails closed.
+	return w.optionGroupClient.ProvisionBaselineOptionGroup(i, rdsTags)
+}
+
+// prepareRestoreToPointInTimeInput returns the parameters which restore the
+// database of another instance to RestoreTime, or to its latest restorable
+// time if RestoreTime is not set.
+func (w *CreateWorker) prepareRestoreToPointInTimeInput(
+	i *RDSInstance,
+	plan *catalog.RDSPlan,
+) (*rds.RestoreDBInstanceToPointInTimeInput, error) {
+	rdsTags := ConvertTagsToRDSTags(i.getTags())
+
+	allocatedStorage, err := common.ConvertInt64ToInt32Safely(i.AllocatedStorage)
 	if err != nil {
 		return nil, err
 	}
+
+	backupRetentionPeriod, err := common.ConvertInt64ToInt32Safely(i.BackupRetentionPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &rds.RestoreDBInstanceToPointInTimeInput{
+		SourceDBInstanceIdentifier: aws.String(i.RestoreSourceDatabase),
+		TargetDBInstanceIdentifier: aws.String(i.Database),
+		AllocatedStorage:           allocatedStorage,
+		DBInstanceClass:            &plan.InstanceClass,
+		AutoMinorVersionUpgrade:    aws.Bool(true),
+		MultiAZ:                    aws.Bool(plan.Redundant),
+		StorageType:                aws.String(i.StorageType),
+		Tags:                       rdsTags,
+		PubliclyAccessible:         aws.Bool(w.settings.PubliclyAccessibleFeature && i.PubliclyAccessible),
+		BackupRetentionPeriod:      backupRetentionPeriod,
+		DBSubnetGroupName:          &i.DbSubnetGroup,
+		VpcSecurityGroupIds: []string{
+			i.SecGroup,
+		},
+	}
+
+	if i.RestoreTime != nil {
+		params.RestoreTime = i.RestoreTime
+	} else {
+		params.UseLatestRestorableTime = aws.Bool(true)
+	}
+	if params.MaxAllocatedStorage, err = i.maxAllocatedStorage(); err != nil {
+		return nil, err
+	}
+	if params.Iops, params.StorageThroughput, err = i.provisionedStorage(); err != nil {
+		return nil, err
+	}
+	if i.LicenseModel != "" {
+		params.LicenseModel = aws.String(i.LicenseModel)
+	}
+	if len(i.EnabledCloudwatchLogGroupExports) > 0 {
+		params.EnableCloudwatchLogsExports = i.EnabledCloudwatchLogGroupExports
+	}
+
+	if err := w.provisionGroups(i, rdsTags); err != nil {
+		return nil, err
+	}
 	if i.ParameterGroupName != "" {
 		params.DBParameterGroupName = aws.String(i.ParameterGroupName)
 	}
+	if i.OptionGroupName != "" {
+		params.OptionGroupName = aws.String(i.OptionGroupName)
+	}
 
-	// Attach the engine's baseline option group (Oracle SE2: SSL/TCPS). No-op
-	// for postgres/mysql. Fails closed.
-	if err = w.optionGroupClient.ProvisionBaselineOptionGroup(i, rdsTags); err != nil {
+	return params, nil
+}
+
+// prepareRestoreFromSnapshotInput returns the parameters which restore a
+// snapshot of the database of another instance.
+func (w *CreateWorker) prepareRestoreFromSnapshotInput(
+	i *RDSInstance,
+	plan *catalog.RDSPlan,
+) (*rds.RestoreDBInstanceFromDBSnapshotInput, error) {
+	rdsTags := ConvertTagsToRDSTags(i.getTags())
+
+	allocatedStorage, err := common.ConvertInt64ToInt32Safely(i.AllocatedStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	backupRetentionPeriod, err := common.ConvertInt64ToInt32Safely(i.BackupRetentionPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBSnapshotIdentifier:    aws.String(i.RestoreSnapshot),
+		DBInstanceIdentifier:    aws.String(i.Database),
+		AllocatedStorage:        allocatedStorage,
+		DBInstanceClass:         &plan.InstanceClass,
+		AutoMinorVersionUpgrade: aws.Bool(true),
+		MultiAZ:                 aws.Bool(plan.Redundant),
+		StorageType:             aws.String(i.StorageType),
+		Tags:                    rdsTags,
+		PubliclyAccessible:      aws.Bool(w.settings.PubliclyAccessibleFeature && i.PubliclyAccessible),
+		BackupRetentionPeriod:   backupRetentionPeriod,
+		DBSubnetGroupName:       &i.DbSubnetGroup,
+		VpcSecurityGroupIds: []string{
+			i.SecGroup,
+		},
+	}
+
+	if params.Iops, params.StorageThroughput, err = i.provisionedStorage(); err != nil {
+		return nil, err
+	}
+	if i.LicenseModel != "" {
+		params.LicenseModel = aws.String(i.LicenseModel)
+	}
+	if len(i.EnabledCloudwatchLogGroupExports) > 0 {
+		params.EnableCloudwatchLogsExports = i.EnabledCloudwatchLogGroupExports
+	}
+
+	if err := w.provisionGroups(i, rdsTags); err != nil {
 		return nil, err
 	}
+	if i.ParameterGroupName != "" {
+		params.DBParameterGroupName = aws.String(i.ParameterGroupName)
+	}
 	if i.OptionGroupName != "" {
 		params.OptionGroupName = aws.String(i.OptionGroupName)
 	}
@@ -139,6 +296,34 @@ func (w *CreateWorker) prepareCreateDbInput(
 	return params, nil
 }
 
+// createDatabase creates the primary database, from a backup if the instance
+// is restored from one.
+func (w *CreateWorker) createDatabase(ctx context.Context, i *RDSInstance, plan *catalog.RDSPlan, password string) error {
+	switch {
+	case i.RestoreSourceDatabase != "":
+		params, err := w.prepareRestoreToPointInTimeInput(i, plan)
+		if err != nil {
+			return fmt.Errorf("error generating database restore params: %w", err)
+		}
+		_, err = w.rds.RestoreDBInstanceToPointInTime(ctx, params)
+		return err
+	case i.RestoreSnapshot != "":
+		params, err := w.prepareRestoreFromSnapshotInput(i, plan)
+		if err != nil {
+			return fmt.Errorf("error generating database restore params: %w", err)
+		}
+		_, err = w.rds.RestoreDBInstanceFromDBSnapshot(ctx, params)
+		return err
+	default:
+		params, err := w.prepareCreateDbInput(i, plan, password)
+		if err != nil {
+			return fmt.Errorf("error generating database creation params: %w", err)
+		}
+		_, err = w.rds.CreateDBInstance(ctx, params)
+		return err
+	}
+}
+
 func (w *CreateWorker) createDBReadReplica(ctx context.Context, i *RDSInstance, plan *catalog.RDSPlan) (*rds.CreateDBInstanceReadReplicaOutput, error) {
 	var err error
 
@@ -183,82 +368,128 @@ func (w *CreateWorker) createDBReadReplica(ctx context.Context, i *RDSInstance,
 	return createDbInstanceReadReplicaOutput, err
 }
 
-func (w *CreateWorker) waitAndCreateDBReadReplica(
-	ctx context.Context,
-	operation base.Operation,
-	i *RDSInstance,
-	plan *catalog.RDSPlan,
-) error {
-	err := waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, operation, i, i.Database)
-	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for database to become available: %s", err))
-		return fmt.Errorf("waitAndCreateDBReadReplica, error waiting for database to be ready: %w", err)
-	}
-
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Creating database read replica")
-
-	createReplicaOutput, err := w.createDBReadReplica(ctx, i, plan)
-	if err != nil {
-		w.logger.Error("waitAndCreateDBReadReplica: createDBReadReplica failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Creating database read replica failed: %s", err))
-		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
-	}
-
-	err = waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, operation, i, i.ReplicaDatabase)
-	if err != nil {
-		w.logger.Error("waitAndCreateDBReadReplica: waitForDbReady failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for replica database to become available: %s", err))
-		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
-	}
-
-	err = updateDBTags(ctx, w.rds, i, *createReplicaOutput.DBInstance.DBInstanceArn)
-	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error updating tags for database replica: %s", err))
-		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
-	}
-
-	return nil
+// createState is the state of a create job saved with each checkpoint.
+type createState struct {
+	Instance   *RDSInstance `json:"instance"`
+	ReplicaARN string       `json:"replica_arn"`
 }
 
 func (w *CreateWorker) asyncCreateDB(ctx context.Context, i *RDSInstance, plan *catalog.RDSPlan) error {
-	operation := base.CreateOp
-
-	password, err := w.credentialUtils.getPassword(i.Salt, i.Password, w.settings.EncryptionKey)
+	state := &createState{Instance: i}
+	runner, err := steps.NewRunner(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:   i.ServiceID,
+		InstanceID:  i.Uuid,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}, state)
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error getting password: %s", err))
-		return river.JobCancel(fmt.Errorf("asyncCreateDB: error getting password %w ", err))
+		return fmt.Errorf("asyncCreateDB: %w", err)
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Preparing database creation input")
-	createDbInputParams, err := w.prepareCreateDbInput(i, plan, password)
-	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error generating database creation params: %s", err))
-		return river.JobCancel(fmt.Errorf("asyncCreateDB: prepareCreateDbInput error: %w ", err))
+	var password string
+	createSteps := []steps.Step{
+		{
+			ErrorMessage: "Error getting password",
+			Run: func(ctx context.Context) error {
+				password, err = w.credentialUtils.getPassword(i.Salt, i.Password, w.settings.Keyring())
+				return err
+			},
+		},
+		{
+			Name:         "primary created",
+			Message:      "Creating database instance",
+			ErrorMessage: "Error creating database",
+			Run: func(ctx context.Context) error {
+				return w.createDatabase(ctx, i, plan, password)
+			},
+		},
+		{
+			Name:         "primary available",
+			Message:      "Waiting for database to be ready",
+			ErrorMessage: "Error waiting for database to become available",
+			Run: func(ctx context.Context) error {
+				return waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, base.CreateOp, i, i.Database)
+			},
+		},
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Creating database instance")
-	_, err = w.rds.CreateDBInstance(ctx, createDbInputParams)
-	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error creating database: %s", err))
-		return river.JobCancel(fmt.Errorf("asyncCreateDB: CreateDBInstance error: %w ", err))
+	if i.isRestore() {
+		// A restored database keeps the master password of its backup.
+		createSteps = append(createSteps,
+			steps.Step{
+				Name:         "primary credentials reset",
+				Message:      "Setting new credentials for restored database",
+				ErrorMessage: "Error setting new credentials for restored database",
+				Run: func(ctx context.Context) error {
+					_, err := w.rds.ModifyDBInstance(ctx, &rds.ModifyDBInstanceInput{
+						DBInstanceIdentifier: aws.String(i.Database),
+						MasterUserPassword:   aws.String(password),
+						ApplyImmediately:     aws.Bool(true),
+					})
+					var invalidDbInstanceStateErr *rdsTypes.InvalidDBInstanceStateFault
+					if errors.As(err, &invalidDbInstanceStateErr) {
+						return steps.Transient(err)
+					}
+					return err
+				},
+			},
+			steps.Step{
+				Name:         "primary credentials available",
+				Message:      "Waiting for database to be ready",
+				ErrorMessage: "Error waiting for database to become available",
+				Run: func(ctx context.Context) error {
+					return waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, base.CreateOp, i, i.Database)
+				},
+			},
+		)
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Waiting for database to be ready")
-	err = waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, operation, i, i.Database)
-	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for database to become available: %s", err))
-		return river.JobCancel(fmt.Errorf("asyncCreateDB: waitForDbReady error: %w ", err))
+	if i.AddReadReplica {
+		createSteps = append(createSteps,
+			steps.Step{
+				Name:         "replica created",
+				Message:      "Creating database read replica",
+				ErrorMessage: "Creating database read replica failed",
+				Run: func(ctx context.Context) error {
+					createReplicaOutput, err := w.createDBReadReplica(ctx, i, plan)
+					var invalidDbInstanceStateErr *rdsTypes.InvalidDBInstanceStateFault
+					if errors.As(err, &invalidDbInstanceStateErr) {
+						// the primary is still being modified after it became available
+						return steps.Transient(err)
+					}
+					if err != nil {
+						return err
+					}
+					state.ReplicaARN = aws.ToString(createReplicaOutput.DBInstance.DBInstanceArn)
+					return nil
+				},
+			},
+			steps.Step{
+				Name:         "replica available",
+				Message:      "Waiting for database replica to be ready",
+				ErrorMessage: "Error waiting for replica database to become available",
+				Run: func(ctx context.Context) error {
+					return waitForDbReady(ctx, w.db, w.settings, w.rds, w.logger, base.CreateOp, i, i.ReplicaDatabase)
+				},
+			},
+			steps.Step{
+				Name:         "replica tags applied",
+				Message:      "Updating tags for database replica",
+				ErrorMessage: "Error updating tags for database replica",
+				Run: func(ctx context.Context) error {
+					return updateDBTags(ctx, w.rds, i, state.ReplicaARN)
+				},
+			},
+		)
 	}
 
-	if i.AddReadReplica {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Creating database replica")
-		err := w.waitAndCreateDBReadReplica(ctx, operation, i, plan)
-		if err != nil {
-			asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error creating database replica: %s", err))
-			return river.JobCancel(fmt.Errorf("asyncCreateDB: waitAndCreateDBReadReplica error: %w ", err))
+	for _, step := range createSteps {
+		if err := runner.Run(ctx, step); err != nil {
+			return err
 		}
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceReady, "Finished creating database resources")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceReady, "Finished creating database resources")
+	runner.Finish(ctx)
 	return nil
 }
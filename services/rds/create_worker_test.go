@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/smithy-go"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
@@ -22,6 +23,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
 )
 
 func TestCreateWorkerWork(t *testing.T) {
@@ -384,6 +386,9 @@ func TestPrepareCreateDbInstanceInput(t *testing.T) {
 				SecGroup:                         "sec-group-1",
 				LicenseModel:                     "foo",
 				EnabledCloudwatchLogGroupExports: pq.StringArray{"slowquery", "audit"},
+				MaxAllocatedStorage:              aws.Int64(100),
+				Iops:                             aws.Int64(16000),
+				StorageThroughput:                aws.Int64(1000),
 			},
 			tags: map[string]string{
 				"foo": "bar",
@@ -433,6 +438,9 @@ func TestPrepareCreateDbInstanceInput(t *testing.T) {
 				EngineVersion:               aws.String("8.0"),
 				LicenseModel:                aws.String("foo"),
 				EnableCloudwatchLogsExports: []string{"slowquery", "audit"},
+				MaxAllocatedStorage:         aws.Int32(100),
+				Iops:                        aws.Int32(16000),
+				StorageThroughput:           aws.Int32(1000),
 			},
 		},
 	}
@@ -470,6 +478,7 @@ func TestAsyncCreateDb(t *testing.T) {
 		password      string
 		plan          *catalog.RDSPlan
 		expectErr     bool
+		expectCancel  bool
 	}{
 		"error provisioning custom parameter group": {
 			ctx: t.Context(),
@@ -738,6 +747,155 @@ func TestAsyncCreateDb(t *testing.T) {
 			expectedState: base.InstanceNotCreated,
 			expectErr:     true,
 		},
+		"error adding replica tags": {
+			ctx: t.Context(),
+			worker: NewCreateWorker(
+				brokerDB,
+				&config.Settings{
+					PollAwsMinDelay:    1 * time.Millisecond,
+					PollAwsMaxDuration: 1 * time.Millisecond,
+					DbConfig: &db.DBConfig{
+						DbType: "sqlite3",
+					},
+				},
+				&mockRDSClient{
+					addTagsToResourceErr: errors.New("error adding tags to read replica"),
+					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									DBInstanceStatus: aws.String("available"),
+								},
+							},
+						},
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									DBInstanceStatus: aws.String("available"),
+								},
+							},
+						},
+					},
+				},
+				slog.New(&testutil.MockLogHandler{}),
+				&mockParameterGroupClient{},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{
+					mockClearPassword: "fake-pw",
+				},
+			),
+			plan:     &catalog.RDSPlan{},
+			password: helpers.RandStr(10),
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+				Database:        helpers.RandStr(10),
+				ReplicaDatabase: "replica",
+				AddReadReplica:  true,
+			}),
+			expectedState: base.InstanceNotCreated,
+			expectErr:     true,
+		},
+		"error checking database creation status": {
+			// with attempts left, so that only a non-transient failure cancels the job
+			ctx: asyncmessage.ContextWithJob(t.Context(), &rivertype.JobRow{ID: 2, Attempt: 1, MaxAttempts: 3}),
+			worker: NewCreateWorker(
+				brokerDB,
+				&config.Settings{
+					PollAwsMinDelay:    1 * time.Millisecond,
+					PollAwsMaxDuration: 1 * time.Millisecond,
+					DbConfig: &db.DBConfig{
+						DbType: "sqlite3",
+					},
+				},
+				&mockRDSClient{
+					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									DBInstanceStatus: aws.String("available"),
+								},
+							},
+						},
+					},
+					describeDbInstancesErrs: []error{nil, errors.New("error describing database instances")},
+				},
+				slog.New(&testutil.MockLogHandler{}),
+				&mockParameterGroupClient{},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{
+					mockClearPassword: "fake-pw",
+				},
+			),
+			plan:     &catalog.RDSPlan{},
+			password: helpers.RandStr(10),
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+				Database:        helpers.RandStr(10),
+				ReplicaDatabase: "replica",
+				AddReadReplica:  true,
+			}),
+			expectedState: base.InstanceNotCreated,
+			expectErr:     true,
+			expectCancel:  true,
+		},
+		"error creating database replica": {
+			// with attempts left, so that only a non-transient failure cancels the job
+			ctx: asyncmessage.ContextWithJob(t.Context(), &rivertype.JobRow{ID: 3, Attempt: 1, MaxAttempts: 3}),
+			worker: NewCreateWorker(
+				brokerDB,
+				&config.Settings{
+					PollAwsMinDelay:    1 * time.Millisecond,
+					PollAwsMaxDuration: 1 * time.Millisecond,
+					DbConfig: &db.DBConfig{
+						DbType: "sqlite3",
+					},
+				},
+				&mockRDSClient{
+					createDBInstanceReadReplicaErrs: []error{errors.New("error creating database instance read replica")},
+					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									DBInstanceStatus: aws.String("available"),
+								},
+							},
+						},
+					},
+				},
+				slog.New(&testutil.MockLogHandler{}),
+				&mockParameterGroupClient{},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{
+					mockClearPassword: "fake-pw",
+				},
+			),
+			plan:     &catalog.RDSPlan{},
+			password: helpers.RandStr(10),
+			dbInstance: createTestRdsInstance(&RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+				Database:        helpers.RandStr(10),
+				ReplicaDatabase: "replica",
+				AddReadReplica:  true,
+			}),
+			expectedState: base.InstanceNotCreated,
+			expectErr:     true,
+			expectCancel:  true,
+		},
 		"error getting password": {
 			ctx: t.Context(),
 			worker: NewCreateWorker(
@@ -782,6 +940,10 @@ func TestAsyncCreateDb(t *testing.T) {
 			if test.expectErr && err == nil {
 				t.Fatal("expected error")
 			}
+			var cancelErr *river.JobCancelError
+			if test.expectCancel && !errors.As(err, &cancelErr) {
+				t.Fatalf("expected job to be cancelled, got %v", err)
+			}
 
 			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, test.dbInstance.ServiceID, test.dbInstance.Uuid, base.CreateOp)
 			if err != nil {
@@ -912,212 +1074,210 @@ func TestCreateDBReadReplica(t *testing.T) {
 	}
 }
 
-func TestWaitAndCreateDBReadReplica(t *testing.T) {
+func TestAsyncCreateDbResumesFromCheckpoint(t *testing.T) {
 	brokerDB, err := testDBInit()
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	available := &rds.DescribeDBInstancesOutput{
+		DBInstances: []rdsTypes.DBInstance{
+			{
+				DBInstanceStatus: aws.String("available"),
+			},
+		},
+	}
+	rdsClient := &mockRDSClient{
+		describeDbInstancesResults:      []*rds.DescribeDBInstancesOutput{available, available},
+		createDBInstanceReadReplicaErrs: []error{&smithy.GenericAPIError{Code: "Throttling"}},
+	}
+	worker := NewCreateWorker(
+		brokerDB,
+		&config.Settings{
+			PollAwsMinDelay:    1 * time.Millisecond,
+			PollAwsMaxDuration: 1 * time.Millisecond,
+			DbConfig: &db.DBConfig{
+				DbType: "sqlite3",
+			},
+		},
+		rdsClient,
+		slog.New(&testutil.MockLogHandler{}),
+		&mockParameterGroupClient{},
+		&mockOptionGroupClient{},
+		&mockCredentialUtils{
+			mockClearPassword: "fake-pw",
+		},
+	)
+	dbInstance := createTestRdsInstance(&RDSInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid: helpers.RandStr(10),
+		},
+		Database:        helpers.RandStr(10),
+		ReplicaDatabase: "replica",
+		AddReadReplica:  true,
+	})
+
+	job := &rivertype.JobRow{ID: 1, Attempt: 1, MaxAttempts: 3}
+	ctx := asyncmessage.ContextWithJob(t.Context(), job)
+
+	err = worker.asyncCreateDB(ctx, dbInstance, &catalog.RDSPlan{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var cancelErr *river.JobCancelError
+	if errors.As(err, &cancelErr) {
+		t.Fatalf("expected throttling error to be retried, got %s", err)
+	}
+
+	job.Attempt++
+	err = worker.asyncCreateDB(ctx, dbInstance, &catalog.RDSPlan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rdsClient.createDbCallNum != 1 {
+		t.Errorf("expected database to be created once, got %d calls", rdsClient.createDbCallNum)
+	}
+	if rdsClient.createDBInstanceReadReplicaCallNum != 2 {
+		t.Errorf("expected replica creation to be retried, got %d calls", rdsClient.createDBInstanceReadReplicaCallNum)
+	}
+
+	asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, dbInstance.ServiceID, dbInstance.Uuid, base.CreateOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asyncJobMsg.JobState.State != base.InstanceReady {
+		t.Errorf("expected async job state: %s, got: %s", base.InstanceReady, asyncJobMsg.JobState.State)
+	}
+}
+
+func TestAsyncCreateDbRestore(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	available := &rds.DescribeDBInstancesOutput{
+		DBInstances: []rdsTypes.DBInstance{
+			{
+				DBInstanceStatus: aws.String("available"),
+			},
+		},
+	}
+
 	testCases := map[string]struct {
-		ctx           context.Context
-		worker        *CreateWorker
-		dbInstance    *RDSInstance
-		expectedState base.InstanceState
-		expectErr     bool
-		plan          *catalog.RDSPlan
+		dbInstance                   *RDSInstance
+		rdsClient                    *mockRDSClient
+		expectedState                base.InstanceState
+		expectErr                    bool
+		expectRestoreToPointInTime   bool
+		expectRestoreFromSnapshot    bool
+		expectedUseLatestRestoreTime bool
 	}{
-		"success": {
-			ctx: t.Context(),
-			worker: NewCreateWorker(
-				brokerDB,
-				&config.Settings{
-					PollAwsMinDelay:    1 * time.Millisecond,
-					PollAwsMaxDuration: 1 * time.Millisecond,
-					DbConfig: &db.DBConfig{
-						DbType: "sqlite3",
-					},
-				},
-				&mockRDSClient{
-					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-					},
-				},
-				slog.New(&testutil.MockLogHandler{}),
-				&mockParameterGroupClient{},
-				&mockOptionGroupClient{},
-				&mockCredentialUtils{},
-			),
+		"restores to the latest restorable time": {
 			dbInstance: &RDSInstance{
-				Instance: base.Instance{
-					Request: request.Request{
-						ServiceID: helpers.RandStr(10),
-					},
-					Uuid: helpers.RandStr(10),
-				},
-				Database: helpers.RandStr(10),
+				RestoreSourceDatabase: "source-db",
 			},
-			plan:          &catalog.RDSPlan{},
-			expectedState: base.InstanceInProgress,
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{available, available},
+			},
+			expectedState:                base.InstanceReady,
+			expectRestoreToPointInTime:   true,
+			expectedUseLatestRestoreTime: true,
 		},
-		"error checking database creation status": {
-			ctx: t.Context(),
-			worker: NewCreateWorker(
-				brokerDB,
-				&config.Settings{
-					PollAwsMinDelay:    1 * time.Millisecond,
-					PollAwsMaxDuration: 1 * time.Millisecond,
-					DbConfig: &db.DBConfig{
-						DbType: "sqlite3",
-					},
-				},
-				&mockRDSClient{
-					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-					},
-					describeDbInstancesErrs: []error{nil, errors.New("error describing database instances")},
-				},
-				slog.New(&testutil.MockLogHandler{}),
-				&mockParameterGroupClient{},
-				&mockOptionGroupClient{},
-				&mockCredentialUtils{},
-			),
+		"restores to a point in time": {
 			dbInstance: &RDSInstance{
-				Instance: base.Instance{
-					Request: request.Request{
-						ServiceID: helpers.RandStr(10),
-					},
-					Uuid: helpers.RandStr(10),
-				},
-				Database: helpers.RandStr(10),
+				RestoreSourceDatabase: "source-db",
+				RestoreTime:           &restoreTime,
 			},
-			plan:          &catalog.RDSPlan{},
-			expectedState: base.InstanceNotCreated,
-			expectErr:     true,
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{available, available},
+			},
+			expectedState:              base.InstanceReady,
+			expectRestoreToPointInTime: true,
 		},
-		"error creating database replica": {
-			ctx: t.Context(),
-			worker: NewCreateWorker(
-				brokerDB,
-				&config.Settings{
-					PollAwsMinDelay:    1 * time.Millisecond,
-					PollAwsMaxDuration: 1 * time.Millisecond,
-					DbConfig: &db.DBConfig{
-						DbType: "sqlite3",
-					},
-				},
-				&mockRDSClient{
-					createDBInstanceReadReplicaErrs: []error{errors.New("error creating database instance read replica")},
-					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-					},
-				},
-				slog.New(&testutil.MockLogHandler{}),
-				&mockParameterGroupClient{},
-				&mockOptionGroupClient{},
-				&mockCredentialUtils{},
-			),
-			plan: &catalog.RDSPlan{},
+		"restores from a snapshot": {
 			dbInstance: &RDSInstance{
-				Instance: base.Instance{
-					Request: request.Request{
-						ServiceID: helpers.RandStr(10),
-					},
-					Uuid: helpers.RandStr(10),
-				},
-				Database: helpers.RandStr(10),
+				RestoreSnapshot: "source-snapshot",
 			},
-			expectedState: base.InstanceNotCreated,
-			expectErr:     true,
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{available, available},
+			},
+			expectedState:             base.InstanceReady,
+			expectRestoreFromSnapshot: true,
 		},
-		"error adding tags": {
-			ctx: t.Context(),
-			worker: NewCreateWorker(
+		"restore error": {
+			dbInstance: &RDSInstance{
+				RestoreSnapshot: "source-snapshot",
+			},
+			rdsClient: &mockRDSClient{
+				restoreDbErr: errors.New("snapshot not found"),
+			},
+			expectedState:             base.InstanceNotCreated,
+			expectErr:                 true,
+			expectRestoreFromSnapshot: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			worker := NewCreateWorker(
 				brokerDB,
 				&config.Settings{
 					PollAwsMinDelay:    1 * time.Millisecond,
-					PollAwsMaxDuration: 3 * time.Millisecond,
+					PollAwsMaxDuration: 1 * time.Millisecond,
 					DbConfig: &db.DBConfig{
 						DbType: "sqlite3",
 					},
 				},
-				&mockRDSClient{
-					addTagsToResourceErr: errors.New("error adding tags to read replica"),
-					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-						{
-							DBInstances: []rdsTypes.DBInstance{
-								{
-									DBInstanceStatus: aws.String("available"),
-								},
-							},
-						},
-					},
-				},
+				test.rdsClient,
 				slog.New(&testutil.MockLogHandler{}),
 				&mockParameterGroupClient{},
 				&mockOptionGroupClient{},
-				&mockCredentialUtils{},
-			),
-			dbInstance: &RDSInstance{
-				Instance: base.Instance{
-					Request: request.Request{
-						ServiceID: helpers.RandStr(10),
-					},
-					Uuid: helpers.RandStr(10),
+				&mockCredentialUtils{
+					mockClearPassword: "fake-pw",
 				},
-				Database: helpers.RandStr(10),
-			},
-			plan:          &catalog.RDSPlan{},
-			expectedState: base.InstanceNotCreated,
-			expectErr:     true,
-		},
-	}
+			)
+			i := createTestRdsInstance(test.dbInstance)
+			i.ServiceID = helpers.RandStr(10)
+			i.Uuid = helpers.RandStr(10)
+			i.Database = helpers.RandStr(10)
 
-	for name, test := range testCases {
-		t.Run(name, func(t *testing.T) {
-			err := test.worker.waitAndCreateDBReadReplica(test.ctx, base.CreateOp, test.dbInstance, test.plan)
-			if !test.expectErr && err != nil {
-				t.Fatal(err)
+			err := worker.asyncCreateDB(t.Context(), i, &catalog.RDSPlan{})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
 			}
 
-			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, test.dbInstance.ServiceID, test.dbInstance.Uuid, base.CreateOp)
+			if test.rdsClient.createDbCallNum != 0 {
+				t.Error("expected database to be restored rather than created")
+			}
+			if test.expectRestoreToPointInTime != (test.rdsClient.restoreToPointInTimeInput != nil) {
+				t.Errorf("expected restore to point in time: %t", test.expectRestoreToPointInTime)
+			}
+			if test.expectRestoreFromSnapshot != (test.rdsClient.restoreFromSnapshotInput != nil) {
+				t.Errorf("expected restore from snapshot: %t", test.expectRestoreFromSnapshot)
+			}
+			if input := test.rdsClient.restoreToPointInTimeInput; input != nil {
+				if aws.ToBool(input.UseLatestRestorableTime) != test.expectedUseLatestRestoreTime {
+					t.Errorf("expected UseLatestRestorableTime: %t, got %t", test.expectedUseLatestRestoreTime, aws.ToBool(input.UseLatestRestorableTime))
+				}
+				if diff := deep.Equal(input.RestoreTime, test.dbInstance.RestoreTime); diff != nil {
+					t.Error(diff)
+				}
+			}
+			if !test.expectErr && test.rdsClient.modifyDbCallNum != 1 {
+				t.Errorf("expected the master password to be reset once, got %d modifications", test.rdsClient.modifyDbCallNum)
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, i.ServiceID, i.Uuid, base.CreateOp)
 			if err != nil {
 				t.Fatal(err)
 			}
-
-			if asyncJobMsg.JobState.State != test.expectedState {
-				t.Fatalf("expected state: %s, got: %s", test.expectedState, asyncJobMsg.JobState.State)
+			if test.expectedState != asyncJobMsg.JobState.State {
+				t.Fatalf("expected async job state: %s, got: %s", test.expectedState, asyncJobMsg.JobState.State)
 			}
 		})
 	}
@@ -13,8 +13,8 @@ import (
 )
 
 type CredentialUtils interface {
-	generatePassword(salt string, password string, key string) (string, error)
-	getPassword(salt string, password string, key string) (string, error)
+	generatePassword(salt string, password string, keys *helpers.Keyring) (string, error)
+	getPassword(salt string, password string, keys *helpers.Keyring) (string, error)
 	getCredentials(i *RDSInstance, password string) (map[string]string, error)
 	generateCredentials(settings *config.Settings) (string, string, error)
 }
@@ -32,14 +32,12 @@ func formatDBName(database string, dbType string) string {
 type RDSCredentialUtils struct {
 }
 
-func (u *RDSCredentialUtils) generatePassword(salt string, password string, key string) (string, error) {
+func (u *RDSCredentialUtils) generatePassword(salt string, password string, keys *helpers.Keyring) (string, error) {
 	if salt == "" {
 		return "", errors.New("salt has to be set before writing the password")
 	}
 
-	iv, _ := base64.StdEncoding.DecodeString(salt)
-
-	encrypted, err := helpers.Encrypt(password, key, iv)
+	encrypted, err := keys.Encrypt(password)
 	if err != nil {
 		return "", err
 	}
@@ -47,14 +45,14 @@ func (u *RDSCredentialUtils) generatePassword(salt string, password string, key
 	return encrypted, nil
 }
 
-func (u *RDSCredentialUtils) getPassword(salt string, password string, key string) (string, error) {
+func (u *RDSCredentialUtils) getPassword(salt string, password string, keys *helpers.Keyring) (string, error) {
 	if salt == "" || password == "" {
 		return "", errors.New("salt and password has to be set before getting the password")
 	}
 
 	iv, _ := base64.StdEncoding.DecodeString(salt)
 
-	decrypted, err := helpers.Decrypt(password, key, iv)
+	decrypted, err := keys.Decrypt(password, iv)
 	if err != nil {
 		return "", err
 	}
@@ -75,7 +73,7 @@ func (u *RDSCredentialUtils) getCredentials(i *RDSInstance, password string) (ma
 		return nil, errors.New("Cannot generate credentials for unsupported db type: " + i.DbType)
 	}
 
-	dbName := formatDBName(i.Database, i.DbType)
+	dbName := i.dbName()
 	if i.DbType == "oracle-se1" || i.DbType == "oracle-se2" {
 		return oracleCredentials(i, password, dbScheme, dbName)
 	}
@@ -149,7 +147,7 @@ func (u *RDSCredentialUtils) generateCredentials(
 ) (string, string, error) {
 	salt := helpers.GenerateSalt(aes.BlockSize)
 	password := helpers.RandStrNoCaps(25)
-	encrypted, err := u.generatePassword(salt, password, settings.EncryptionKey)
+	encrypted, err := u.generatePassword(salt, password, settings.Keyring())
 	if err != nil {
 		return "", "", err
 	}
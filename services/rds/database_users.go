@@ -0,0 +1,138 @@
+package rds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// databaseUserClient manages users inside of a provisioned database by
+// connecting to it with the instance's master credentials.
+type databaseUserClient interface {
+	createUser(ctx context.Context, i *RDSInstance, masterPassword string, username string, password string) error
+	dropUser(ctx context.Context, i *RDSInstance, masterPassword string, username string) error
+}
+
+type sqlDatabaseUserClient struct{}
+
+// Usernames and passwords are generated by the broker, but since they are
+// interpolated into DDL statements which do not support placeholders, make
+// sure they cannot be used to inject SQL.
+var databaseUserCredentialPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+func validateDatabaseUserCredential(value string) error {
+	if !databaseUserCredentialPattern.MatchString(value) {
+		return errors.New("database user credentials may only contain alphanumeric characters")
+	}
+	return nil
+}
+
+func openInstanceConnection(i *RDSInstance, masterPassword string) (*sql.DB, error) {
+	if i.Host == "" {
+		return nil, fmt.Errorf("host is not known for database %s", i.Database)
+	}
+	dbName := i.dbName()
+
+	switch i.DbType {
+	case "postgres":
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(i.Username, masterPassword),
+			Host:     net.JoinHostPort(i.Host, strconv.FormatInt(i.Port, 10)),
+			Path:     dbName,
+			RawQuery: "sslmode=require",
+		}
+		return sql.Open("postgres", dsn.String())
+	case "mysql":
+		cfg := mysql.NewConfig()
+		cfg.User = i.Username
+		cfg.Passwd = masterPassword
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(i.Host, strconv.FormatInt(i.Port, 10))
+		cfg.DBName = dbName
+		cfg.TLSConfig = "preferred"
+		return sql.Open("mysql", cfg.FormatDSN())
+	default:
+		return nil, fmt.Errorf("cannot manage database users for unsupported db type: %s", i.DbType)
+	}
+}
+
+func (c *sqlDatabaseUserClient) createUser(ctx context.Context, i *RDSInstance, masterPassword string, username string, password string) error {
+	if err := validateDatabaseUserCredential(username); err != nil {
+		return err
+	}
+	if err := validateDatabaseUserCredential(password); err != nil {
+		return err
+	}
+
+	conn, err := openInstanceConnection(i, masterPassword)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var statements []string
+	switch i.DbType {
+	case "postgres":
+		// Granting membership in the master role gives the binding the same
+		// privileges as the master user. Setting the default role means that
+		// any objects created by the binding are owned by the master user, so
+		// they are not lost when the binding user is dropped.
+		statements = []string{
+			fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s", pq.QuoteIdentifier(username), pq.QuoteLiteral(password)),
+			fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(i.Username), pq.QuoteIdentifier(username)),
+			fmt.Sprintf("ALTER ROLE %s SET role = %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(i.Username)),
+		}
+	case "mysql":
+		statements = []string{
+			fmt.Sprintf("CREATE USER '%s'@'%%' IDENTIFIED BY '%s'", username, password),
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'%%'", i.dbName(), username),
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("error creating database user %s: %w", username, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *sqlDatabaseUserClient) dropUser(ctx context.Context, i *RDSInstance, masterPassword string, username string) error {
+	if err := validateDatabaseUserCredential(username); err != nil {
+		return err
+	}
+
+	conn, err := openInstanceConnection(i, masterPassword)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch i.DbType {
+	case "postgres":
+		// Terminate any open sessions so that revoked credentials cannot
+		// continue to be used.
+		if _, err := conn.ExecContext(ctx, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = $1", username); err != nil {
+			return fmt.Errorf("error terminating sessions for database user %s: %w", username, err)
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", pq.QuoteIdentifier(username))); err != nil {
+			return fmt.Errorf("error dropping database user %s: %w", username, err)
+		}
+	case "mysql":
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("DROP USER IF EXISTS '%s'@'%%'", username)); err != nil {
+			return fmt.Errorf("error dropping database user %s: %w", username, err)
+		}
+	}
+
+	return nil
+}
@@ -2,15 +2,22 @@ package rds
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -18,11 +25,24 @@ const (
 )
 
 type DeleteArgs struct {
-	Instance *RDSInstance `json:"instance"`
+	Instance    *RDSInstance `json:"instance"`
+	OperationID string       `json:"operation_id"`
 }
 
 func (DeleteArgs) Kind() string { return DeleteKind }
 
+func (DeleteArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a DeleteArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.DeleteOp,
+		FailedState: base.InstanceNotGone,
+	}
+}
+
 type DeleteWorker struct {
 	river.WorkerDefaults[DeleteArgs]
 	db                   *gorm.DB
@@ -54,8 +74,19 @@ func NewDeleteWorker(
 	}
 }
 
+func (w *DeleteWorker) Timeout(*river.Job[DeleteArgs]) time.Duration {
+	return w.settings.RDSQueue.JobTimeout
+}
+
 func (w *DeleteWorker) Work(ctx context.Context, job *river.Job[DeleteArgs]) error {
-	return w.asyncDeleteDB(ctx, job.Args.Instance)
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	err := w.asyncDeleteDB(ctx, job.Args.Instance)
+	return steps.RetryIfInterrupted(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:  job.Args.Instance.ServiceID,
+		InstanceID: job.Args.Instance.Uuid,
+		Operation:  base.DeleteOp,
+	}, err)
 }
 
 func (w *DeleteWorker) waitForDbDeleted(ctx context.Context, operation base.Operation, i *RDSInstance, database string) error {
@@ -75,15 +106,15 @@ func (w *DeleteWorker) waitForDbDeleted(ctx context.Context, operation base.Oper
 	err := waiter.Wait(ctx, waiterInput, maxWaitTime)
 
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed waiting for database to be deleted: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed waiting for database to be deleted: %s", err))
 		return fmt.Errorf("waitForDbReady: %w", err)
 	}
 
 	return nil
 }
 
-func (w *DeleteWorker) deleteDatabaseInstance(ctx context.Context, i *RDSInstance, operation base.Operation, database string) error {
-	params := prepareDeleteDbInput(database)
+func (w *DeleteWorker) deleteDatabaseInstance(ctx context.Context, i *RDSInstance, operation base.Operation, database string, finalSnapshot string) error {
+	params := prepareDeleteDbInput(database, finalSnapshot)
 	_, err := w.rds.DeleteDBInstance(ctx, params)
 	if err != nil {
 		if isDatabaseInstanceNotFoundError(err) {
@@ -102,8 +133,45 @@ func (w *DeleteWorker) deleteDatabaseInstance(ctx context.Context, i *RDSInstanc
 	return nil
 }
 
+// recordFinalSnapshot tags the final snapshot of the database with the tags of
+// the instance, which include its organization and space, and records it so
+// that it can be restored until its retention has passed.
+func (w *DeleteWorker) recordFinalSnapshot(ctx context.Context, i *RDSInstance) error {
+	resp, err := w.rds.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(i.FinalSnapshotIdentifier),
+	})
+	if err != nil {
+		var notFoundException *rdsTypes.DBSnapshotNotFoundFault
+		if !errors.As(err, &notFoundException) {
+			return fmt.Errorf("recordFinalSnapshot: %w", err)
+		}
+	}
+	if resp == nil || len(resp.DBSnapshots) == 0 {
+		// The database was already deleted when the job ran, so there is no
+		// final snapshot of it.
+		w.logger.Warn(fmt.Sprintf("final snapshot %s was not found, continuing", i.FinalSnapshotIdentifier))
+		return nil
+	}
+
+	_, err = w.rds.AddTagsToResource(ctx, &rds.AddTagsToResourceInput{
+		ResourceName: resp.DBSnapshots[0].DBSnapshotArn,
+		Tags:         ConvertTagsToRDSTags(i.getTags()),
+	})
+	if err != nil {
+		return fmt.Errorf("recordFinalSnapshot: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(w.settings.FinalSnapshotRetention)
+	snapshot := newRDSSnapshot(i.FinalSnapshotIdentifier, i, &expiresAt)
+	err = w.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(snapshot).Error
+	if err != nil {
+		return fmt.Errorf("recordFinalSnapshot: %w", err)
+	}
+	return nil
+}
+
 func (w *DeleteWorker) deleteDatabaseReadReplica(ctx context.Context, i *RDSInstance, operation base.Operation) error {
-	err := w.deleteDatabaseInstance(ctx, i, operation, i.ReplicaDatabase)
+	err := w.deleteDatabaseInstance(ctx, i, operation, i.ReplicaDatabase, "")
 	if err != nil {
 		return fmt.Errorf("deleteDatabaseReadReplica: %w", err)
 	}
@@ -115,51 +183,61 @@ func (w *DeleteWorker) asyncDeleteDB(ctx context.Context, i *RDSInstance) error
 	operation := base.DeleteOp
 
 	if i.ReplicaDatabase != "" {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting database replica")
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting database replica")
 		err := w.deleteDatabaseReadReplica(ctx, i, operation)
 		if err != nil {
-			asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete replica database: %s", err))
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete replica database: %s", err))
 			w.logger.Error("asyncDeleteDB: deleteDatabaseReadReplica error", "err", err)
 			return river.JobCancel(fmt.Errorf("asyncDeleteDB: error deleting replica %w ", err))
 		}
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting database")
-	err := w.deleteDatabaseInstance(ctx, i, operation, i.Database)
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting database")
+	err := w.deleteDatabaseInstance(ctx, i, operation, i.Database, i.FinalSnapshotIdentifier)
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete database: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete database: %s", err))
 		w.logger.Error("asyncDeleteDB: deleteDatabaseInstance error", "err", err)
 		return river.JobCancel(fmt.Errorf("asyncDeleteDB: error deleting database %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting parameter group")
+	if i.FinalSnapshotIdentifier != "" {
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Recording final snapshot")
+		err = w.recordFinalSnapshot(ctx, i)
+		if err != nil {
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to record final snapshot: %s", err))
+			w.logger.Error("asyncDeleteDB: recordFinalSnapshot error", "err", err)
+			return river.JobCancel(fmt.Errorf("asyncDeleteDB: error recording final snapshot %w ", err))
+		}
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting parameter group")
 	err = w.parameterGroupClient.DeleteParameterGroup(i.ParameterGroupName)
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete parameter group: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to delete parameter group: %s", err))
 		w.logger.Error("asyncDeleteDB: DeleteParameterGroup error", "err", err)
 		return river.JobCancel(fmt.Errorf("asyncDeleteDB: error deleting parameter group %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Cleaning up parameter groups")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Cleaning up parameter groups")
 	err = w.parameterGroupClient.CleanupCustomParameterGroups()
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to cleanup parameter groups: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed to cleanup parameter groups: %s", err))
 		w.logger.Error("asyncDeleteDB: CleanupCustomParameterGroups error", "err", err)
 		return river.JobCancel(fmt.Errorf("asyncDeleteDB: error deleting parameter groups %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting option group")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting option group")
 	err = w.optionGroupClient.DeleteOptionGroup(i.OptionGroupName)
 	if err != nil {
 		// best effort deletion. Option group might still be attached to snapshots (preventing deletion), so leave it for later cleanup
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "asyncModifyDbInstance: deletion of old option group failed; leaving for later cleanup")
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "asyncModifyDbInstance: deletion of old option group failed; leaving for later cleanup")
 		w.logger.Warn("asyncDeleteDb: deletion of option group failed; leaving for later cleanup", "err", err)
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Cleaning up option groups")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Cleaning up option groups")
 	err = w.optionGroupClient.CleanupCustomOptionGroups()
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, fmt.Sprintf("Failed to cleanup option groups: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, fmt.Sprintf("Failed to cleanup option groups: %s", err))
 		w.logger.Warn("asyncDeleteDB: CleanupCustomOptionGroups error", "err", err)
 	}
 
@@ -169,6 +247,6 @@ func (w *DeleteWorker) asyncDeleteDB(ctx context.Context, i *RDSInstance) error
 		return river.JobCancel(fmt.Errorf("asyncDeleteDB: error deleting record %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Successfully deleted database resources")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Successfully deleted database resources")
 	return nil
 }
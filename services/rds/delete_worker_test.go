@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
@@ -400,3 +401,104 @@ func TestAsyncDeleteDB(t *testing.T) {
 		})
 	}
 }
+
+func TestAsyncDeleteDBFinalSnapshot(t *testing.T) {
+	testCases := map[string]struct {
+		rdsClient      *mockRDSClient
+		expectErr      bool
+		expectRecorded bool
+		expectedTagged int
+	}{
+		"records the tagged snapshot": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesErrs: []error{&rdsTypes.DBInstanceNotFoundFault{}},
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{DBSnapshotArn: aws.String("snapshot-arn")}},
+				},
+			},
+			expectRecorded: true,
+			expectedTagged: 1,
+		},
+		"continues when there is no snapshot": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesErrs: []error{&rdsTypes.DBInstanceNotFoundFault{}},
+				describeDBSnapshotsErr:  &rdsTypes.DBSnapshotNotFoundFault{},
+			},
+		},
+		"error tagging snapshot": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesErrs: []error{&rdsTypes.DBInstanceNotFoundFault{}},
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{DBSnapshotArn: aws.String("snapshot-arn")}},
+				},
+				addTagsToResourceErr: errors.New("access denied"),
+			},
+			expectErr:      true,
+			expectedTagged: 1,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := brokerDB.Where("1 = 1").Delete(&RDSSnapshot{}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			settings := &config.Settings{
+				PollAwsMinDelay:        1 * time.Millisecond,
+				PollAwsMaxDuration:     1 * time.Millisecond,
+				FinalSnapshotRetention: 24 * time.Hour,
+			}
+			worker := NewDeleteWorker(brokerDB, settings, test.rdsClient, slog.New(&testutil.MockLogHandler{}), &mockParameterGroupClient{}, &mockOptionGroupClient{}, &mockCredentialUtils{})
+
+			instance := &RDSInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+						SpaceGUID: "space-1",
+					},
+					Uuid: helpers.RandStr(10),
+				},
+				Database:                helpers.RandStr(10),
+				Username:                "user-1",
+				DbType:                  "postgres",
+				Tags:                    map[string]string{"Space GUID": "space-1"},
+				FinalSnapshotIdentifier: "db-final-instance-1",
+			}
+
+			err = worker.asyncDeleteDB(t.Context(), instance)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+
+			deleteInput := test.rdsClient.deleteDbInstanceInputs[0]
+			if aws.ToBool(deleteInput.SkipFinalSnapshot) || aws.ToString(deleteInput.FinalDBSnapshotIdentifier) != "db-final-instance-1" {
+				t.Errorf("expected final snapshot db-final-instance-1 to be taken, got %+v", deleteInput)
+			}
+			if len(test.rdsClient.addTagsToResourceInputs) != test.expectedTagged {
+				t.Errorf("expected %d snapshots to be tagged, got %d", test.expectedTagged, len(test.rdsClient.addTagsToResourceInputs))
+			}
+
+			records := []RDSSnapshot{}
+			if err := brokerDB.Find(&records).Error; err != nil {
+				t.Fatal(err)
+			}
+			if test.expectRecorded != (len(records) == 1) {
+				t.Fatalf("expected snapshot to be recorded: %t, got %+v", test.expectRecorded, records)
+			}
+			if test.expectRecorded {
+				record := records[0]
+				if record.Identifier != "db-final-instance-1" || record.InstanceID != instance.Uuid || record.SpaceGUID != "space-1" || record.Username != "user-1" {
+					t.Errorf("unexpected snapshot record %+v", record)
+				}
+				if record.ExpiresAt == nil || record.ExpiresAt.Before(time.Now().Add(23*time.Hour)) {
+					t.Errorf("expected snapshot to expire after its retention, got %v", record.ExpiresAt)
+				}
+			}
+		})
+	}
+}
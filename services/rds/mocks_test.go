@@ -2,14 +2,19 @@ package rds
 
 import (
 	"context"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cloudwatchTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/cloud-gov/aws-broker/testutil"
 	"gorm.io/gorm"
 )
@@ -20,7 +25,7 @@ func testDBInit() (*gorm.DB, error) {
 		return nil, err
 	}
 	// Automigrate!
-	err = db.AutoMigrate(&RDSInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{})
+	err = db.AutoMigrate(&RDSInstance{}, &RDSBinding{}, &RDSSnapshot{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}, &steps.Checkpoint{})
 	return db, err
 }
 
@@ -153,16 +158,17 @@ func (m *mockCredentialUtils) generateCredentials(settings *config.Settings) (st
 	return m.mockSalt, m.mockEncryptedPassword, nil
 }
 
-func (m *mockCredentialUtils) generatePassword(salt string, password string, key string) (string, error) {
+func (m *mockCredentialUtils) generatePassword(salt string, password string, keys *helpers.Keyring) (string, error) {
 	return m.mockEncryptedPassword, nil
 }
 
-func (m *mockCredentialUtils) getPassword(salt string, password string, key string) (string, error) {
+func (m *mockCredentialUtils) getPassword(salt string, password string, keys *helpers.Keyring) (string, error) {
 	return m.mockClearPassword, m.mockGetPassworrdErr
 }
 
 type mockRDSClient struct {
 	createDbErr                         error
+	createDbCallNum                     int
 	createDBInstanceReadReplicaErrs     []error
 	createDBInstanceReadReplicaCallNum  int
 	dbEngineVersions                    []rdsTypes.DBEngineVersion
@@ -185,6 +191,8 @@ type mockRDSClient struct {
 	modifyDbCallNum                     int
 	modifyDbParamGroupErr               error
 	addTagsToResourceErr                error
+	addTagsToResourceInputs             []*rds.AddTagsToResourceInput
+	listTagsForResourceOutput           *rds.ListTagsForResourceOutput
 	describeDBParameterGroupsOutput     []*rds.DescribeDBParameterGroupsOutput
 	describeDBParameterGroupsCallNum    int
 	deleteDbParameterGroupErrs          []error
@@ -198,6 +206,16 @@ type mockRDSClient struct {
 	modifyOptionGroupErr                error
 	deleteOptionGroupErrs               []error
 	deleteOptionGroupCallNum            int
+	describeDBSnapshotsOutput           *rds.DescribeDBSnapshotsOutput
+	describeDBSnapshotsErr              error
+	restoreToPointInTimeInput           *rds.RestoreDBInstanceToPointInTimeInput
+	restoreFromSnapshotInput            *rds.RestoreDBInstanceFromDBSnapshotInput
+	restoreDbErr                        error
+	deleteDbInstanceInputs              []*rds.DeleteDBInstanceInput
+	deleteDBSnapshotInputs              []*rds.DeleteDBSnapshotInput
+	deleteDBSnapshotErr                 error
+	createDBSnapshotInput               *rds.CreateDBSnapshotInput
+	createDBSnapshotErr                 error
 }
 
 func (m *mockRDSClient) CreateOptionGroup(ctx context.Context, params *rds.CreateOptionGroupInput, optFns ...func(*rds.Options)) (*rds.CreateOptionGroupOutput, error) {
@@ -239,13 +257,22 @@ func (m *mockRDSClient) DescribeOptionGroups(ctx context.Context, params *rds.De
 }
 
 func (m *mockRDSClient) AddTagsToResource(ctx context.Context, params *rds.AddTagsToResourceInput, optFns ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error) {
+	m.addTagsToResourceInputs = append(m.addTagsToResourceInputs, params)
 	if m.addTagsToResourceErr != nil {
 		return nil, m.addTagsToResourceErr
 	}
 	return nil, nil
 }
 
+func (m *mockRDSClient) ListTagsForResource(ctx context.Context, params *rds.ListTagsForResourceInput, optFns ...func(*rds.Options)) (*rds.ListTagsForResourceOutput, error) {
+	if m.listTagsForResourceOutput != nil {
+		return m.listTagsForResourceOutput, nil
+	}
+	return &rds.ListTagsForResourceOutput{}, nil
+}
+
 func (m *mockRDSClient) CreateDBInstance(ctx context.Context, params *rds.CreateDBInstanceInput, optFns ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error) {
+	m.createDbCallNum++
 	if m.createDbErr != nil {
 		return nil, m.createDbErr
 	}
@@ -273,6 +300,7 @@ func (m *mockRDSClient) CreateDBParameterGroup(ctx context.Context, params *rds.
 }
 
 func (m *mockRDSClient) DeleteDBInstance(ctx context.Context, params *rds.DeleteDBInstanceInput, optFns ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error) {
+	m.deleteDbInstanceInputs = append(m.deleteDbInstanceInputs, params)
 	if len(m.deleteDbInstancesErrs) > 0 && m.deleteDbInstancesErrs[m.deleteDBInstancesCallNum] != nil {
 		return nil, m.deleteDbInstancesErrs[m.deleteDBInstancesCallNum]
 	}
@@ -338,6 +366,26 @@ func (m *mockRDSClient) DescribeDBParameters(ctx context.Context, params *rds.De
 	return result, err
 }
 
+func (m *mockRDSClient) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	if m.describeDBSnapshotsErr != nil {
+		return nil, m.describeDBSnapshotsErr
+	}
+	if m.describeDBSnapshotsOutput != nil {
+		return m.describeDBSnapshotsOutput, nil
+	}
+	return &rds.DescribeDBSnapshotsOutput{}, nil
+}
+
+func (m *mockRDSClient) CreateDBSnapshot(ctx context.Context, params *rds.CreateDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.CreateDBSnapshotOutput, error) {
+	m.createDBSnapshotInput = params
+	return nil, m.createDBSnapshotErr
+}
+
+func (m *mockRDSClient) DeleteDBSnapshot(ctx context.Context, params *rds.DeleteDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error) {
+	m.deleteDBSnapshotInputs = append(m.deleteDBSnapshotInputs, params)
+	return nil, m.deleteDBSnapshotErr
+}
+
 func (m *mockRDSClient) ModifyDBParameterGroup(ctx context.Context, params *rds.ModifyDBParameterGroupInput, optFns ...func(*rds.Options)) (*rds.ModifyDBParameterGroupOutput, error) {
 	if m.modifyDbParamGroupErr != nil {
 		return nil, m.modifyDbParamGroupErr
@@ -356,3 +404,43 @@ func (m *mockRDSClient) ModifyDBInstance(ctx context.Context, params *rds.Modify
 		},
 	}, nil
 }
+
+func (m *mockRDSClient) RestoreDBInstanceFromDBSnapshot(ctx context.Context, params *rds.RestoreDBInstanceFromDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	m.restoreFromSnapshotInput = params
+	return nil, m.restoreDbErr
+}
+
+func (m *mockRDSClient) RestoreDBInstanceToPointInTime(ctx context.Context, params *rds.RestoreDBInstanceToPointInTimeInput, optFns ...func(*rds.Options)) (*rds.RestoreDBInstanceToPointInTimeOutput, error) {
+	m.restoreToPointInTimeInput = params
+	return nil, m.restoreDbErr
+}
+
+type mockLogsClient struct {
+	logGroups            []cloudwatchTypes.LogGroup
+	describeLogGroupsErr error
+	tags                 map[string]string
+	tagResourceInputs    []*cloudwatchlogs.TagResourceInput
+	tagResourceErr       error
+}
+
+func (m *mockLogsClient) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	if m.describeLogGroupsErr != nil {
+		return nil, m.describeLogGroupsErr
+	}
+	logGroups := []cloudwatchTypes.LogGroup{}
+	for _, logGroup := range m.logGroups {
+		if strings.HasPrefix(aws.ToString(logGroup.LogGroupName), aws.ToString(params.LogGroupNamePrefix)) {
+			logGroups = append(logGroups, logGroup)
+		}
+	}
+	return &cloudwatchlogs.DescribeLogGroupsOutput{LogGroups: logGroups}, nil
+}
+
+func (m *mockLogsClient) ListTagsForResource(ctx context.Context, params *cloudwatchlogs.ListTagsForResourceInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.ListTagsForResourceOutput, error) {
+	return &cloudwatchlogs.ListTagsForResourceOutput{Tags: m.tags}, nil
+}
+
+func (m *mockLogsClient) TagResource(ctx context.Context, params *cloudwatchlogs.TagResourceInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.TagResourceOutput, error) {
+	m.tagResourceInputs = append(m.tagResourceInputs, params)
+	return nil, m.tagResourceErr
+}
@@ -796,6 +796,146 @@ func TestPrepareModifyDbInstanceInput(t *testing.T) {
 				MasterUserPassword:       aws.String("fake-pw"),
 			},
 		},
+		"turn on storage autoscaling": {
+			dbInstance: &RDSInstance{
+				AllocatedStorage:      20,
+				MaxAllocatedStorage:   aws.Int64(100),
+				Database:              "db-name",
+				BackupRetentionPeriod: 14,
+			},
+			worker: NewModifyWorker(
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{},
+				nil,
+				&mockParameterGroupClient{
+					rds: &mockRDSClient{},
+				},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{},
+			),
+			plan: &catalog.RDSPlan{
+				InstanceClass: "class",
+				Redundant:     true,
+			},
+			expectedParams: &rds.ModifyDBInstanceInput{
+				AllocatedStorage:         aws.Int32(20),
+				ApplyImmediately:         aws.Bool(true),
+				DBInstanceClass:          aws.String("class"),
+				MultiAZ:                  aws.Bool(true),
+				DBInstanceIdentifier:     aws.String("db-name"),
+				AllowMajorVersionUpgrade: aws.Bool(false),
+				BackupRetentionPeriod:    aws.Int32(14),
+				MaxAllocatedStorage:      aws.Int32(100),
+			},
+		},
+		"turn off storage autoscaling": {
+			dbInstance: &RDSInstance{
+				AllocatedStorage:      20,
+				MaxAllocatedStorage:   aws.Int64(0),
+				Database:              "db-name",
+				BackupRetentionPeriod: 14,
+			},
+			worker: NewModifyWorker(
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{},
+				nil,
+				&mockParameterGroupClient{
+					rds: &mockRDSClient{},
+				},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{},
+			),
+			plan: &catalog.RDSPlan{
+				InstanceClass: "class",
+				Redundant:     true,
+			},
+			expectedParams: &rds.ModifyDBInstanceInput{
+				AllocatedStorage:         aws.Int32(20),
+				ApplyImmediately:         aws.Bool(true),
+				DBInstanceClass:          aws.String("class"),
+				MultiAZ:                  aws.Bool(true),
+				DBInstanceIdentifier:     aws.String("db-name"),
+				AllowMajorVersionUpgrade: aws.Bool(false),
+				BackupRetentionPeriod:    aws.Int32(14),
+				MaxAllocatedStorage:      aws.Int32(20),
+			},
+		},
+		"provisioned iops and throughput": {
+			dbInstance: &RDSInstance{
+				AllocatedStorage:      400,
+				Database:              "db-name",
+				BackupRetentionPeriod: 14,
+				StorageType:           "gp3",
+				Iops:                  aws.Int64(16000),
+				StorageThroughput:     aws.Int64(1000),
+			},
+			worker: NewModifyWorker(
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{},
+				nil,
+				&mockParameterGroupClient{
+					rds: &mockRDSClient{},
+				},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{},
+			),
+			plan: &catalog.RDSPlan{
+				InstanceClass: "class",
+				Redundant:     true,
+			},
+			expectedParams: &rds.ModifyDBInstanceInput{
+				AllocatedStorage:         aws.Int32(400),
+				ApplyImmediately:         aws.Bool(true),
+				DBInstanceClass:          aws.String("class"),
+				MultiAZ:                  aws.Bool(true),
+				DBInstanceIdentifier:     aws.String("db-name"),
+				AllowMajorVersionUpgrade: aws.Bool(false),
+				BackupRetentionPeriod:    aws.Int32(14),
+				StorageType:              aws.String("gp3"),
+				Iops:                     aws.Int32(16000),
+				StorageThroughput:        aws.Int32(1000),
+			},
+		},
+		"cleared iops and throughput return gp3 storage to its baseline": {
+			dbInstance: &RDSInstance{
+				AllocatedStorage:      400,
+				Database:              "db-name",
+				BackupRetentionPeriod: 14,
+				StorageType:           "gp3",
+				Iops:                  aws.Int64(0),
+				StorageThroughput:     aws.Int64(0),
+			},
+			worker: NewModifyWorker(
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{},
+				nil,
+				&mockParameterGroupClient{
+					rds: &mockRDSClient{},
+				},
+				&mockOptionGroupClient{},
+				&mockCredentialUtils{},
+			),
+			plan: &catalog.RDSPlan{
+				InstanceClass: "class",
+				Redundant:     true,
+			},
+			expectedParams: &rds.ModifyDBInstanceInput{
+				AllocatedStorage:         aws.Int32(400),
+				ApplyImmediately:         aws.Bool(true),
+				DBInstanceClass:          aws.String("class"),
+				MultiAZ:                  aws.Bool(true),
+				DBInstanceIdentifier:     aws.String("db-name"),
+				AllowMajorVersionUpgrade: aws.Bool(false),
+				BackupRetentionPeriod:    aws.Int32(14),
+				StorageType:              aws.String("gp3"),
+				Iops:                     aws.Int32(12000),
+				StorageThroughput:        aws.Int32(500),
+			},
+		},
 		"update storage type": {
 			dbInstance: &RDSInstance{
 				DbType:                "mysql",
@@ -9,7 +9,6 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/riverqueue/river"
 
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
@@ -20,18 +19,23 @@ import (
 
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 
 	"errors"
 	"fmt"
 )
 
 type dbAdapter interface {
-	createDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error)
-	modifyDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error)
+	createDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error)
+	modifyDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error)
+	snapshotDB(i *RDSInstance, snapshot string, operationID string) (base.InstanceState, error)
 	checkDBStatus(database string) (base.InstanceState, error)
 	bindDBToApp(i *RDSInstance, password string) (map[string]string, error)
-	deleteDB(i *RDSInstance) (base.InstanceState, error)
+	createBindingUser(i *RDSInstance, masterPassword string, username string, password string) error
+	dropBindingUser(i *RDSInstance, masterPassword string, username string) error
+	deleteDB(i *RDSInstance, operationID string) (base.InstanceState, error)
 	describeDatabaseInstance(database string) (*rdsTypes.DBInstance, error)
+	describeDBSnapshot(snapshot string) (*rdsTypes.DBSnapshot, error)
 	reconcileDbState(ctx context.Context, i RDSInstance) (*RDSInstance, error)
 }
 
@@ -41,7 +45,7 @@ func initializeAdapter(
 	s *config.Settings,
 	db *gorm.DB,
 	logger *slog.Logger,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 ) (dbAdapter, error) {
 	// For test environments, use a mock broker.dbAdapter.
 	if s.Environment == "test" {
@@ -75,7 +79,7 @@ func NewRdsDedicatedDBAdapter(
 	parameterGroupClient parameterGroupClient,
 	optionGroupClient optionGroupClient,
 	logger *slog.Logger,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 ) *dedicatedDBAdapter {
 	return &dedicatedDBAdapter{
 		ctx:                  ctx,
@@ -86,6 +90,7 @@ func NewRdsDedicatedDBAdapter(
 		db:                   db,
 		logger:               logger,
 		riverClient:          riverClient,
+		userClient:           &sqlDatabaseUserClient{},
 	}
 }
 
@@ -97,20 +102,28 @@ type mockDBAdapter struct {
 	db                 *gorm.DB
 	createDBState      *base.InstanceState
 	reconciledInstance *RDSInstance
+	dbInstance         *rdsTypes.DBInstance
+	dbSnapshot         *rdsTypes.DBSnapshot
+	snapshot           string
 }
 
-func (d *mockDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error) {
+func (d *mockDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error) {
 	if d.createDBState != nil {
 		return *d.createDBState, nil
 	}
 	return base.InstanceInProgress, nil
 }
 
-func (d *mockDBAdapter) modifyDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error) {
+func (d *mockDBAdapter) modifyDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error) {
 	err := d.db.Save(i).Error
 	return base.InstanceInProgress, err
 }
 
+func (d *mockDBAdapter) snapshotDB(i *RDSInstance, snapshot string, operationID string) (base.InstanceState, error) {
+	d.snapshot = snapshot
+	return base.InstanceInProgress, nil
+}
+
 func (d *mockDBAdapter) checkDBStatus(database string) (base.InstanceState, error) {
 	// TODO
 	return base.InstanceReady, nil
@@ -121,13 +134,28 @@ func (d *mockDBAdapter) bindDBToApp(i *RDSInstance, password string) (map[string
 	return i.getCredentials(password)
 }
 
-func (d *mockDBAdapter) deleteDB(i *RDSInstance) (base.InstanceState, error) {
+func (d *mockDBAdapter) createBindingUser(i *RDSInstance, masterPassword string, username string, password string) error {
+	return nil
+}
+
+func (d *mockDBAdapter) dropBindingUser(i *RDSInstance, masterPassword string, username string) error {
+	return nil
+}
+
+func (d *mockDBAdapter) deleteDB(i *RDSInstance, operationID string) (base.InstanceState, error) {
 	// TODO
 	return base.InstanceInProgress, nil
 }
 
 func (d *mockDBAdapter) describeDatabaseInstance(database string) (*rdsTypes.DBInstance, error) {
-	return nil, nil
+	return d.dbInstance, nil
+}
+
+func (d *mockDBAdapter) describeDBSnapshot(snapshot string) (*rdsTypes.DBSnapshot, error) {
+	if d.dbSnapshot == nil {
+		return nil, fmt.Errorf("could not find snapshot %s", snapshot)
+	}
+	return d.dbSnapshot, nil
 }
 
 func (d *mockDBAdapter) reconcileDbState(ctx context.Context, i RDSInstance) (*RDSInstance, error) {
@@ -152,11 +180,13 @@ type dedicatedDBAdapter struct {
 	optionGroupClient    optionGroupClient
 	db                   *gorm.DB
 	logger               *slog.Logger
-	riverClient          *river.Client[*sql.Tx]
+	riverClient          queue.Client
+	userClient           databaseUserClient
 }
 
-func (d *dedicatedDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceInProgress, "Database creation in progress")
+func (d *dedicatedDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceInProgress, "Database creation in progress")
 	if err != nil {
 		return base.InstanceNotCreated, err
 	}
@@ -170,8 +200,9 @@ func (d *dedicatedDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan) (ba
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &CreateArgs{
-		Instance: i,
-		Plan:     plan,
+		Instance:    i,
+		Plan:        plan,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotCreated, err
@@ -186,8 +217,9 @@ func (d *dedicatedDBAdapter) createDB(i *RDSInstance, plan *catalog.RDSPlan) (ba
 
 // This should ultimately get exposed as part of the "update-service" method for the broker:
 // cf update-service SERVICE_INSTANCE [-p NEW_PLAN] [-c PARAMETERS_AS_JSON] [-t TAGS] [--upgrade]
-func (d *dedicatedDBAdapter) modifyDB(i *RDSInstance, plan *catalog.RDSPlan) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Database modification in progress")
+func (d *dedicatedDBAdapter) modifyDB(i *RDSInstance, plan *catalog.RDSPlan, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Database modification in progress")
 	if err != nil {
 		return base.InstanceNotModified, err
 	}
@@ -201,8 +233,42 @@ func (d *dedicatedDBAdapter) modifyDB(i *RDSInstance, plan *catalog.RDSPlan) (ba
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &ModifyArgs{
-		Instance: i,
-		Plan:     plan,
+		Instance:    i,
+		Plan:        plan,
+		OperationID: operationID,
+	}, nil)
+	if err != nil {
+		return base.InstanceNotModified, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return base.InstanceNotModified, err
+	}
+
+	return base.InstanceInProgress, nil
+}
+
+// snapshotDB takes a snapshot of the database on demand, as requested with
+// cf update-service SERVICE_INSTANCE -c '{"create_snapshot": "NAME"}'
+func (d *dedicatedDBAdapter) snapshotDB(i *RDSInstance, snapshot string, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Database snapshot in progress")
+	if err != nil {
+		return base.InstanceNotModified, err
+	}
+
+	tx := d.db.Begin()
+	if err := tx.Error; err != nil {
+		return base.InstanceNotModified, err
+	}
+	defer tx.Rollback()
+
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+
+	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &SnapshotArgs{
+		Instance:    i,
+		Snapshot:    snapshot,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotModified, err
@@ -237,6 +303,23 @@ func (d *dedicatedDBAdapter) describeDatabaseInstance(database string) (*rdsType
 	return &resp.DBInstances[0], nil
 }
 
+func (d *dedicatedDBAdapter) describeDBSnapshot(snapshot string) (*rdsTypes.DBSnapshot, error) {
+	resp, err := d.rds.DescribeDBSnapshots(d.ctx, &rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(snapshot),
+	})
+	if err != nil {
+		var notFoundErr *rdsTypes.DBSnapshotNotFoundFault
+		if errors.As(err, &notFoundErr) {
+			return nil, fmt.Errorf("could not find snapshot %s", snapshot)
+		}
+		return nil, err
+	}
+	if len(resp.DBSnapshots) == 0 {
+		return nil, fmt.Errorf("could not find snapshot %s", snapshot)
+	}
+	return &resp.DBSnapshots[0], nil
+}
+
 func (d *dedicatedDBAdapter) checkDBStatus(database string) (base.InstanceState, error) {
 	dbInstance, err := d.describeDatabaseInstance(database)
 	if err != nil {
@@ -313,8 +396,17 @@ func (d *dedicatedDBAdapter) bindDBToApp(i *RDSInstance, password string) (map[s
 	return i.getCredentials(password)
 }
 
-func (d *dedicatedDBAdapter) deleteDB(i *RDSInstance) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deleting database resources")
+func (d *dedicatedDBAdapter) createBindingUser(i *RDSInstance, masterPassword string, username string, password string) error {
+	return d.userClient.createUser(d.ctx, i, masterPassword, username, password)
+}
+
+func (d *dedicatedDBAdapter) dropBindingUser(i *RDSInstance, masterPassword string, username string) error {
+	return d.userClient.dropUser(d.ctx, i, masterPassword, username)
+}
+
+func (d *dedicatedDBAdapter) deleteDB(i *RDSInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deleting database resources")
 	if err != nil {
 		return base.InstanceNotGone, err
 	}
@@ -328,7 +420,8 @@ func (d *dedicatedDBAdapter) deleteDB(i *RDSInstance) (base.InstanceState, error
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &DeleteArgs{
-		Instance: i,
+		Instance:    i,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotGone, err
@@ -376,6 +469,15 @@ func (d *dedicatedDBAdapter) reconcileDbState(ctx context.Context, i RDSInstance
 		reconciledInstance.AllocatedStorage = int64(*dbInstanceState.AllocatedStorage)
 	}
 
+	// RDS may have grown the storage up to a limit set outside of the broker,
+	// which has to be kept when the instance is modified
+	if dbInstanceState.MaxAllocatedStorage != nil {
+		maxAllocatedStorage := int64(*dbInstanceState.MaxAllocatedStorage)
+		reconciledInstance.MaxAllocatedStorage = &maxAllocatedStorage
+	} else if reconciledInstance.MaxAllocatedStorage != nil {
+		reconciledInstance.MaxAllocatedStorage = aws.Int64(0)
+	}
+
 	return &reconciledInstance, nil
 }
 
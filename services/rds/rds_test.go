@@ -27,6 +27,7 @@ import (
 	"github.com/cloud-gov/aws-broker/db"
 	"github.com/cloud-gov/aws-broker/helpers"
 	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 	"github.com/cloud-gov/aws-broker/testutil"
 )
 
@@ -54,7 +55,7 @@ func NewTestDedicatedDBAdapter(ctx context.Context, brokerDB *gorm.DB, s *config
 		log.Fatal(fmt.Errorf("error creating river client: %w", err))
 	}
 
-	return NewRdsDedicatedDBAdapter(ctx, s, brokerDB, rdsClient, parameterGroupClient, optionGroupClient, logger, riverClient)
+	return NewRdsDedicatedDBAdapter(ctx, s, brokerDB, rdsClient, parameterGroupClient, optionGroupClient, logger, queue.NewRiverClient(riverClient))
 }
 
 func TestCreateDb(t *testing.T) {
@@ -132,7 +133,7 @@ func TestCreateDb(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			responseCode, err := test.dbAdapter.createDB(test.dbInstance, test.plan)
+			responseCode, err := test.dbAdapter.createDB(test.dbInstance, test.plan, uuid.NewString())
 
 			if err != nil && test.expectedErr == nil {
 				t.Errorf("unexpected error: %s", err)
@@ -273,7 +274,7 @@ func TestModifyDb(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			responseCode, err := test.dbAdapter.modifyDB(test.dbInstance, test.plan)
+			responseCode, err := test.dbAdapter.modifyDB(test.dbInstance, test.plan, uuid.NewString())
 			if err != nil && test.expectedErr == nil {
 				t.Errorf("unexpected error: %s", err)
 			}
@@ -309,6 +310,39 @@ func TestModifyDb(t *testing.T) {
 	}
 }
 
+func TestModifyDbOperationInProgress(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbAdapter := NewTestDedicatedDBAdapter(t.Context(), brokerDB, &config.Settings{}, &mockRDSClient{}, &mockParameterGroupClient{})
+	dbInstance := &RDSInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid: helpers.RandStr(10),
+		},
+		Database: helpers.RandStr(10),
+	}
+
+	state, err := dbAdapter.modifyDB(dbInstance, &catalog.RDSPlan{}, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != base.InstanceInProgress {
+		t.Fatalf("expected state %s, got %s", base.InstanceInProgress, state)
+	}
+
+	state, err = dbAdapter.snapshotDB(dbInstance, "db-pre-migration-"+dbInstance.Uuid, uuid.NewString())
+	if !errors.Is(err, queue.ErrOperationInProgress) {
+		t.Errorf("expected ErrOperationInProgress while the modify job is unfinished, got %v", err)
+	}
+	if state != base.InstanceNotModified {
+		t.Errorf("expected state %s, got %s", base.InstanceNotModified, state)
+	}
+}
+
 func TestDescribeDatbaseInstance(t *testing.T) {
 	brokerDB, err := testDBInit()
 	if err != nil {
@@ -625,7 +659,7 @@ func TestDeleteDb(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			responseCode, err := test.dbAdapter.deleteDB(test.dbInstance)
+			responseCode, err := test.dbAdapter.deleteDB(test.dbInstance, uuid.NewString())
 
 			if err != nil && test.expectedErr == nil {
 				t.Errorf("unexpected error: %s", err)
@@ -704,6 +738,63 @@ func TestReconcileDbState(t *testing.T) {
 				AllocatedStorage: 30,
 			},
 		},
+		"reconcile storage autoscaling": {
+			ctx: t.Context(),
+			dbAdapter: NewTestDedicatedDBAdapter(
+				t.Context(),
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{
+					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									AllocatedStorage:    aws.Int32(40),
+									MaxAllocatedStorage: aws.Int32(100),
+								},
+							},
+						},
+					},
+				},
+				&mockParameterGroupClient{},
+			),
+			dbInstance: RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(50),
+			},
+			expectedInstance: &RDSInstance{
+				AllocatedStorage:    40,
+				MaxAllocatedStorage: aws.Int64(100),
+			},
+		},
+		"reconcile storage autoscaling turned off": {
+			ctx: t.Context(),
+			dbAdapter: NewTestDedicatedDBAdapter(
+				t.Context(),
+				brokerDB,
+				&config.Settings{},
+				&mockRDSClient{
+					describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+						{
+							DBInstances: []rdsTypes.DBInstance{
+								{
+									AllocatedStorage: aws.Int32(20),
+								},
+							},
+						},
+					},
+				},
+				&mockParameterGroupClient{},
+			),
+			dbInstance: RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(50),
+			},
+			expectedInstance: &RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(0),
+			},
+		},
 		"reconcile custom parameter group": {
 			ctx: t.Context(),
 			dbAdapter: NewTestDedicatedDBAdapter(
@@ -2,9 +2,11 @@ package rds
 
 import (
 	"fmt"
+	"math"
 	"slices"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/lib/pq"
@@ -12,6 +14,7 @@ import (
 	"errors"
 
 	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/common"
 	"github.com/cloud-gov/aws-broker/config"
 )
 
@@ -22,6 +25,10 @@ type RDSInstance struct {
 	credentialUtils CredentialUtils `gorm:"-" json:"-"`
 
 	Database string `sql:"size(255)" deep:"-"`
+	// DbName is the name of the database created in the instance, when it is
+	// not the one derived from Database because the instance was restored from
+	// the backup of another instance.
+	DbName   string `sql:"size(255)"`
 	Username string `sql:"size(255)" deep:"-"`
 	Password string `sql:"size(255)"`
 	Salt     string `sql:"size(255)"`
@@ -35,6 +42,11 @@ type RDSInstance struct {
 	SecGroup              string `gorm:"-"`
 	PubliclyAccessible    bool   `gorm:"-"`
 
+	// MaxAllocatedStorage is the limit up to which RDS grows the storage of
+	// the database on its own. It is nil if storage autoscaling was never set,
+	// and 0 if it was turned off.
+	MaxAllocatedStorage *int64
+
 	Adapter string `sql:"size(255)"`
 
 	DbType       string `sql:"size(255)"`
@@ -53,6 +65,10 @@ type RDSInstance struct {
 	EnabledCloudwatchLogGroupExports pq.StringArray `gorm:"type:text[]"`
 
 	StorageType string `sql:"size(255)"`
+	// The IOPS and throughput in MiB/s provisioned for the storage, if any
+	// beyond the baseline of the storage type.
+	Iops              *int64
+	StorageThroughput *int64
 
 	AddReadReplica      bool   `gorm:"-"`
 	ReplicaDatabase     string `sql:"size(255)" deep:"-"`
@@ -61,6 +77,20 @@ type RDSInstance struct {
 
 	RotateCredentials        bool `gorm:"-"`
 	AllowMajorVersionUpgrade bool `gorm:"-"`
+
+	// The backup the database is created from, if any: either the database of
+	// another instance, restored to RestoreTime or to its latest restorable
+	// time, or a snapshot.
+	RestoreSourceDatabase string     `gorm:"-"`
+	RestoreTime           *time.Time `gorm:"-"`
+	RestoreSnapshot       string     `gorm:"-"`
+
+	// FinalSnapshot is set when the final snapshot of the database was turned
+	// on or off with a parameter, instead of by the plan.
+	FinalSnapshot *bool
+	// FinalSnapshotIdentifier is the snapshot taken of the database when the
+	// instance is deleted, if any.
+	FinalSnapshotIdentifier string `gorm:"-"`
 }
 
 func NewRDSInstance() *RDSInstance {
@@ -70,10 +100,63 @@ func NewRDSInstance() *RDSInstance {
 	}
 }
 
+// dbName returns the name of the database created in the instance.
+func (i *RDSInstance) dbName() string {
+	if i.DbName != "" {
+		return i.DbName
+	}
+	return formatDBName(i.Database, i.DbType)
+}
+
+// isRestore reports whether the database is created from a backup.
+func (i *RDSInstance) isRestore() bool {
+	return i.RestoreSourceDatabase != "" || i.RestoreSnapshot != ""
+}
+
 func (i *RDSInstance) getCredentials(password string) (map[string]string, error) {
 	return i.credentialUtils.getCredentials(i, password)
 }
 
+// getBindingCredentials returns the credentials for a binding, which are the
+// same as the instance credentials except for the username and password.
+func (i *RDSInstance) getBindingCredentials(username string, password string) (map[string]string, error) {
+	bindingInstance := *i
+	bindingInstance.Username = username
+	return i.credentialUtils.getCredentials(&bindingInstance, password)
+}
+
+// getParameters returns the effective values of the parameters that can be
+// set with "cf create-service" or "cf update-service", keyed the same way as
+// Options.
+func (i *RDSInstance) getParameters() map[string]any {
+	parameters := map[string]any{
+		"storage":                              i.AllocatedStorage,
+		"version":                              i.DbVersion,
+		"storage_type":                         i.StorageType,
+		"backup_retention_period":              i.BackupRetentionPeriod,
+		"enable_cloudwatch_log_groups_exports": []string(i.EnabledCloudwatchLogGroupExports),
+	}
+	if i.EnablePgCron != nil {
+		parameters["enable_pg_cron"] = *i.EnablePgCron
+	}
+	if i.BinaryLogFormat != "" {
+		parameters["binary_log_format"] = i.BinaryLogFormat
+	}
+	if i.FinalSnapshot != nil {
+		parameters["final_snapshot"] = *i.FinalSnapshot
+	}
+	if i.MaxAllocatedStorage != nil {
+		parameters["max_allocated_storage"] = *i.MaxAllocatedStorage
+	}
+	if i.Iops != nil {
+		parameters["iops"] = *i.Iops
+	}
+	if i.StorageThroughput != nil {
+		parameters["storage_throughput"] = *i.StorageThroughput
+	}
+	return parameters
+}
+
 func (i *RDSInstance) generateCredentials(settings *config.Settings) error {
 	salt, encrypted, err := i.credentialUtils.generateCredentials(settings)
 	if err != nil {
@@ -111,6 +194,14 @@ func (i RDSInstance) modify(options Options, currentPlan *catalog.RDSPlan, newPl
 		modifiedInstance.AllocatedStorage = options.AllocatedStorage
 	}
 
+	if options.MaxAllocatedStorage != nil {
+		modifiedInstance.MaxAllocatedStorage = options.MaxAllocatedStorage
+	}
+
+	if err := modifiedInstance.validateMaxAllocatedStorage(); err != nil {
+		return nil, err
+	}
+
 	if options.StorageType == "gp3" && modifiedInstance.AllocatedStorage < 20 {
 		return nil, errors.New("the database must have at least 20 GB of storage to use gp3 storage volumes. Please update the \"storage\" value in your update-service command")
 	}
@@ -123,6 +214,22 @@ func (i RDSInstance) modify(options Options, currentPlan *catalog.RDSPlan, newPl
 		modifiedInstance.StorageType = newPlan.StorageType
 	}
 
+	// IOPS and throughput provisioned for one storage type do not carry over to
+	// another
+	if modifiedInstance.StorageType != i.StorageType {
+		modifiedInstance.Iops = nil
+		modifiedInstance.StorageThroughput = nil
+	}
+	if options.Iops != nil {
+		modifiedInstance.Iops = options.Iops
+	}
+	if options.StorageThroughput != nil {
+		modifiedInstance.StorageThroughput = options.StorageThroughput
+	}
+	if err := validateProvisionedStorage(modifiedInstance.DbType, modifiedInstance.StorageType, modifiedInstance.AllocatedStorage, modifiedInstance.Iops, modifiedInstance.StorageThroughput); err != nil {
+		return nil, err
+	}
+
 	// Check if there is a backup retention change
 	if options.BackupRetentionPeriod != nil && *options.BackupRetentionPeriod > 0 {
 		modifiedInstance.BackupRetentionPeriod = *options.BackupRetentionPeriod
@@ -149,6 +256,10 @@ func (i RDSInstance) modify(options Options, currentPlan *catalog.RDSPlan, newPl
 		modifiedInstance.LongQueryTime = options.LongQueryTime
 	}
 
+	if options.FinalSnapshot != nil {
+		modifiedInstance.FinalSnapshot = options.FinalSnapshot
+	}
+
 	err := modifiedInstance.setPgQueryLogging(options)
 	if err != nil {
 		return nil, err
@@ -190,6 +301,27 @@ func (i *RDSInstance) generateDatabaseReplicaName() string {
 	return i.Database + "-replica"
 }
 
+// generateFinalSnapshotName names the final snapshot of the database after the
+// instance GUID.
+func (i *RDSInstance) generateFinalSnapshotName(settings *config.Settings) string {
+	return fmt.Sprintf("%s-final-%s", settings.DbNamePrefix, i.Uuid)
+}
+
+// generateSnapshotName names a snapshot taken of the database on demand after
+// the name given for it and the instance GUID.
+func (i *RDSInstance) generateSnapshotName(settings *config.Settings, name string) string {
+	return fmt.Sprintf("%s-%s-%s", settings.DbNamePrefix, name, i.Uuid)
+}
+
+// takesFinalSnapshot reports whether a snapshot of the database is taken when
+// the instance is deleted.
+func (i *RDSInstance) takesFinalSnapshot(plan *catalog.RDSPlan) bool {
+	if i.FinalSnapshot != nil {
+		return *i.FinalSnapshot
+	}
+	return plan.FinalSnapshot
+}
+
 func (i *RDSInstance) init(
 	uuid string,
 	orgGUID string,
@@ -237,16 +369,29 @@ func (i *RDSInstance) init(
 	i.setTags(plan, tags) //nolint:errcheck // decide fail-vs-best-effort on tagging failure
 
 	i.StorageType = plan.StorageType
+	if options.StorageType != "" {
+		i.StorageType = options.StorageType
+	}
 
 	i.AllocatedStorage = options.AllocatedStorage
 	if i.AllocatedStorage == 0 {
 		i.AllocatedStorage = plan.AllocatedStorage
 	}
+	i.MaxAllocatedStorage = options.MaxAllocatedStorage
+	if err := i.validateMaxAllocatedStorage(); err != nil {
+		return err
+	}
+	i.Iops = options.Iops
+	i.StorageThroughput = options.StorageThroughput
+	if err := validateProvisionedStorage(i.DbType, i.StorageType, i.AllocatedStorage, i.Iops, i.StorageThroughput); err != nil {
+		return err
+	}
 	i.EnableFunctions = options.EnableFunctions
 	i.PubliclyAccessible = options.PubliclyAccessible
 	i.BinaryLogFormat = options.BinaryLogFormat
 	i.EnablePgCron = options.EnablePgCron
 	i.LongQueryTime = options.LongQueryTime
+	i.FinalSnapshot = options.FinalSnapshot
 	err = i.setPgQueryLogging(options)
 	if err != nil {
 		return err
@@ -262,6 +407,55 @@ func (i *RDSInstance) init(
 	return nil
 }
 
+// provisionedStorage returns the IOPS and throughput provisioned for the
+// storage of the database. Cleared values return gp3 storage which can be
+// provisioned to its baseline, and are otherwise nil like values never set.
+func (i *RDSInstance) provisionedStorage() (iops *int32, throughput *int32, err error) {
+	if iops, err = i.provisionedStorageValue(i.Iops, gp3MinIops); err != nil {
+		return nil, nil, err
+	}
+	if throughput, err = i.provisionedStorageValue(i.StorageThroughput, gp3MinThroughput); err != nil {
+		return nil, nil, err
+	}
+	return iops, throughput, nil
+}
+
+func (i *RDSInstance) provisionedStorageValue(v *int64, gp3Baseline int64) (*int32, error) {
+	switch {
+	case v == nil:
+		return nil, nil
+	case *v > 0:
+		return common.ConvertInt64ToInt32Safely(*v)
+	case i.StorageType == "gp3" && i.AllocatedStorage >= gp3ProvisioningThreshold(i.DbType):
+		return common.ConvertInt64ToInt32Safely(gp3Baseline)
+	default:
+		return nil, nil
+	}
+}
+
+// maxAllocatedStorage returns the limit of storage autoscaling to create the
+// database with, or nil if it is off.
+func (i *RDSInstance) maxAllocatedStorage() (*int32, error) {
+	if i.MaxAllocatedStorage == nil || *i.MaxAllocatedStorage == 0 {
+		return nil, nil
+	}
+	return common.ConvertInt64ToInt32Safely(*i.MaxAllocatedStorage)
+}
+
+// validateMaxAllocatedStorage checks that storage autoscaling, if turned on,
+// leaves room for RDS to grow the storage of the database, which it requires
+// to be at least 10% above the allocated storage.
+func (i *RDSInstance) validateMaxAllocatedStorage() error {
+	if i.MaxAllocatedStorage == nil || *i.MaxAllocatedStorage == 0 {
+		return nil
+	}
+	minimum := int64(math.Ceil(float64(i.AllocatedStorage) * 1.1))
+	if *i.MaxAllocatedStorage < minimum {
+		return fmt.Errorf("invalid max_allocated_storage %d; must be at least 10%% above the storage of %d GB, so >= %d", *i.MaxAllocatedStorage, i.AllocatedStorage, minimum)
+	}
+	return nil
+}
+
 func (i *RDSInstance) setPgQueryLogging(options Options) error {
 	if options.PgQueryLogging != nil {
 		if i.PgQueryLogging == nil {
@@ -552,6 +552,91 @@ func TestModifyInstance(t *testing.T) {
 			settings:      &config.Settings{},
 			expectUpdates: true,
 		},
+		"turn on storage autoscaling": {
+			options: Options{
+				MaxAllocatedStorage: aws.Int64(100),
+			},
+			existingInstance: &RDSInstance{
+				AllocatedStorage: 20,
+			},
+			expectedInstance: &RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(100),
+				Tags:                map[string]string{},
+			},
+			currentPlan:   &catalog.RDSPlan{},
+			newPlan:       &catalog.RDSPlan{},
+			settings:      &config.Settings{},
+			expectUpdates: true,
+		},
+		"turn off storage autoscaling": {
+			options: Options{
+				MaxAllocatedStorage: aws.Int64(0),
+			},
+			existingInstance: &RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(100),
+			},
+			expectedInstance: &RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(0),
+				Tags:                map[string]string{},
+			},
+			currentPlan:   &catalog.RDSPlan{},
+			newPlan:       &catalog.RDSPlan{},
+			settings:      &config.Settings{},
+			expectUpdates: true,
+		},
+		"storage grown past the storage autoscaling limit": {
+			options: Options{
+				AllocatedStorage: 100,
+			},
+			existingInstance: &RDSInstance{
+				AllocatedStorage:    20,
+				MaxAllocatedStorage: aws.Int64(100),
+			},
+			currentPlan: &catalog.RDSPlan{},
+			newPlan:     &catalog.RDSPlan{},
+			settings:    &config.Settings{},
+			expectErr:   true,
+		},
+		"provision iops and throughput": {
+			options: Options{
+				Iops:              aws.Int64(16000),
+				StorageThroughput: aws.Int64(1000),
+			},
+			existingInstance: &RDSInstance{
+				DbType:           "postgres",
+				AllocatedStorage: 400,
+				StorageType:      "gp3",
+			},
+			expectedInstance: &RDSInstance{
+				DbType:            "postgres",
+				AllocatedStorage:  400,
+				StorageType:       "gp3",
+				Iops:              aws.Int64(16000),
+				StorageThroughput: aws.Int64(1000),
+				Tags:              map[string]string{},
+			},
+			currentPlan:   &catalog.RDSPlan{},
+			newPlan:       &catalog.RDSPlan{StorageType: "gp3"},
+			settings:      &config.Settings{},
+			expectUpdates: true,
+		},
+		"provision iops for small gp3 storage": {
+			options: Options{
+				Iops: aws.Int64(16000),
+			},
+			existingInstance: &RDSInstance{
+				DbType:           "postgres",
+				AllocatedStorage: 20,
+				StorageType:      "gp3",
+			},
+			currentPlan: &catalog.RDSPlan{},
+			newPlan:     &catalog.RDSPlan{},
+			settings:    &config.Settings{},
+			expectErr:   true,
+		},
 		"allocated storage option less than existing, does not update": {
 			options: Options{
 				AllocatedStorage: 10,
@@ -1300,3 +1385,71 @@ func TestSetPgQueryLogging(t *testing.T) {
 		}
 	})
 }
+
+func TestTakesFinalSnapshot(t *testing.T) {
+	testCases := map[string]struct {
+		finalSnapshot *bool
+		plan          *catalog.RDSPlan
+		expected      bool
+	}{
+		"plan default off": {
+			plan: &catalog.RDSPlan{},
+		},
+		"plan default on": {
+			plan:     &catalog.RDSPlan{FinalSnapshot: true},
+			expected: true,
+		},
+		"turned on by parameter": {
+			finalSnapshot: aws.Bool(true),
+			plan:          &catalog.RDSPlan{},
+			expected:      true,
+		},
+		"turned off by parameter": {
+			finalSnapshot: aws.Bool(false),
+			plan:          &catalog.RDSPlan{FinalSnapshot: true},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			i := &RDSInstance{FinalSnapshot: test.finalSnapshot}
+			if actual := i.takesFinalSnapshot(test.plan); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateMaxAllocatedStorage(t *testing.T) {
+	testCases := map[string]struct {
+		instance  *RDSInstance
+		expectErr bool
+	}{
+		"storage autoscaling not set": {
+			instance: &RDSInstance{AllocatedStorage: 20},
+		},
+		"storage autoscaling off": {
+			instance: &RDSInstance{AllocatedStorage: 20, MaxAllocatedStorage: aws.Int64(0)},
+		},
+		"limit at least 10% above the storage": {
+			instance: &RDSInstance{AllocatedStorage: 20, MaxAllocatedStorage: aws.Int64(22)},
+		},
+		"limit less than 10% above the storage": {
+			instance:  &RDSInstance{AllocatedStorage: 20, MaxAllocatedStorage: aws.Int64(21)},
+			expectErr: true,
+		},
+		"limit below the storage": {
+			instance:  &RDSInstance{AllocatedStorage: 100, MaxAllocatedStorage: aws.Int64(50)},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := test.instance.validateMaxAllocatedStorage()
+			if test.expectErr != (err != nil) {
+				t.Errorf("expected error: %t, got: %v", test.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package rds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type CloudwatchLogsClientInterface interface {
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	ListTagsForResource(ctx context.Context, params *cloudwatchlogs.ListTagsForResourceInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.ListTagsForResourceOutput, error)
+	TagResource(ctx context.Context, params *cloudwatchlogs.TagResourceInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.TagResourceOutput, error)
+}
+
+func getLogGroupPrefix(prefixParts ...string) string {
+	return fmt.Sprintf("/aws/rds/instance/%s", strings.Join(prefixParts, "/"))
+}
+
+// describeDatabase returns nil if the database does not exist.
+func describeDatabase(ctx context.Context, rdsClient RDSClientInterface, database string) (*rdsTypes.DBInstance, error) {
+	resp, err := rdsClient.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(database),
+	})
+	if err != nil {
+		if isDatabaseInstanceNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not describe database %s: %w", database, err)
+	}
+	if len(resp.DBInstances) == 0 {
+		return nil, nil
+	}
+	return &resp.DBInstances[0], nil
+}
+
+// ReconcileCloudwatchLogGroups records the CloudWatch log groups enabled for
+// the database of the instance, reporting whether they differed from the ones
+// recorded.
+func ReconcileCloudwatchLogGroups(ctx context.Context, db *gorm.DB, rdsClient RDSClientInterface, i *RDSInstance) (bool, error) {
+	dbInstance, err := describeDatabase(ctx, rdsClient, i.Database)
+	if err != nil || dbInstance == nil {
+		return false, err
+	}
+
+	enabled := slices.Sorted(slices.Values(dbInstance.EnabledCloudwatchLogsExports))
+	if slices.Equal(enabled, slices.Sorted(slices.Values(i.EnabledCloudwatchLogGroupExports))) {
+		return false, nil
+	}
+
+	err = db.WithContext(ctx).Model(i).Update("enabled_cloudwatch_log_group_exports", pq.StringArray(enabled)).Error
+	if err != nil {
+		return false, fmt.Errorf("could not save enabled log groups of database %s: %w", i.Database, err)
+	}
+	return true, nil
+}
+
+// ReconcileRDSCloudwatchLogGroups records the CloudWatch log groups enabled for
+// every database which has log groups under the prefix of the broker's
+// databases.
+func ReconcileRDSCloudwatchLogGroups(ctx context.Context, logsClient CloudwatchLogsClientInterface, rdsClient RDSClientInterface, dbNamePrefix string, db *gorm.DB, logger *slog.Logger) error {
+	resp, err := logsClient.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(getLogGroupPrefix(dbNamePrefix)),
+	})
+	if err != nil {
+		return fmt.Errorf("could not describe log groups: %w", err)
+	}
+
+	reconciled := map[string]bool{}
+	for _, logGroup := range resp.LogGroups {
+		// Log group names are /aws/rds/instance/<database>/<log type>.
+		parts := strings.Split(aws.ToString(logGroup.LogGroupName), "/")
+		if len(parts) < 5 || parts[4] == "" {
+			return fmt.Errorf("could not get database name for log group %s", aws.ToString(logGroup.LogGroupName))
+		}
+		dbName := parts[4]
+		if reconciled[dbName] {
+			continue
+		}
+		reconciled[dbName] = true
+
+		i := &RDSInstance{}
+		err := db.WithContext(ctx).Where(&RDSInstance{Database: dbName}).First(i).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Info("could not find database record, continuing", "database", dbName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		changed, err := ReconcileCloudwatchLogGroups(ctx, db, rdsClient, i)
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.Info("saved enabled log groups", "database", dbName)
+		}
+	}
+	return nil
+}
+
+// ReconcileResourceTags applies the tags generated for the instance to its
+// databases, custom parameter group and CloudWatch log groups, returning the
+// resources which were missing any of them.
+func ReconcileResourceTags(
+	ctx context.Context,
+	i *RDSInstance,
+	catalog *catalog.Catalog,
+	rdsClient RDSClientInterface,
+	logsClient CloudwatchLogsClientInterface,
+	tagManager brokertags.TagManager,
+) ([]string, error) {
+	dbInstance, err := describeDatabase(ctx, rdsClient, i.Database)
+	if err != nil || dbInstance == nil {
+		return nil, err
+	}
+
+	plan, err := catalog.RdsService.FetchPlan(i.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("could not find plan %s: %w", i.PlanID, err)
+	}
+	tags, err := i.ReconcileTags(tagManager, catalog.RdsService.Name, plan.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate tags: %w", err)
+	}
+
+	resources := map[string]string{
+		fmt.Sprintf("database %s", i.Database): aws.ToString(dbInstance.DBInstanceArn),
+	}
+	if i.ReplicaDatabase != "" {
+		replica, err := describeDatabase(ctx, rdsClient, i.ReplicaDatabase)
+		if err != nil {
+			return nil, err
+		}
+		if replica != nil {
+			resources[fmt.Sprintf("database %s", i.ReplicaDatabase)] = aws.ToString(replica.DBInstanceArn)
+		}
+	}
+	if i.ParameterGroupName != "" {
+		groups, err := rdsClient.DescribeDBParameterGroups(ctx, &rds.DescribeDBParameterGroupsInput{
+			DBParameterGroupName: aws.String(i.ParameterGroupName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not describe parameter group %s: %w", i.ParameterGroupName, err)
+		}
+		if len(groups.DBParameterGroups) > 0 {
+			resources[fmt.Sprintf("parameter group %s", i.ParameterGroupName)] = aws.ToString(groups.DBParameterGroups[0].DBParameterGroupArn)
+		}
+	}
+
+	tagged := []string{}
+	for _, resource := range slices.Sorted(maps.Keys(resources)) {
+		changed, err := reconcileRDSResourceTags(ctx, rdsClient, resources[resource], tags)
+		if err != nil {
+			return tagged, fmt.Errorf("could not tag %s: %w", resource, err)
+		}
+		if changed {
+			tagged = append(tagged, resource)
+		}
+	}
+
+	for _, logGroupType := range i.EnabledCloudwatchLogGroupExports {
+		logGroupName := getLogGroupPrefix(i.Database, logGroupType)
+		changed, err := reconcileLogGroupTags(ctx, logsClient, logGroupName, tags)
+		if err != nil {
+			return tagged, fmt.Errorf("could not tag log group %s: %w", logGroupName, err)
+		}
+		if changed {
+			tagged = append(tagged, fmt.Sprintf("log group %s", logGroupName))
+		}
+	}
+	return tagged, nil
+}
+
+// reconcileRDSResourceTags adds the tags to the resource, reporting whether it
+// was missing any of them.
+func reconcileRDSResourceTags(ctx context.Context, rdsClient RDSClientInterface, arn string, tags map[string]string) (bool, error) {
+	existing, err := rdsClient.ListTagsForResource(ctx, &rds.ListTagsForResourceInput{
+		ResourceName: aws.String(arn),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not list tags: %w", err)
+	}
+	existingTags := map[string]string{}
+	for _, tag := range existing.TagList {
+		existingTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if base.HasTags(existingTags, tags) {
+		return false, nil
+	}
+
+	_, err = rdsClient.AddTagsToResource(ctx, &rds.AddTagsToResourceInput{
+		ResourceName: aws.String(arn),
+		Tags:         ConvertTagsToRDSTags(tags),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reconcileLogGroupTags adds the tags to the log group, reporting whether it
+// was missing any of them. Log groups which do not exist yet are skipped.
+func reconcileLogGroupTags(ctx context.Context, logsClient CloudwatchLogsClientInterface, logGroupName string, tags map[string]string) (bool, error) {
+	resp, err := logsClient.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(logGroupName),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not describe log group: %w", err)
+	}
+	if len(resp.LogGroups) == 0 {
+		return false, nil
+	}
+	// The ARN of a log group ends with :* which tagging does not accept.
+	arn, _ := strings.CutSuffix(aws.ToString(resp.LogGroups[0].Arn), ":*")
+
+	existing, err := logsClient.ListTagsForResource(ctx, &cloudwatchlogs.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not list tags: %w", err)
+	}
+	if base.HasTags(existing.Tags, tags) {
+		return false, nil
+	}
+
+	_, err = logsClient.TagResource(ctx, &cloudwatchlogs.TagResourceInput{
+		ResourceArn: aws.String(arn),
+		Tags:        tags,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReconcileResourceTagsForAllRDSDatabases applies the tags generated for every
+// instance to its RDS resources.
+func ReconcileResourceTagsForAllRDSDatabases(
+	ctx context.Context,
+	catalog *catalog.Catalog,
+	db *gorm.DB,
+	rdsClient RDSClientInterface,
+	logsClient CloudwatchLogsClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) error {
+	instances := []*RDSInstance{}
+	if err := db.WithContext(ctx).Find(&instances).Error; err != nil {
+		return fmt.Errorf("could not list RDS instances: %w", err)
+	}
+
+	var errs error
+	for _, i := range instances {
+		tagged, err := ReconcileResourceTags(ctx, i, catalog, rdsClient, logsClient, tagManager)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("database %s: %w", i.Database, err))
+			continue
+		}
+		for _, resource := range tagged {
+			logger.Info("updated tags", "resource", resource)
+		}
+	}
+	return errs
+}
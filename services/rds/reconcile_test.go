@@ -0,0 +1,337 @@
+package rds
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/mocks"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/go-test/deep"
+)
+
+func TestReconcileResourceTags(t *testing.T) {
+	testCatalog := &catalog.Catalog{
+		RdsService: catalog.RDSService{
+			Service: catalog.Service{Name: "aws-rds"},
+			RDSPlans: []catalog.RDSPlan{
+				{ServicePlan: domain.ServicePlan{ID: "plan-1", Name: "micro-psql"}},
+			},
+		},
+	}
+	tagManager := &mocks.MockTagGenerator{Tags: map[string]string{"Space GUID": "space-1"}}
+	database := &rds.DescribeDBInstancesOutput{
+		DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}},
+	}
+	logGroup := cloudwatchTypes.LogGroup{
+		LogGroupName: aws.String("/aws/rds/instance/db-1/postgresql"),
+		Arn:          aws.String("log-group-arn:*"),
+	}
+
+	testCases := map[string]struct {
+		instance       *RDSInstance
+		rdsClient      *mockRDSClient
+		logsClient     *mockLogsClient
+		expectErr      bool
+		expectedTagged []string
+	}{
+		"tags every resource of the instance": {
+			instance: &RDSInstance{
+				Instance:                         base.Instance{Request: request.Request{PlanID: "plan-1"}},
+				Database:                         "db-1",
+				ReplicaDatabase:                  "db-1-replica",
+				ParameterGroupName:               "pgroup-1",
+				EnabledCloudwatchLogGroupExports: []string{"postgresql", "upgrade"},
+			},
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+					database,
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("replica-arn")}}},
+				},
+				describeDBParameterGroupsOutput: []*rds.DescribeDBParameterGroupsOutput{
+					{DBParameterGroups: []rdsTypes.DBParameterGroup{{DBParameterGroupArn: aws.String("pgroup-arn")}}},
+				},
+			},
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{logGroup},
+			},
+			expectedTagged: []string{
+				"database db-1",
+				"database db-1-replica",
+				"parameter group pgroup-1",
+				"log group /aws/rds/instance/db-1/postgresql",
+			},
+		},
+		"leaves log groups which are up to date": {
+			instance: &RDSInstance{
+				Instance:                         base.Instance{Request: request.Request{PlanID: "plan-1"}},
+				Database:                         "db-1",
+				EnabledCloudwatchLogGroupExports: []string{"postgresql"},
+			},
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{database},
+				listTagsForResourceOutput: &rds.ListTagsForResourceOutput{
+					TagList: []rdsTypes.Tag{{Key: aws.String("Space GUID"), Value: aws.String("space-1")}},
+				},
+			},
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{logGroup},
+				tags:      map[string]string{"Space GUID": "space-1"},
+			},
+			expectedTagged: []string{},
+		},
+		"skips databases which do not exist": {
+			instance: &RDSInstance{
+				Instance: base.Instance{Request: request.Request{PlanID: "plan-1"}},
+				Database: "db-1",
+			},
+			rdsClient: &mockRDSClient{
+				describeDbInstancesErrs: []error{&rdsTypes.DBInstanceNotFoundFault{}},
+			},
+			logsClient: &mockLogsClient{},
+		},
+		"error fetching plan": {
+			instance: &RDSInstance{
+				Instance: base.Instance{Request: request.Request{PlanID: "unknown"}},
+				Database: "db-1",
+			},
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{database},
+			},
+			logsClient: &mockLogsClient{},
+			expectErr:  true,
+		},
+		"error tagging log group": {
+			instance: &RDSInstance{
+				Instance:                         base.Instance{Request: request.Request{PlanID: "plan-1"}},
+				Database:                         "db-1",
+				EnabledCloudwatchLogGroupExports: []string{"postgresql"},
+			},
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{database},
+			},
+			logsClient: &mockLogsClient{
+				logGroups:      []cloudwatchTypes.LogGroup{logGroup},
+				tagResourceErr: errors.New("access denied"),
+			},
+			expectErr:      true,
+			expectedTagged: []string{"database db-1"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tagged, err := ReconcileResourceTags(t.Context(), test.instance, testCatalog, test.rdsClient, test.logsClient, tagManager)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if diff := deep.Equal(tagged, test.expectedTagged); diff != nil {
+				t.Error(diff)
+			}
+			for _, input := range test.logsClient.tagResourceInputs {
+				if aws.ToString(input.ResourceArn) != "log-group-arn" {
+					t.Errorf("expected log group ARN without the :* suffix, got %s", aws.ToString(input.ResourceArn))
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileRDSCloudwatchLogGroups(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := "db-" + helpers.RandStr(10)
+	instance := &RDSInstance{
+		Instance: base.Instance{Uuid: helpers.RandStr(10)},
+		Database: database,
+	}
+	if err := brokerDB.Create(instance).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	logsClient := &mockLogsClient{
+		logGroups: []cloudwatchTypes.LogGroup{
+			{LogGroupName: aws.String("/aws/rds/instance/" + database + "/postgresql")},
+			{LogGroupName: aws.String("/aws/rds/instance/" + database + "/upgrade")},
+			{LogGroupName: aws.String("/aws/rds/instance/db-unknown/postgresql")},
+		},
+	}
+	rdsClient := &mockRDSClient{
+		describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+			{DBInstances: []rdsTypes.DBInstance{{EnabledCloudwatchLogsExports: []string{"upgrade", "postgresql"}}}},
+		},
+	}
+
+	err = ReconcileRDSCloudwatchLogGroups(t.Context(), logsClient, rdsClient, "db", brokerDB, slog.New(&testutil.MockLogHandler{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := &RDSInstance{}
+	if err := brokerDB.Where("uuid = ?", instance.Uuid).First(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(saved.EnabledCloudwatchLogGroupExports, []string{"postgresql", "upgrade"}) {
+		t.Errorf("expected log groups postgresql and upgrade to be recorded, got %v", saved.EnabledCloudwatchLogGroupExports)
+	}
+	// The database is described once, although it has two log groups.
+	if rdsClient.describeDBInstancesCallNum != 1 {
+		t.Errorf("expected database to be described once, got %d", rdsClient.describeDBInstancesCallNum)
+	}
+}
+
+func TestReconcileRDSResourceTags(t *testing.T) {
+	testCases := map[string]struct {
+		existingTags  []rdsTypes.Tag
+		generatedTags map[string]string
+		addTagsErr    error
+		expectErr     bool
+		expectChanged bool
+	}{
+		"different key order": {
+			existingTags: []rdsTypes.Tag{
+				{Key: aws.String("foo"), Value: aws.String("bar")},
+				{Key: aws.String("moo"), Value: aws.String("cow")},
+			},
+			generatedTags: map[string]string{"moo": "cow", "foo": "bar"},
+		},
+		"different Created at times": {
+			existingTags: []rdsTypes.Tag{
+				{Key: aws.String("foo"), Value: aws.String("bar")},
+				{Key: aws.String("Created at"), Value: aws.String(time.Now().Add(-time.Hour).String())},
+			},
+			generatedTags: map[string]string{"foo": "bar", "Created at": time.Now().String()},
+		},
+		"different Updated at times": {
+			existingTags: []rdsTypes.Tag{
+				{Key: aws.String("foo"), Value: aws.String("bar")},
+				{Key: aws.String("Updated at"), Value: aws.String(time.Now().Add(-time.Hour).String())},
+			},
+			generatedTags: map[string]string{"foo": "bar", "Updated at": time.Now().String()},
+		},
+		"different value": {
+			existingTags: []rdsTypes.Tag{
+				{Key: aws.String("foo"), Value: aws.String("bar")},
+			},
+			generatedTags: map[string]string{"foo": "cow"},
+			expectChanged: true,
+		},
+		"missing tag": {
+			generatedTags: map[string]string{"foo": "bar"},
+			expectChanged: true,
+		},
+		"error adding tags": {
+			generatedTags: map[string]string{"foo": "bar"},
+			addTagsErr:    errors.New("access denied"),
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tags, err := base.Instance{}.ReconcileTags(&mocks.MockTagGenerator{Tags: test.generatedTags}, "aws-rds", "micro-psql")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rdsClient := &mockRDSClient{
+				listTagsForResourceOutput: &rds.ListTagsForResourceOutput{TagList: test.existingTags},
+				addTagsToResourceErr:      test.addTagsErr,
+			}
+
+			changed, err := reconcileRDSResourceTags(t.Context(), rdsClient, "db-arn", tags)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if changed != test.expectChanged {
+				t.Errorf("expected tags changed: %t, got: %t", test.expectChanged, changed)
+			}
+			expectTagged := test.expectChanged || test.addTagsErr != nil
+			if tagged := len(rdsClient.addTagsToResourceInputs) > 0; tagged != expectTagged {
+				t.Errorf("expected resource tagged: %t, got: %t", expectTagged, tagged)
+			}
+			if test.expectChanged && aws.ToString(rdsClient.addTagsToResourceInputs[0].ResourceName) != "db-arn" {
+				t.Errorf("expected db-arn to be tagged, got %s", aws.ToString(rdsClient.addTagsToResourceInputs[0].ResourceName))
+			}
+		})
+	}
+}
+
+func TestReconcileLogGroupTags(t *testing.T) {
+	logGroupName := "/aws/rds/instance/db-1/postgresql"
+	logGroup := cloudwatchTypes.LogGroup{
+		LogGroupName: aws.String(logGroupName),
+		Arn:          aws.String("group1-arn:*"),
+	}
+
+	testCases := map[string]struct {
+		logsClient    *mockLogsClient
+		expectErr     bool
+		expectChanged bool
+	}{
+		"success": {
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{logGroup},
+			},
+			expectChanged: true,
+		},
+		"already tagged": {
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{logGroup},
+				tags:      map[string]string{"foo": "bar", "moo": "cow"},
+			},
+		},
+		"error describing log group": {
+			logsClient: &mockLogsClient{
+				describeLogGroupsErr: errors.New("error describing log group"),
+			},
+			expectErr: true,
+		},
+		"no error, but log group not found": {
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{},
+			},
+		},
+		"error tagging log group": {
+			logsClient: &mockLogsClient{
+				logGroups:      []cloudwatchTypes.LogGroup{logGroup},
+				tagResourceErr: errors.New("error tagging resource"),
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			changed, err := reconcileLogGroupTags(t.Context(), test.logsClient, logGroupName, map[string]string{"foo": "bar"})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if changed != test.expectChanged {
+				t.Errorf("expected tags changed: %t, got: %t", test.expectChanged, changed)
+			}
+			if test.expectChanged {
+				input := test.logsClient.tagResourceInputs[0]
+				if aws.ToString(input.ResourceArn) != "group1-arn" {
+					t.Errorf("expected log group ARN without the :* suffix, got %s", aws.ToString(input.ResourceArn))
+				}
+				if diff := deep.Equal(input.Tags, map[string]string{"foo": "bar"}); diff != nil {
+					t.Error(diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package rds
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	ReconcileKind = "rds-reconcile"
+)
+
+// ReconcileArgs are the arguments of the periodic job which brings the RDS
+// resources of every instance in line with the broker's records.
+type ReconcileArgs struct{}
+
+func (ReconcileArgs) Kind() string { return ReconcileKind }
+
+// A failed job is not retried, as the job runs again on its schedule.
+func (ReconcileArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: reconcile.Queue, MaxAttempts: 1}
+}
+
+type ReconcileWorker struct {
+	river.WorkerDefaults[ReconcileArgs]
+	db         *gorm.DB
+	settings   *config.Settings
+	catalog    *catalog.Catalog
+	rds        RDSClientInterface
+	logs       CloudwatchLogsClientInterface
+	tagManager brokertags.TagManager
+	logger     *slog.Logger
+}
+
+func NewReconcileWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	catalog *catalog.Catalog,
+	rds RDSClientInterface,
+	logs CloudwatchLogsClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) *ReconcileWorker {
+	return &ReconcileWorker{
+		db:         db,
+		settings:   settings,
+		catalog:    catalog,
+		rds:        rds,
+		logs:       logs,
+		tagManager: tagManager,
+		logger:     logger,
+	}
+}
+
+func (w *ReconcileWorker) Timeout(*river.Job[ReconcileArgs]) time.Duration {
+	return w.settings.RDSQueue.JobTimeout
+}
+
+// Work reconciles the CloudWatch log groups recorded for every database with
+// the ones enabled in RDS, and applies the tags generated for the instance to
+// its databases, parameter group and log groups.
+func (w *ReconcileWorker) Work(ctx context.Context, job *river.Job[ReconcileArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	instance := func(i *RDSInstance) *base.Instance { return &i.Instance }
+	return reconcile.Instances(ctx, w.db, w.logger, "RDS", instance, w.reconcileInstance)
+}
+
+// reconcileInstance returns a description of each change made to the instance.
+func (w *ReconcileWorker) reconcileInstance(ctx context.Context, i *RDSInstance) ([]string, error) {
+	changes := []string{}
+	changed, err := ReconcileCloudwatchLogGroups(ctx, w.db, w.rds, i)
+	if err != nil {
+		return changes, err
+	}
+	if changed {
+		changes = append(changes, "updated enabled CloudWatch log groups")
+	}
+
+	tagged, err := ReconcileResourceTags(ctx, i, w.catalog, w.rds, w.logs, w.tagManager)
+	if err != nil {
+		return changes, err
+	}
+	for _, resource := range tagged {
+		changes = append(changes, fmt.Sprintf("updated tags of %s", resource))
+	}
+	return changes, nil
+}
@@ -0,0 +1,207 @@
+package rds
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/mocks"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+)
+
+func TestReconcileWorkerWork(t *testing.T) {
+	testCatalog := &catalog.Catalog{
+		RdsService: catalog.RDSService{
+			Service: catalog.Service{Name: "aws-rds"},
+			RDSPlans: []catalog.RDSPlan{
+				{ServicePlan: domain.ServicePlan{ID: "plan-1", Name: "micro-psql"}},
+			},
+		},
+	}
+	tagManager := &mocks.MockTagGenerator{Tags: map[string]string{"Space GUID": "space-1"}}
+
+	testCases := map[string]struct {
+		rdsClient               *mockRDSClient
+		logsClient              *mockLogsClient
+		planID                  string
+		operationInProgress     bool
+		expectErr               bool
+		expectedTagged          int
+		expectedLogGroupsTagged int
+		expectedLogGroups       []string
+		expectedOperationState  base.InstanceState
+		expectOperationLogEntry bool
+	}{
+		"applies missing tags and records enabled log groups": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+					{DBInstances: []rdsTypes.DBInstance{{
+						DBInstanceArn:                aws.String("db-arn"),
+						EnabledCloudwatchLogsExports: []string{"postgresql", "upgrade"},
+					}}},
+					{DBInstances: []rdsTypes.DBInstance{{
+						DBInstanceArn:                aws.String("db-arn"),
+						EnabledCloudwatchLogsExports: []string{"postgresql", "upgrade"},
+					}}},
+				},
+			},
+			logsClient: &mockLogsClient{
+				logGroups: []cloudwatchTypes.LogGroup{
+					{
+						LogGroupName: aws.String("/aws/rds/instance/db-1/postgresql"),
+						Arn:          aws.String("arn:aws:logs:us-gov-west-1:123456789012:log-group:/aws/rds/instance/db-1/postgresql:*"),
+					},
+				},
+			},
+			planID:                  "plan-1",
+			expectedTagged:          1,
+			expectedLogGroupsTagged: 1,
+			expectedLogGroups:       []string{"postgresql", "upgrade"},
+			expectedOperationState:  base.InstanceReady,
+			expectOperationLogEntry: true,
+		},
+		"leaves resources which are up to date": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+				},
+				listTagsForResourceOutput: &rds.ListTagsForResourceOutput{
+					TagList: []rdsTypes.Tag{{Key: aws.String("Space GUID"), Value: aws.String("space-1")}},
+				},
+			},
+			planID: "plan-1",
+		},
+		"skips databases which do not exist": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesErrs: []error{&rdsTypes.DBInstanceNotFoundFault{}},
+			},
+			planID: "plan-1",
+		},
+		"skips instances with an operation in progress": {
+			rdsClient:           &mockRDSClient{},
+			planID:              "plan-1",
+			operationInProgress: true,
+		},
+		"reports errors to the operation log": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+				},
+				addTagsToResourceErr: errors.New("access denied"),
+			},
+			planID:                  "plan-1",
+			expectErr:               true,
+			expectedTagged:          1,
+			expectedOperationState:  base.InstanceNotModified,
+			expectOperationLogEntry: true,
+		},
+		"unknown plan": {
+			rdsClient: &mockRDSClient{
+				describeDbInstancesResults: []*rds.DescribeDBInstancesOutput{
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+					{DBInstances: []rdsTypes.DBInstance{{DBInstanceArn: aws.String("db-arn")}}},
+				},
+			},
+			planID:                  "unknown",
+			expectErr:               true,
+			expectedOperationState:  base.InstanceNotModified,
+			expectOperationLogEntry: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The test database is shared between tests, so remove the instances
+			// created by any previous test.
+			if err := brokerDB.Where("1 = 1").Delete(&RDSInstance{}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			instance := &RDSInstance{
+				Instance: base.Instance{
+					Uuid: helpers.RandStr(10),
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+						PlanID:    test.planID,
+					},
+				},
+				Database: "db-1",
+			}
+			if err := brokerDB.Create(instance).Error; err != nil {
+				t.Fatal(err)
+			}
+			if test.operationInProgress {
+				err := asyncmessage.WriteAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.ModifyOp, base.InstanceInProgress, "Modifying")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.logsClient == nil {
+				test.logsClient = &mockLogsClient{}
+			}
+			worker := NewReconcileWorker(brokerDB, &config.Settings{}, testCatalog, test.rdsClient, test.logsClient, tagManager, slog.New(&testutil.MockLogHandler{}))
+			err = worker.Work(t.Context(), &river.Job[ReconcileArgs]{})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+
+			if len(test.rdsClient.addTagsToResourceInputs) != test.expectedTagged {
+				t.Errorf("expected %d resources to be tagged, got %d", test.expectedTagged, len(test.rdsClient.addTagsToResourceInputs))
+			}
+
+			if len(test.logsClient.tagResourceInputs) != test.expectedLogGroupsTagged {
+				t.Errorf("expected %d log groups to be tagged, got %d", test.expectedLogGroupsTagged, len(test.logsClient.tagResourceInputs))
+			}
+			for _, input := range test.logsClient.tagResourceInputs {
+				if strings.HasSuffix(aws.ToString(input.ResourceArn), ":*") {
+					t.Errorf("expected log group ARN without the :* suffix, got %s", aws.ToString(input.ResourceArn))
+				}
+			}
+
+			saved := &RDSInstance{}
+			if err := brokerDB.Where("uuid = ?", instance.Uuid).First(saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(saved.EnabledCloudwatchLogGroupExports) != len(test.expectedLogGroups) {
+				t.Errorf("expected log groups %v, got %v", test.expectedLogGroups, saved.EnabledCloudwatchLogGroupExports)
+			}
+
+			entries, err := asyncmessage.GetOperationLog(brokerDB, instance.ServiceID, instance.Uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reconcileEntries := []asyncmessage.OperationLogEntry{}
+			for _, entry := range entries {
+				if entry.JobType == base.ReconcileOp {
+					reconcileEntries = append(reconcileEntries, entry)
+				}
+			}
+			if test.expectOperationLogEntry != (len(reconcileEntries) == 1) {
+				t.Fatalf("expected operation log entry: %t, got %+v", test.expectOperationLogEntry, reconcileEntries)
+			}
+			if test.expectOperationLogEntry && reconcileEntries[0].State != test.expectedOperationState {
+				t.Errorf("expected state %s, got %s: %s", test.expectedOperationState, reconcileEntries[0].State, reconcileEntries[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package rds
+
+import (
+	"time"
+
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+)
+
+// RDSSnapshot records a snapshot taken of the database of an instance, which
+// outlives the instance so that it can be restored into a new one.
+type RDSSnapshot struct {
+	Identifier string `gorm:"primaryKey;size:255"`
+	InstanceID string `gorm:"size:255;index"`
+
+	ServiceID        string `gorm:"size:255"`
+	PlanID           string `gorm:"size:255"`
+	OrganizationGUID string `gorm:"size:255"`
+	SpaceGUID        string `gorm:"size:255;index"`
+
+	// The database the snapshot was taken of, and what a database restored
+	// from it inherits.
+	Database         string `gorm:"size:255"`
+	DbName           string `gorm:"size:255"`
+	Username         string `gorm:"size:255"`
+	DbType           string `gorm:"size:255"`
+	DbVersion        string `gorm:"size:255"`
+	AllocatedStorage int64
+
+	CreatedAt time.Time
+	// ExpiresAt is when the snapshot is deleted. Snapshots without an expiry
+	// are kept until they are deleted by hand.
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+func (RDSSnapshot) TableName() string {
+	return "rds_snapshots"
+}
+
+// newRDSSnapshot returns the record of a snapshot of the database of i.
+func newRDSSnapshot(identifier string, i *RDSInstance, expiresAt *time.Time) *RDSSnapshot {
+	return &RDSSnapshot{
+		Identifier:       identifier,
+		InstanceID:       i.Uuid,
+		ServiceID:        i.ServiceID,
+		PlanID:           i.PlanID,
+		OrganizationGUID: i.OrganizationGUID,
+		SpaceGUID:        i.SpaceGUID,
+		Database:         i.Database,
+		DbName:           i.dbName(),
+		Username:         i.Username,
+		DbType:           i.DbType,
+		DbVersion:        i.DbVersion,
+		AllocatedStorage: i.AllocatedStorage,
+		ExpiresAt:        expiresAt,
+	}
+}
+
+// sourceInstance returns the instance the snapshot was taken of, as far as it
+// is needed to restore the snapshot.
+func (s *RDSSnapshot) sourceInstance() *RDSInstance {
+	return &RDSInstance{
+		Instance: base.Instance{
+			Uuid: s.InstanceID,
+			Request: request.Request{
+				ServiceID:        s.ServiceID,
+				PlanID:           s.PlanID,
+				OrganizationGUID: s.OrganizationGUID,
+				SpaceGUID:        s.SpaceGUID,
+			},
+		},
+		Database: s.Database,
+		DbName:   s.DbName,
+		Username: s.Username,
+		DbType:   s.DbType,
+	}
+}
+
+// snapshotListing is how a snapshot is listed in the details of an instance.
+type snapshotListing struct {
+	Identifier string     `json:"identifier"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+func listSnapshots(snapshots []RDSSnapshot) []snapshotListing {
+	listings := []snapshotListing{}
+	for _, s := range snapshots {
+		listings = append(listings, snapshotListing{
+			Identifier: s.Identifier,
+			CreatedAt:  s.CreatedAt,
+			ExpiresAt:  s.ExpiresAt,
+		})
+	}
+	return listings
+}
@@ -0,0 +1,99 @@
+package rds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	SnapshotPurgeKind = "rds-snapshot-purge"
+)
+
+// SnapshotPurgeArgs are the arguments of the periodic job which deletes the
+// snapshots whose retention has passed.
+type SnapshotPurgeArgs struct{}
+
+func (SnapshotPurgeArgs) Kind() string { return SnapshotPurgeKind }
+
+// A failed job is not retried, as the job runs again on its schedule.
+func (SnapshotPurgeArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: reconcile.Queue, MaxAttempts: 1}
+}
+
+type SnapshotPurgeWorker struct {
+	river.WorkerDefaults[SnapshotPurgeArgs]
+	db       *gorm.DB
+	settings *config.Settings
+	rds      RDSClientInterface
+	logger   *slog.Logger
+}
+
+func NewSnapshotPurgeWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	rds RDSClientInterface,
+	logger *slog.Logger,
+) *SnapshotPurgeWorker {
+	return &SnapshotPurgeWorker{
+		db:       db,
+		settings: settings,
+		rds:      rds,
+		logger:   logger,
+	}
+}
+
+func (w *SnapshotPurgeWorker) Timeout(*river.Job[SnapshotPurgeArgs]) time.Duration {
+	return w.settings.RDSQueue.JobTimeout
+}
+
+// Work deletes every recorded snapshot which has expired, and its record.
+func (w *SnapshotPurgeWorker) Work(ctx context.Context, job *river.Job[SnapshotPurgeArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+
+	snapshots := []*RDSSnapshot{}
+	err := w.db.WithContext(ctx).Where("expires_at < ?", time.Now().UTC()).Find(&snapshots).Error
+	if err != nil {
+		return fmt.Errorf("could not list expired snapshots: %w", err)
+	}
+
+	var errs error
+	for _, snapshot := range snapshots {
+		if err := w.purgeSnapshot(ctx, snapshot); err != nil {
+			w.logger.Error("could not purge snapshot", "snapshot", snapshot.Identifier, "err", err)
+			errs = errors.Join(errs, fmt.Errorf("snapshot %s: %w", snapshot.Identifier, err))
+			continue
+		}
+		w.logger.Info("purged expired snapshot", "snapshot", snapshot.Identifier, "instance_id", snapshot.InstanceID)
+	}
+	return errs
+}
+
+func (w *SnapshotPurgeWorker) purgeSnapshot(ctx context.Context, snapshot *RDSSnapshot) error {
+	_, err := w.rds.DeleteDBSnapshot(ctx, &rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(snapshot.Identifier),
+	})
+	if err != nil {
+		var notFoundException *rdsTypes.DBSnapshotNotFoundFault
+		if !errors.As(err, &notFoundException) {
+			return fmt.Errorf("could not delete snapshot: %w", err)
+		}
+		w.logger.Debug(fmt.Sprintf("snapshot %s was already deleted, continuing", snapshot.Identifier))
+	}
+
+	if err := w.db.WithContext(ctx).Delete(snapshot).Error; err != nil {
+		return fmt.Errorf("could not delete snapshot record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package rds
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+)
+
+func TestSnapshotPurgeWorkerWork(t *testing.T) {
+	testCases := map[string]struct {
+		rdsClient         *mockRDSClient
+		expectErr         bool
+		expectedRemaining []string
+	}{
+		"purges expired snapshots": {
+			rdsClient:         &mockRDSClient{},
+			expectedRemaining: []string{"snapshot-current"},
+		},
+		"purges records of snapshots which were already deleted": {
+			rdsClient: &mockRDSClient{
+				deleteDBSnapshotErr: &rdsTypes.DBSnapshotNotFoundFault{},
+			},
+			expectedRemaining: []string{"snapshot-current"},
+		},
+		"keeps records of snapshots which could not be deleted": {
+			rdsClient: &mockRDSClient{
+				deleteDBSnapshotErr: errors.New("snapshot is in use"),
+			},
+			expectErr:         true,
+			expectedRemaining: []string{"snapshot-current", "snapshot-expired"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The test database is shared between tests, so remove the snapshots
+			// recorded by any previous test.
+			if err := brokerDB.Where("1 = 1").Delete(&RDSSnapshot{}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			expired := time.Now().UTC().Add(-time.Hour)
+			current := time.Now().UTC().Add(time.Hour)
+			for _, snapshot := range []*RDSSnapshot{
+				{Identifier: "snapshot-expired", ExpiresAt: &expired},
+				{Identifier: "snapshot-current", ExpiresAt: &current},
+			} {
+				if err := brokerDB.Create(snapshot).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			worker := NewSnapshotPurgeWorker(brokerDB, &config.Settings{}, test.rdsClient, slog.New(&testutil.MockLogHandler{}))
+			err = worker.Work(t.Context(), &river.Job[SnapshotPurgeArgs]{})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+
+			if len(test.rdsClient.deleteDBSnapshotInputs) != 1 || aws.ToString(test.rdsClient.deleteDBSnapshotInputs[0].DBSnapshotIdentifier) != "snapshot-expired" {
+				t.Errorf("expected only snapshot-expired to be deleted, got %+v", test.rdsClient.deleteDBSnapshotInputs)
+			}
+
+			remaining := []string{}
+			if err := brokerDB.Model(&RDSSnapshot{}).Order("identifier").Pluck("identifier", &remaining).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(remaining) != len(test.expectedRemaining) {
+				t.Fatalf("expected snapshots %v to remain, got %v", test.expectedRemaining, remaining)
+			}
+			for i := range remaining {
+				if remaining[i] != test.expectedRemaining[i] {
+					t.Errorf("expected snapshots %v to remain, got %v", test.expectedRemaining, remaining)
+				}
+			}
+		})
+	}
+}
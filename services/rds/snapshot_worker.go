@@ -0,0 +1,209 @@
+package rds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SnapshotKind = "rds-snapshot"
+)
+
+// SnapshotArgs are the arguments of the job which takes a snapshot of the
+// database of an instance on demand, as an update of the instance.
+type SnapshotArgs struct {
+	Instance    *RDSInstance `json:"instance"`
+	Snapshot    string       `json:"snapshot"`
+	OperationID string       `json:"operation_id"`
+}
+
+func (SnapshotArgs) Kind() string { return SnapshotKind }
+
+func (SnapshotArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a SnapshotArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.ModifyOp,
+		FailedState: base.InstanceNotModified,
+	}
+}
+
+type SnapshotWorker struct {
+	river.WorkerDefaults[SnapshotArgs]
+	db       *gorm.DB
+	settings *config.Settings
+	rds      RDSClientInterface
+	logger   *slog.Logger
+}
+
+func NewSnapshotWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	rds RDSClientInterface,
+	logger *slog.Logger,
+) *SnapshotWorker {
+	return &SnapshotWorker{
+		db:       db,
+		settings: settings,
+		rds:      rds,
+		logger:   logger,
+	}
+}
+
+func (w *SnapshotWorker) Timeout(*river.Job[SnapshotArgs]) time.Duration {
+	return w.settings.RDSQueue.JobTimeout
+}
+
+func (w *SnapshotWorker) Work(ctx context.Context, job *river.Job[SnapshotArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	return w.asyncSnapshotDB(ctx, job.Args.Instance, job.Args.Snapshot)
+}
+
+// asyncSnapshotDB takes a snapshot of the database tagged with the tags of the
+// instance, and updates the record of it once it is available. The record is
+// made when the snapshot is requested, and removed if it cannot be taken.
+// Snapshots taken on demand are kept until they are deleted by hand.
+//
+// The instance is marked in progress when the snapshot is requested, and is
+// returned to the state it had before once the job finishes either way.
+func (w *SnapshotWorker) asyncSnapshotDB(ctx context.Context, i *RDSInstance, snapshot string) error {
+	runner, err := steps.NewRunner(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:   i.ServiceID,
+		InstanceID:  i.Uuid,
+		Operation:   base.ModifyOp,
+		FailedState: base.InstanceNotModified,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("asyncSnapshotDB: %w", err)
+	}
+
+	snapshotSteps := []steps.Step{
+		{
+			Name:         "snapshot created",
+			Message:      fmt.Sprintf("Creating snapshot %s", snapshot),
+			ErrorMessage: "Error creating snapshot",
+			Run: func(ctx context.Context) error {
+				_, err := w.rds.CreateDBSnapshot(ctx, &rds.CreateDBSnapshotInput{
+					DBInstanceIdentifier: aws.String(i.Database),
+					DBSnapshotIdentifier: aws.String(snapshot),
+					Tags:                 ConvertTagsToRDSTags(i.getTags()),
+				})
+				var invalidDbInstanceStateErr *rdsTypes.InvalidDBInstanceStateFault
+				if errors.As(err, &invalidDbInstanceStateErr) {
+					// the database is being modified or backed up
+					return steps.Transient(err)
+				}
+				var alreadyExistsErr *rdsTypes.DBSnapshotAlreadyExistsFault
+				if errors.As(err, &alreadyExistsErr) {
+					// an earlier attempt of the job may have taken the snapshot
+					// before it was interrupted
+					return w.checkSnapshotOfDatabase(ctx, i, snapshot, err)
+				}
+				return err
+			},
+		},
+		{
+			Name:         "snapshot available",
+			Message:      fmt.Sprintf("Waiting for snapshot %s to be available", snapshot),
+			ErrorMessage: "Error waiting for snapshot to become available",
+			Run: func(ctx context.Context) error {
+				return w.waitForSnapshotAvailable(ctx, i, snapshot)
+			},
+		},
+		{
+			Name:         "snapshot recorded",
+			ErrorMessage: "Error recording snapshot",
+			Run: func(ctx context.Context) error {
+				return w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+					if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(newRDSSnapshot(snapshot, i, nil)).Error; err != nil {
+						return err
+					}
+					return restoreInstanceState(tx, i)
+				})
+			},
+		},
+	}
+
+	for _, step := range snapshotSteps {
+		if err := runner.Run(ctx, step); err != nil {
+			var cancelErr *river.JobCancelError
+			if errors.As(err, &cancelErr) {
+				w.releaseSnapshotName(ctx, snapshot)
+				w.restoreInstanceState(ctx, i)
+			}
+			return err
+		}
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceReady, fmt.Sprintf("Finished creating snapshot %s", snapshot))
+	runner.Finish(ctx)
+	return nil
+}
+
+func (w *SnapshotWorker) waitForSnapshotAvailable(ctx context.Context, i *RDSInstance, snapshot string) error {
+	w.logger.Debug(fmt.Sprintf("Waiting for DB snapshot %s to be available", snapshot))
+
+	waiter := rds.NewDBSnapshotAvailableWaiter(w.rds, func(o *rds.DBSnapshotAvailableWaiterOptions) {
+		o.MinDelay = w.settings.PollAwsMinDelay
+	})
+	maxWaitTime := getPollAwsMaxWaitTime(i.AllocatedStorage, w.settings.PollAwsMaxDuration)
+
+	return waiter.Wait(ctx, &rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(snapshot),
+	}, maxWaitTime)
+}
+
+// checkSnapshotOfDatabase returns nil if the existing snapshot was taken of the
+// database of the instance, and otherwise the error of creating it.
+func (w *SnapshotWorker) checkSnapshotOfDatabase(ctx context.Context, i *RDSInstance, snapshot string, createErr error) error {
+	resp, err := w.rds.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(snapshot),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: could not describe existing snapshot: %w", createErr, err)
+	}
+	if len(resp.DBSnapshots) == 0 || aws.ToString(resp.DBSnapshots[0].DBInstanceIdentifier) != i.Database {
+		return createErr
+	}
+	return nil
+}
+
+// releaseSnapshotName removes the record of a snapshot which could not be
+// taken, which was made when the snapshot was requested to reserve its name.
+func (w *SnapshotWorker) releaseSnapshotName(ctx context.Context, snapshot string) {
+	err := w.db.WithContext(context.WithoutCancel(ctx)).Where("identifier = ?", snapshot).Delete(&RDSSnapshot{}).Error
+	if err != nil {
+		w.logger.Error("asyncSnapshotDB: could not remove record of snapshot which could not be taken", "snapshot", snapshot, "err", err)
+	}
+}
+
+// restoreInstanceState returns the instance to the state it had when the
+// snapshot was requested, which is the state recorded in the job's arguments.
+func (w *SnapshotWorker) restoreInstanceState(ctx context.Context, i *RDSInstance) {
+	if err := restoreInstanceState(w.db.WithContext(context.WithoutCancel(ctx)), i); err != nil {
+		w.logger.Error("asyncSnapshotDB: could not restore state of instance", "instance_id", i.Uuid, "err", err)
+	}
+}
+
+func restoreInstanceState(db *gorm.DB, i *RDSInstance) error {
+	return db.Model(&RDSInstance{}).Where("uuid = ?", i.Uuid).Update("state", i.State).Error
+}
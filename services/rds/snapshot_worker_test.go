@@ -0,0 +1,153 @@
+package rds
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+)
+
+func TestSnapshotWorkerWork(t *testing.T) {
+	testCases := map[string]struct {
+		rdsClient      *mockRDSClient
+		expectErr      bool
+		expectRecorded bool
+		expectedState  base.InstanceState
+	}{
+		"success": {
+			rdsClient: &mockRDSClient{
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{Status: aws.String("available")}},
+				},
+			},
+			expectRecorded: true,
+			expectedState:  base.InstanceReady,
+		},
+		"error creating snapshot": {
+			rdsClient: &mockRDSClient{
+				createDBSnapshotErr: errors.New("quota exceeded"),
+			},
+			expectErr:     true,
+			expectedState: base.InstanceNotModified,
+		},
+		"snapshot taken by an earlier attempt": {
+			rdsClient: &mockRDSClient{
+				createDBSnapshotErr: &rdsTypes.DBSnapshotAlreadyExistsFault{},
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{DBInstanceIdentifier: aws.String("database-1"), Status: aws.String("available")}},
+				},
+			},
+			expectRecorded: true,
+			expectedState:  base.InstanceReady,
+		},
+		"snapshot name taken by another database": {
+			rdsClient: &mockRDSClient{
+				createDBSnapshotErr: &rdsTypes.DBSnapshotAlreadyExistsFault{},
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{DBInstanceIdentifier: aws.String("database-2"), Status: aws.String("available")}},
+				},
+			},
+			expectErr:     true,
+			expectedState: base.InstanceNotModified,
+		},
+		"snapshot failed": {
+			rdsClient: &mockRDSClient{
+				describeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: []rdsTypes.DBSnapshot{{Status: aws.String("failed")}},
+				},
+			},
+			expectErr:     true,
+			expectedState: base.InstanceNotModified,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			brokerDB, err := testDBInit()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instance := &RDSInstance{
+				Instance: base.Instance{
+					Uuid: helpers.RandStr(10),
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+						SpaceGUID: "space-1",
+					},
+				},
+				Database: "database-1",
+				Tags:     map[string]string{"Space GUID": "space-1"},
+			}
+			instance.State = base.InstanceReady
+			// the broker marks the instance in progress once the job is queued,
+			// after the instance is recorded in the job's arguments
+			inProgress := *instance
+			inProgress.State = base.InstanceInProgress
+			if err := brokerDB.Create(&inProgress).Error; err != nil {
+				t.Fatal(err)
+			}
+			snapshot := "db-pre-migration-" + instance.Uuid
+			// the broker records the snapshot when it is requested
+			if err := brokerDB.Create(newRDSSnapshot(snapshot, instance, nil)).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			settings := &config.Settings{
+				PollAwsMinDelay:    1 * time.Millisecond,
+				PollAwsMaxDuration: 1 * time.Millisecond,
+			}
+			worker := NewSnapshotWorker(brokerDB, settings, test.rdsClient, slog.New(&testutil.MockLogHandler{}))
+			err = worker.Work(t.Context(), &river.Job[SnapshotArgs]{Args: SnapshotArgs{
+				Instance: instance,
+				Snapshot: snapshot,
+			}})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+
+			input := test.rdsClient.createDBSnapshotInput
+			if aws.ToString(input.DBInstanceIdentifier) != instance.Database || aws.ToString(input.DBSnapshotIdentifier) != snapshot {
+				t.Errorf("expected snapshot %s of database %s, got %+v", snapshot, instance.Database, input)
+			}
+			if len(input.Tags) != 1 {
+				t.Errorf("expected snapshot to be tagged with the instance tags, got %+v", input.Tags)
+			}
+
+			var count int64
+			if err := brokerDB.Model(&RDSSnapshot{}).Where("identifier = ?", snapshot).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if test.expectRecorded != (count == 1) {
+				t.Errorf("expected snapshot to be recorded: %t, got %d records", test.expectRecorded, count)
+			}
+
+			saved := &RDSInstance{}
+			if err := brokerDB.Where("uuid = ?", instance.Uuid).First(saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.State != base.InstanceReady {
+				t.Errorf("expected instance state to be restored to %s, got %s", base.InstanceReady, saved.State)
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, instance.ServiceID, instance.Uuid, base.ModifyOp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if asyncJobMsg.JobState.State != test.expectedState {
+				t.Errorf("expected state %s, got %s: %s", test.expectedState, asyncJobMsg.JobState.State, asyncJobMsg.JobState.Message)
+			}
+		})
+	}
+}
@@ -1,8 +1,15 @@
 package rds
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/config"
 )
 
 func validateBinaryLogFormat(format string) error {
@@ -16,7 +23,7 @@ func validateBinaryLogFormat(format string) error {
 
 func validateStorageType(storageType string) error {
 	switch storageType {
-	case "", "gp3":
+	case "", "gp3", "io1", "io2":
 		return nil
 	default:
 		return fmt.Errorf("storage type is not supported: %s", storageType)
@@ -67,3 +74,153 @@ func validatePgQueryLogging(opts *PgQueryLoggingOptions) error {
 
 	return nil
 }
+
+func validateRestore(o Options) error {
+	if o.RestoreFromInstance != "" && o.RestoreFromSnapshot != "" {
+		return errors.New("only one of restore_from_instance and restore_from_snapshot can be set")
+	}
+	if o.RestoreTime != nil {
+		if o.RestoreFromInstance == "" {
+			return errors.New("restore_time can only be set with restore_from_instance")
+		}
+		if o.RestoreTime.After(time.Now()) {
+			return fmt.Errorf("restore_time must be in the past, got %s", o.RestoreTime.Format(time.RFC3339))
+		}
+	}
+	if o.isRestore() && o.Version != "" {
+		return errors.New("version cannot be set when restoring, as the database keeps the version of its backup")
+	}
+	return nil
+}
+
+// validateMaxAllocatedStorage checks the limit of storage autoscaling against
+// the settings. It is checked against the storage of the instance when the
+// options are applied to it. 0 turns storage autoscaling off.
+func validateMaxAllocatedStorage(o Options, settings *config.Settings) error {
+	if o.MaxAllocatedStorage == nil {
+		return nil
+	}
+	if *o.MaxAllocatedStorage < 0 || *o.MaxAllocatedStorage > settings.MaxAllocatedStorage {
+		return fmt.Errorf("invalid max_allocated_storage %d; must be between 0 and %d", *o.MaxAllocatedStorage, settings.MaxAllocatedStorage)
+	}
+	// RDS does not support storage autoscaling when restoring a snapshot
+	if o.RestoreFromSnapshot != "" && *o.MaxAllocatedStorage > 0 {
+		return errors.New("max_allocated_storage cannot be set when restoring from a snapshot; set it with update-service once the instance is created")
+	}
+	return nil
+}
+
+// Limits of the IOPS and throughput which can be provisioned for RDS storage.
+// See https://docs.aws.amazon.com/AmazonRDS/latest/UserGuide/CHAP_Storage.html
+const (
+	gp3MinIops       = 12000
+	gp3MaxIops       = 64000
+	gp3MinThroughput = 500
+	gp3MaxThroughput = 4000
+	// throughput in MiB/s per provisioned IOPS
+	gp3MaxThroughputPerIops = 0.25
+
+	ioMinStorage = 100
+	ioMinIops    = 1000
+	ioMaxIops    = 256000
+)
+
+// ioIopsPerGB are the limits of the IOPS provisioned per GB of io1 and io2
+// storage.
+var ioIopsPerGB = map[string]struct{ min, max float64 }{
+	"io1": {min: 1, max: 50},
+	"io2": {min: 0.5, max: 1000},
+}
+
+// gp3ProvisioningThreshold returns the storage in GB from which the IOPS and
+// throughput of gp3 storage can be provisioned. Below it, gp3 storage has a
+// fixed baseline.
+func gp3ProvisioningThreshold(dbType string) int64 {
+	if strings.HasPrefix(dbType, "oracle") {
+		return 200
+	}
+	return 400
+}
+
+// isProvisioned reports whether a value of provisioned IOPS or throughput is
+// set. 0 clears a value, returning the storage to the baseline of its type.
+func isProvisioned(v *int64) bool {
+	return v != nil && *v > 0
+}
+
+// validateProvisionedStorage checks the IOPS and throughput provisioned for
+// the storage of a database against the limits of its storage type and size.
+func validateProvisionedStorage(dbType string, storageType string, allocatedStorage int64, iops *int64, throughput *int64) error {
+	switch storageType {
+	case "gp3":
+		if !isProvisioned(iops) && !isProvisioned(throughput) {
+			return nil
+		}
+		threshold := gp3ProvisioningThreshold(dbType)
+		if allocatedStorage < threshold {
+			return fmt.Errorf("iops and storage_throughput can only be set for gp3 storage of at least %d GB for %s, got %d GB", threshold, dbType, allocatedStorage)
+		}
+		effectiveIops, effectiveThroughput := int64(gp3MinIops), int64(gp3MinThroughput)
+		if isProvisioned(iops) {
+			if *iops < gp3MinIops || *iops > gp3MaxIops {
+				return fmt.Errorf("invalid iops %d; must be between %d and %d for gp3 storage", *iops, gp3MinIops, gp3MaxIops)
+			}
+			effectiveIops = *iops
+		}
+		if isProvisioned(throughput) {
+			if *throughput < gp3MinThroughput || *throughput > gp3MaxThroughput {
+				return fmt.Errorf("invalid storage_throughput %d; must be between %d and %d for gp3 storage", *throughput, gp3MinThroughput, gp3MaxThroughput)
+			}
+			effectiveThroughput = *throughput
+		}
+		if float64(effectiveThroughput) > float64(effectiveIops)*gp3MaxThroughputPerIops {
+			return fmt.Errorf("invalid storage_throughput %d; must be at most %v MiB/s per IOPS, so <= %d for %d IOPS", effectiveThroughput, gp3MaxThroughputPerIops, int64(float64(effectiveIops)*gp3MaxThroughputPerIops), effectiveIops)
+		}
+		return nil
+	case "io1", "io2":
+		if allocatedStorage < ioMinStorage {
+			return fmt.Errorf("%s storage must be at least %d GB, got %d GB", storageType, ioMinStorage, allocatedStorage)
+		}
+		if isProvisioned(throughput) {
+			return fmt.Errorf("storage_throughput cannot be set for %s storage", storageType)
+		}
+		// io1 and io2 storage has no baseline, so its IOPS cannot be cleared
+		if !isProvisioned(iops) {
+			return fmt.Errorf("iops must be set for %s storage", storageType)
+		}
+		if *iops < ioMinIops || *iops > ioMaxIops {
+			return fmt.Errorf("invalid iops %d; must be between %d and %d for %s storage", *iops, ioMinIops, ioMaxIops, storageType)
+		}
+		ratio := ioIopsPerGB[storageType]
+		minIops := int64(math.Ceil(float64(allocatedStorage) * ratio.min))
+		maxIops := int64(float64(allocatedStorage) * ratio.max)
+		if *iops < minIops || *iops > maxIops {
+			return fmt.Errorf("invalid iops %d; must be between %v and %v IOPS per GB of %s storage, so between %d and %d for %d GB", *iops, ratio.min, ratio.max, storageType, minIops, maxIops, allocatedStorage)
+		}
+		return nil
+	default:
+		if isProvisioned(iops) || isProvisioned(throughput) {
+			return fmt.Errorf("iops and storage_throughput can only be set for gp3, io1 or io2 storage, got %q", storageType)
+		}
+		return nil
+	}
+}
+
+// Snapshot names are part of the snapshot identifier, so they follow the rules
+// for RDS identifiers: letters, digits and single hyphens, starting with a
+// letter.
+var snapshotNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*(-[a-zA-Z0-9]+)*$`)
+
+func validateSnapshotName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > 63 || !snapshotNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q; must be at most 63 letters, digits or hyphens, start with a letter, and not end with or contain two consecutive hyphens", name)
+	}
+	// final snapshots are named after the instance the same way
+	if name == "final" {
+		return errors.New("snapshot name final is reserved")
+	}
+	return nil
+}
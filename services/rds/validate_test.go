@@ -1,6 +1,7 @@
 package rds
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -53,9 +54,17 @@ func TestValidateStorageType(t *testing.T) {
 		expectedErr bool
 	}{
 		"invalid": {
-			storageType: "io1",
+			storageType: "standard",
 			expectedErr: true,
 		},
+		"io1": {
+			storageType: "io1",
+			expectedErr: false,
+		},
+		"io2": {
+			storageType: "io2",
+			expectedErr: false,
+		},
 		"empty": {
 			storageType: "",
 			expectedErr: false,
@@ -232,3 +241,211 @@ func TestValidateRetentionPeriod(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSnapshotName(t *testing.T) {
+	testCases := map[string]struct {
+		name        string
+		expectedErr bool
+	}{
+		"empty": {
+			name: "",
+		},
+		"valid": {
+			name: "pre-migration",
+		},
+		"starts with a digit": {
+			name:        "1-pre-migration",
+			expectedErr: true,
+		},
+		"consecutive hyphens": {
+			name:        "pre--migration",
+			expectedErr: true,
+		},
+		"ends with a hyphen": {
+			name:        "pre-migration-",
+			expectedErr: true,
+		},
+		"invalid characters": {
+			name:        "pre_migration",
+			expectedErr: true,
+		},
+		"too long": {
+			name:        "a" + strings.Repeat("b", 63),
+			expectedErr: true,
+		},
+		"reserved for final snapshots": {
+			name:        "final",
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := validateSnapshotName(test.name)
+			if test.expectedErr && err == nil {
+				t.Fatalf("expected error")
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestValidateProvisionedStorage(t *testing.T) {
+	testCases := map[string]struct {
+		dbType           string
+		storageType      string
+		allocatedStorage int64
+		iops             *int64
+		throughput       *int64
+		expectedErr      bool
+	}{
+		"nothing provisioned": {
+			dbType:           "postgres",
+			storageType:      "gp3",
+			allocatedStorage: 20,
+		},
+		"gp3": {
+			dbType:           "postgres",
+			storageType:      "gp3",
+			allocatedStorage: 400,
+			iops:             aws.Int64(16000),
+			throughput:       aws.Int64(1000),
+		},
+		"gp3 below the provisioning threshold": {
+			dbType:           "postgres",
+			storageType:      "gp3",
+			allocatedStorage: 300,
+			iops:             aws.Int64(16000),
+			expectedErr:      true,
+		},
+		"gp3 for oracle above its provisioning threshold": {
+			dbType:           "oracle-se2",
+			storageType:      "gp3",
+			allocatedStorage: 300,
+			iops:             aws.Int64(16000),
+		},
+		"gp3 iops below the minimum": {
+			dbType:           "mysql",
+			storageType:      "gp3",
+			allocatedStorage: 400,
+			iops:             aws.Int64(3000),
+			expectedErr:      true,
+		},
+		"gp3 throughput above the maximum": {
+			dbType:           "mysql",
+			storageType:      "gp3",
+			allocatedStorage: 400,
+			iops:             aws.Int64(64000),
+			throughput:       aws.Int64(5000),
+			expectedErr:      true,
+		},
+		"gp3 throughput too high for the baseline iops": {
+			dbType:           "mysql",
+			storageType:      "gp3",
+			allocatedStorage: 400,
+			throughput:       aws.Int64(4000),
+			expectedErr:      true,
+		},
+		"io1": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 100,
+			iops:             aws.Int64(5000),
+		},
+		"io1 iops above 50 per GB": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 100,
+			iops:             aws.Int64(6000),
+			expectedErr:      true,
+		},
+		"io1 iops below 1 per GB": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 2000,
+			iops:             aws.Int64(1500),
+			expectedErr:      true,
+		},
+		"io2 iops above 0.5 per GB": {
+			dbType:           "postgres",
+			storageType:      "io2",
+			allocatedStorage: 2000,
+			iops:             aws.Int64(1500),
+		},
+		"io1 without iops": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 100,
+			expectedErr:      true,
+		},
+		"io1 with cleared iops": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 100,
+			iops:             aws.Int64(0),
+			expectedErr:      true,
+		},
+		"io1 below the minimum storage": {
+			dbType:           "postgres",
+			storageType:      "io1",
+			allocatedStorage: 50,
+			iops:             aws.Int64(1000),
+			expectedErr:      true,
+		},
+		"gp3 with cleared iops and throughput": {
+			dbType:           "postgres",
+			storageType:      "gp3",
+			allocatedStorage: 20,
+			iops:             aws.Int64(0),
+			throughput:       aws.Int64(0),
+		},
+		"gp2 with cleared iops": {
+			dbType:           "postgres",
+			storageType:      "gp2",
+			allocatedStorage: 20,
+			iops:             aws.Int64(0),
+		},
+		"io2 iops above 50 per GB": {
+			dbType:           "postgres",
+			storageType:      "io2",
+			allocatedStorage: 100,
+			iops:             aws.Int64(50000),
+		},
+		"io2 iops below the minimum": {
+			dbType:           "postgres",
+			storageType:      "io2",
+			allocatedStorage: 100,
+			iops:             aws.Int64(500),
+			expectedErr:      true,
+		},
+		"io2 throughput": {
+			dbType:           "postgres",
+			storageType:      "io2",
+			allocatedStorage: 100,
+			iops:             aws.Int64(5000),
+			throughput:       aws.Int64(500),
+			expectedErr:      true,
+		},
+		"gp2": {
+			dbType:           "postgres",
+			storageType:      "gp2",
+			allocatedStorage: 400,
+			iops:             aws.Int64(12000),
+			expectedErr:      true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := validateProvisionedStorage(test.dbType, test.storageType, test.allocatedStorage, test.iops, test.throughput)
+			if test.expectedErr && err == nil {
+				t.Fatalf("expected error")
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
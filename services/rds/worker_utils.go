@@ -14,6 +14,7 @@ import (
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/metrics"
 	"gorm.io/gorm"
 )
 
@@ -41,10 +42,12 @@ func waitForDbReady(
 	waiterInput := &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: &database,
 	}
+	start := time.Now()
 	err := waiter.Wait(ctx, waiterInput, maxWaitTime)
+	metrics.ObserveWaitForDbReady(start, err)
 
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Failed waiting for database to become available: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Failed waiting for database to become available: %s", err))
 		return fmt.Errorf("waitForDbReady: %w", err)
 	}
 
@@ -122,29 +125,29 @@ func waitAndCreateDBReadReplica(
 ) error {
 	err := waitForDbReady(ctx, db, settings, rdsClient, logger, operation, i, i.Database)
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for database to become available: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for database to become available: %s", err))
 		return fmt.Errorf("waitAndCreateDBReadReplica, error waiting for database to be ready: %w", err)
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Creating database read replica")
+	asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Creating database read replica")
 
 	createReplicaOutput, err := createDBReadReplica(ctx, settings, rdsClient, logger, i, plan)
 	if err != nil {
 		logger.Error("waitAndCreateDBReadReplica: createDBReadReplica failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Creating database read replica failed: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Creating database read replica failed: %s", err))
 		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
 	}
 
 	err = waitForDbReady(ctx, db, settings, rdsClient, logger, operation, i, i.ReplicaDatabase)
 	if err != nil {
 		logger.Error("waitAndCreateDBReadReplica: waitForDbReady failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for replica database to become available: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error waiting for replica database to become available: %s", err))
 		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
 	}
 
 	err = updateDBTags(ctx, rdsClient, i, *createReplicaOutput.DBInstance.DBInstanceArn)
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error updating tags for database replica: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotCreated, fmt.Sprintf("Error updating tags for database replica: %s", err))
 		return fmt.Errorf("waitAndCreateDBReadReplica: %w", err)
 	}
 
@@ -177,7 +180,7 @@ func waitForDbDeleted(
 	err := waiter.Wait(ctx, waiterInput, maxWaitTime)
 
 	if err != nil {
-		asyncmessage.WriteAsyncJobMessageAndLogError(db, logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed waiting for database to be deleted: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(db.WithContext(ctx), logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Failed waiting for database to be deleted: %s", err))
 		return fmt.Errorf("waitForDbReady: %w", err)
 	}
 
@@ -194,7 +197,7 @@ func deleteDatabaseInstance(
 	operation base.Operation,
 	database string,
 ) error {
-	params := prepareDeleteDbInput(database)
+	params := prepareDeleteDbInput(database, "")
 	_, err := rdsClient.DeleteDBInstance(ctx, params)
 	if err != nil {
 		if isDatabaseInstanceNotFoundError(err) {
@@ -230,12 +233,19 @@ func deleteDatabaseReadReplica(
 	return nil
 }
 
-func prepareDeleteDbInput(database string) *rds.DeleteDBInstanceInput {
-	return &rds.DeleteDBInstanceInput{
+// prepareDeleteDbInput takes a final snapshot of the database if finalSnapshot
+// names one.
+func prepareDeleteDbInput(database string, finalSnapshot string) *rds.DeleteDBInstanceInput {
+	params := &rds.DeleteDBInstanceInput{
 		DBInstanceIdentifier:   aws.String(database), // Required
 		DeleteAutomatedBackups: aws.Bool(false),
 		SkipFinalSnapshot:      aws.Bool(true),
 	}
+	if finalSnapshot != "" {
+		params.SkipFinalSnapshot = aws.Bool(false)
+		params.FinalDBSnapshotIdentifier = aws.String(finalSnapshot)
+	}
+	return params
 }
 
 func isDatabaseInstanceNotFoundError(err error) bool {
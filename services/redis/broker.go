@@ -2,8 +2,8 @@ package redis
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -13,13 +13,13 @@ import (
 	"code.cloudfoundry.org/brokerapi/v13/domain/apiresponses"
 
 	brokertags "github.com/cloud-gov/go-broker-tags"
-	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 
 	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/catalog"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 )
 
 type RedisOptions struct {
@@ -47,7 +47,7 @@ func InitRedisBroker(
 	brokerDB *gorm.DB,
 	settings *config.Settings,
 	tagManager brokertags.TagManager,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 	logger *slog.Logger,
 ) (base.Broker, error) {
 	adapter, err := initializeAdapter(ctx, settings, brokerDB, logger, riverClient)
@@ -91,7 +91,7 @@ func (broker *redisBroker) parseOptionsFromRequest(
 	return options, nil
 }
 
-func (broker *redisBroker) CreateInstance(id string, details domain.ProvisionDetails) error {
+func (broker *redisBroker) CreateInstance(id string, operationID string, details domain.ProvisionDetails) error {
 	newInstance := RedisInstance{}
 
 	options, err := broker.parseOptionsFromRequest(details.RawParameters)
@@ -158,7 +158,7 @@ func (broker *redisBroker) CreateInstance(id string, details domain.ProvisionDet
 	}
 
 	// Create the redis instance.
-	status, err := broker.adapter.createRedis(&newInstance)
+	status, err := broker.adapter.createRedis(&newInstance, operationID)
 	if err != nil {
 		return apiresponses.NewFailureResponse(
 			err,
@@ -194,7 +194,7 @@ func (broker *redisBroker) CreateInstance(id string, details domain.ProvisionDet
 	}
 }
 
-func (broker *redisBroker) ModifyInstance(id string, details domain.UpdateDetails) error {
+func (broker *redisBroker) ModifyInstance(id string, operationID string, details domain.UpdateDetails) error {
 	existingInstance := &RedisInstance{}
 
 	// Load the existing instance provided.
@@ -244,7 +244,10 @@ func (broker *redisBroker) ModifyInstance(id string, details domain.UpdateDetail
 	}
 
 	// Modify the database instance.
-	status, err := broker.adapter.modifyRedis(modifiedInstance)
+	status, err := broker.adapter.modifyRedis(modifiedInstance, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 
 	switch status {
 	case base.InstanceNotModified:
@@ -276,17 +279,18 @@ func (broker *redisBroker) ModifyInstance(id string, details domain.UpdateDetail
 
 func (broker *redisBroker) LastOperation(id string, details domain.PollDetails) (domain.LastOperation, error) {
 	lastOperation := domain.LastOperation{}
+	operationData := base.ParseOperationData(details.OperationData)
 	existingInstance := RedisInstance{}
 
 	var count int64
 	broker.brokerDB.Where("uuid = ?", id).First(&existingInstance).Count(&count)
-	if count == 0 && details.OperationData != base.DeleteOp.String() {
+	if count == 0 && operationData.Operation != base.DeleteOp {
 		return lastOperation, apiresponses.ErrInstanceDoesNotExist
 	}
 
 	// When asynchronous deletion has finished, the instance record no longer exists, so
 	// return a last operation status indicating that the deletion was successful.
-	if count == 0 && details.OperationData == base.DeleteOp.String() {
+	if count == 0 && operationData.Operation == base.DeleteOp {
 		return domain.LastOperation{
 			State:       domain.Succeeded,
 			Description: "Successfully deleted instance",
@@ -298,11 +302,14 @@ func (broker *redisBroker) LastOperation(id string, details domain.PollDetails)
 	var instanceOperation base.Operation
 	var statusMessage string
 
-	switch details.OperationData {
-	case base.ModifyOp.String():
+	switch operationData.Operation {
+	case base.CreateOp:
+		needAsyncJobState = broker.AsyncOperationRequired(base.CreateOp)
+		instanceOperation = base.CreateOp
+	case base.ModifyOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.ModifyOp)
 		instanceOperation = base.ModifyOp
-	case base.DeleteOp.String():
+	case base.DeleteOp:
 		needAsyncJobState = broker.AsyncOperationRequired(base.DeleteOp)
 		instanceOperation = base.DeleteOp
 	default:
@@ -310,7 +317,7 @@ func (broker *redisBroker) LastOperation(id string, details domain.PollDetails)
 	}
 
 	if needAsyncJobState {
-		asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation)
+		asyncJobMsg, err := asyncmessage.GetAsyncJobMessage(broker.brokerDB, existingInstance.ServiceID, existingInstance.Uuid, instanceOperation, operationData.ID)
 		if err != nil {
 			return lastOperation, apiresponses.NewFailureResponse(
 				err,
@@ -340,7 +347,7 @@ func (broker *redisBroker) LastOperation(id string, details domain.PollDetails)
 	}, nil
 }
 
-func (broker *redisBroker) BindInstance(id string, details domain.BindDetails) (domain.Binding, error) {
+func (broker *redisBroker) BindInstance(id string, bindingID string, details domain.BindDetails) (domain.Binding, error) {
 	binding := domain.Binding{
 		OperationData: base.BindOp.String(),
 	}
@@ -352,7 +359,7 @@ func (broker *redisBroker) BindInstance(id string, details domain.BindDetails) (
 		return binding, apiresponses.ErrInstanceDoesNotExist
 	}
 
-	password, err := existingInstance.getPassword(broker.settings.EncryptionKey)
+	password, err := existingInstance.getPassword(broker.settings.Keyring())
 	if err != nil {
 		return binding, apiresponses.NewFailureResponse(
 			fmt.Errorf("unable to get instance password: %s", err),
@@ -388,7 +395,29 @@ func (broker *redisBroker) BindInstance(id string, details domain.BindDetails) (
 	return binding, nil
 }
 
-func (broker *redisBroker) DeleteInstance(id string) error {
+// UnbindInstance is a no-op since every binding to a Redis instance shares
+// the instance credentials.
+func (broker *redisBroker) UnbindInstance(id string, bindingID string, details domain.UnbindDetails) error {
+	return nil
+}
+
+func (broker *redisBroker) GetInstance(id string, details domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error) {
+	existingInstance := RedisInstance{}
+
+	var count int64
+	broker.brokerDB.Where("uuid = ?", id).First(&existingInstance).Count(&count)
+	if count == 0 {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceNotFound
+	}
+
+	return domain.GetInstanceDetailsSpec{
+		ServiceID:  existingInstance.ServiceID,
+		PlanID:     existingInstance.PlanID,
+		Parameters: existingInstance.getParameters(),
+	}, nil
+}
+
+func (broker *redisBroker) DeleteInstance(id string, operationID string) error {
 	existingInstance := RedisInstance{}
 	var count int64
 	broker.brokerDB.Where("uuid = ?", id).First(&existingInstance).Count(&count)
@@ -397,7 +426,10 @@ func (broker *redisBroker) DeleteInstance(id string) error {
 	}
 
 	// Delete the database instance.
-	status, err := broker.adapter.deleteRedis(&existingInstance)
+	status, err := broker.adapter.deleteRedis(&existingInstance, operationID)
+	if errors.Is(err, queue.ErrOperationInProgress) {
+		return apiresponses.ErrConcurrentInstanceAccess
+	}
 	if err != nil {
 		return apiresponses.NewFailureResponse(
 			fmt.Errorf("there was an error deleting the instance: %s", err),
@@ -180,7 +180,7 @@ func TestCreateInstance(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := test.redisBroker.CreateInstance(test.instance.Uuid, test.provisionDetails)
+			err := test.redisBroker.CreateInstance(test.instance.Uuid, uuid.NewString(), test.provisionDetails)
 			if err != nil {
 				if apiErr, ok := err.(*apiresponses.FailureResponse); ok {
 					responseCode := apiErr.ValidatedStatusCode(nil)
@@ -473,7 +473,7 @@ func TestModifyInstance(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = broker.ModifyInstance(test.redisInstance.Uuid, test.updateDetails)
+			err = broker.ModifyInstance(test.redisInstance.Uuid, uuid.NewString(), test.updateDetails)
 			if err != nil {
 				if apiErr, ok := err.(*apiresponses.FailureResponse); ok {
 					responseCode := apiErr.ValidatedStatusCode(nil)
@@ -543,7 +543,41 @@ func TestLastOperation(t *testing.T) {
 				Environment:   "test", // use the mock adapter
 			},
 			expectedState: base.InstanceReady,
-			adapter:       &mockRedisAdapter{},
+			asyncJobMsg: &asyncmessage.AsyncJobMsg{
+				JobType: base.CreateOp,
+				JobState: asyncmessage.AsyncJobState{
+					Message: "Finished creating Redis resources",
+					State:   base.InstanceReady,
+				},
+			},
+			adapter: &mockRedisAdapter{},
+		},
+		"create in progress": {
+			pollDetails: domain.PollDetails{
+				OperationData: base.CreateOp.String(),
+			},
+			instance: &RedisInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+			},
+			tagManager: &mocks.MockTagGenerator{},
+			settings: &config.Settings{
+				EncryptionKey: helpers.RandStr(32),
+				Environment:   "test", // use the mock adapter
+			},
+			expectedState: base.InstanceInProgress,
+			asyncJobMsg: &asyncmessage.AsyncJobMsg{
+				JobType: base.CreateOp,
+				JobState: asyncmessage.AsyncJobState{
+					Message: "Waiting for replication group to be available",
+					State:   base.InstanceInProgress,
+				},
+			},
+			adapter: &mockRedisAdapter{},
 		},
 		"modify successful": {
 			pollDetails: domain.PollDetails{
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	CreateKind = "redis-create"
+)
+
+type CreateArgs struct {
+	Instance    *RedisInstance `json:"instance"`
+	OperationID string         `json:"operation_id"`
+}
+
+func (CreateArgs) Kind() string { return CreateKind }
+
+func (CreateArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a CreateArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}
+}
+
+type CreateWorker struct {
+	river.WorkerDefaults[CreateArgs]
+	db          *gorm.DB
+	settings    *config.Settings
+	elasticache ElasticacheClientInterface
+	logger      *slog.Logger
+}
+
+func NewCreateWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	elasticache ElasticacheClientInterface,
+	logger *slog.Logger,
+) *CreateWorker {
+	return &CreateWorker{
+		db:          db,
+		settings:    settings,
+		elasticache: elasticache,
+		logger:      logger,
+	}
+}
+
+func (w *CreateWorker) Timeout(*river.Job[CreateArgs]) time.Duration {
+	return w.settings.RedisQueue.JobTimeout
+}
+
+func (w *CreateWorker) Work(ctx context.Context, job *river.Job[CreateArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	return w.asyncCreateRedis(ctx, job.Args.Instance)
+}
+
+func (w *CreateWorker) asyncCreateRedis(ctx context.Context, i *RedisInstance) error {
+	runner, err := steps.NewRunner(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:   i.ServiceID,
+		InstanceID:  i.Uuid,
+		Operation:   base.CreateOp,
+		FailedState: base.InstanceNotCreated,
+	}, i)
+	if err != nil {
+		return fmt.Errorf("asyncCreateRedis: %w", err)
+	}
+
+	createSteps := []steps.Step{
+		{
+			ErrorMessage: "Error getting password",
+			Run: func(ctx context.Context) error {
+				// The password is not serialized with the job arguments, so it is
+				// decrypted from the instance.
+				password, err := i.getPassword(w.settings.Keyring())
+				if err != nil {
+					return err
+				}
+				i.ClearPassword = password
+				return nil
+			},
+		},
+		{
+			Name:         "replication group created",
+			Message:      "Creating replication group",
+			ErrorMessage: "Error creating replication group",
+			Run: func(ctx context.Context) error {
+				params, err := prepareCreateReplicationGroupInput(i)
+				if err != nil {
+					return fmt.Errorf("error generating replication group creation params: %w", err)
+				}
+				_, err = w.elasticache.CreateReplicationGroup(ctx, params)
+				return err
+			},
+		},
+		{
+			Name:         "replication group available",
+			Message:      "Waiting for replication group to be available",
+			ErrorMessage: "Error waiting for replication group to become available",
+			Run: func(ctx context.Context) error {
+				waiter := elasticache.NewReplicationGroupAvailableWaiter(w.elasticache, func(o *elasticache.ReplicationGroupAvailableWaiterOptions) {
+					o.MinDelay = w.settings.PollAwsMinDelay
+				})
+				return waiter.Wait(ctx, &elasticache.DescribeReplicationGroupsInput{
+					ReplicationGroupId: &i.ClusterID,
+				}, w.settings.PollAwsMaxDuration)
+			},
+		},
+	}
+
+	for _, step := range createSteps {
+		if err := runner.Run(ctx, step); err != nil {
+			return err
+		}
+	}
+
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceReady, "Finished creating Redis resources")
+	runner.Finish(ctx)
+	return nil
+}
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"context"
+	"crypto/aes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	elasticacheTypes "github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/helpers"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/testutil"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func newTestCreateInstance(t *testing.T, settings *config.Settings) *RedisInstance {
+	i := &RedisInstance{
+		Instance: base.Instance{
+			Request: request.Request{
+				ServiceID: helpers.RandStr(10),
+			},
+			Uuid: helpers.RandStr(10),
+		},
+		ClusterID: helpers.RandStr(10),
+		Salt:      helpers.GenerateSalt(aes.BlockSize),
+	}
+	if err := i.setPassword(helpers.RandStr(10), settings.Keyring()); err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestCreateWorkerWork(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:      helpers.RandStr(32),
+		PollAwsMinDelay:    1 * time.Millisecond,
+		PollAwsMaxDuration: 10 * time.Millisecond,
+	}
+	worker := NewCreateWorker(
+		brokerDB,
+		settings,
+		&mockRedisClient{
+			describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{
+				{
+					ReplicationGroups: []elasticacheTypes.ReplicationGroup{
+						{
+							Status: aws.String("available"),
+						},
+					},
+				},
+			},
+		},
+		slog.New(&testutil.MockLogHandler{}),
+	)
+
+	err = worker.Work(t.Context(), &river.Job[CreateArgs]{Args: CreateArgs{
+		Instance: newTestCreateInstance(t, settings),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncCreateRedis(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &config.Settings{
+		EncryptionKey:      helpers.RandStr(32),
+		PollAwsMinDelay:    1 * time.Millisecond,
+		PollAwsMaxDuration: 10 * time.Millisecond,
+	}
+
+	testCases := map[string]struct {
+		ctx             context.Context
+		instance        *RedisInstance
+		redisClient     *mockRedisClient
+		expectedState   base.InstanceState
+		expectedMessage string
+	}{
+		"success": {
+			ctx:      t.Context(),
+			instance: newTestCreateInstance(t, settings),
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{
+					{
+						ReplicationGroups: []elasticacheTypes.ReplicationGroup{
+							{
+								Status: aws.String("creating"),
+							},
+						},
+					},
+					{
+						ReplicationGroups: []elasticacheTypes.ReplicationGroup{
+							{
+								Status: aws.String("available"),
+							},
+						},
+					},
+				},
+			},
+			expectedState:   base.InstanceReady,
+			expectedMessage: "Finished creating Redis resources",
+		},
+		"error getting password": {
+			ctx: t.Context(),
+			instance: &RedisInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+			},
+			redisClient:   &mockRedisClient{},
+			expectedState: base.InstanceNotCreated,
+		},
+		"error creating replication group": {
+			ctx:      t.Context(),
+			instance: newTestCreateInstance(t, settings),
+			redisClient: &mockRedisClient{
+				createReplicationGroupErr: errors.New("error creating replication group"),
+			},
+			expectedState: base.InstanceNotCreated,
+		},
+		"throttled replication group creation is retried": {
+			ctx:      asyncmessage.ContextWithJob(t.Context(), &rivertype.JobRow{ID: 1, Attempt: 1, MaxAttempts: 3}),
+			instance: newTestCreateInstance(t, settings),
+			redisClient: &mockRedisClient{
+				createReplicationGroupErr: &smithy.GenericAPIError{Code: "Throttling"},
+			},
+			expectedState:   base.InstanceInProgress,
+			expectedMessage: "Error creating replication group, retrying: api error Throttling: ",
+		},
+		"error waiting for replication group": {
+			ctx:      t.Context(),
+			instance: newTestCreateInstance(t, settings),
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsErrs: []error{
+					errors.New("error waiting for replication group"),
+				},
+			},
+			expectedState: base.InstanceNotCreated,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			worker := NewCreateWorker(brokerDB, settings, test.redisClient, slog.New(&testutil.MockLogHandler{}))
+			err := worker.asyncCreateRedis(test.ctx, test.instance)
+			if test.expectedState == base.InstanceReady && err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != base.InstanceReady && err == nil {
+				t.Fatal("expected error")
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, test.instance.ServiceID, test.instance.Uuid, base.CreateOp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedState != asyncJobMsg.JobState.State {
+				t.Fatalf("expected async job state: %s, got: %s", test.expectedState, asyncJobMsg.JobState.State)
+			}
+			if test.expectedMessage != "" && test.expectedMessage != asyncJobMsg.JobState.Message {
+				t.Errorf("expected async job message: %s, got: %s", test.expectedMessage, asyncJobMsg.JobState.Message)
+			}
+		})
+	}
+}
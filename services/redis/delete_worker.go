@@ -17,6 +17,8 @@ import (
 	brokerAws "github.com/cloud-gov/aws-broker/aws"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
@@ -26,11 +28,24 @@ const (
 )
 
 type DeleteArgs struct {
-	Instance *RedisInstance `json:"instance"`
+	Instance    *RedisInstance `json:"instance"`
+	OperationID string         `json:"operation_id"`
 }
 
 func (DeleteArgs) Kind() string { return DeleteKind }
 
+func (DeleteArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a DeleteArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.DeleteOp,
+		FailedState: base.InstanceNotGone,
+	}
+}
+
 type DeleteWorker struct {
 	river.WorkerDefaults[DeleteArgs]
 	db          *gorm.DB
@@ -56,28 +71,39 @@ func NewDeleteWorker(
 	}
 }
 
+func (w *DeleteWorker) Timeout(*river.Job[DeleteArgs]) time.Duration {
+	return w.settings.RedisQueue.JobTimeout
+}
+
 func (w *DeleteWorker) Work(ctx context.Context, job *river.Job[DeleteArgs]) error {
-	return w.asyncDeleteRedis(ctx, job.Args.Instance)
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	err := w.asyncDeleteRedis(ctx, job.Args.Instance)
+	return steps.RetryIfInterrupted(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:  job.Args.Instance.ServiceID,
+		InstanceID: job.Args.Instance.Uuid,
+		Operation:  base.DeleteOp,
+	}, err)
 }
 
 func (w *DeleteWorker) asyncDeleteRedis(ctx context.Context, i *RedisInstance) error {
 	operation := base.DeleteOp
 
-	asyncmessage.WriteAsyncJobMessage(w.db, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting replication group") //nolint:errcheck // decide fail-vs-log on async job-message write (job-state drift risk)
+	asyncmessage.WriteAsyncJobMessage(w.db.WithContext(ctx), i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Deleting replication group") //nolint:errcheck // decide fail-vs-log on async job-message write (job-state drift risk)
 
 	err := w.deleteReplicationGroup(ctx, i, operation)
 	if err != nil {
 		w.logger.Error("asyncDeleteRedis: DdleteReplicationGroup failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: deleteReplicationGroup failed: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: deleteReplicationGroup failed: %s", err))
 		return river.JobCancel(fmt.Errorf("asyncModifyRedis: error deleting replication group %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessage(w.db, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Exporting snapshot") //nolint:errcheck // decide fail-vs-log on async job-message write (job-state drift risk)
+	asyncmessage.WriteAsyncJobMessage(w.db.WithContext(ctx), i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Exporting snapshot") //nolint:errcheck // decide fail-vs-log on async job-message write (job-state drift risk)
 
 	err = w.exportRedisSnapshot(ctx, i)
 	if err != nil {
 		w.logger.Error("asyncDeleteRedis: exportRedisSnapshot failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: exportRedisSnapshot failed: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: exportRedisSnapshot failed: %s", err))
 		return river.JobCancel(fmt.Errorf("asyncModifyRedis: error exporting snapshot %w ", err))
 	}
 
@@ -87,7 +113,7 @@ func (w *DeleteWorker) asyncDeleteRedis(ctx context.Context, i *RedisInstance) e
 		return river.JobCancel(fmt.Errorf("asyncModifyRedis: deleting record %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Finished deleting replication group")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceGone, "Finished deleting replication group")
 	return nil
 }
 
@@ -105,7 +131,7 @@ func (w *DeleteWorker) deleteReplicationGroup(ctx context.Context, i *RedisInsta
 			return nil
 		}
 		w.logger.Error("asyncDeleteRedis: DeleteReplicationGroup failed", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: DeleteReplicationGroup failed: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("asyncDeleteRedis: DeleteReplicationGroup failed: %s", err))
 		return err
 	}
 
@@ -119,7 +145,7 @@ func (w *DeleteWorker) deleteReplicationGroup(ctx context.Context, i *RedisInsta
 	err = waiter.Wait(ctx, waiterInput, w.settings.PollAwsMaxDuration)
 	if err != nil {
 		w.logger.Error("error waiting for cluster to be deleted", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Error waiting for cluster to be deleted: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotGone, fmt.Sprintf("Error waiting for cluster to be deleted: %s", err))
 		return err
 	}
 
@@ -168,9 +194,9 @@ func (w *DeleteWorker) exportRedisSnapshot(ctx context.Context, i *RedisInstance
 	// write instance to manifest
 	// marshall instance to bytes.
 	// #nosec G117 -- Password is the AES-encrypted ciphertext (plaintext lives
-	// only in the unpersisted ClearPassword). Marshaled into required restore
-	// metadata written to the broker's private, SSE-AES256 snapshots bucket;
-	// never logged or returned to clients.
+	// only in ClearPassword, which is neither persisted nor marshaled).
+	// Marshaled into required restore metadata written to the broker's private,
+	// SSE-AES256 snapshots bucket; never logged or returned to clients.
 	data, err := json.Marshal(i)
 	if err != nil {
 		return err
@@ -13,6 +13,8 @@ import (
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
 	"github.com/cloud-gov/aws-broker/db"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/cloud-gov/aws-broker/testutil"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
@@ -24,7 +26,7 @@ func testDBInit() (*gorm.DB, error) {
 		return nil, err
 	}
 	// Automigrate!
-	err = db.AutoMigrate(&RedisInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{})
+	err = db.AutoMigrate(&RedisInstance{}, &base.Instance{}, &asyncmessage.AsyncJobMsg{}, &asyncmessage.OperationLogEntry{}, &steps.Checkpoint{})
 	return db, err
 }
 
@@ -38,6 +40,7 @@ func NewTestDedicatedRedisAdapter(
 	logger := slog.New(&testutil.MockLogHandler{})
 
 	workers := river.NewWorkers()
+	river.AddWorker(workers, NewCreateWorker(brokerDB, s, elasticache, logger))
 	river.AddWorker(workers, NewModifyWorker(brokerDB, s, elasticache, logger))
 	river.AddWorker(workers, NewDeleteWorker(brokerDB, s, elasticache, s3, logger))
 
@@ -52,10 +55,11 @@ func NewTestDedicatedRedisAdapter(
 		log.Fatal(fmt.Errorf("error creating river client: %w", err))
 	}
 
-	return NewRedisDedicatedDBAdapter(ctx, s, brokerDB, elasticache, logger, riverClient)
+	return NewRedisDedicatedDBAdapter(ctx, s, brokerDB, elasticache, logger, queue.NewRiverClient(riverClient))
 }
 
 type mockRedisClient struct {
+	createReplicationGroupErr        error
 	modifyReplicationGroupErr        error
 	increaseReplicaCountErr          error
 	describeReplicationGroupsErrs    []error
@@ -67,6 +71,14 @@ type mockRedisClient struct {
 	deleteReplicationGroupErr        error
 	copySnapshotErr                  error
 	deleteSnapshotErr                error
+	addTagsToResourceInputs          []*elasticache.AddTagsToResourceInput
+	addTagsToResourceErr             error
+	listTagsForResourceOutput        *elasticache.ListTagsForResourceOutput
+}
+
+func (m *mockRedisClient) AddTagsToResource(ctx context.Context, params *elasticache.AddTagsToResourceInput, optFns ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error) {
+	m.addTagsToResourceInputs = append(m.addTagsToResourceInputs, params)
+	return nil, m.addTagsToResourceErr
 }
 
 func (m *mockRedisClient) CopySnapshot(ctx context.Context, params *elasticache.CopySnapshotInput, optFns ...func(*elasticache.Options)) (*elasticache.CopySnapshotOutput, error) {
@@ -74,7 +86,7 @@ func (m *mockRedisClient) CopySnapshot(ctx context.Context, params *elasticache.
 }
 
 func (m *mockRedisClient) CreateReplicationGroup(ctx context.Context, params *elasticache.CreateReplicationGroupInput, optFns ...func(*elasticache.Options)) (*elasticache.CreateReplicationGroupOutput, error) {
-	return nil, nil
+	return nil, m.createReplicationGroupErr
 }
 
 func (m *mockRedisClient) DeleteReplicationGroup(ctx context.Context, params *elasticache.DeleteReplicationGroupInput, optFns ...func(*elasticache.Options)) (*elasticache.DeleteReplicationGroupOutput, error) {
@@ -103,6 +115,13 @@ func (m *mockRedisClient) DescribeSnapshots(ctx context.Context, params *elastic
 	return output, nil
 }
 
+func (m *mockRedisClient) ListTagsForResource(ctx context.Context, params *elasticache.ListTagsForResourceInput, optFns ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error) {
+	if m.listTagsForResourceOutput != nil {
+		return m.listTagsForResourceOutput, nil
+	}
+	return &elasticache.ListTagsForResourceOutput{}, nil
+}
+
 func (m *mockRedisClient) IncreaseReplicaCount(ctx context.Context, params *elasticache.IncreaseReplicaCountInput, optFns ...func(*elasticache.Options)) (*elasticache.IncreaseReplicaCountOutput, error) {
 	return nil, m.increaseReplicaCountErr
 }
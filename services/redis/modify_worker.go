@@ -13,6 +13,8 @@ import (
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/common"
 	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
+	"github.com/cloud-gov/aws-broker/jobs/steps"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 )
@@ -22,11 +24,24 @@ const (
 )
 
 type ModifyArgs struct {
-	Instance *RedisInstance `json:"instance"`
+	Instance    *RedisInstance `json:"instance"`
+	OperationID string         `json:"operation_id"`
 }
 
 func (ModifyArgs) Kind() string { return ModifyKind }
 
+func (ModifyArgs) InsertOpts() river.InsertOpts { return river.InsertOpts{Queue: Queue} }
+
+func (a ModifyArgs) JobInstance() queue.JobInstance {
+	return queue.JobInstance{
+		ServiceID:   a.Instance.ServiceID,
+		InstanceID:  a.Instance.Uuid,
+		OperationID: a.OperationID,
+		Operation:   base.ModifyOp,
+		FailedState: base.InstanceNotModified,
+	}
+}
+
 type ModifyWorker struct {
 	river.WorkerDefaults[ModifyArgs]
 	db          *gorm.DB
@@ -49,8 +64,19 @@ func NewModifyWorker(
 	}
 }
 
+func (w *ModifyWorker) Timeout(*river.Job[ModifyArgs]) time.Duration {
+	return w.settings.RedisQueue.JobTimeout
+}
+
 func (w *ModifyWorker) Work(ctx context.Context, job *river.Job[ModifyArgs]) error {
-	return w.asyncModifyRedis(ctx, job.Args.Instance)
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	ctx = asyncmessage.ContextWithOperationID(ctx, job.Args.OperationID)
+	err := w.asyncModifyRedis(ctx, job.Args.Instance)
+	return steps.RetryIfInterrupted(ctx, w.db, w.logger, steps.Operation{
+		ServiceID:  job.Args.Instance.ServiceID,
+		InstanceID: job.Args.Instance.Uuid,
+		Operation:  base.ModifyOp,
+	}, err)
 }
 
 func (w *ModifyWorker) asyncModifyRedis(ctx context.Context, i *RedisInstance) error {
@@ -59,7 +85,7 @@ func (w *ModifyWorker) asyncModifyRedis(ctx context.Context, i *RedisInstance) e
 	params, err := prepareModifyReplicationGroupInput(i)
 	if err != nil {
 		w.logger.Error("error preparing modify replication group input", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error preparing modify input: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error preparing modify input: %s", err))
 		return river.JobCancel(fmt.Errorf("asyncModifyRedis: error preparing modify input %w ", err))
 	}
 
@@ -67,26 +93,26 @@ func (w *ModifyWorker) asyncModifyRedis(ctx context.Context, i *RedisInstance) e
 		err = w.increaseReplicaCount(ctx, i, operation)
 		if err != nil {
 			w.logger.Error("error increasing replica count", "err", err)
-			asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("error increasing replica count: %s", err))
+			asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("error increasing replica count: %s", err))
 			return river.JobCancel(fmt.Errorf("asyncModifyRedis: error increasing replica count %w ", err))
 		}
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Modifying replication group")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Modifying replication group")
 
 	_, err = w.elasticache.ModifyReplicationGroup(ctx, params)
 	if err != nil {
 		w.logger.Error("error modifying replication group", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error modifying cluster: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error modifying cluster: %s", err))
 		return river.JobCancel(fmt.Errorf("asyncModifyRedis: error modifying replication group %w ", err))
 	}
 
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceReady, "Finished modifying cluster")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceReady, "Finished modifying cluster")
 	return nil
 }
 
 func (w *ModifyWorker) increaseReplicaCount(ctx context.Context, i *RedisInstance, operation base.Operation) error {
-	asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Adding new replica nodes")
+	asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceInProgress, "Adding new replica nodes")
 
 	newReplicaCount, err := common.ConvertIntToInt32Safely(i.NewReplicaCount)
 	if err != nil {
@@ -100,7 +126,7 @@ func (w *ModifyWorker) increaseReplicaCount(ctx context.Context, i *RedisInstanc
 	})
 	if err != nil {
 		w.logger.Error("error increasing replica count", "err", err)
-		asyncmessage.WriteAsyncJobMessageAndLogError(w.db, w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error increasing replica count: %s", err))
+		asyncmessage.WriteAsyncJobMessageAndLogError(w.db.WithContext(ctx), w.logger, i.ServiceID, i.Uuid, operation, base.InstanceNotModified, fmt.Sprintf("Error increasing replica count: %s", err))
 		return err
 	}
 
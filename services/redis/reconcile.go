@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"gorm.io/gorm"
+)
+
+// ReconcileResourceTags applies the tags generated for the instance to its
+// replication group, reporting whether it was missing any of them. Replication
+// groups which do not exist are skipped.
+func ReconcileResourceTags(
+	ctx context.Context,
+	i *RedisInstance,
+	catalog *catalog.Catalog,
+	elasticacheClient ElasticacheClientInterface,
+	tagManager brokertags.TagManager,
+) (bool, error) {
+	resp, err := elasticacheClient.DescribeReplicationGroups(ctx, &elasticache.DescribeReplicationGroupsInput{
+		ReplicationGroupId: aws.String(i.ClusterID),
+	})
+	if err != nil {
+		var notFoundException *types.ReplicationGroupNotFoundFault
+		if errors.As(err, &notFoundException) {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not describe replication group: %w", err)
+	}
+	if len(resp.ReplicationGroups) == 0 {
+		return false, nil
+	}
+	arn := resp.ReplicationGroups[0].ARN
+
+	plan, err := catalog.RedisService.FetchPlan(i.PlanID)
+	if err != nil {
+		return false, fmt.Errorf("could not find plan %s: %w", i.PlanID, err)
+	}
+	tags, err := i.ReconcileTags(tagManager, catalog.RedisService.Name, plan.Name)
+	if err != nil {
+		return false, fmt.Errorf("could not generate tags: %w", err)
+	}
+
+	existing, err := elasticacheClient.ListTagsForResource(ctx, &elasticache.ListTagsForResourceInput{
+		ResourceName: arn,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not list tags: %w", err)
+	}
+	existingTags := map[string]string{}
+	for _, tag := range existing.TagList {
+		existingTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if base.HasTags(existingTags, tags) {
+		return false, nil
+	}
+
+	_, err = elasticacheClient.AddTagsToResource(ctx, &elasticache.AddTagsToResourceInput{
+		ResourceName: arn,
+		Tags:         ConvertTagsToElasticacheTags(tags),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not add tags: %w", err)
+	}
+	return true, nil
+}
+
+// ReconcileElasticacheResourceTags applies the tags generated for every
+// instance to its replication group.
+func ReconcileElasticacheResourceTags(
+	ctx context.Context,
+	catalog *catalog.Catalog,
+	db *gorm.DB,
+	elasticacheClient ElasticacheClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) error {
+	instances := []*RedisInstance{}
+	if err := db.WithContext(ctx).Find(&instances).Error; err != nil {
+		return fmt.Errorf("could not list Redis instances: %w", err)
+	}
+
+	var errs error
+	for _, i := range instances {
+		tagged, err := ReconcileResourceTags(ctx, i, catalog, elasticacheClient, tagManager)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("replication group %s: %w", i.ClusterID, err))
+			continue
+		}
+		if tagged {
+			logger.Info("updated tags", "cluster_id", i.ClusterID)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/brokerapi/v13/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/helpers/request"
+	"github.com/cloud-gov/aws-broker/mocks"
+)
+
+func TestReconcileResourceTags(t *testing.T) {
+	testCatalog := &catalog.Catalog{
+		RedisService: catalog.RedisService{
+			Service: catalog.Service{Name: "aws-elasticache-redis"},
+			RedisPlans: []catalog.RedisPlan{
+				{ServicePlan: domain.ServicePlan{ID: "plan-1", Name: "redis-dev"}},
+			},
+		},
+	}
+	tagManager := &mocks.MockTagGenerator{Tags: map[string]string{"Space GUID": "space-1"}}
+	replicationGroup := &elasticache.DescribeReplicationGroupsOutput{
+		ReplicationGroups: []types.ReplicationGroup{{ARN: aws.String("cluster-arn")}},
+	}
+
+	testCases := map[string]struct {
+		redisClient   *mockRedisClient
+		planID        string
+		expectErr     bool
+		expectTagged  bool
+		expectedAdded int
+	}{
+		"applies missing tags": {
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{replicationGroup},
+			},
+			planID:        "plan-1",
+			expectTagged:  true,
+			expectedAdded: 1,
+		},
+		"leaves tags which are up to date": {
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{replicationGroup},
+				listTagsForResourceOutput: &elasticache.ListTagsForResourceOutput{
+					TagList: []types.Tag{{Key: aws.String("Space GUID"), Value: aws.String("space-1")}},
+				},
+			},
+			planID: "plan-1",
+		},
+		"skips replication groups which do not exist": {
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsErrs: []error{&types.ReplicationGroupNotFoundFault{}},
+			},
+			planID: "plan-1",
+		},
+		"unknown plan": {
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{replicationGroup},
+			},
+			planID:    "unknown",
+			expectErr: true,
+		},
+		"error adding tags": {
+			redisClient: &mockRedisClient{
+				describeReplicationGroupsResults: []*elasticache.DescribeReplicationGroupsOutput{replicationGroup},
+				addTagsToResourceErr:             errors.New("access denied"),
+			},
+			planID:        "plan-1",
+			expectErr:     true,
+			expectedAdded: 1,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			instance := &RedisInstance{
+				Instance: base.Instance{
+					Request: request.Request{PlanID: test.planID},
+				},
+				ClusterID: "cluster-1",
+			}
+
+			tagged, err := ReconcileResourceTags(t.Context(), instance, testCatalog, test.redisClient, tagManager)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.expectErr, err)
+			}
+			if test.expectTagged != tagged {
+				t.Errorf("expected tagged: %t, got: %t", test.expectTagged, tagged)
+			}
+			if len(test.redisClient.addTagsToResourceInputs) != test.expectedAdded {
+				t.Errorf("expected %d calls to add tags, got %d", test.expectedAdded, len(test.redisClient.addTagsToResourceInputs))
+			}
+		})
+	}
+}
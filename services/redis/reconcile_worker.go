@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cloud-gov/aws-broker/asyncmessage"
+	"github.com/cloud-gov/aws-broker/base"
+	"github.com/cloud-gov/aws-broker/catalog"
+	"github.com/cloud-gov/aws-broker/config"
+	"github.com/cloud-gov/aws-broker/jobs/reconcile"
+	brokertags "github.com/cloud-gov/go-broker-tags"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const (
+	ReconcileKind = "elasticache-reconcile"
+)
+
+// ReconcileArgs are the arguments of the periodic job which brings the
+// ElastiCache resources of every instance in line with the broker's records.
+type ReconcileArgs struct{}
+
+func (ReconcileArgs) Kind() string { return ReconcileKind }
+
+// A failed job is not retried, as the job runs again on its schedule.
+func (ReconcileArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: reconcile.Queue, MaxAttempts: 1}
+}
+
+type ReconcileWorker struct {
+	river.WorkerDefaults[ReconcileArgs]
+	db          *gorm.DB
+	settings    *config.Settings
+	catalog     *catalog.Catalog
+	elasticache ElasticacheClientInterface
+	tagManager  brokertags.TagManager
+	logger      *slog.Logger
+}
+
+func NewReconcileWorker(
+	db *gorm.DB,
+	settings *config.Settings,
+	catalog *catalog.Catalog,
+	elasticache ElasticacheClientInterface,
+	tagManager brokertags.TagManager,
+	logger *slog.Logger,
+) *ReconcileWorker {
+	return &ReconcileWorker{
+		db:          db,
+		settings:    settings,
+		catalog:     catalog,
+		elasticache: elasticache,
+		tagManager:  tagManager,
+		logger:      logger,
+	}
+}
+
+func (w *ReconcileWorker) Timeout(*river.Job[ReconcileArgs]) time.Duration {
+	return w.settings.RedisQueue.JobTimeout
+}
+
+// Work applies the tags generated for every instance to its replication group.
+func (w *ReconcileWorker) Work(ctx context.Context, job *river.Job[ReconcileArgs]) error {
+	ctx = asyncmessage.ContextWithJob(ctx, job.JobRow)
+	instance := func(i *RedisInstance) *base.Instance { return &i.Instance }
+	return reconcile.Instances(ctx, w.db, w.logger, "ElastiCache", instance, w.reconcileInstance)
+}
+
+// reconcileInstance returns a description of each change made to the instance.
+func (w *ReconcileWorker) reconcileInstance(ctx context.Context, i *RedisInstance) ([]string, error) {
+	tagged, err := ReconcileResourceTags(ctx, i, w.catalog, w.elasticache, w.tagManager)
+	if err != nil || !tagged {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("updated tags of replication group %s", i.ClusterID)}, nil
+}
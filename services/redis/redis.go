@@ -12,7 +12,7 @@ import (
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/common"
 	"github.com/cloud-gov/aws-broker/config"
-	"github.com/riverqueue/river"
+	"github.com/cloud-gov/aws-broker/jobs/queue"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
@@ -22,11 +22,11 @@ import (
 )
 
 type redisAdapter interface {
-	createRedis(i *RedisInstance) (base.InstanceState, error)
-	modifyRedis(i *RedisInstance) (base.InstanceState, error)
+	createRedis(i *RedisInstance, operationID string) (base.InstanceState, error)
+	modifyRedis(i *RedisInstance, operationID string) (base.InstanceState, error)
 	checkRedisStatus(i *RedisInstance) (base.InstanceState, error)
 	bindRedisToApp(i *RedisInstance, password string) (map[string]string, error)
-	deleteRedis(i *RedisInstance) (base.InstanceState, error)
+	deleteRedis(i *RedisInstance, operationID string) (base.InstanceState, error)
 }
 
 // initializeAdapter is the main function to create database instances
@@ -35,7 +35,7 @@ func initializeAdapter(
 	s *config.Settings,
 	db *gorm.DB,
 	logger *slog.Logger,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 ) (redisAdapter, error) {
 	var redisAdapter redisAdapter
 
@@ -64,7 +64,7 @@ func NewRedisDedicatedDBAdapter(
 	db *gorm.DB,
 	elasticache ElasticacheClientInterface,
 	logger *slog.Logger,
-	riverClient *river.Client[*sql.Tx],
+	riverClient queue.Client,
 ) *dedicatedRedisAdapter {
 	return &dedicatedRedisAdapter{
 		ctx:         ctx,
@@ -79,11 +79,11 @@ func NewRedisDedicatedDBAdapter(
 type mockRedisAdapter struct {
 }
 
-func (d *mockRedisAdapter) createRedis(i *RedisInstance) (base.InstanceState, error) {
+func (d *mockRedisAdapter) createRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
-func (d *mockRedisAdapter) modifyRedis(i *RedisInstance) (base.InstanceState, error) {
+func (d *mockRedisAdapter) modifyRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
@@ -95,7 +95,7 @@ func (d *mockRedisAdapter) bindRedisToApp(i *RedisInstance, password string) (ma
 	return i.getCredentials(password)
 }
 
-func (d *mockRedisAdapter) deleteRedis(i *RedisInstance) (base.InstanceState, error) {
+func (d *mockRedisAdapter) deleteRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
 	return base.InstanceInProgress, nil
 }
 
@@ -105,31 +105,45 @@ type dedicatedRedisAdapter struct {
 	logger      *slog.Logger
 	elasticache ElasticacheClientInterface
 	db          *gorm.DB
-	riverClient *river.Client[*sql.Tx]
+	riverClient queue.Client
 }
 
 // This is the prefix for all pgroups created by the broker.
 const PgroupPrefix = "cg-redis-broker-"
 
-func (d *dedicatedRedisAdapter) createRedis(i *RedisInstance) (base.InstanceState, error) {
-	// Standard parameters
-	params, err := prepareCreateReplicationGroupInput(i)
+func (d *dedicatedRedisAdapter) createRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.CreateOp, base.InstanceInProgress, "Creation in progress")
 	if err != nil {
-		d.logger.Error("prepareCreateReplicationGroupInput", "err", err)
 		return base.InstanceNotCreated, err
 	}
 
-	_, err = d.elasticache.CreateReplicationGroup(d.ctx, params)
+	tx := d.db.Begin()
+	if err := tx.Error; err != nil {
+		return base.InstanceNotCreated, err
+	}
+	defer tx.Rollback()
+
+	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+
+	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &CreateArgs{
+		Instance:    i,
+		OperationID: operationID,
+	}, nil)
 	if err != nil {
-		d.logger.Error("CreateReplicationGroup", "err", err)
+		return base.InstanceNotCreated, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		return base.InstanceNotCreated, err
 	}
 
 	return base.InstanceInProgress, nil
 }
 
-func (d *dedicatedRedisAdapter) modifyRedis(i *RedisInstance) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Modification in progress")
+func (d *dedicatedRedisAdapter) modifyRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.ModifyOp, base.InstanceInProgress, "Modification in progress")
 	if err != nil {
 		return base.InstanceNotModified, err
 	}
@@ -143,7 +157,8 @@ func (d *dedicatedRedisAdapter) modifyRedis(i *RedisInstance) (base.InstanceStat
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &ModifyArgs{
-		Instance: i,
+		Instance:    i,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotModified, err
@@ -239,8 +254,9 @@ func (d *dedicatedRedisAdapter) bindRedisToApp(i *RedisInstance, password string
 	return i.getCredentials(password)
 }
 
-func (d *dedicatedRedisAdapter) deleteRedis(i *RedisInstance) (base.InstanceState, error) {
-	err := asyncmessage.WriteAsyncJobMessage(d.db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deletion in progress")
+func (d *dedicatedRedisAdapter) deleteRedis(i *RedisInstance, operationID string) (base.InstanceState, error) {
+	db := d.db.WithContext(asyncmessage.ContextWithOperationID(d.ctx, operationID))
+	err := asyncmessage.WriteAsyncJobMessage(db, i.ServiceID, i.Uuid, base.DeleteOp, base.InstanceInProgress, "Deletion in progress")
 	if err != nil {
 		return base.InstanceNotGone, err
 	}
@@ -254,7 +270,8 @@ func (d *dedicatedRedisAdapter) deleteRedis(i *RedisInstance) (base.InstanceStat
 	sqlTx := tx.Statement.ConnPool.(*sql.Tx)
 
 	_, err = d.riverClient.InsertTx(d.ctx, sqlTx, &DeleteArgs{
-		Instance: i,
+		Instance:    i,
+		OperationID: operationID,
 	}, nil)
 	if err != nil {
 		return base.InstanceNotGone, err
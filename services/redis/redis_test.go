@@ -10,12 +10,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/elasticache"
 	elasticacheTypes "github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/cloud-gov/aws-broker/asyncmessage"
 	"github.com/cloud-gov/aws-broker/base"
 	"github.com/cloud-gov/aws-broker/config"
 	"github.com/cloud-gov/aws-broker/helpers"
 	"github.com/cloud-gov/aws-broker/helpers/request"
 	"github.com/cloud-gov/aws-broker/testutil"
 	"github.com/go-test/deep"
+	"github.com/google/uuid"
 )
 
 func TestPrepareCreateReplicationGroupInput(t *testing.T) {
@@ -130,6 +132,86 @@ func TestPrepareCreateReplicationGroupInput(t *testing.T) {
 	}
 }
 
+func TestCreateRedis(t *testing.T) {
+	brokerDB, err := testDBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		ctx           context.Context
+		instance      *RedisInstance
+		adapter       redisAdapter
+		expectedErr   error
+		expectedState base.InstanceState
+	}{
+		"success": {
+			ctx: t.Context(),
+			adapter: NewTestDedicatedRedisAdapter(
+				t.Context(),
+				&config.Settings{},
+				brokerDB,
+				&mockRedisClient{},
+				&mockS3Client{},
+			),
+			instance: &RedisInstance{
+				Instance: base.Instance{
+					Request: request.Request{
+						ServiceID: helpers.RandStr(10),
+					},
+					Uuid: helpers.RandStr(10),
+				},
+				ClearPassword: helpers.RandStr(10),
+			},
+			expectedState: base.InstanceInProgress,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			responseCode, err := test.adapter.createRedis(test.instance, uuid.NewString())
+			if err != nil && test.expectedErr == nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error: %s, got: %s", test.expectedErr, err)
+			}
+
+			asyncJobMsg, err := asyncmessage.GetLastAsyncJobMessage(brokerDB, test.instance.ServiceID, test.instance.Uuid, base.CreateOp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if asyncJobMsg.JobState.State != base.InstanceInProgress {
+				t.Errorf("expected async job state: %s, got: %s", base.InstanceInProgress, asyncJobMsg.JobState.State)
+			}
+
+			tx := brokerDB.Begin()
+			if err := tx.Error; err != nil {
+				t.Fatal(err)
+			}
+
+			sqlTx := tx.Statement.ConnPool.(*sql.Tx)
+			defer tx.Rollback()
+
+			job, err := testutil.RequireInsertedTx(test.ctx, t, sqlTx, &CreateArgs{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.Args.Instance.Uuid != test.instance.Uuid {
+				t.Fatal("Did not receive expected instance as create worker argument")
+			}
+			if job.Args.Instance.ClearPassword != "" {
+				t.Error("expected clear password not to be serialized with the job arguments")
+			}
+
+			if responseCode != test.expectedState {
+				t.Errorf("expected response: %s, got: %s", test.expectedState, responseCode)
+			}
+		})
+	}
+}
+
 func TestModifyRedis(t *testing.T) {
 	brokerDB, err := testDBInit()
 	if err != nil {
@@ -167,7 +249,7 @@ func TestModifyRedis(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			responseCode, err := test.adapter.modifyRedis(test.instance)
+			responseCode, err := test.adapter.modifyRedis(test.instance, uuid.NewString())
 			if err != nil && test.expectedErr == nil {
 				t.Errorf("unexpected error: %s", err)
 			}
@@ -245,7 +327,7 @@ func TestDeleteRedis(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			responseCode, err := test.adapter.deleteRedis(test.instance)
+			responseCode, err := test.adapter.deleteRedis(test.instance, uuid.NewString())
 
 			if err != nil && test.expectedErr == nil {
 				t.Errorf("unexpected error: %s", err)
@@ -23,7 +23,7 @@ type RedisInstance struct {
 	Password string `sql:"size(255)" deep:"-"`
 	Salt     string `sql:"size(255)" deep:"-"`
 
-	ClearPassword string `gorm:"-" deep:"-"`
+	ClearPassword string `gorm:"-" json:"-" deep:"-"`
 
 	Engine                     string `sql:"size(255)"`
 	EngineVersion              string `sql:"size(255)"`
@@ -49,14 +49,23 @@ type RedisInstance struct {
 	NewReplicaCount int `gorm:"-"`
 }
 
-func (i *RedisInstance) setPassword(password, key string) error {
+// getParameters returns the effective values of the instance parameters,
+// keyed the same way as RedisOptions where possible.
+func (i *RedisInstance) getParameters() map[string]any {
+	return map[string]any{
+		"engine":          i.Engine,
+		"engine_version":  i.EngineVersion,
+		"node_type":       i.CacheNodeType,
+		"num_cache_nodes": i.NumCacheClusters,
+	}
+}
+
+func (i *RedisInstance) setPassword(password string, keys *helpers.Keyring) error {
 	if i.Salt == "" {
 		return errors.New("salt has to be set before writing the password")
 	}
 
-	iv, _ := base64.StdEncoding.DecodeString(i.Salt)
-
-	encrypted, err := helpers.Encrypt(password, key, iv)
+	encrypted, err := keys.Encrypt(password)
 	if err != nil {
 		return err
 	}
@@ -67,14 +76,14 @@ func (i *RedisInstance) setPassword(password, key string) error {
 	return nil
 }
 
-func (i *RedisInstance) getPassword(key string) (string, error) {
+func (i *RedisInstance) getPassword(keys *helpers.Keyring) (string, error) {
 	if i.Salt == "" || i.Password == "" {
 		return "", errors.New("salt and password has to be set before writing the password")
 	}
 
 	iv, _ := base64.StdEncoding.DecodeString(i.Salt)
 
-	decrypted, err := helpers.Decrypt(i.Password, key, iv)
+	decrypted, err := keys.Decrypt(i.Password, iv)
 	if err != nil {
 		return "", err
 	}
@@ -123,7 +132,7 @@ func (i *RedisInstance) init(
 	i.ClusterID = s.DbShorthandPrefix + "-" + uuid
 	i.Salt = helpers.GenerateSalt(aes.BlockSize)
 	password := helpers.RandStr(25)
-	if err := i.setPassword(password, s.EncryptionKey); err != nil {
+	if err := i.setPassword(password, s.Keyring()); err != nil {
 		return err
 	}
 